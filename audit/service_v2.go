@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/crawlab-team/go-trace"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fields not compared in diff
+var ignoredDiffFields = []string{
+	"_id",
+	"updated_ts",
+	"updated_by",
+}
+
+// fields of which values are masked in diff
+var sensitiveDiffFields = []string{
+	"password",
+	"private_key",
+	"token",
+	"token_hash",
+	"secret",
+	"recovery_codes",
+	"refresh_token_hash",
+	"prev_refresh_token_hash",
+	"value", // encrypted values of secrets
+}
+
+// ServiceV2 records audit logs (AuditLogV2) of mutating API calls and
+// system actions, and removes audit logs older than the retention days in
+// the "audit" setting.
+type ServiceV2 struct {
+	// settings
+	cleanupInterval time.Duration
+}
+
+func (svc *ServiceV2) Start() {
+	for {
+		svc.cleanup()
+		time.Sleep(svc.cleanupInterval)
+	}
+}
+
+// Record inserts an audit log
+func (svc *ServiceV2) Record(l *models.AuditLogV2) {
+	l.SetCreated(l.ActorId)
+	l.SetUpdated(l.ActorId)
+	if _, err := service.NewModelServiceV2[models.AuditLogV2]().InsertOne(*l); err != nil {
+		log.Errorf("[AuditServiceV2] failed to record audit log: %v", err)
+		trace.PrintError(err)
+	}
+}
+
+// RecordSystem inserts an audit log of a system action
+func (svc *ServiceV2) RecordSystem(action, resource string, resourceId primitive.ObjectID, message string) {
+	svc.Record(&models.AuditLogV2{
+		ActorType:  constants.AuditActorTypeSystem,
+		ActorName:  constants.AuditActorTypeSystem,
+		Action:     action,
+		Resource:   resource,
+		ResourceId: resourceId,
+		Message:    message,
+	})
+}
+
+// GetRetentionDays returns days to keep audit logs, from "retention_days"
+// in the "audit" setting
+func (svc *ServiceV2) GetRetentionDays() (days int) {
+	s, err := service.NewModelServiceV2[models.SettingV2]().GetOne(bson.M{"key": constants.AuditSettingKey}, nil)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			trace.PrintError(err)
+		}
+		return constants.AuditDefaultRetentionDays
+	}
+	switch v := s.Value["retention_days"].(type) {
+	case int32:
+		days = int(v)
+	case int64:
+		days = int(v)
+	case float64:
+		days = int(v)
+	}
+	if days <= 0 {
+		return constants.AuditDefaultRetentionDays
+	}
+	return days
+}
+
+func (svc *ServiceV2) cleanup() {
+	days := svc.GetRetentionDays()
+	query := bson.M{
+		"created_ts": bson.M{
+			"$lt": time.Now().Add(-time.Duration(days) * 24 * time.Hour),
+		},
+	}
+	modelSvc := service.NewModelServiceV2[models.AuditLogV2]()
+	count, err := modelSvc.Count(query)
+	if err != nil {
+		trace.PrintError(err)
+		return
+	}
+	if count == 0 {
+		return
+	}
+	if err := modelSvc.DeleteMany(query); err != nil {
+		trace.PrintError(err)
+		return
+	}
+	svc.RecordSystem(
+		constants.AuditActionCleanup,
+		"audit-logs",
+		primitive.NilObjectID,
+		fmt.Sprintf("removed %d audit logs older than %d days", count, days),
+	)
+}
+
+// GetDiff returns changed fields between before and after of a document,
+// with values of sensitive fields masked
+func GetDiff(before, after bson.M) (diff []entity.AuditLogDiff) {
+	keys := map[string]bool{}
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	for k := range keys {
+		if utils.Contains(ignoredDiffFields, k) {
+			continue
+		}
+		b, a := before[k], after[k]
+		if reflect.DeepEqual(b, a) {
+			continue
+		}
+		if isSensitiveField(k) {
+			if b != nil {
+				b = constants.AuditMaskedValue
+			}
+			if a != nil {
+				a = constants.AuditMaskedValue
+			}
+		}
+		diff = append(diff, entity.AuditLogDiff{
+			Field:  k,
+			Before: b,
+			After:  a,
+		})
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		return diff[i].Field < diff[j].Field
+	})
+	return diff
+}
+
+func isSensitiveField(field string) bool {
+	field = strings.ToLower(field)
+	for _, f := range sensitiveDiffFields {
+		if field == f || strings.HasSuffix(field, "_"+f) {
+			return true
+		}
+	}
+	return false
+}
+
+func NewAuditServiceV2() (svc *ServiceV2) {
+	return &ServiceV2{
+		cleanupInterval: time.Hour,
+	}
+}
+
+var auditSvcV2 *ServiceV2
+
+func GetAuditServiceV2() (svc *ServiceV2) {
+	if auditSvcV2 != nil {
+		return auditSvcV2
+	}
+	auditSvcV2 = NewAuditServiceV2()
+	return auditSvcV2
+}
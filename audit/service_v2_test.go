@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestGetDiff(t *testing.T) {
+	before := bson.M{
+		"_id":        "1",
+		"name":       "spider",
+		"cmd":        "python main.py",
+		"password":   "old",
+		"updated_ts": 1,
+	}
+	after := bson.M{
+		"_id":        "1",
+		"name":       "spider",
+		"cmd":        "scrapy crawl quotes",
+		"password":   "new",
+		"updated_ts": 2,
+		"priority":   5,
+	}
+	require.Equal(t, []entity.AuditLogDiff{
+		{Field: "cmd", Before: "python main.py", After: "scrapy crawl quotes"},
+		{Field: "password", Before: constants.AuditMaskedValue, After: constants.AuditMaskedValue},
+		{Field: "priority", Before: nil, After: 5},
+	}, GetDiff(before, after))
+
+	// deleted
+	diff := GetDiff(bson.M{"name": "spider"}, nil)
+	require.Equal(t, []entity.AuditLogDiff{{Field: "name", Before: "spider", After: nil}}, diff)
+
+	// secret
+	diff = GetDiff(bson.M{"key": "API_KEY", "value": "old"}, bson.M{"key": "API_KEY", "value": "new"})
+	require.Equal(t, []entity.AuditLogDiff{{Field: "value", Before: constants.AuditMaskedValue, After: constants.AuditMaskedValue}}, diff)
+
+	// unchanged
+	require.Nil(t, GetDiff(before, before))
+}
@@ -4,6 +4,17 @@ import "strings"
 
 const Version = "v0.6.3"
 
+// ProtocolVersion is the version of the protocol between masters and
+// workers, which is increased on incompatible changes
+const ProtocolVersion = 2
+
+// Commit and BuildTime are set at build time, e.g.
+// -ldflags "-X github.com/crawlab-team/crawlab-core/config.Commit=abc1234"
+var (
+	Commit    string
+	BuildTime string
+)
+
 func GetVersion() (v string) {
 	if strings.HasPrefix(Version, "v") {
 		return Version
@@ -0,0 +1,24 @@
+package constants
+
+const (
+	AuditActorTypeUser      = "user"
+	AuditActorTypeToken     = "token"
+	AuditActorTypeAnonymous = "anonymous"
+	AuditActorTypeSystem    = "system"
+)
+
+const (
+	AuditActionScheduleFire = "schedule_fire"
+	AuditActionNodeOffline  = "node_offline"
+	AuditActionNodeDrained  = "node_drained"
+	AuditActionNodeLost     = "node_lost"
+	AuditActionLeaderChange = "leader_change"
+	AuditActionTaskRequeue  = "task_requeue"
+	AuditActionCleanup      = "cleanup"
+)
+
+const (
+	AuditSettingKey           = "audit"
+	AuditDefaultRetentionDays = 90
+	AuditMaskedValue          = "******"
+)
@@ -0,0 +1,24 @@
+package constants
+
+const (
+	DependencyLangPython = "python"
+	DependencyLangNode   = "node"
+	DependencyLangGo     = "go"
+)
+
+const (
+	DependencyManifestPython = "requirements.txt"
+	DependencyManifestNode   = "package.json"
+	DependencyManifestGo     = "go.mod"
+)
+
+const (
+	DependencyEnvDirName         = ".envs"
+	DependencyEnvInstalledMarker = ".crawlab_installed"
+)
+
+const (
+	DependencyActionInstall   = "install"
+	DependencyActionUpgrade   = "upgrade"
+	DependencyActionUninstall = "uninstall"
+)
@@ -0,0 +1,12 @@
+package constants
+
+// sources of task environment variables, in the order of precedence from
+// lowest to highest
+const (
+	EnvSourceGlobal   = "global"
+	EnvSourceProject  = "project"
+	EnvSourceSpider   = "spider"
+	EnvSourceSchedule = "schedule"
+	EnvSourceRun      = "run"
+	EnvSourceSecret   = "secret"
+)
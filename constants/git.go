@@ -5,6 +5,11 @@ const (
 	GitAuthTypeSsh  = "ssh"
 )
 
+const (
+	GitSshKeyTypeEd25519 = "ed25519"
+	GitSshKeyTypeRsa     = "rsa"
+)
+
 const (
 	GitRemoteNameUpstream = "upstream"
 	GitRemoteNameOrigin   = "origin"
@@ -14,3 +19,30 @@ const (
 	GitBranchMaster = "master"
 	GitBranchMain   = "main"
 )
+
+const (
+	GitWebhookProviderGithub  = "github"
+	GitWebhookProviderGitlab  = "gitlab"
+	GitWebhookProviderGitea   = "gitea"
+	GitWebhookProviderGeneric = "generic"
+)
+
+const (
+	GitWebhookStatusProcessing = "processing"
+	GitWebhookStatusSuccess    = "success"
+	GitWebhookStatusIgnored    = "ignored"
+	GitWebhookStatusError      = "error"
+)
+
+const (
+	GitWebhookHeaderGithubEvent      = "X-GitHub-Event"
+	GitWebhookHeaderGithubDelivery   = "X-GitHub-Delivery"
+	GitWebhookHeaderGithubSignature  = "X-Hub-Signature-256"
+	GitWebhookHeaderGitlabEvent      = "X-Gitlab-Event"
+	GitWebhookHeaderGitlabToken      = "X-Gitlab-Token"
+	GitWebhookHeaderGitlabDelivery   = "X-Gitlab-Event-UUID"
+	GitWebhookHeaderGiteaEvent       = "X-Gitea-Event"
+	GitWebhookHeaderGiteaDelivery    = "X-Gitea-Delivery"
+	GitWebhookHeaderGiteaSignature   = "X-Gitea-Signature"
+	GitWebhookHeaderGenericSignature = "X-Crawlab-Signature"
+)
@@ -9,7 +9,9 @@ const (
 )
 
 const (
-	GrpcHeaderAuthorization = "authorization"
+	GrpcHeaderAuthorization  = "authorization"
+	GrpcHeaderNodeKey        = "node-key"
+	GrpcHeaderNodeCredential = "node-credential"
 )
 
 const (
@@ -5,4 +5,20 @@ const (
 	NodeStatusRegistered   = "r"
 	NodeStatusOnline       = "on"
 	NodeStatusOffline      = "off"
+
+	NodeStatusPendingApproval = "pending-approval"
+)
+
+const (
+	JoinTokenPrefix      = "crawlab_join_"
+	NodeCredentialPrefix = "crawlab_node_"
+)
+
+const (
+	NodeVersionSkewNone     = ""
+	NodeVersionSkewPatch    = "patch"
+	NodeVersionSkewMinor    = "minor"
+	NodeVersionSkewMajor    = "major"
+	NodeVersionSkewProtocol = "protocol"
+	NodeVersionSkewUnknown  = "unknown"
 )
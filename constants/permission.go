@@ -0,0 +1,13 @@
+package constants
+
+const (
+	PermissionActionView   = "view"
+	PermissionActionCreate = "create"
+	PermissionActionEdit   = "edit"
+	PermissionActionDelete = "delete"
+	PermissionActionRun    = "run"
+)
+
+const (
+	PermissionAll = "*"
+)
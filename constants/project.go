@@ -0,0 +1,7 @@
+package constants
+
+const (
+	ProjectMemberRoleOwner     = "owner"
+	ProjectMemberRoleDeveloper = "developer"
+	ProjectMemberRoleViewer    = "viewer"
+)
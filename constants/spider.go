@@ -0,0 +1,10 @@
+package constants
+
+const (
+	SpiderParamTypeString  = "string"
+	SpiderParamTypeInteger = "integer"
+	SpiderParamTypeNumber  = "number"
+	SpiderParamTypeBoolean = "boolean"
+)
+
+const SpiderParamEnvPrefix = "CRAWLAB_PARAM_"
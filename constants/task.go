@@ -1,18 +1,21 @@
 package constants
 
 const (
-	TaskStatusPending   = "pending"
-	TaskStatusRunning   = "running"
-	TaskStatusFinished  = "finished"
-	TaskStatusError     = "error"
-	TaskStatusCancelled = "cancelled"
-	TaskStatusAbnormal  = "abnormal"
+	TaskStatusPending       = "pending"
+	TaskStatusRunning       = "running"
+	TaskStatusFinished      = "finished"
+	TaskStatusError         = "error"
+	TaskStatusCancelled     = "cancelled"
+	TaskStatusAbnormal      = "abnormal"
+	TaskStatusLost          = "lost"          // running on a lost node
+	TaskStatusUnschedulable = "unschedulable" // pinned to a lost node
 )
 
 const (
 	RunTypeAllNodes      = "all-nodes"
 	RunTypeRandom        = "random"
 	RunTypeSelectedNodes = "selected-nodes"
+	RunTypeMatchedNodes  = "matched-nodes" // all nodes matching the node selector
 )
 
 const (
@@ -13,3 +13,33 @@ const (
 const (
 	UserContextKey = "user"
 )
+
+const (
+	TokenContextKey = "token"
+)
+
+const (
+	PermissionFilterContextKey = "permission_filter"
+)
+
+const (
+	ApiTokenPrefix = "crawlab_"
+)
+
+const (
+	TokenScopeRead  = "read"
+	TokenScopeWrite = "write"
+	TokenScopeRun   = "run"
+)
+
+const (
+	AuthSourceLocal = "local"
+	AuthSourceOidc  = "oidc"
+	AuthSourceLdap  = "ldap"
+)
+
+const (
+	TotpDefaultIssuer     = "Crawlab"
+	TotpChallengePurpose  = "totp"
+	TotpRecoveryCodeCount = 10
+)
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-db/mongo"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongo2 "go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+func GetAuditLogList(c *gin.Context) {
+	// params
+	pagination := MustGetPagination(c)
+	sort := MustGetSortOption(c)
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "_id", Value: -1}}
+	}
+
+	// query
+	query, err := getAuditLogQuery(c)
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	modelSvc := service.NewModelServiceV2[models.AuditLogV2]()
+	list, err := modelSvc.GetMany(query, &mongo.FindOptions{
+		Sort:  sort,
+		Skip:  pagination.Size * (pagination.Page - 1),
+		Limit: pagination.Size,
+	})
+	if err != nil {
+		if errors.Is(err, mongo2.ErrNoDocuments) {
+			HandleSuccessWithListData(c, nil, 0)
+		} else {
+			HandleErrorInternalServerError(c, err)
+		}
+		return
+	}
+	total, err := modelSvc.Count(query)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithListData(c, list, total)
+}
+
+func GetAuditLogById(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	l, err := service.NewModelServiceV2[models.AuditLogV2]().GetById(id)
+	if err != nil {
+		if errors.Is(err, mongo2.ErrNoDocuments) {
+			HandleErrorNotFound(c, err)
+			return
+		}
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	HandleSuccessWithData(c, l)
+}
+
+// getAuditLogQuery returns query of audit logs from filter conditions and
+// query params "actor_id", "actor_type", "resource", "resource_id",
+// "action", "start" and "end" (RFC3339 time)
+func getAuditLogQuery(c *gin.Context) (query bson.M, err error) {
+	query = MustGetFilterQuery(c)
+	if query == nil {
+		query = bson.M{}
+	}
+	for _, key := range []string{"actor_id", "resource_id"} {
+		if v := c.Query(key); v != "" {
+			id, err := primitive.ObjectIDFromHex(v)
+			if err != nil {
+				return nil, err
+			}
+			query[key] = id
+		}
+	}
+	for _, key := range []string{"actor_type", "resource", "action"} {
+		if v := c.Query(key); v != "" {
+			query[key] = v
+		}
+	}
+	ts := bson.M{}
+	if v := c.Query("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, err
+		}
+		ts["$gte"] = t
+	}
+	if v := c.Query("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, err
+		}
+		ts["$lte"] = t
+	}
+	if len(ts) > 0 {
+		query["created_ts"] = ts
+	}
+	return query, nil
+}
@@ -2,8 +2,11 @@ package controllers
 
 import (
 	"errors"
+	"github.com/crawlab-team/crawlab-core/constants"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
 	"github.com/crawlab-team/crawlab-core/interfaces"
 	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/project"
 	"github.com/crawlab-team/crawlab-db/mongo"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -12,8 +15,9 @@ import (
 )
 
 type BaseControllerV2[T any] struct {
-	modelSvc *service.ModelServiceV2[T]
-	actions  []Action
+	modelSvc     *service.ModelServiceV2[T]
+	actions      []Action
+	projectField string
 }
 
 func (ctr *BaseControllerV2[T]) GetById(c *gin.Context) {
@@ -50,6 +54,9 @@ func (ctr *BaseControllerV2[T]) Post(c *gin.Context) {
 		HandleErrorBadRequest(c, err)
 		return
 	}
+	if !ctr.canWriteProject(c, &model) {
+		return
+	}
 	u := GetUserFromContextV2(c)
 	m := any(&model).(interfaces.ModelV2)
 	m.SetId(primitive.NewObjectID())
@@ -84,6 +91,9 @@ func (ctr *BaseControllerV2[T]) PutById(c *gin.Context) {
 		return
 	}
 
+	if !ctr.canWriteProject(c, &model) {
+		return
+	}
 	u := GetUserFromContextV2(c)
 	m := any(&model).(interfaces.ModelV2)
 	m.SetId(primitive.NewObjectID())
@@ -116,10 +126,22 @@ func (ctr *BaseControllerV2[T]) PatchList(c *gin.Context) {
 	}
 
 	// query
-	query := bson.M{
+	query, err := ctr.getProjectFilterQuery(c, bson.M{
 		"_id": bson.M{
 			"$in": payload.Ids,
 		},
+	}, true)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// only admin can move resources to another project in batch
+	if _, ok := payload.Update[ctr.projectField]; ok && ctr.projectField != "_id" {
+		if u := GetUserFromContextV2(c); u != nil && u.Role != constants.RoleAdmin {
+			HandleErrorForbidden(c, errors2.ErrorProjectForbidden)
+			return
+		}
 	}
 
 	// update
@@ -157,11 +179,17 @@ func (ctr *BaseControllerV2[T]) DeleteList(c *gin.Context) {
 		return
 	}
 
-	if err := ctr.modelSvc.DeleteMany(bson.M{
+	query, err := ctr.getProjectFilterQuery(c, bson.M{
 		"_id": bson.M{
 			"$in": payload.Ids,
 		},
-	}); err != nil {
+	}, true)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	if err := ctr.modelSvc.DeleteMany(query); err != nil {
 		HandleErrorInternalServerError(c, err)
 		return
 	}
@@ -170,14 +198,19 @@ func (ctr *BaseControllerV2[T]) DeleteList(c *gin.Context) {
 }
 
 func (ctr *BaseControllerV2[T]) getAll(c *gin.Context) {
-	models, err := ctr.modelSvc.GetMany(nil, &mongo.FindOptions{
+	query, err := ctr.getProjectFilterQuery(c, nil, false)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	models, err := ctr.modelSvc.GetMany(query, &mongo.FindOptions{
 		Sort: bson.D{{"_id", -1}},
 	})
 	if err != nil {
 		HandleErrorInternalServerError(c, err)
 		return
 	}
-	total, err := ctr.modelSvc.Count(nil)
+	total, err := ctr.modelSvc.Count(query)
 	if err != nil {
 		HandleErrorInternalServerError(c, err)
 		return
@@ -191,6 +224,13 @@ func (ctr *BaseControllerV2[T]) getList(c *gin.Context) {
 	query := MustGetFilterQuery(c)
 	sort := MustGetSortOption(c)
 
+	// restrict to projects of user
+	query, err := ctr.getProjectFilterQuery(c, query, false)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
 	// get list
 	models, err := ctr.modelSvc.GetMany(query, &mongo.FindOptions{
 		Sort:  sort,
@@ -217,10 +257,39 @@ func (ctr *BaseControllerV2[T]) getList(c *gin.Context) {
 	HandleSuccessWithListData(c, models, total)
 }
 
+// getProjectFilterQuery restricts query to projects of the current user
+// (or projects the user can write to if write is true) if the model is
+// scoped to projects, and to resources allowed by permissions
+func (ctr *BaseControllerV2[T]) getProjectFilterQuery(c *gin.Context, query bson.M, write bool) (q bson.M, err error) {
+	if ctr.projectField == "" {
+		return GetPermissionFilterQuery(c, query), nil
+	}
+	return GetProjectFilterQuery(c, ctr.projectField, query, write)
+}
+
+// canWriteProject checks if the current user can write to the project the
+// model belongs to, and responds with error if not
+func (ctr *BaseControllerV2[T]) canWriteProject(c *gin.Context, model *T) (ok bool) {
+	if ctr.projectField == "" || ctr.projectField == "_id" {
+		return true
+	}
+	return checkProjectWrite(c, model)
+}
+
+// getAuditDoc returns the raw document of a model to record its changes in
+// audit logs
+func (ctr *BaseControllerV2[T]) getAuditDoc(id primitive.ObjectID) (doc bson.M, err error) {
+	if err := ctr.modelSvc.GetCol().FindId(id).One(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
 func NewControllerV2[T any](actions ...Action) *BaseControllerV2[T] {
 	ctr := &BaseControllerV2[T]{
-		modelSvc: service.NewModelServiceV2[T](),
-		actions:  actions,
+		modelSvc:     service.NewModelServiceV2[T](),
+		actions:      actions,
+		projectField: project.GetProjectField[T](),
 	}
 	return ctr
 }
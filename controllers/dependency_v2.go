@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"github.com/crawlab-team/crawlab-core/dependency"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/task/log"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+)
+
+type dependencyPayload struct {
+	Lang         string               `json:"lang"`
+	Dependencies []entity.Dependency  `json:"dependencies"`
+	NodeIds      []primitive.ObjectID `json:"node_ids"`
+	Upgrade      bool                 `json:"upgrade"`
+}
+
+func GetDependencyList(c *gin.Context) {
+	svc, err := dependency.GetDependencyServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	items, err := svc.GetList(c.Query("lang"))
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	HandleSuccessWithListData(c, items, len(items))
+}
+
+func PostDependencyInstall(c *gin.Context) {
+	var payload dependencyPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	svc, err := dependency.GetDependencyServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	u := GetUserFromContextV2(c)
+	tasks, err := svc.Install(payload.Lang, payload.Dependencies, payload.NodeIds, payload.Upgrade, u.Id)
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	HandleSuccessWithData(c, tasks)
+}
+
+func PostDependencyUninstall(c *gin.Context) {
+	var payload dependencyPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	svc, err := dependency.GetDependencyServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	u := GetUserFromContextV2(c)
+	tasks, err := svc.Uninstall(payload.Lang, payload.Dependencies, payload.NodeIds, u.Id)
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	HandleSuccessWithData(c, tasks)
+}
+
+func GetDependencyTaskLogs(c *gin.Context) {
+	// id
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// pagination
+	p, err := GetPagination(c)
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// logs
+	logDriver, err := log.GetFileLogDriver()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	logs, err := logDriver.Find(id.Hex(), "", (p.Page-1)*p.Size, p.Size)
+	if err != nil {
+		if strings.HasSuffix(err.Error(), "Status:404 Not Found") {
+			HandleSuccess(c)
+			return
+		}
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	total, err := logDriver.Count(id.Hex(), "")
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithListData(c, logs, total)
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/environment"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/secret"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func PostEnvironment(c *gin.Context) {
+	var e models.EnvironmentV2
+	if err := c.ShouldBindJSON(&e); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	if err := environment.Validate(&e); err != nil {
+		handleEnvironmentError(c, err)
+		return
+	}
+	if !checkProjectWrite(c, &e) {
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	e.SetCreated(u.Id)
+	e.SetUpdated(u.Id)
+	id, err := service.NewModelServiceV2[models.EnvironmentV2]().InsertOne(e)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	e.SetId(id)
+
+	HandleSuccessWithData(c, e)
+}
+
+func PutEnvironmentById(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var e models.EnvironmentV2
+	if err := c.ShouldBindJSON(&e); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	modelSvc := service.NewModelServiceV2[models.EnvironmentV2]()
+	prev, err := modelSvc.GetById(id)
+	if err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+	if !checkProjectWrite(c, prev) {
+		return
+	}
+	if err := environment.Validate(&e); err != nil {
+		handleEnvironmentError(c, err)
+		return
+	}
+	if !checkProjectWrite(c, &e) {
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	e.SetId(id)
+	e.CreatedAt = prev.CreatedAt
+	e.CreatedBy = prev.CreatedBy
+	e.SetUpdated(u.Id)
+	if err := modelSvc.ReplaceById(id, e); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, e)
+}
+
+// GetTaskEnv returns resolved environment variables of a task for
+// debugging, of which values of secrets are masked. Variables of the process
+// environment on the node are not resolved.
+func GetTaskEnv(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	t, err := service.NewModelServiceV2[models.TaskV2]().GetById(id)
+	if err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+	s, err := service.NewModelServiceV2[models.SpiderV2]().GetById(t.SpiderId)
+	if err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+	secrets, err := secret.GetSecretServiceV2().GetTaskSecrets(s)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	src, err := environment.GetTaskSources(t, s, secrets)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	vars, err := environment.Resolve(src, nil)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	masker := secret.NewMasker(environment.GetSecretValues(vars))
+	for i := range vars {
+		switch {
+		case vars[i].Source == constants.EnvSourceSecret:
+			vars[i].Value = secret.MaskedValue
+		case vars[i].Secret:
+			vars[i].Value = masker.Mask(vars[i].Value)
+		}
+	}
+	HandleSuccessWithData(c, vars)
+}
+
+func handleEnvironmentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errors2.ErrorEnvironmentInvalidKey),
+		errors.Is(err, errors2.ErrorEnvironmentInvalidScope):
+		HandleErrorBadRequest(c, err)
+	default:
+		HandleErrorInternalServerError(c, err)
+	}
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/crawlab-team/crawlab-core/constants"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongo2 "go.mongodb.org/mongo-driver/mongo"
+	"strings"
+)
+
+type gitCredentialPayload struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	PrivateKey  string `json:"private_key"`
+	Generate    bool   `json:"generate"`
+	KeyType     string `json:"key_type"`
+	KnownHosts  string `json:"known_hosts"`
+}
+
+func PostGitCredential(c *gin.Context) {
+	var payload gitCredentialPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	cred := models.GitCredentialV2{
+		Name:        payload.Name,
+		Description: payload.Description,
+		Type:        payload.Type,
+		Username:    payload.Username,
+		KnownHosts:  payload.KnownHosts,
+	}
+	if err := setGitCredentialSecrets(&cred, &payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	cred.SetCreated(u.Id)
+	cred.SetUpdated(u.Id)
+	id, err := service.NewModelServiceV2[models.GitCredentialV2]().InsertOne(cred)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	cred.SetId(id)
+
+	HandleSuccessWithData(c, cred)
+}
+
+func PutGitCredentialById(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var payload gitCredentialPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	modelSvc := service.NewModelServiceV2[models.GitCredentialV2]()
+	cred, err := modelSvc.GetById(id)
+	if err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+
+	// secrets are kept unless new ones are provided
+	cred.Name = payload.Name
+	cred.Description = payload.Description
+	cred.Username = payload.Username
+	cred.KnownHosts = payload.KnownHosts
+	if payload.Type != cred.Type || payload.Password != "" || payload.PrivateKey != "" || payload.Generate {
+		cred.Type = payload.Type
+		if err := setGitCredentialSecrets(cred, &payload); err != nil {
+			HandleErrorBadRequest(c, err)
+			return
+		}
+	}
+
+	u := GetUserFromContextV2(c)
+	cred.SetUpdated(u.Id)
+	if err := modelSvc.ReplaceById(id, *cred); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, cred)
+}
+
+func DeleteGitCredentialById(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	if err := checkGitCredentialsNotInUse([]primitive.ObjectID{id}); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	if err := service.NewModelServiceV2[models.GitCredentialV2]().DeleteById(id); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccess(c)
+}
+
+func DeleteGitCredentialList(c *gin.Context) {
+	var payload struct {
+		Ids []primitive.ObjectID `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	if err := checkGitCredentialsNotInUse(payload.Ids); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	if err := service.NewModelServiceV2[models.GitCredentialV2]().DeleteMany(bson.M{
+		"_id": bson.M{
+			"$in": payload.Ids,
+		},
+	}); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccess(c)
+}
+
+// PostGitCredentialKnownHosts scans the host key of a ssh git server and
+// pins it to the credential.
+func PostGitCredentialKnownHosts(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var payload struct {
+		Url string `json:"url"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	address := utils.GetSshAddressFromGitUrl(payload.Url)
+	if address == "" {
+		HandleErrorBadRequest(c, errors.New("not a ssh git url"))
+		return
+	}
+
+	modelSvc := service.NewModelServiceV2[models.GitCredentialV2]()
+	cred, err := modelSvc.GetById(id)
+	if err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+
+	line, err := utils.ScanSshHostKey(address)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	if !strings.Contains(cred.KnownHosts, line) {
+		if cred.KnownHosts != "" && !strings.HasSuffix(cred.KnownHosts, "\n") {
+			cred.KnownHosts += "\n"
+		}
+		cred.KnownHosts += line + "\n"
+	}
+
+	u := GetUserFromContextV2(c)
+	cred.SetUpdated(u.Id)
+	if err := modelSvc.ReplaceById(id, *cred); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, cred)
+}
+
+// PostGitDeployKey generates a ssh key pair only usable by the given git,
+// links it to the git and returns the public key to be added to the remote
+// repository. Previous deploy keys of the git are removed.
+func PostGitDeployKey(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var payload struct {
+		KeyType string `json:"key_type"`
+	}
+	_ = c.ShouldBindJSON(&payload)
+
+	// git
+	gitSvc := service.NewModelServiceV2[models.GitV2]()
+	g, err := gitSvc.GetById(id)
+	if err != nil {
+		if errors.Is(err, mongo2.ErrNoDocuments) {
+			HandleErrorNotFound(c, err)
+			return
+		}
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// credential
+	cred := models.GitCredentialV2{
+		Name:  "deploy-key-" + g.Id.Hex(),
+		Type:  constants.GitAuthTypeSsh,
+		GitId: g.Id,
+	}
+	if err := setGitCredentialSecrets(&cred, &gitCredentialPayload{
+		Type:     constants.GitAuthTypeSsh,
+		Generate: true,
+		KeyType:  payload.KeyType,
+	}); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// replace previous deploy keys
+	credSvc := service.NewModelServiceV2[models.GitCredentialV2]()
+	if err := credSvc.DeleteMany(bson.M{"git_id": g.Id}); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	u := GetUserFromContextV2(c)
+	cred.SetCreated(u.Id)
+	cred.SetUpdated(u.Id)
+	credId, err := credSvc.InsertOne(cred)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	cred.SetId(credId)
+
+	// link to git
+	if err := gitSvc.UpdateById(g.Id, bson.M{
+		"$set": bson.M{
+			"credential_id": credId,
+			"auth_type":     constants.GitAuthTypeSsh,
+		},
+	}); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, cred)
+}
+
+func setGitCredentialSecrets(cred *models.GitCredentialV2, payload *gitCredentialPayload) (err error) {
+	switch payload.Type {
+	case constants.GitAuthTypeHttp:
+		cred.Password, err = utils.EncryptAES(payload.Password)
+		if err != nil {
+			return err
+		}
+		cred.PrivateKey = ""
+		cred.PublicKey = ""
+		cred.Fingerprint = ""
+	case constants.GitAuthTypeSsh:
+		privateKey := payload.PrivateKey
+		if payload.Generate {
+			privateKey, _, err = utils.GenerateSshKeyPair(payload.KeyType, "crawlab")
+			if err != nil {
+				return err
+			}
+		}
+		cred.PublicKey, cred.Fingerprint, err = utils.GetSshPublicKey(privateKey)
+		if err != nil {
+			return err
+		}
+		cred.PrivateKey, err = utils.EncryptAES(privateKey)
+		if err != nil {
+			return err
+		}
+		cred.Password = ""
+	default:
+		return errors2.ErrorGitInvalidAuthType
+	}
+	return nil
+}
+
+func checkGitCredentialsNotInUse(ids []primitive.ObjectID) (err error) {
+	count, err := service.NewModelServiceV2[models.GitV2]().Count(bson.M{
+		"credential_id": bson.M{
+			"$in": ids,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors2.ErrorGitCredentialInUse
+	}
+	return nil
+}
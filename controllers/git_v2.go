@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type gitWebhookSecretPayload struct {
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+// PutGitById replaces a git, keeping fields which are not exposed in API
+// responses, e.g. the webhook secret (see PutGitWebhookSecret)
+func PutGitById(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var g models.GitV2
+	if err := c.ShouldBindJSON(&g); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	modelSvc := service.NewModelServiceV2[models.GitV2]()
+	prev, err := modelSvc.GetById(id)
+	if err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	g.SetId(id)
+	g.CreatedAt = prev.CreatedAt
+	g.CreatedBy = prev.CreatedBy
+	g.SetUpdated(u.Id)
+	g.Password = prev.Password
+	g.WebhookSecret = prev.WebhookSecret
+	if err := modelSvc.ReplaceById(id, g); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, g)
+}
+
+// PutGitWebhookSecret sets the secret to verify webhook signatures of a git,
+// which falls back to the global secret if empty. The secret is write-only.
+func PutGitWebhookSecret(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var payload gitWebhookSecretPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	modelSvc := service.NewModelServiceV2[models.GitV2]()
+	if _, err := modelSvc.GetById(id); err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+	u := GetUserFromContextV2(c)
+	if err := modelSvc.UpdateById(id, bson.M{"$set": bson.M{
+		"webhook_secret": payload.WebhookSecret,
+		"updated_by":     u.Id,
+		"updated_ts":     time.Now(),
+	}}); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccess(c)
+}
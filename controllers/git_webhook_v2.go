@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"errors"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/spider/admin"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+)
+
+// maxGitWebhookBodySize is the maximal size of webhook deliveries, which
+// are received from anonymous callers
+const maxGitWebhookBodySize = 5 << 20
+
+func PostGitWebhook(c *gin.Context) {
+	// body
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxGitWebhookBodySize))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// event
+	evt, err := utils.ParseGitWebhookEvent(c.Request.Header, body)
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	adminSvc, err := admin.GetSpiderAdminServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// handle
+	status, err := adminSvc.HandleGitWebhook(evt, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, errors2.ErrorGitWebhookInvalidSignature) {
+			HandleErrorUnauthorized(c, err)
+			return
+		}
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, gin.H{"status": status})
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"errors"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/node/credential"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongo2 "go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+func PostJoinToken(c *gin.Context) {
+	var payload struct {
+		Name            string    `json:"name"`
+		RequireApproval bool      `json:"require_approval"`
+		ExpiresAt       time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	if !payload.ExpiresAt.IsZero() && payload.ExpiresAt.Before(time.Now()) {
+		HandleErrorBadRequest(c, errors2.ErrorNodeInvalidJoinToken)
+		return
+	}
+	u := GetUserFromContextV2(c)
+	t, err := credential.GetNodeCredentialServiceV2().CreateJoinToken(payload.Name, payload.RequireApproval, payload.ExpiresAt, u.Id)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// plain token is only returned here
+	HandleSuccessWithData(c, t)
+}
+
+// PutJoinTokenById only allows to rename a join token, as its secret and
+// expiry cannot be changed once created
+func PutJoinTokenById(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	var payload struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	u := GetUserFromContextV2(c)
+	modelSvc := service.NewModelServiceV2[models.JoinTokenV2]()
+	if err := modelSvc.UpdateById(id, bson.M{"$set": bson.M{
+		"name":       payload.Name,
+		"updated_by": u.Id,
+		"updated_ts": time.Now(),
+	}}); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	t, err := modelSvc.GetById(id)
+	if err != nil {
+		if errors.Is(err, mongo2.ErrNoDocuments) {
+			HandleErrorNotFound(c, err)
+			return
+		}
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	HandleSuccessWithData(c, t)
+}
@@ -1,10 +1,13 @@
 package controllers
 
 import (
+	errors2 "errors"
 	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
 	"github.com/crawlab-team/crawlab-core/errors"
 	"github.com/crawlab-team/crawlab-core/user"
 	"github.com/gin-gonic/gin"
+	"net/http"
 )
 
 func PostLogin(c *gin.Context) {
@@ -21,16 +24,109 @@ func PostLogin(c *gin.Context) {
 		HandleErrorInternalServerError(c, err)
 		return
 	}
-	token, loggedInUser, err := userSvc.Login(payload.Username, payload.Password)
+	res, loggedInUser, err := userSvc.Login(payload.Username, payload.Password, getLoginClient(c))
 	if err != nil {
-		HandleErrorUnauthorized(c, errors.ErrorUserUnauthorized)
+		handleLoginError(c, err)
 		return
 	}
 	c.Set(constants.UserContextKey, loggedInUser)
-	HandleSuccessWithData(c, token)
+	HandleSuccessWithData(c, res)
+}
+
+// PostLoginRefresh returns a new access token with the refresh token of a
+// session, which is rotated
+func PostLoginRefresh(c *gin.Context) {
+	var payload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	res, u, err := userSvc.RefreshSession(payload.RefreshToken, getLoginClient(c))
+	if err != nil {
+		HandleErrorUnauthorized(c, err)
+		return
+	}
+	c.Set(constants.UserContextKey, u)
+	HandleSuccessWithData(c, res)
+}
+
+// PostLoginChangePassword changes an expired password, with which the user
+// cannot log in
+func PostLoginChangePassword(c *gin.Context) {
+	var payload struct {
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	if err := userSvc.ChangeExpiredPassword(payload.Username, payload.Password, payload.NewPassword, c.ClientIP()); err != nil {
+		if isPasswordPolicyError(err) || errors2.Is(err, errors.ErrorUserPasswordUnchanged) {
+			HandleErrorBadRequest(c, err)
+			return
+		}
+		handleLoginError(c, err)
+		return
+	}
+	HandleSuccess(c)
 }
 
+// PostLogout revokes the session of the access token in the header or the
+// refresh token in the payload
 func PostLogout(c *gin.Context) {
+	var payload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	_ = c.ShouldBindJSON(&payload)
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	if err := userSvc.Logout(c.GetHeader("Authorization"), payload.RefreshToken); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
 	c.Set(constants.UserContextKey, nil)
 	HandleSuccess(c)
 }
+
+// handleLoginError responds with the reason of a failed login if it is
+// actionable by the user, without revealing whether the user exists
+func handleLoginError(c *gin.Context, err error) {
+	switch {
+	case errors2.Is(err, errors.ErrorUserLocked):
+		HandleError(http.StatusTooManyRequests, c, err)
+	case errors2.Is(err, errors.ErrorUserPasswordExpired):
+		HandleErrorUnauthorized(c, err)
+	default:
+		HandleErrorUnauthorized(c, errors.ErrorUserUnauthorized)
+	}
+}
+
+func getLoginClient(c *gin.Context) *entity.LoginClient {
+	return &entity.LoginClient{
+		Ip:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+func isPasswordPolicyError(err error) bool {
+	return errors2.Is(err, errors.ErrorUserPasswordTooShort) ||
+		errors2.Is(err, errors.ErrorUserPasswordTooWeak) ||
+		errors2.Is(err, errors.ErrorUserPasswordBreached)
+}
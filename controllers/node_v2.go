@@ -0,0 +1,349 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/grpc/server"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/node/credential"
+	"github.com/crawlab-team/crawlab-core/node/drain"
+	"github.com/crawlab-team/crawlab-core/node/pki"
+	"github.com/crawlab-team/crawlab-core/node/selector"
+	"github.com/crawlab-team/crawlab-core/node/version"
+	"github.com/crawlab-team/crawlab-db/mongo"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongo2 "go.mongodb.org/mongo-driver/mongo"
+	"path/filepath"
+	"time"
+)
+
+func PutNodeById(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var n models.NodeV2
+	if err := c.ShouldBindJSON(&n); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// validate labels
+	if err := selector.ValidateLabels(n.Labels); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	modelSvc := service.NewModelServiceV2[models.NodeV2]()
+	prev, err := modelSvc.GetById(id)
+	if err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	n.SetId(id)
+	n.CreatedAt = prev.CreatedAt
+	n.CreatedBy = prev.CreatedBy
+	n.Drain = prev.Drain // drained by PostNodeDrain and PostNodeResume only
+	n.Resources = prev.Resources
+	n.SetUpdated(u.Id)
+	if err := modelSvc.ReplaceById(id, n); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, n)
+}
+
+// PostNodeDrain stops a node from accepting new tasks. Running tasks are
+// cancelled and re-queued after timeout (in seconds) if it is positive, and
+// queued tasks pinned to the node are reassigned to any node if requested.
+func PostNodeDrain(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var payload struct {
+		Timeout  int  `json:"timeout"`
+		Reassign bool `json:"reassign"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	if payload.Timeout < 0 {
+		HandleErrorBadRequest(c, errors2.ErrorHttpBadRequest)
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	n, err := drain.GetNodeDrainServiceV2().Drain(id, time.Duration(payload.Timeout)*time.Second, payload.Reassign, u.Id)
+	if err != nil {
+		handleNodeDrainError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, n)
+}
+
+// PostNodeResume ends draining a node
+func PostNodeResume(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	n, err := drain.GetNodeDrainServiceV2().Resume(id)
+	if err != nil {
+		handleNodeDrainError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, n)
+}
+
+func handleNodeDrainError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errors2.ErrorNodeDraining),
+		errors.Is(err, errors2.ErrorNodeNotDraining):
+		HandleErrorBadRequest(c, err)
+	case errors.Is(err, mongo2.ErrNoDocuments):
+		HandleErrorNotFound(c, err)
+	default:
+		HandleErrorInternalServerError(c, err)
+	}
+}
+
+// maxNodeResourcesRange is the maximum range of resources history returned
+// at a time, as nodes report resources in every heartbeat
+const maxNodeResourcesRange = 24 * time.Hour
+
+// GetNodeResources returns resources history of a node between "from" and
+// "to" (RFC 3339), by default in the last hour, of at most
+// maxNodeResourcesRange
+func GetNodeResources(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	to := time.Now()
+	if v := c.Query("to"); v != "" {
+		to, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			HandleErrorBadRequest(c, err)
+			return
+		}
+	}
+	from := to.Add(-time.Hour)
+	if v := c.Query("from"); v != "" {
+		from, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			HandleErrorBadRequest(c, err)
+			return
+		}
+	}
+	if from.After(to) || to.Sub(from) > maxNodeResourcesRange {
+		HandleErrorBadRequest(c, errors2.ErrorNodeInvalidResourcesRange)
+		return
+	}
+
+	history, err := service.NewModelServiceV2[models.NodeResourceV2]().GetMany(bson.M{
+		"node_id":    id,
+		"created_ts": bson.M{"$gte": from, "$lte": to},
+	}, &mongo.FindOptions{
+		Sort: bson.D{{Key: "created_ts", Value: 1}},
+	})
+	if err != nil && !errors.Is(err, mongo2.ErrNoDocuments) {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, history)
+}
+
+// GetNodeCertificates returns certificates issued to a node
+func GetNodeCertificates(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	certs, err := service.NewModelServiceV2[models.NodeCertificateV2]().GetMany(bson.M{
+		"node_id": id,
+	}, &mongo.FindOptions{
+		Sort: bson.D{{Key: "not_before", Value: -1}},
+	})
+	if err != nil && !errors.Is(err, mongo2.ErrNoDocuments) {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, certs)
+}
+
+// PostNodeCertificatesRevoke revokes all certificates of a node, e.g. of a
+// compromised worker, which is then rejected by masters and has to be
+// registered again
+func PostNodeCertificatesRevoke(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	n, err := service.NewModelServiceV2[models.NodeV2]().GetById(id)
+	if err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	count, err := pki.Revoke(n.Id, u.Id)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	closeNodeStream(n)
+
+	HandleSuccessWithData(c, bson.M{"revoked": count})
+}
+
+// PostNodeApprove approves a node pending approval, which then fetches
+// tasks like other nodes
+func PostNodeApprove(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	modelSvc := service.NewModelServiceV2[models.NodeV2]()
+	n, err := modelSvc.GetById(id)
+	if err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+	if n.Status != constants.NodeStatusPendingApproval {
+		HandleErrorBadRequest(c, errors2.ErrorNodeNotPendingApproval)
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	n.Status = constants.NodeStatusRegistered
+	n.Active = true
+	n.ActiveAt = time.Now()
+	n.SetUpdated(u.Id)
+	if err := modelSvc.ReplaceById(n.Id, *n); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	credential.GetNodeCredentialServiceV2().Forget(n.Key)
+
+	HandleSuccessWithData(c, n)
+}
+
+// PostNodeCredentialRevoke revokes the credential of a node, which has to
+// join again with a new join token
+func PostNodeCredentialRevoke(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	n, err := service.NewModelServiceV2[models.NodeV2]().GetById(id)
+	if err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	count, err := credential.GetNodeCredentialServiceV2().Revoke(n.Id, u.Id)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	closeNodeStream(n)
+
+	HandleSuccessWithData(c, bson.M{"revoked": count})
+}
+
+// closeNodeStream closes the stream of a node if subscribed to this master
+func closeNodeStream(n *models.NodeV2) {
+	svr, err := server.GetGrpcServerV2()
+	if err != nil {
+		return
+	}
+	sub, err := svr.GetSubscribe("node:" + n.Key)
+	if err != nil {
+		return
+	}
+	select {
+	case sub.GetFinished() <- true:
+	default:
+	}
+}
+
+// GetNodeVersions returns versions of nodes and their skew from the version
+// of this master
+func GetNodeVersions(c *gin.Context) {
+	nodes, err := service.NewModelServiceV2[models.NodeV2]().GetMany(nil, &mongo.FindOptions{
+		Sort: bson.D{{Key: "is_master", Value: -1}, {Key: "name", Value: 1}},
+	})
+	if err != nil && !errors.Is(err, mongo2.ErrNoDocuments) {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	type nodeVersion struct {
+		Id       primitive.ObjectID  `json:"_id"`
+		Key      string              `json:"key"`
+		Name     string              `json:"name"`
+		IsMaster bool                `json:"is_master"`
+		Version  *entity.NodeVersion `json:"version"`
+		Skew     string              `json:"skew"`
+	}
+	current := version.GetCurrent()
+	data := make([]nodeVersion, 0, len(nodes))
+	for _, n := range nodes {
+		data = append(data, nodeVersion{
+			Id:       n.Id,
+			Key:      n.Key,
+			Name:     n.Name,
+			IsMaster: n.IsMaster,
+			Version:  n.Version,
+			Skew:     version.GetSkew(current, n.Version),
+		})
+	}
+	HandleSuccessWithData(c, bson.M{
+		"master": current,
+		"nodes":  data,
+	})
+}
+
+// GetWorkerUpdate serves the worker binary of the platform in "os" and
+// "arch", which workers verify by the checksum in registration responses
+func GetWorkerUpdate(c *gin.Context) {
+	path, err := version.GetUpdatePath(c.Query("os"), c.Query("arch"))
+	if err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+	c.FileAttachment(path, filepath.Base(path))
+}
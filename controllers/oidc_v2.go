@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/crawlab-team/crawlab-core/constants"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// oidcBindingCookie is the cookie binding a pending login to the browser
+// starting it
+const oidcBindingCookie = "crawlab_oidc_binding"
+
+// GetOidcLogin redirects the user to the authorization endpoint of the
+// OpenID Connect provider
+func GetOidcLogin(c *gin.Context) {
+	svc := oidc.GetOidcServiceV2()
+	u, binding, err := svc.GetLoginUrl(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, errors2.ErrorOidcNotEnabled) {
+			HandleErrorBadRequest(c, err)
+			return
+		}
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcBindingCookie, binding, int(svc.GetSessionTtl().Seconds()), "/", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, u)
+}
+
+// GetOidcCallback completes the login redirected back from the provider.
+// The tokens, or the challenge token if a second step is required, are
+// passed to the frontend in the url fragment if "oidc.frontendUrl" is set,
+// or returned in the response otherwise.
+func GetOidcCallback(c *gin.Context) {
+	binding, _ := c.Cookie(oidcBindingCookie)
+	c.SetCookie(oidcBindingCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+	if c.Query("error") != "" {
+		HandleErrorUnauthorized(c, errors2.ErrorUserUnauthorized)
+		return
+	}
+	res, u, err := oidc.GetOidcServiceV2().Callback(c.Request.Context(), c.Query("state"), c.Query("code"), binding, getLoginClient(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, errors2.ErrorOidcNotEnabled):
+			HandleErrorBadRequest(c, err)
+		case errors.Is(err, errors2.ErrorUserAuthSourceConflict):
+			HandleErrorForbidden(c, err)
+		case errors.Is(err, errors2.ErrorUserLocked):
+			handleLoginError(c, err)
+		default:
+			HandleErrorUnauthorized(c, errors2.ErrorUserUnauthorized)
+		}
+		return
+	}
+	c.Set(constants.UserContextKey, u)
+	if frontendUrl := viper.GetString("oidc.frontendUrl"); frontendUrl != "" {
+		fragment := url.Values{}
+		if res.Challenge != "" {
+			fragment.Set("challenge", res.Challenge)
+			fragment.Set("totp_required", strconv.FormatBool(res.TotpRequired))
+			fragment.Set("totp_setup_required", strconv.FormatBool(res.TotpSetupRequired))
+		} else {
+			fragment.Set("token", res.Token)
+			fragment.Set("refresh_token", res.RefreshToken)
+		}
+		c.Redirect(http.StatusFound, frontendUrl+"#"+fragment.Encode())
+		return
+	}
+	HandleSuccessWithData(c, res)
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/project"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var projectMemberRoles = []string{
+	constants.ProjectMemberRoleOwner,
+	constants.ProjectMemberRoleDeveloper,
+	constants.ProjectMemberRoleViewer,
+}
+
+func PostProject(c *gin.Context) {
+	var p models.ProjectV2
+	if err := c.ShouldBindJSON(&p); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+
+	// add project
+	p.SetCreated(u.Id)
+	p.SetUpdated(u.Id)
+	id, err := service.NewModelServiceV2[models.ProjectV2]().InsertOne(p)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	p.SetId(id)
+
+	// creator is owner of the project
+	m := models.ProjectMemberV2{
+		ProjectId: id,
+		UserId:    u.Id,
+		Role:      constants.ProjectMemberRoleOwner,
+	}
+	m.SetCreated(u.Id)
+	m.SetUpdated(u.Id)
+	if _, err := service.NewModelServiceV2[models.ProjectMemberV2]().InsertOne(m); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, p)
+}
+
+func PostProjectMember(c *gin.Context) {
+	var m models.ProjectMemberV2
+	if err := c.ShouldBindJSON(&m); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	if !checkProjectMember(c, &m) {
+		return
+	}
+
+	// check if already a member
+	modelSvc := service.NewModelServiceV2[models.ProjectMemberV2]()
+	if count, err := modelSvc.Count(bson.M{"project_id": m.ProjectId, "user_id": m.UserId}); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	} else if count > 0 {
+		HandleErrorBadRequest(c, errors.ErrorProjectMemberAlreadyExists)
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	m.SetCreated(u.Id)
+	m.SetUpdated(u.Id)
+	id, err := modelSvc.InsertOne(m)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// added concurrently
+			HandleErrorBadRequest(c, errors.ErrorProjectMemberAlreadyExists)
+			return
+		}
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	m.SetId(id)
+
+	HandleSuccessWithData(c, m)
+}
+
+func PutProjectMemberById(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var m models.ProjectMemberV2
+	if err := c.ShouldBindJSON(&m); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	if !checkProjectMember(c, &m) {
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	m.SetId(id)
+	m.SetUpdated(u.Id)
+	if err := service.NewModelServiceV2[models.ProjectMemberV2]().ReplaceById(id, m); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			HandleErrorBadRequest(c, errors.ErrorProjectMemberAlreadyExists)
+			return
+		}
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, m)
+}
+
+func DeleteProjectMemberList(c *gin.Context) {
+	type Payload struct {
+		Ids []primitive.ObjectID `json:"ids"`
+	}
+
+	var payload Payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	modelSvc := service.NewModelServiceV2[models.ProjectMemberV2]()
+	members, err := modelSvc.GetMany(bson.M{"_id": bson.M{"$in": payload.Ids}}, nil)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	projectSvc := project.GetProjectServiceV2()
+	for _, m := range members {
+		ok, err := projectSvc.CanManage(u, m.ProjectId)
+		if err != nil {
+			HandleErrorInternalServerError(c, err)
+			return
+		}
+		if !ok {
+			HandleErrorForbidden(c, errors.ErrorProjectForbidden)
+			return
+		}
+	}
+
+	if err := modelSvc.DeleteMany(bson.M{"_id": bson.M{"$in": payload.Ids}}); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccess(c)
+}
+
+// checkProjectMember validates a project member and checks if the current
+// user can manage members of its project, and responds with error if not
+func checkProjectMember(c *gin.Context, m *models.ProjectMemberV2) (ok bool) {
+	if m.ProjectId.IsZero() || m.UserId.IsZero() {
+		HandleErrorBadRequest(c, errors.ErrorHttpBadRequest)
+		return false
+	}
+	validRole := false
+	for _, role := range projectMemberRoles {
+		if m.Role == role {
+			validRole = true
+			break
+		}
+	}
+	if !validRole {
+		HandleErrorBadRequest(c, errors.ErrorProjectInvalidMemberRole)
+		return false
+	}
+
+	ok, err := project.GetProjectServiceV2().CanManage(GetUserFromContextV2(c), m.ProjectId)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return false
+	}
+	if !ok {
+		HandleErrorForbidden(c, errors.ErrorProjectForbidden)
+		return false
+	}
+	return true
+}
@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"github.com/crawlab-team/crawlab-core/constants"
 	"github.com/crawlab-team/crawlab-core/middlewares"
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strings"
 )
 
 type RouterGroups struct {
@@ -22,48 +24,273 @@ func NewRouterGroups(app *gin.Engine) (groups *RouterGroups) {
 func RegisterController[T any](group *gin.RouterGroup, basePath string, ctr *BaseControllerV2[T]) {
 	actionPaths := make(map[string]bool)
 	for _, action := range ctr.actions {
-		group.Handle(action.Method, basePath+action.Path, action.HandlerFunc)
+		handle(group, action.Method, basePath, action.Path, action.HandlerFunc, ctr.getAuditDoc)
 		path := basePath + action.Path
 		key := action.Method + " - " + path
 		actionPaths[key] = true
 	}
-	registerBuiltinHandler(group, http.MethodGet, basePath+"", ctr.GetList, actionPaths)
-	registerBuiltinHandler(group, http.MethodGet, basePath+"/:id", ctr.GetById, actionPaths)
-	registerBuiltinHandler(group, http.MethodPost, basePath+"", ctr.Post, actionPaths)
-	registerBuiltinHandler(group, http.MethodPut, basePath+"/:id", ctr.PutById, actionPaths)
-	registerBuiltinHandler(group, http.MethodPatch, basePath+"", ctr.PatchList, actionPaths)
-	registerBuiltinHandler(group, http.MethodDelete, basePath+"/:id", ctr.DeleteById, actionPaths)
-	registerBuiltinHandler(group, http.MethodDelete, basePath+"", ctr.DeleteList, actionPaths)
+	registerBuiltinHandler(group, http.MethodGet, basePath, "", ctr.GetList, ctr.getAuditDoc, actionPaths)
+	registerBuiltinHandler(group, http.MethodGet, basePath, "/:id", ctr.GetById, ctr.getAuditDoc, actionPaths)
+	registerBuiltinHandler(group, http.MethodPost, basePath, "", ctr.Post, ctr.getAuditDoc, actionPaths)
+	registerBuiltinHandler(group, http.MethodPut, basePath, "/:id", ctr.PutById, ctr.getAuditDoc, actionPaths)
+	registerBuiltinHandler(group, http.MethodPatch, basePath, "", ctr.PatchList, ctr.getAuditDoc, actionPaths)
+	registerBuiltinHandler(group, http.MethodDelete, basePath, "/:id", ctr.DeleteById, ctr.getAuditDoc, actionPaths)
+	registerBuiltinHandler(group, http.MethodDelete, basePath, "", ctr.DeleteList, ctr.getAuditDoc, actionPaths)
 }
 
 func RegisterActions(group *gin.RouterGroup, basePath string, actions []Action) {
 	for _, action := range actions {
-		group.Handle(action.Method, basePath+action.Path, action.HandlerFunc)
+		handle(group, action.Method, basePath, action.Path, action.HandlerFunc, nil)
 	}
 }
 
-func registerBuiltinHandler(group *gin.RouterGroup, method, path string, handlerFunc gin.HandlerFunc, existingActionPaths map[string]bool) {
-	key := method + " - " + path
+func registerBuiltinHandler(group *gin.RouterGroup, method, basePath, path string, handlerFunc gin.HandlerFunc, getDoc middlewares.AuditDocFunc, existingActionPaths map[string]bool) {
+	key := method + " - " + basePath + path
 	_, ok := existingActionPaths[key]
 	if ok {
 		return
 	}
-	group.Handle(method, path, handlerFunc)
+	handle(group, method, basePath, path, handlerFunc, getDoc)
+}
+
+// handle registers a handler with permission check of the resource and
+// action the route maps to, and project access check of the resource.
+// Mutating requests are recorded in audit logs, with changes of the
+// resource if getDoc is given. The audit middleware comes first so that
+// requests denied by the checks are recorded as well.
+func handle(group *gin.RouterGroup, method, basePath, path string, handlerFunc gin.HandlerFunc, getDoc middlewares.AuditDocFunc) {
+	resource, action := getPermissionResourceAction(method, basePath, path)
+	var handlers []gin.HandlerFunc
+	if method != http.MethodGet {
+		handlers = append(handlers, middlewares.AuditMiddlewareV2(strings.Trim(basePath, "/"), action, getDoc))
+	}
+	handlers = append(handlers,
+		middlewares.PermissionMiddlewareV2(resource, action),
+		middlewares.ProjectMiddlewareV2(resource),
+		handlerFunc,
+	)
+	group.Handle(method, basePath+path, handlers...)
+}
+
+// getPermissionResourceAction maps a route to the resource and action to
+// check permissions against. The resource is the base path without leading
+// slash, e.g. "spiders" or "data/collections", and the action is derived
+// from the method, or the last static path segment for run actions. Routes
+// of the current user ("/users/me") map to an empty resource and are not
+// checked.
+func getPermissionResourceAction(method, basePath, path string) (resource, action string) {
+	resource = strings.Trim(basePath, "/")
+	if resource == "users" && strings.HasPrefix(path, "/me") {
+		return "", ""
+	}
+
+	switch method {
+	case http.MethodGet:
+		return resource, constants.PermissionActionView
+	case http.MethodPut, http.MethodPatch:
+		return resource, constants.PermissionActionEdit
+	case http.MethodDelete:
+		return resource, constants.PermissionActionDelete
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	switch segments[len(segments)-1] {
+	case "":
+		return resource, constants.PermissionActionCreate
+	case "run", "restart", "cancel":
+		return resource, constants.PermissionActionRun
+	default:
+		return resource, constants.PermissionActionEdit
+	}
 }
 
 func InitRoutes(app *gin.Engine) (err error) {
 	// routes groups
 	groups := NewRouterGroups(app)
 
+	RegisterActions(groups.AuthGroup, "/audit-logs", []Action{
+		{
+			Method:      http.MethodGet,
+			Path:        "",
+			HandlerFunc: GetAuditLogList,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/:id",
+			HandlerFunc: GetAuditLogById,
+		},
+	})
 	RegisterController(groups.AuthGroup, "/data/collections", NewControllerV2[models.DataCollectionV2]())
 	RegisterController(groups.AuthGroup, "/data-sources", NewControllerV2[models.DataSourceV2]())
-	RegisterController(groups.AuthGroup, "/environments", NewControllerV2[models.EnvironmentV2]())
-	RegisterController(groups.AuthGroup, "/gits", NewControllerV2[models.GitV2]())
-	RegisterController(groups.AuthGroup, "/nodes", NewControllerV2[models.NodeV2]())
+	RegisterActions(groups.AuthGroup, "/dependencies", []Action{
+		{
+			Method:      http.MethodGet,
+			Path:        "",
+			HandlerFunc: GetDependencyList,
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/install",
+			HandlerFunc: PostDependencyInstall,
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/uninstall",
+			HandlerFunc: PostDependencyUninstall,
+		},
+	})
+	RegisterController(groups.AuthGroup, "/dependencies/settings", NewControllerV2[models.DependencySettingV2]())
+	RegisterController(groups.AuthGroup, "/dependencies/tasks", NewControllerV2[models.DependencyTaskV2](
+		Action{
+			Method:      http.MethodGet,
+			Path:        "/:id/logs",
+			HandlerFunc: GetDependencyTaskLogs,
+		},
+	))
+	RegisterController(groups.AuthGroup, "/environments", NewControllerV2[models.EnvironmentV2](
+		Action{
+			Method:      http.MethodPost,
+			Path:        "",
+			HandlerFunc: PostEnvironment,
+		},
+		Action{
+			Method:      http.MethodPut,
+			Path:        "/:id",
+			HandlerFunc: PutEnvironmentById,
+		},
+	))
+	RegisterController(groups.AuthGroup, "/gits", NewControllerV2[models.GitV2](
+		Action{
+			Method:      http.MethodPut,
+			Path:        "/:id",
+			HandlerFunc: PutGitById,
+		},
+		Action{
+			Method:      http.MethodPut,
+			Path:        "/:id/webhook-secret",
+			HandlerFunc: PutGitWebhookSecret,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/:id/deploy-key",
+			HandlerFunc: PostGitDeployKey,
+		},
+	))
+	RegisterController(groups.AuthGroup, "/git-credentials", NewControllerV2[models.GitCredentialV2](
+		Action{
+			Method:      http.MethodPost,
+			Path:        "",
+			HandlerFunc: PostGitCredential,
+		},
+		Action{
+			Method:      http.MethodPut,
+			Path:        "/:id",
+			HandlerFunc: PutGitCredentialById,
+		},
+		Action{
+			Method:      http.MethodDelete,
+			Path:        "/:id",
+			HandlerFunc: DeleteGitCredentialById,
+		},
+		Action{
+			Method:      http.MethodDelete,
+			Path:        "",
+			HandlerFunc: DeleteGitCredentialList,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/:id/known-hosts",
+			HandlerFunc: PostGitCredentialKnownHosts,
+		},
+	))
+	RegisterController(groups.AuthGroup, "/git-webhooks/logs", NewControllerV2[models.GitWebhookLogV2]())
+	RegisterController(groups.AuthGroup, "/join-tokens", NewControllerV2[models.JoinTokenV2](
+		Action{
+			Method:      http.MethodPost,
+			Path:        "",
+			HandlerFunc: PostJoinToken,
+		},
+		Action{
+			Method:      http.MethodPut,
+			Path:        "/:id",
+			HandlerFunc: PutJoinTokenById,
+		},
+	))
+	RegisterController(groups.AuthGroup, "/nodes", NewControllerV2[models.NodeV2](
+		Action{
+			Method:      http.MethodGet,
+			Path:        "/versions",
+			HandlerFunc: GetNodeVersions,
+		},
+		Action{
+			Method:      http.MethodPut,
+			Path:        "/:id",
+			HandlerFunc: PutNodeById,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/:id/drain",
+			HandlerFunc: PostNodeDrain,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/:id/resume",
+			HandlerFunc: PostNodeResume,
+		},
+		Action{
+			Method:      http.MethodGet,
+			Path:        "/:id/resources",
+			HandlerFunc: GetNodeResources,
+		},
+		Action{
+			Method:      http.MethodGet,
+			Path:        "/:id/certificates",
+			HandlerFunc: GetNodeCertificates,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/:id/certificates/revoke",
+			HandlerFunc: PostNodeCertificatesRevoke,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/:id/approve",
+			HandlerFunc: PostNodeApprove,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/:id/credential/revoke",
+			HandlerFunc: PostNodeCredentialRevoke,
+		},
+	))
 	RegisterController(groups.AuthGroup, "/notifications/settings", NewControllerV2[models.SettingV2]())
 	RegisterController(groups.AuthGroup, "/permissions", NewControllerV2[models.PermissionV2]())
-	RegisterController(groups.AuthGroup, "/projects", NewControllerV2[models.ProjectV2]())
+	RegisterController(groups.AuthGroup, "/projects", NewControllerV2[models.ProjectV2](
+		Action{
+			Method:      http.MethodPost,
+			Path:        "",
+			HandlerFunc: PostProject,
+		},
+	))
+	RegisterController(groups.AuthGroup, "/projects/members", NewControllerV2[models.ProjectMemberV2](
+		Action{
+			Method:      http.MethodPost,
+			Path:        "",
+			HandlerFunc: PostProjectMember,
+		},
+		Action{
+			Method:      http.MethodPut,
+			Path:        "/:id",
+			HandlerFunc: PutProjectMemberById,
+		},
+		Action{
+			Method:      http.MethodDelete,
+			Path:        "",
+			HandlerFunc: DeleteProjectMemberList,
+		},
+	))
 	RegisterController(groups.AuthGroup, "/roles", NewControllerV2[models.RoleV2]())
+	RegisterController(groups.AuthGroup, "/roles/permissions", NewControllerV2[models.RolePermissionV2]())
 	RegisterController(groups.AuthGroup, "/schedules", NewControllerV2[models.ScheduleV2](
 		Action{
 			Method:      http.MethodPost,
@@ -86,6 +313,23 @@ func InitRoutes(app *gin.Engine) (err error) {
 			HandlerFunc: PostScheduleDisable,
 		},
 	))
+	RegisterController(groups.AuthGroup, "/secrets", NewControllerV2[models.SecretV2](
+		Action{
+			Method:      http.MethodPost,
+			Path:        "",
+			HandlerFunc: PostSecret,
+		},
+		Action{
+			Method:      http.MethodPut,
+			Path:        "/:id",
+			HandlerFunc: PutSecretById,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/rotate",
+			HandlerFunc: PostSecretRotate,
+		},
+	))
 	RegisterController(groups.AuthGroup, "/spiders", NewControllerV2[models.SpiderV2](
 		Action{
 			Method:      http.MethodGet,
@@ -182,6 +426,16 @@ func InitRoutes(app *gin.Engine) (err error) {
 			Path:        "/:id/git/remote-refs",
 			HandlerFunc: GetSpiderGitRemoteRefs,
 		},
+		Action{
+			Method:      http.MethodGet,
+			Path:        "/:id/git/log",
+			HandlerFunc: GetSpiderGitLogs,
+		},
+		Action{
+			Method:      http.MethodGet,
+			Path:        "/:id/git/diff",
+			HandlerFunc: GetSpiderGitDiff,
+		},
 		Action{
 			Method:      http.MethodPost,
 			Path:        "/:id/git/checkout",
@@ -214,6 +468,11 @@ func InitRoutes(app *gin.Engine) (err error) {
 			Path:        "/:id",
 			HandlerFunc: GetTaskById,
 		},
+		Action{
+			Method:      http.MethodGet,
+			Path:        "/:id/env",
+			HandlerFunc: GetTaskEnv,
+		},
 		Action{
 			Method:      http.MethodGet,
 			Path:        "",
@@ -256,12 +515,43 @@ func InitRoutes(app *gin.Engine) (err error) {
 		},
 	))
 	RegisterController(groups.AuthGroup, "/tokens", NewControllerV2[models.TokenV2](
+		Action{
+			Method:      http.MethodGet,
+			Path:        "",
+			HandlerFunc: GetTokenList,
+		},
+		Action{
+			Method:      http.MethodGet,
+			Path:        "/:id",
+			HandlerFunc: GetTokenById,
+		},
 		Action{
 			Method:      http.MethodPost,
 			Path:        "",
 			HandlerFunc: PostToken,
 		},
+		Action{
+			Method:      http.MethodPut,
+			Path:        "/:id",
+			HandlerFunc: PutTokenById,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/:id/revoke",
+			HandlerFunc: PostTokenRevoke,
+		},
+		Action{
+			Method:      http.MethodDelete,
+			Path:        "/:id",
+			HandlerFunc: DeleteTokenById,
+		},
+		Action{
+			Method:      http.MethodDelete,
+			Path:        "",
+			HandlerFunc: DeleteTokenList,
+		},
 	))
+	RegisterController(groups.AuthGroup, "/users/roles", NewControllerV2[models.UserRoleV2]())
 	RegisterController(groups.AuthGroup, "/users", NewControllerV2[models.UserV2](
 		Action{
 			Method:      http.MethodPost,
@@ -283,6 +573,56 @@ func InitRoutes(app *gin.Engine) (err error) {
 			Path:        "/me",
 			HandlerFunc: PutUserById,
 		},
+		Action{
+			Method:      http.MethodGet,
+			Path:        "/me/totp",
+			HandlerFunc: GetUserMeTotp,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/me/totp/setup",
+			HandlerFunc: PostUserMeTotpSetup,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/me/totp/enable",
+			HandlerFunc: PostUserMeTotpEnable,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/me/totp/disable",
+			HandlerFunc: PostUserMeTotpDisable,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/me/totp/recovery-codes",
+			HandlerFunc: PostUserMeTotpRecoveryCodes,
+		},
+		Action{
+			Method:      http.MethodGet,
+			Path:        "/me/sessions",
+			HandlerFunc: GetUserMeSessions,
+		},
+		Action{
+			Method:      http.MethodDelete,
+			Path:        "/me/sessions/:id",
+			HandlerFunc: DeleteUserMeSession,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/:id/logout",
+			HandlerFunc: PostUserLogout,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/:id/totp/reset",
+			HandlerFunc: PostUserTotpReset,
+		},
+		Action{
+			Method:      http.MethodPost,
+			Path:        "/:id/unlock",
+			HandlerFunc: PostUserUnlock,
+		},
 	))
 
 	RegisterActions(groups.AuthGroup, "/results", []Action{
@@ -356,6 +696,13 @@ func InitRoutes(app *gin.Engine) (err error) {
 		},
 	})
 
+	RegisterActions(groups.AnonymousGroup, "/git-webhooks", []Action{
+		{
+			Method:      http.MethodPost,
+			Path:        "",
+			HandlerFunc: PostGitWebhook,
+		},
+	})
 	RegisterActions(groups.AnonymousGroup, "/system-info", []Action{
 		{
 			Path:        "",
@@ -363,6 +710,13 @@ func InitRoutes(app *gin.Engine) (err error) {
 			HandlerFunc: GetSystemInfo,
 		},
 	})
+	RegisterActions(groups.AnonymousGroup, "/updates", []Action{
+		{
+			Method:      http.MethodGet,
+			Path:        "/worker",
+			HandlerFunc: GetWorkerUpdate,
+		},
+	})
 	RegisterActions(groups.AnonymousGroup, "/version", []Action{
 		{
 			Method:      http.MethodGet,
@@ -376,12 +730,44 @@ func InitRoutes(app *gin.Engine) (err error) {
 			Path:        "/login",
 			HandlerFunc: PostLogin,
 		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/login/totp",
+			HandlerFunc: PostLoginTotp,
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/login/totp/setup",
+			HandlerFunc: PostLoginTotpSetup,
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/login/change-password",
+			HandlerFunc: PostLoginChangePassword,
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/login/refresh",
+			HandlerFunc: PostLoginRefresh,
+		},
 		{
 			Method:      http.MethodPost,
 			Path:        "/logout",
 			HandlerFunc: PostLogout,
 		},
 	})
+	RegisterActions(groups.AnonymousGroup, "/oidc", []Action{
+		{
+			Method:      http.MethodGet,
+			Path:        "/login",
+			HandlerFunc: GetOidcLogin,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/callback",
+			HandlerFunc: GetOidcCallback,
+		},
+	})
 
 	return nil
 }
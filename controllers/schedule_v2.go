@@ -4,7 +4,9 @@ import (
 	"github.com/crawlab-team/crawlab-core/errors"
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/node/selector"
 	"github.com/crawlab-team/crawlab-core/schedule"
+	"github.com/crawlab-team/crawlab-core/spider/param"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -16,6 +18,22 @@ func PostSchedule(c *gin.Context) {
 		return
 	}
 
+	// check project
+	if !checkProjectWrite(c, &s) {
+		return
+	}
+
+	// validate params
+	if !checkScheduleParams(c, &s) {
+		return
+	}
+
+	// validate node selector
+	if err := selector.Validate(s.NodeSelector); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
 	u := GetUserFromContextV2(c)
 
 	modelSvc := service.NewModelServiceV2[models.ScheduleV2]()
@@ -60,6 +78,22 @@ func PutScheduleById(c *gin.Context) {
 		return
 	}
 
+	// check project
+	if !checkProjectWrite(c, &s) {
+		return
+	}
+
+	// validate params
+	if !checkScheduleParams(c, &s) {
+		return
+	}
+
+	// validate node selector
+	if err := selector.Validate(s.NodeSelector); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
 	modelSvc := service.NewModelServiceV2[models.ScheduleV2]()
 	err = modelSvc.ReplaceById(id, s)
 	if err != nil {
@@ -128,3 +162,19 @@ func postScheduleEnableDisableFunc(isEnable bool) func(c *gin.Context) {
 		HandleSuccess(c)
 	}
 }
+
+// checkScheduleParams validates params of a schedule against the param
+// schema of its spider, and responds with error if invalid
+func checkScheduleParams(c *gin.Context, s *models.ScheduleV2) (ok bool) {
+	// required params without defaults are checked even if no params are given
+	spider, err := service.NewModelServiceV2[models.SpiderV2]().GetById(s.SpiderId)
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return false
+	}
+	if _, err := param.Validate(spider.ParamSchema, s.Params); err != nil {
+		HandleErrorBadRequest(c, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"errors"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/secret"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type secretPayload struct {
+	Key         string             `json:"key"`
+	Value       string             `json:"value"`
+	Description string             `json:"description"`
+	ProjectId   primitive.ObjectID `json:"project_id"`
+	SpiderId    primitive.ObjectID `json:"spider_id"`
+}
+
+func PostSecret(c *gin.Context) {
+	var payload secretPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	s := models.SecretV2{
+		Key:         payload.Key,
+		Description: payload.Description,
+		ProjectId:   payload.ProjectId,
+		SpiderId:    payload.SpiderId,
+	}
+	secretSvc := secret.GetSecretServiceV2()
+	if err := secretSvc.Validate(&s); err != nil {
+		handleSecretError(c, err)
+		return
+	}
+	if !checkProjectWrite(c, &s) {
+		return
+	}
+	var err error
+	s.Value, s.KeyId, err = secretSvc.Encrypt(payload.Value)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	u := GetUserFromContextV2(c)
+	s.SetCreated(u.Id)
+	s.SetUpdated(u.Id)
+	id, err := service.NewModelServiceV2[models.SecretV2]().InsertOne(s)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	s.SetId(id)
+
+	HandleSuccessWithData(c, s)
+}
+
+func PutSecretById(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var payload secretPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	modelSvc := service.NewModelServiceV2[models.SecretV2]()
+	s, err := modelSvc.GetById(id)
+	if err != nil {
+		HandleErrorNotFound(c, err)
+		return
+	}
+	if !checkProjectWrite(c, s) {
+		return
+	}
+
+	// value is kept unless a new one is provided
+	s.Key = payload.Key
+	s.Description = payload.Description
+	s.ProjectId = payload.ProjectId
+	s.SpiderId = payload.SpiderId
+	secretSvc := secret.GetSecretServiceV2()
+	if err := secretSvc.Validate(s); err != nil {
+		handleSecretError(c, err)
+		return
+	}
+	if !checkProjectWrite(c, s) {
+		return
+	}
+	if payload.Value != "" {
+		s.Value, s.KeyId, err = secretSvc.Encrypt(payload.Value)
+		if err != nil {
+			HandleErrorInternalServerError(c, err)
+			return
+		}
+	}
+
+	u := GetUserFromContextV2(c)
+	s.SetUpdated(u.Id)
+	if err := modelSvc.ReplaceById(id, *s); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, s)
+}
+
+// PostSecretRotate re-encrypts secrets with the current key after a new key
+// is added to the "secret.keys" setting
+func PostSecretRotate(c *gin.Context) {
+	n, err := secret.GetSecretServiceV2().RotateKeys(GetUserFromContextV2(c).Id)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	HandleSuccessWithData(c, struct {
+		Count int `json:"count"`
+	}{n})
+}
+
+func handleSecretError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errors2.ErrorSecretInvalidKey),
+		errors.Is(err, errors2.ErrorSecretInvalidScope),
+		errors.Is(err, errors2.ErrorSecretAlreadyExists):
+		HandleErrorBadRequest(c, err)
+	default:
+		HandleErrorInternalServerError(c, err)
+	}
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/user"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetUserMeSessions returns active sessions of the current user, of which
+// the session of the request is marked as current
+func GetUserMeSessions(c *gin.Context) {
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	u := GetUserFromContextV2(c)
+	sessions, err := userSvc.GetActiveSessions(u.Id)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	currentId, _ := userSvc.GetTokenSessionId(c.GetHeader("Authorization"))
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == currentId
+	}
+	HandleSuccessWithData(c, sessions)
+}
+
+// DeleteUserMeSession revokes a session of the current user
+func DeleteUserMeSession(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	u := GetUserFromContextV2(c)
+	sessions, err := userSvc.GetActiveSessions(u.Id)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	for _, s := range sessions {
+		if s.Id != id {
+			continue
+		}
+		if err := userSvc.RevokeSession(id, u.Id); err != nil {
+			HandleErrorInternalServerError(c, err)
+			return
+		}
+		HandleSuccess(c)
+		return
+	}
+	HandleErrorNotFound(c, errors.ErrorModelNotFound)
+}
+
+// PostUserLogout revokes all sessions of a user, e.g. when the user leaves
+// the team
+func PostUserLogout(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	if err := userSvc.RevokeUserSessions(id, GetUserFromContextV2(c).Id); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	HandleSuccess(c)
+}
@@ -6,11 +6,14 @@ import (
 	log2 "github.com/apex/log"
 	"github.com/crawlab-team/crawlab-core/constants"
 	"github.com/crawlab-team/crawlab-core/entity"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
 	"github.com/crawlab-team/crawlab-core/fs"
 	"github.com/crawlab-team/crawlab-core/interfaces"
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/node/selector"
 	"github.com/crawlab-team/crawlab-core/spider/admin"
+	"github.com/crawlab-team/crawlab-core/spider/param"
 	"github.com/crawlab-team/crawlab-core/utils"
 	"github.com/crawlab-team/crawlab-db/mongo"
 	vcs "github.com/crawlab-team/crawlab-vcs"
@@ -83,6 +86,13 @@ func GetSpiderList(c *gin.Context) {
 	query := MustGetFilterQuery(c)
 	sort := MustGetSortOption(c)
 
+	// restrict to projects of user
+	query, err := GetProjectFilterQuery(c, "project_id", query, false)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
 	// get list
 	spiders, err := service.NewModelServiceV2[models.SpiderV2]().GetMany(query, &mongo.FindOptions{
 		Sort:  sort,
@@ -207,6 +217,23 @@ func PostSpider(c *gin.Context) {
 		return
 	}
 
+	// check project
+	if !checkProjectWrite(c, &s) {
+		return
+	}
+
+	// validate param schema
+	if err := param.ValidateSchema(s.ParamSchema); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// validate node selector
+	if err := selector.Validate(s.NodeSelector); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
 	// upsert data collection
 	if err := upsertSpiderDataCollection(&s); err != nil {
 		HandleErrorInternalServerError(c, err)
@@ -260,6 +287,23 @@ func PutSpiderById(c *gin.Context) {
 		return
 	}
 
+	// check project
+	if !checkProjectWrite(c, &s) {
+		return
+	}
+
+	// validate param schema
+	if err := param.ValidateSchema(s.ParamSchema); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// validate node selector
+	if err := selector.Validate(s.NodeSelector); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
 	// upsert data collection
 	if err := upsertSpiderDataCollection(&s); err != nil {
 		HandleErrorInternalServerError(c, err)
@@ -369,6 +413,14 @@ func DeleteSpiderList(c *gin.Context) {
 		return
 	}
 
+	// spiders user can delete
+	ids, err := FilterProjectWritableIds[models.SpiderV2](c, "project_id", payload.Ids)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	payload.Ids = ids
+
 	if err := mongo.RunTransaction(func(context mongo2.SessionContext) (err error) {
 		// delete spiders
 		if err := service.NewModelServiceV2[models.SpiderV2]().DeleteMany(bson.M{
@@ -749,7 +801,7 @@ func PostSpiderRun(c *gin.Context) {
 	// schedule
 	taskIds, err := adminSvc.Schedule(id, &opts)
 	if err != nil {
-		HandleErrorInternalServerError(c, err)
+		handleSpiderRunError(c, err)
 		return
 	}
 
@@ -885,6 +937,7 @@ func PostSpiderGitCheckout(c *gin.Context) {
 		CommitMessage string   `json:"commit_message"`
 		Branch        string   `json:"branch"`
 		Tag           string   `json:"tag"`
+		Commit        string   `json:"commit"`
 	}
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		HandleErrorBadRequest(c, err)
@@ -904,6 +957,20 @@ func PostSpiderGitCheckout(c *gin.Context) {
 		return
 	}
 
+	// tag or commit
+	if payload.Tag != "" || payload.Commit != "" {
+		rev := payload.Commit
+		if payload.Tag != "" {
+			rev = "refs/tags/" + payload.Tag
+		}
+		if err := gitSpiderCheckoutRef(id, gitClient, rev); err != nil {
+			HandleErrorInternalServerError(c, err)
+			return
+		}
+		HandleSuccess(c)
+		return
+	}
+
 	// branch to pull
 	var branch string
 	if payload.Branch == "" {
@@ -924,9 +991,99 @@ func PostSpiderGitCheckout(c *gin.Context) {
 		return
 	}
 
+	// follow branch again
+	if err := service.NewModelServiceV2[models.GitV2]().UpdateById(id, bson.M{
+		"$set": bson.M{
+			"current_branch": branch,
+			"current_ref":    "",
+		},
+	}); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
 	HandleSuccess(c)
 }
 
+func GetSpiderGitLogs(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// pagination
+	p := MustGetPagination(c)
+
+	// git client
+	gitClient, err := getSpiderGitClient(id)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// return null if git client is empty
+	if gitClient == nil {
+		HandleSuccess(c)
+		return
+	}
+
+	// logs
+	logs, err := gitClient.GetLogsWithRefs()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// paginate
+	page, size := p.Page, p.Size
+	if page < 1 {
+		page = constants.PaginationDefaultPage
+	}
+	if size < 1 {
+		size = constants.PaginationDefaultSize
+	}
+	total := len(logs)
+	start := total
+	// pages out of range are checked first, so that (page-1)*size does not overflow
+	if page-1 < total/size+1 {
+		start = min((page-1)*size, total)
+	}
+	end := min(start+size, total)
+
+	HandleSuccessWithListData(c, logs[start:end], total)
+}
+
+func GetSpiderGitDiff(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// git client
+	gitClient, err := getSpiderGitClient(id)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// return null if git client is empty
+	if gitClient == nil {
+		HandleSuccess(c)
+		return
+	}
+
+	// diff
+	diff, err := utils.GetGitDiff(gitClient.GetRepository(), c.Query("from"), c.Query("to"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+
+	HandleSuccessWithData(c, diff)
+}
+
 func PostSpiderGitPull(c *gin.Context) {
 	id, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
@@ -1107,7 +1264,7 @@ func getSpiderFsSvcById(id primitive.ObjectID) interfaces.FsServiceV2 {
 	return fsSvc
 }
 
-func getSpiderGitClient(id primitive.ObjectID) (client *vcs.GitClient, err error) {
+func getSpiderGitClient(id primitive.ObjectID) (client *utils.GitClientV2, err error) {
 	// git
 	g, err := service.NewModelServiceV2[models.GitV2]().GetById(id)
 	if err != nil {
@@ -1119,13 +1276,19 @@ func getSpiderGitClient(id primitive.ObjectID) (client *vcs.GitClient, err error
 
 	// git client
 	workspacePath := viper.GetString("workspace")
-	client, err = vcs.NewGitClient(vcs.WithPath(filepath.Join(workspacePath, id.Hex())))
+	client, err = utils.NewGitClientV2(vcs.WithPath(filepath.Join(workspacePath, id.Hex())))
 	if err != nil {
 		return nil, err
 	}
 
 	// set auth
-	utils.InitGitClientAuthV2(g, client)
+	adminSvc, err := admin.GetSpiderAdminServiceV2()
+	if err != nil {
+		return nil, err
+	}
+	if err := adminSvc.InitGitClientAuth(g, client); err != nil {
+		return nil, err
+	}
 
 	// remote name
 	remoteName := vcs.GitRemoteNameOrigin
@@ -1171,7 +1334,7 @@ func getSpiderGitClient(id primitive.ObjectID) (client *vcs.GitClient, err error
 	return client, nil
 }
 
-func alignSpiderGitBranch(gitClient *vcs.GitClient) {
+func alignSpiderGitBranch(gitClient *utils.GitClientV2) {
 	// current branch
 	currentBranch, err := gitClient.GetCurrentBranch()
 	if err != nil {
@@ -1243,7 +1406,7 @@ func getSpiderGitIgnore(id primitive.ObjectID) (ignore []string, err error) {
 	return ignore, nil
 }
 
-func gitSpiderCheckout(gitClient *vcs.GitClient, remote, branch string) (err error) {
+func gitSpiderCheckout(gitClient *utils.GitClientV2, remote, branch string) (err error) {
 	if err := gitClient.CheckoutBranch(branch, vcs.WithBranch(branch)); err != nil {
 		return trace.TraceError(err)
 	}
@@ -1252,7 +1415,24 @@ func gitSpiderCheckout(gitClient *vcs.GitClient, remote, branch string) (err err
 	return spiderGitPull(gitClient, remote, branch)
 }
 
-func spiderGitPull(gitClient *vcs.GitClient, remote, branch string) (err error) {
+// gitSpiderCheckoutRef checks out a tag or commit in detached HEAD and pins
+// the git to it, so that it is no longer pulled automatically.
+func gitSpiderCheckoutRef(id primitive.ObjectID, gitClient *utils.GitClientV2, rev string) (err error) {
+	hash, err := utils.ResolveGitRevision(gitClient.GetRepository(), rev)
+	if err != nil {
+		return err
+	}
+	if err := gitClient.CheckoutHash(hash); err != nil {
+		return trace.TraceError(err)
+	}
+	return service.NewModelServiceV2[models.GitV2]().UpdateById(id, bson.M{
+		"$set": bson.M{
+			"current_ref": hash,
+		},
+	})
+}
+
+func spiderGitPull(gitClient *utils.GitClientV2, remote, branch string) (err error) {
 	// pull
 	if err := gitClient.Pull(
 		vcs.WithRemoteNamePull(remote),
@@ -1307,3 +1487,12 @@ func upsertSpiderDataCollection(s *models.SpiderV2) (err error) {
 	}
 	return nil
 }
+
+func handleSpiderRunError(c *gin.Context, err error) {
+	if errors.Is(err, errors2.ErrorSpiderInvalidParam) ||
+		errors.Is(err, errors2.ErrorNodeInvalidSelector) {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	HandleErrorInternalServerError(c, err)
+}
@@ -3,10 +3,12 @@ package controllers_test
 import (
 	"bytes"
 	"encoding/json"
+	"github.com/crawlab-team/crawlab-core/constants"
 	"github.com/crawlab-team/crawlab-core/controllers"
 	"github.com/crawlab-team/crawlab-core/middlewares"
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/user"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -247,3 +249,28 @@ func TestDeleteSpiderList(t *testing.T) {
 	require.Nil(t, err)
 	assert.Equal(t, 0, taskStatCount)
 }
+
+func TestGetSpiderList_NormalUser(t *testing.T) {
+	SetupTestDB()
+	defer CleanupTestDB()
+
+	// freshly created normal user is assigned the default role
+	userSvc, err := user.GetUserServiceV2()
+	require.Nil(t, err)
+	require.Nil(t, userSvc.Create("alice", "Alice-Passw0rd!", constants.RoleNormal, "", primitive.NilObjectID))
+	u, err := service.NewModelServiceV2[models.UserV2]().GetOne(bson.M{"username": "alice"}, nil)
+	require.Nil(t, err)
+	token, err := userSvc.MakeToken(u)
+	require.Nil(t, err)
+
+	router := gin.Default()
+	router.Use(middlewares.AuthorizationMiddlewareV2())
+	router.GET("/spiders", middlewares.PermissionMiddlewareV2("spiders", constants.PermissionActionView), controllers.NewControllerV2[models.SpiderV2]().GetList)
+
+	req, _ := http.NewRequest(http.MethodGet, "/spiders", nil)
+	req.Header.Set("Authorization", token)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/crawlab-team/crawlab-core/models/service"
 	"github.com/crawlab-team/crawlab-core/result"
 	"github.com/crawlab-team/crawlab-core/spider/admin"
+	"github.com/crawlab-team/crawlab-core/spider/param"
 	"github.com/crawlab-team/crawlab-core/task/log"
 	"github.com/crawlab-team/crawlab-core/task/scheduler"
 	"github.com/crawlab-team/crawlab-core/utils"
@@ -71,6 +72,13 @@ func GetTaskList(c *gin.Context) {
 	query := MustGetFilterQuery(c)
 	sort := MustGetSortOption(c)
 
+	// restrict to projects of user
+	query, err := GetProjectFilterQuery(c, "spider_id", query, false)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
 	// get list
 	list, err := service.NewModelServiceV2[models.TaskV2]().GetMany(query, &mongo.FindOptions{
 		Sort:  sort,
@@ -190,6 +198,14 @@ func DeleteList(c *gin.Context) {
 		return
 	}
 
+	// tasks user can delete
+	ids, err := FilterProjectWritableIds[models.TaskV2](c, "spider_id", payload.Ids)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	payload.Ids = ids
+
 	if err := mongo.RunTransaction(func(context mongo2.SessionContext) error {
 		// delete tasks
 		if err := service.NewModelServiceV2[models.TaskV2]().DeleteMany(bson.M{
@@ -255,13 +271,21 @@ func PostTaskRun(c *gin.Context) {
 		return
 	}
 
+	// check project
+	if !checkProjectWrite(c, s) {
+		return
+	}
+
 	// options
 	opts := &interfaces.SpiderRunOptions{
-		Mode:     t.Mode,
-		NodeIds:  t.NodeIds,
-		Cmd:      t.Cmd,
-		Param:    t.Param,
-		Priority: t.Priority,
+		Mode:         t.Mode,
+		NodeIds:      t.NodeIds,
+		NodeSelector: t.NodeSelector,
+		Cmd:          t.Cmd,
+		Param:        t.Param,
+		Priority:     t.Priority,
+		Envs:         t.Envs,
+		Params:       param.ToValues(t.Params),
 	}
 
 	// user
@@ -277,7 +301,7 @@ func PostTaskRun(c *gin.Context) {
 	}
 	taskIds, err := adminSvc.Schedule(s.Id, opts)
 	if err != nil {
-		HandleErrorInternalServerError(c, err)
+		handleSpiderRunError(c, err)
 		return
 	}
 
@@ -302,11 +326,14 @@ func PostTaskRestart(c *gin.Context) {
 
 	// options
 	opts := &interfaces.SpiderRunOptions{
-		Mode:     t.Mode,
-		NodeIds:  t.NodeIds,
-		Cmd:      t.Cmd,
-		Param:    t.Param,
-		Priority: t.Priority,
+		Mode:         t.Mode,
+		NodeIds:      t.NodeIds,
+		NodeSelector: t.NodeSelector,
+		Cmd:          t.Cmd,
+		Param:        t.Param,
+		Priority:     t.Priority,
+		Envs:         t.Envs,
+		Params:       param.ToValues(t.Params),
 	}
 
 	// user
@@ -322,7 +349,7 @@ func PostTaskRestart(c *gin.Context) {
 	}
 	taskIds, err := adminSvc.Schedule(t.SpiderId, opts)
 	if err != nil {
-		HandleErrorInternalServerError(c, err)
+		handleSpiderRunError(c, err)
 		return
 	}
 
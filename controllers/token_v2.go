@@ -1,35 +1,213 @@
 package controllers
 
 import (
+	"errors"
+	"github.com/crawlab-team/crawlab-core/constants"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/models/service"
 	"github.com/crawlab-team/crawlab-core/user"
+	"github.com/crawlab-team/crawlab-db/mongo"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongo2 "go.mongodb.org/mongo-driver/mongo"
+	"time"
 )
 
+func GetTokenList(c *gin.Context) {
+	// params
+	pagination := MustGetPagination(c)
+	query := MustGetFilterQuery(c)
+	sort := MustGetSortOption(c)
+
+	// only tokens of current user unless admin
+	u := GetUserFromContextV2(c)
+	if u.Role != constants.RoleAdmin {
+		if query == nil {
+			query = bson.M{}
+		}
+		query["created_by"] = u.Id
+	}
+
+	modelSvc := service.NewModelServiceV2[models.TokenV2]()
+	tokens, err := modelSvc.GetMany(query, &mongo.FindOptions{
+		Sort:  sort,
+		Skip:  pagination.Size * (pagination.Page - 1),
+		Limit: pagination.Size,
+	})
+	if err != nil {
+		if errors.Is(err, mongo2.ErrNoDocuments) {
+			HandleSuccessWithListData(c, nil, 0)
+		} else {
+			HandleErrorInternalServerError(c, err)
+		}
+		return
+	}
+	total, err := modelSvc.Count(query)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	HandleSuccessWithListData(c, tokens, total)
+}
+
+func GetTokenById(c *gin.Context) {
+	id, ok := getOwnTokenId(c)
+	if !ok {
+		return
+	}
+	t, err := service.NewModelServiceV2[models.TokenV2]().GetById(id)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	HandleSuccessWithData(c, t)
+}
+
 func PostToken(c *gin.Context) {
-	var t models.TokenV2
-	if err := c.ShouldBindJSON(&t); err != nil {
+	var payload struct {
+		Name      string    `json:"name"`
+		Scopes    []string  `json:"scopes"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
 		HandleErrorBadRequest(c, err)
 		return
 	}
+	if !payload.ExpiresAt.IsZero() && payload.ExpiresAt.Before(time.Now()) {
+		HandleErrorBadRequest(c, errors2.ErrorUserTokenExpired)
+		return
+	}
 	svc, err := user.GetUserServiceV2()
 	if err != nil {
 		HandleErrorInternalServerError(c, err)
 		return
 	}
+	// tokens created with a token cannot have more access than it
+	if value, ok := c.Get(constants.TokenContextKey); ok {
+		if ct, ok := value.(*models.TokenV2); ok && !user.CoverTokenScopes(ct.Scopes, payload.Scopes) {
+			HandleErrorForbidden(c, errors2.ErrorUserTokenScopeExceeded)
+			return
+		}
+	}
+	u := GetUserFromContextV2(c)
+	t, err := svc.CreateToken(u, payload.Name, payload.Scopes, payload.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, errors2.ErrorUserTokenInvalidScope) {
+			HandleErrorBadRequest(c, err)
+			return
+		}
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// plain token is only returned here
+	HandleSuccessWithData(c, t)
+}
+
+// PutTokenById only allows to rename a token, as its secret, scopes and
+// expiry cannot be changed once created
+func PutTokenById(c *gin.Context) {
+	id, ok := getOwnTokenId(c)
+	if !ok {
+		return
+	}
+	var payload struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
 	u := GetUserFromContextV2(c)
-	t.SetCreated(u.Id)
-	t.SetUpdated(u.Id)
-	t.Token, err = svc.MakeToken(u)
+	modelSvc := service.NewModelServiceV2[models.TokenV2]()
+	if err := modelSvc.UpdateById(id, bson.M{"$set": bson.M{
+		"name":       payload.Name,
+		"updated_by": u.Id,
+		"updated_ts": time.Now(),
+	}}); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	t, err := modelSvc.GetById(id)
 	if err != nil {
 		HandleErrorInternalServerError(c, err)
 		return
 	}
-	_, err = service.NewModelServiceV2[models.TokenV2]().InsertOne(t)
+	HandleSuccessWithData(c, t)
+}
+
+func PostTokenRevoke(c *gin.Context) {
+	id, ok := getOwnTokenId(c)
+	if !ok {
+		return
+	}
+	svc, err := user.GetUserServiceV2()
 	if err != nil {
 		HandleErrorInternalServerError(c, err)
 		return
 	}
+	if err := svc.RevokeToken(id, GetUserFromContextV2(c).Id); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	HandleSuccess(c)
+}
+
+func DeleteTokenById(c *gin.Context) {
+	id, ok := getOwnTokenId(c)
+	if !ok {
+		return
+	}
+	if err := service.NewModelServiceV2[models.TokenV2]().DeleteById(id); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	HandleSuccess(c)
+}
+
+func DeleteTokenList(c *gin.Context) {
+	var payload struct {
+		Ids []primitive.ObjectID `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	query := bson.M{"_id": bson.M{"$in": payload.Ids}}
+	if u := GetUserFromContextV2(c); u.Role != constants.RoleAdmin {
+		query["created_by"] = u.Id
+	}
+	if err := service.NewModelServiceV2[models.TokenV2]().DeleteMany(query); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
 	HandleSuccess(c)
 }
+
+// getOwnTokenId returns id of the token in path if it is created by the
+// current user or the current user is admin, and responds with error if not
+func getOwnTokenId(c *gin.Context) (id primitive.ObjectID, ok bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return id, false
+	}
+	t, err := service.NewModelServiceV2[models.TokenV2]().GetById(id)
+	if err != nil {
+		if errors.Is(err, mongo2.ErrNoDocuments) {
+			HandleErrorNotFound(c, err)
+			return id, false
+		}
+		HandleErrorInternalServerError(c, err)
+		return id, false
+	}
+	u := GetUserFromContextV2(c)
+	if u.Role != constants.RoleAdmin && t.CreatedBy != u.Id {
+		HandleErrorForbidden(c, errors2.ErrorHttpForbidden)
+		return id, false
+	}
+	return id, true
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/crawlab-team/crawlab-core/constants"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/user"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+type totpCodePayload struct {
+	Code string `json:"code"`
+}
+
+// PostLoginTotp completes login with the challenge token returned by login
+// and a code from the authenticator app or a recovery code
+func PostLoginTotp(c *gin.Context) {
+	var payload struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	res, u, err := userSvc.LoginTotp(payload.Challenge, payload.Code, getLoginClient(c))
+	if err != nil {
+		handleTotpError(c, err)
+		return
+	}
+	c.Set(constants.UserContextKey, u)
+	HandleSuccessWithData(c, res)
+}
+
+// PostLoginTotpSetup sets up 2FA during login if it is mandatory for the
+// user of the challenge token, which is then enabled by PostLoginTotp
+func PostLoginTotpSetup(c *gin.Context) {
+	var payload struct {
+		Challenge string `json:"challenge"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	setup, err := userSvc.LoginTotpSetup(payload.Challenge)
+	if err != nil {
+		handleTotpError(c, err)
+		return
+	}
+	HandleSuccessWithData(c, setup)
+}
+
+func GetUserMeTotp(c *gin.Context) {
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	u := GetUserFromContextV2(c)
+	enabled, err := userSvc.IsTotpEnabled(u.Id)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	required, err := userSvc.IsTotpRequired(u)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	HandleSuccessWithData(c, struct {
+		Enabled  bool `json:"enabled"`
+		Required bool `json:"required"`
+	}{enabled, required})
+}
+
+func PostUserMeTotpSetup(c *gin.Context) {
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	setup, err := userSvc.SetupTotp(GetUserFromContextV2(c))
+	if err != nil {
+		handleTotpError(c, err)
+		return
+	}
+	HandleSuccessWithData(c, setup)
+}
+
+func PostUserMeTotpEnable(c *gin.Context) {
+	var payload totpCodePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	if err := userSvc.EnableTotp(GetUserFromContextV2(c), payload.Code); err != nil {
+		handleTotpError(c, err)
+		return
+	}
+	HandleSuccess(c)
+}
+
+func PostUserMeTotpDisable(c *gin.Context) {
+	var payload totpCodePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	if err := userSvc.DisableTotp(GetUserFromContextV2(c), payload.Code); err != nil {
+		handleTotpError(c, err)
+		return
+	}
+	HandleSuccess(c)
+}
+
+func PostUserMeTotpRecoveryCodes(c *gin.Context) {
+	var payload totpCodePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	recoveryCodes, err := userSvc.RegenerateTotpRecoveryCodes(GetUserFromContextV2(c), payload.Code)
+	if err != nil {
+		handleTotpError(c, err)
+		return
+	}
+	HandleSuccessWithData(c, recoveryCodes)
+}
+
+// PostUserTotpReset removes 2FA of a user, e.g. when the device is lost
+func PostUserTotpReset(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	if err := userSvc.ResetTotp(id); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	HandleSuccess(c)
+}
+
+func handleTotpError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errors2.ErrorUserInvalidToken),
+		errors.Is(err, errors2.ErrorUserNotExists),
+		errors.Is(err, errors2.ErrorUserMismatch):
+		HandleErrorUnauthorized(c, errors2.ErrorUserUnauthorized)
+	case errors.Is(err, errors2.ErrorUserTotpInvalidCode),
+		errors.Is(err, errors2.ErrorUserTotpNotEnabled),
+		errors.Is(err, errors2.ErrorUserTotpAlreadyEnabled):
+		HandleErrorBadRequest(c, err)
+	case errors.Is(err, errors2.ErrorUserTotpMandatory):
+		HandleErrorForbidden(c, err)
+	case errors.Is(err, errors2.ErrorUserLocked):
+		HandleError(http.StatusTooManyRequests, c, err)
+	default:
+		HandleErrorInternalServerError(c, err)
+	}
+}
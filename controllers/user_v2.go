@@ -3,9 +3,11 @@ package controllers
 import (
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/user"
 	"github.com/crawlab-team/crawlab-core/utils"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
 )
 
 func PostUser(c *gin.Context) {
@@ -19,12 +21,17 @@ func PostUser(c *gin.Context) {
 		HandleErrorBadRequest(c, err)
 		return
 	}
+	if err := user.GetPasswordPolicy().Validate(payload.Password); err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
 	u := GetUserFromContextV2(c)
 	model := models.UserV2{
-		Username: payload.Username,
-		Password: utils.EncryptMd5(payload.Password),
-		Role:     payload.Role,
-		Email:    payload.Email,
+		Username:          payload.Username,
+		Password:          utils.EncryptMd5(payload.Password),
+		Role:              payload.Role,
+		Email:             payload.Email,
+		PasswordUpdatedAt: time.Now(),
 	}
 	model.SetCreated(u.Id)
 	model.SetUpdated(u.Id)
@@ -63,17 +70,18 @@ func PostUserChangePassword(c *gin.Context) {
 
 	// get user
 	u := GetUserFromContextV2(c)
-	modelSvc := service.NewModelServiceV2[models.UserV2]()
 
 	// update password
-	user, err := modelSvc.GetById(id)
+	userSvc, err := user.GetUserServiceV2()
 	if err != nil {
 		HandleErrorInternalServerError(c, err)
 		return
 	}
-	user.SetUpdated(u.Id)
-	user.Password = utils.EncryptMd5(payload.Password)
-	if err := modelSvc.ReplaceById(user.Id, *user); err != nil {
+	if err := userSvc.ChangePassword(id, payload.Password, u.Id); err != nil {
+		if isPasswordPolicyError(err) {
+			HandleErrorBadRequest(c, err)
+			return
+		}
 		HandleErrorInternalServerError(c, err)
 		return
 	}
@@ -92,10 +100,16 @@ func GetUserMe(c *gin.Context) {
 	HandleSuccessWithData(c, _u)
 }
 
+// PutUserById updates the profile of the current user, in which only
+// username and email can be changed. Role, password and other fields are
+// changed by admins or through dedicated routes.
 func PutUserById(c *gin.Context) {
 	// get payload
-	var user models.UserV2
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var payload struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
 		HandleErrorBadRequest(c, err)
 		return
 	}
@@ -111,12 +125,12 @@ func PutUserById(c *gin.Context) {
 		HandleErrorInternalServerError(c, err)
 		return
 	}
-	user.Password = userDb.Password
-	user.SetUpdated(u.Id)
-	if user.Id.IsZero() {
-		user.Id = u.Id
+	if payload.Username != "" {
+		userDb.Username = payload.Username
 	}
-	if err := modelSvc.ReplaceById(u.Id, user); err != nil {
+	userDb.Email = payload.Email
+	userDb.SetUpdated(u.Id)
+	if err := modelSvc.ReplaceById(u.Id, *userDb); err != nil {
 		HandleErrorInternalServerError(c, err)
 		return
 	}
@@ -124,3 +138,27 @@ func PutUserById(c *gin.Context) {
 	// handle success
 	HandleSuccess(c)
 }
+
+// PostUserUnlock clears failed login attempts of a user locked out
+func PostUserUnlock(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HandleErrorBadRequest(c, err)
+		return
+	}
+	u, err := service.NewModelServiceV2[models.UserV2]().GetById(id)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	if err := userSvc.UnlockUser(u.Username); err != nil {
+		HandleErrorInternalServerError(c, err)
+		return
+	}
+	HandleSuccess(c)
+}
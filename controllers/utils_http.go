@@ -35,6 +35,10 @@ func HandleErrorUnauthorized(c *gin.Context, err error) {
 	HandleError(http.StatusUnauthorized, c, err)
 }
 
+func HandleErrorForbidden(c *gin.Context, err error) {
+	HandleError(http.StatusForbidden, c, err)
+}
+
 func HandleErrorNotFound(c *gin.Context, err error) {
 	HandleError(http.StatusNotFound, c, err)
 }
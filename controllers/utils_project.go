@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/interfaces"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/project"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetProjectFilterQuery returns the query restricting resources to
+// projects of the current user (or projects the user can write to if write
+// is true) on given field, and to resources allowed by permissions, merged
+// with query
+func GetProjectFilterQuery(c *gin.Context, field string, query bson.M, write bool) (q bson.M, err error) {
+	query = GetPermissionFilterQuery(c, query)
+	filter, err := project.GetProjectServiceV2().GetFilter(GetUserFromContextV2(c), field, write)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		return query, nil
+	}
+	if len(query) == 0 {
+		return filter, nil
+	}
+	return bson.M{"$and": []bson.M{query, filter}}, nil
+}
+
+// GetPermissionFilterQuery returns query restricted to resources allowed by
+// permissions of the current user scoped to targets, as set in context by
+// middlewares.PermissionMiddlewareV2
+func GetPermissionFilterQuery(c *gin.Context, query bson.M) (q bson.M) {
+	value, ok := c.Get(constants.PermissionFilterContextKey)
+	if !ok {
+		return query
+	}
+	filter, ok := value.(bson.M)
+	if !ok {
+		return query
+	}
+	if len(query) == 0 {
+		return filter
+	}
+	return bson.M{"$and": []bson.M{query, filter}}
+}
+
+// FilterProjectWritableIds returns ids of resources the current user can
+// write to, filtered by projects on given field
+func FilterProjectWritableIds[T any](c *gin.Context, field string, ids []primitive.ObjectID) (res []primitive.ObjectID, err error) {
+	query, err := GetProjectFilterQuery(c, field, bson.M{"_id": bson.M{"$in": ids}}, true)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := service.NewModelServiceV2[T]().GetMany(query, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range docs {
+		res = append(res, any(&d).(interfaces.ModelV2).GetId())
+	}
+	return res, nil
+}
+
+// CanWriteProject returns true if the current user can write to the
+// project the model belongs to, or the model is not scoped to projects
+func CanWriteProject(c *gin.Context, model any) (ok bool, err error) {
+	u := GetUserFromContextV2(c)
+	if u == nil {
+		return true, nil
+	}
+	projectSvc := project.GetProjectServiceV2()
+	projectId, ok, err := projectSvc.GetModelProjectId(model)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return true, nil
+	}
+	return projectSvc.CanWrite(u, projectId)
+}
+
+// checkProjectWrite checks if the current user can write to the project the
+// model belongs to, and responds with error if not
+func checkProjectWrite(c *gin.Context, model any) (ok bool) {
+	ok, err := CanWriteProject(c, model)
+	if err != nil {
+		HandleErrorInternalServerError(c, err)
+		return false
+	}
+	if !ok {
+		HandleErrorForbidden(c, errors.ErrorProjectForbidden)
+		return false
+	}
+	return true
+}
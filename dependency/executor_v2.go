@@ -0,0 +1,206 @@
+package dependency
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/go-trace"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// langs whose dependencies are managed across nodes
+var langs = []string{
+	constants.DependencyLangPython,
+	constants.DependencyLangNode,
+}
+
+// patterns of dependency names and versions, which must not start with "-"
+// to be taken as options of pip or npm
+var (
+	dependencyNamePatterns = map[string]*regexp.Regexp{
+		// e.g. "requests", "scrapy-splash", "requests[socks]"
+		constants.DependencyLangPython: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*(\[[A-Za-z0-9._,-]+\])?$`),
+		// e.g. "axios", "@types/node"
+		constants.DependencyLangNode: regexp.MustCompile(`^(@[a-z0-9~][a-z0-9._~-]*/)?[a-z0-9~][a-z0-9._~-]*$`),
+	}
+	dependencyVersionPatterns = map[string]*regexp.Regexp{
+		// e.g. "2.31.0", "1.0rc1", "2.0.*"
+		constants.DependencyLangPython: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.*+!_-]*$`),
+		// e.g. "1.6.0", "^1.6.0", "latest"
+		constants.DependencyLangNode: regexp.MustCompile(`^[A-Za-z0-9^~<>=*][A-Za-z0-9.^~<>=*+_-]*$`),
+	}
+)
+
+// validateDependencies validates names and versions of dependencies, which
+// are passed to pip or npm as arguments
+func validateDependencies(lang string, deps []entity.Dependency) (err error) {
+	namePattern, ok := dependencyNamePatterns[lang]
+	if !ok {
+		return errors.ErrorDependencyInvalidLang
+	}
+	versionPattern := dependencyVersionPatterns[lang]
+	for _, d := range deps {
+		if !namePattern.MatchString(d.Name) {
+			return errors.ErrorDependencyInvalidName
+		}
+		if d.Version != "" && !versionPattern.MatchString(d.Version) {
+			return errors.ErrorDependencyInvalidVersion
+		}
+	}
+	return nil
+}
+
+// getActionCmdArgs returns the command and arguments to perform a dependency
+// action, with proxy applied as package index url (python) or registry (node).
+func getActionCmdArgs(msg *entity.DependencyTaskMessage) (name string, args []string, err error) {
+	if err := validateDependencies(msg.Lang, msg.Dependencies); err != nil {
+		return "", nil, err
+	}
+	switch msg.Lang {
+	case constants.DependencyLangPython:
+		name = "python3"
+		switch msg.Action {
+		case constants.DependencyActionInstall, constants.DependencyActionUpgrade:
+			args = []string{"-m", "pip", "install"}
+			if msg.Action == constants.DependencyActionUpgrade {
+				args = append(args, "-U")
+			}
+			if msg.Proxy != "" {
+				args = append(args, "-i", msg.Proxy)
+			}
+			for _, d := range msg.Dependencies {
+				if d.Version != "" && msg.Action == constants.DependencyActionInstall {
+					args = append(args, d.Name+"=="+d.Version)
+				} else {
+					args = append(args, d.Name)
+				}
+			}
+		case constants.DependencyActionUninstall:
+			args = []string{"-m", "pip", "uninstall", "-y"}
+			for _, d := range msg.Dependencies {
+				args = append(args, d.Name)
+			}
+		default:
+			return "", nil, errors.ErrorDependencyInvalidAction
+		}
+	case constants.DependencyLangNode:
+		name = "npm"
+		switch msg.Action {
+		case constants.DependencyActionInstall, constants.DependencyActionUpgrade:
+			args = []string{"install", "-g"}
+			if msg.Proxy != "" {
+				args = append(args, "--registry", msg.Proxy)
+			}
+			for _, d := range msg.Dependencies {
+				switch {
+				case msg.Action == constants.DependencyActionUpgrade:
+					args = append(args, d.Name+"@latest")
+				case d.Version != "":
+					args = append(args, d.Name+"@"+d.Version)
+				default:
+					args = append(args, d.Name)
+				}
+			}
+		case constants.DependencyActionUninstall:
+			args = []string{"uninstall", "-g"}
+			for _, d := range msg.Dependencies {
+				args = append(args, d.Name)
+			}
+		default:
+			return "", nil, errors.ErrorDependencyInvalidAction
+		}
+	default:
+		return "", nil, errors.ErrorDependencyInvalidLang
+	}
+	return name, args, nil
+}
+
+// runTask performs a dependency action and writes its output with logFn
+func runTask(msg *entity.DependencyTaskMessage, logFn func(lines []string)) (err error) {
+	name, args, err := getActionCmdArgs(msg)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(name, args...)
+	cmd.Env = os.Environ()
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			logFn([]string{scanner.Text()})
+		}
+	}()
+
+	logFn([]string{name + " " + strings.Join(args, " ")})
+	err = cmd.Run()
+	_ = pw.Close()
+	<-done
+	if err != nil {
+		logFn([]string{err.Error()})
+		return trace.TraceError(err)
+	}
+	return nil
+}
+
+// listDependencies returns globally installed dependencies of a language
+func listDependencies(lang string) (deps []entity.Dependency, err error) {
+	var cmd *exec.Cmd
+	switch lang {
+	case constants.DependencyLangPython:
+		cmd = exec.Command("python3", "-m", "pip", "list", "--format=json")
+	case constants.DependencyLangNode:
+		cmd = exec.Command("npm", "ls", "-g", "--depth=0", "--json")
+	default:
+		return nil, errors.ErrorDependencyInvalidLang
+	}
+	output, err := cmd.Output()
+	if err != nil && len(output) == 0 {
+		return nil, trace.TraceError(err)
+	}
+	return parseDependencyList(lang, output)
+}
+
+func parseDependencyList(lang string, output []byte) (deps []entity.Dependency, err error) {
+	switch lang {
+	case constants.DependencyLangPython:
+		// [{"name": "requests", "version": "2.31.0"}]
+		if err := json.Unmarshal(output, &deps); err != nil {
+			return nil, trace.TraceError(err)
+		}
+	case constants.DependencyLangNode:
+		// {"dependencies": {"npm": {"version": "10.2.0"}}}
+		var res struct {
+			Dependencies map[string]struct {
+				Version string `json:"version"`
+			} `json:"dependencies"`
+		}
+		if err := json.Unmarshal(output, &res); err != nil {
+			return nil, trace.TraceError(err)
+		}
+		for name, d := range res.Dependencies {
+			deps = append(deps, entity.Dependency{
+				Name:    name,
+				Version: d.Version,
+			})
+		}
+		sort.Slice(deps, func(i, j int) bool {
+			return deps[i].Name < deps[j].Name
+		})
+	default:
+		return nil, errors.ErrorDependencyInvalidLang
+	}
+	return deps, nil
+}
@@ -0,0 +1,94 @@
+package dependency
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGetActionCmdArgs(t *testing.T) {
+	deps := []entity.Dependency{{Name: "requests", Version: "2.31.0"}, {Name: "lxml"}}
+
+	name, args, err := getActionCmdArgs(&entity.DependencyTaskMessage{
+		Action:       constants.DependencyActionInstall,
+		Lang:         constants.DependencyLangPython,
+		Dependencies: deps,
+		Proxy:        "https://pypi.example.com/simple",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "python3", name)
+	require.Equal(t, []string{"-m", "pip", "install", "-i", "https://pypi.example.com/simple", "requests==2.31.0", "lxml"}, args)
+
+	_, args, err = getActionCmdArgs(&entity.DependencyTaskMessage{
+		Action:       constants.DependencyActionUpgrade,
+		Lang:         constants.DependencyLangPython,
+		Dependencies: deps,
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"-m", "pip", "install", "-U", "requests", "lxml"}, args)
+
+	name, args, err = getActionCmdArgs(&entity.DependencyTaskMessage{
+		Action:       constants.DependencyActionInstall,
+		Lang:         constants.DependencyLangNode,
+		Dependencies: []entity.Dependency{{Name: "axios", Version: "1.6.0"}},
+		Proxy:        "https://registry.example.com",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "npm", name)
+	require.Equal(t, []string{"install", "-g", "--registry", "https://registry.example.com", "axios@1.6.0"}, args)
+
+	_, args, err = getActionCmdArgs(&entity.DependencyTaskMessage{
+		Action:       constants.DependencyActionUninstall,
+		Lang:         constants.DependencyLangNode,
+		Dependencies: []entity.Dependency{{Name: "axios"}},
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"uninstall", "-g", "axios"}, args)
+
+	_, _, err = getActionCmdArgs(&entity.DependencyTaskMessage{
+		Action: constants.DependencyActionInstall,
+		Lang:   "ruby",
+	})
+	require.ErrorIs(t, err, errors.ErrorDependencyInvalidLang)
+
+	_, _, err = getActionCmdArgs(&entity.DependencyTaskMessage{
+		Action: "reinstall",
+		Lang:   constants.DependencyLangPython,
+	})
+	require.ErrorIs(t, err, errors.ErrorDependencyInvalidAction)
+
+	for _, d := range []entity.Dependency{{Name: "--index-url=https://evil.example.com"}, {Name: "-r"}, {Name: "requests", Version: "1.0 --pre"}} {
+		_, _, err = getActionCmdArgs(&entity.DependencyTaskMessage{
+			Action:       constants.DependencyActionInstall,
+			Lang:         constants.DependencyLangPython,
+			Dependencies: []entity.Dependency{d},
+		})
+		require.NotNil(t, err)
+	}
+
+	_, _, err = getActionCmdArgs(&entity.DependencyTaskMessage{
+		Action:       constants.DependencyActionInstall,
+		Lang:         constants.DependencyLangNode,
+		Dependencies: []entity.Dependency{{Name: "@types/node", Version: "^20.0.0"}, {Name: "requests[socks]"}},
+	})
+	require.ErrorIs(t, err, errors.ErrorDependencyInvalidName)
+
+	_, _, err = getActionCmdArgs(&entity.DependencyTaskMessage{
+		Action:       constants.DependencyActionUninstall,
+		Lang:         constants.DependencyLangNode,
+		Dependencies: []entity.Dependency{{Name: "--prefix=/tmp"}},
+	})
+	require.ErrorIs(t, err, errors.ErrorDependencyInvalidName)
+}
+
+func TestParseDependencyList(t *testing.T) {
+	deps, err := parseDependencyList(constants.DependencyLangPython, []byte(`[{"name": "requests", "version": "2.31.0"}]`))
+	require.Nil(t, err)
+	require.Equal(t, []entity.Dependency{{Name: "requests", Version: "2.31.0"}}, deps)
+
+	deps, err = parseDependencyList(constants.DependencyLangNode, []byte(`{"dependencies": {"yarn": {"version": "1.22.19"}, "npm": {"version": "10.2.0"}}}`))
+	require.Nil(t, err)
+	require.Equal(t, []entity.Dependency{{Name: "npm", Version: "10.2.0"}, {Name: "yarn", Version: "1.22.19"}}, deps)
+}
@@ -0,0 +1,252 @@
+package dependency
+
+import (
+	"errors"
+	log2 "github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/grpc/server"
+	"github.com/crawlab-team/crawlab-core/interfaces"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	nodeconfig "github.com/crawlab-team/crawlab-core/node/config"
+	"github.com/crawlab-team/crawlab-core/task/log"
+	"github.com/crawlab-team/go-trace"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
+	"time"
+)
+
+type ServiceV2 struct {
+	// dependencies
+	cfgSvc interfaces.NodeConfigService
+	server *server.GrpcServerV2
+
+	// settings
+	syncInterval time.Duration
+}
+
+func (svc *ServiceV2) Start() {
+	for {
+		svc.syncLocal()
+		time.Sleep(svc.syncInterval)
+	}
+}
+
+// GetList returns dependencies of a language installed on nodes, grouped by
+// name, with drift marked if versions differ between nodes or it is missing
+// on some of the nodes.
+func (svc *ServiceV2) GetList(lang string) (items []entity.DependencyListItem, err error) {
+	deps, err := service.NewModelServiceV2[models.DependencyV2]().GetMany(bson.M{"lang": lang}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// nodes that have reported dependencies
+	nodeIds := map[primitive.ObjectID]bool{}
+	itemsMap := map[string]*entity.DependencyListItem{}
+	for _, d := range deps {
+		nodeIds[d.NodeId] = true
+		item, ok := itemsMap[d.Name]
+		if !ok {
+			item = &entity.DependencyListItem{
+				Name: d.Name,
+				Lang: lang,
+			}
+			itemsMap[d.Name] = item
+		}
+		item.Nodes = append(item.Nodes, entity.DependencyNodeVersion{
+			NodeId:  d.NodeId,
+			Version: d.Version,
+		})
+	}
+
+	for _, item := range itemsMap {
+		item.Drift = len(item.Nodes) < len(nodeIds)
+		for _, n := range item.Nodes {
+			if n.Version != item.Nodes[0].Version {
+				item.Drift = true
+				break
+			}
+		}
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+
+	return items, nil
+}
+
+// Install installs or upgrades dependencies on given nodes, or all active
+// nodes if no node is given. A dependency task is created for each node.
+func (svc *ServiceV2) Install(lang string, deps []entity.Dependency, nodeIds []primitive.ObjectID, upgrade bool, userId primitive.ObjectID) (tasks []models.DependencyTaskV2, err error) {
+	action := constants.DependencyActionInstall
+	if upgrade {
+		action = constants.DependencyActionUpgrade
+	}
+	return svc.runTasks(action, lang, deps, nodeIds, userId)
+}
+
+// Uninstall uninstalls dependencies on given nodes, or all active nodes if
+// no node is given. A dependency task is created for each node.
+func (svc *ServiceV2) Uninstall(lang string, deps []entity.Dependency, nodeIds []primitive.ObjectID, userId primitive.ObjectID) (tasks []models.DependencyTaskV2, err error) {
+	return svc.runTasks(constants.DependencyActionUninstall, lang, deps, nodeIds, userId)
+}
+
+func (svc *ServiceV2) runTasks(action, lang string, deps []entity.Dependency, nodeIds []primitive.ObjectID, userId primitive.ObjectID) (tasks []models.DependencyTaskV2, err error) {
+	// validate
+	if _, _, err := getActionCmdArgs(&entity.DependencyTaskMessage{Action: action, Lang: lang, Dependencies: deps}); err != nil {
+		return nil, err
+	}
+
+	// proxy
+	proxy, err := svc.getProxy(lang)
+	if err != nil {
+		return nil, err
+	}
+
+	// nodes
+	query := bson.M{
+		"active":  true,
+		"enabled": true,
+	}
+	if len(nodeIds) > 0 {
+		query = bson.M{"_id": bson.M{"$in": nodeIds}}
+	}
+	nodes, err := service.NewModelServiceV2[models.NodeV2]().GetMany(query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range nodes {
+		t := models.DependencyTaskV2{
+			NodeId:       n.Id,
+			Lang:         lang,
+			Action:       action,
+			Dependencies: deps,
+			Status:       constants.TaskStatusPending,
+		}
+		t.SetCreated(userId)
+		t.SetUpdated(userId)
+		t.Id, err = service.NewModelServiceV2[models.DependencyTaskV2]().InsertOne(t)
+		if err != nil {
+			return nil, err
+		}
+		msg := &entity.DependencyTaskMessage{
+			TaskId:       t.Id,
+			Action:       action,
+			Lang:         lang,
+			Dependencies: deps,
+			Proxy:        proxy,
+		}
+		if n.IsMaster {
+			go svc.runLocal(n.Id, msg)
+		} else if err := svc.server.GetDependenciesServer().SendTask(n.Key, msg); err != nil {
+			if errors.Is(err, errors2.ErrorGrpcStreamNotFound) {
+				err = errors2.ErrorDependencyNodeNotConnected
+			}
+			t.Status = constants.TaskStatusError
+			t.Error = err.Error()
+			svc.updateTask(t.Id, t.Status, err)
+		}
+		tasks = append(tasks, t)
+	}
+
+	return tasks, nil
+}
+
+// getProxy returns proxy in the enabled dependency setting of a language
+func (svc *ServiceV2) getProxy(lang string) (proxy string, err error) {
+	s, err := service.NewModelServiceV2[models.DependencySettingV2]().GetOne(bson.M{"key": lang}, nil)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		return "", err
+	}
+	if !s.Enabled {
+		return "", nil
+	}
+	return s.Proxy, nil
+}
+
+// runLocal runs a dependency task on master node
+func (svc *ServiceV2) runLocal(nodeId primitive.ObjectID, msg *entity.DependencyTaskMessage) {
+	logDriver, err := log.GetFileLogDriver()
+	if err != nil {
+		trace.PrintError(err)
+		return
+	}
+	svc.updateTask(msg.TaskId, constants.TaskStatusRunning, nil)
+	err = runTask(msg, func(lines []string) {
+		_ = logDriver.WriteLines(msg.TaskId.Hex(), lines)
+	})
+	if err != nil {
+		svc.updateTask(msg.TaskId, constants.TaskStatusError, err)
+	} else {
+		svc.updateTask(msg.TaskId, constants.TaskStatusFinished, nil)
+	}
+	svc.syncLocalLang(nodeId, msg.Lang)
+}
+
+func (svc *ServiceV2) updateTask(id primitive.ObjectID, status string, e error) {
+	update := bson.M{"status": status}
+	if e != nil {
+		update["error"] = e.Error()
+	}
+	if err := service.NewModelServiceV2[models.DependencyTaskV2]().UpdateById(id, bson.M{"$set": update}); err != nil {
+		trace.PrintError(err)
+	}
+}
+
+// syncLocal syncs installed dependencies of master node
+func (svc *ServiceV2) syncLocal() {
+	n, err := service.NewModelServiceV2[models.NodeV2]().GetOne(bson.M{"key": svc.cfgSvc.GetNodeKey()}, nil)
+	if err != nil {
+		trace.PrintError(err)
+		return
+	}
+	for _, lang := range langs {
+		svc.syncLocalLang(n.Id, lang)
+	}
+}
+
+func (svc *ServiceV2) syncLocalLang(nodeId primitive.ObjectID, lang string) {
+	deps, err := listDependencies(lang)
+	if err != nil {
+		log2.Warnf("[DependencyServiceV2] failed to list %s dependencies: %v", lang, err)
+		return
+	}
+	if err := svc.server.GetDependenciesServer().SaveDependencies(nodeId, lang, deps); err != nil {
+		trace.PrintError(err)
+	}
+}
+
+func NewDependencyServiceV2() (svc *ServiceV2, err error) {
+	svc = &ServiceV2{
+		cfgSvc:       nodeconfig.GetNodeConfigService(),
+		syncInterval: 10 * time.Minute,
+	}
+	svc.server, err = server.GetGrpcServerV2()
+	if err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+var svcV2 *ServiceV2
+
+func GetDependencyServiceV2() (svc *ServiceV2, err error) {
+	if svcV2 != nil {
+		return svcV2, nil
+	}
+	svcV2, err = NewDependencyServiceV2()
+	if err != nil {
+		return nil, err
+	}
+	return svcV2, nil
+}
@@ -0,0 +1,191 @@
+package dependency
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/grpc/client"
+	"github.com/crawlab-team/crawlab-core/interfaces"
+	nodeconfig "github.com/crawlab-team/crawlab-core/node/config"
+	grpc "github.com/crawlab-team/crawlab-grpc"
+	"github.com/crawlab-team/go-trace"
+	"sync"
+	"time"
+)
+
+// WorkerServiceV2 receives dependency tasks from master through the
+// DependencyServiceV2 Install stream, performs them on the worker node,
+// reports their progress through the same stream and installed
+// dependencies back to master.
+type WorkerServiceV2 struct {
+	// dependencies
+	cfgSvc interfaces.NodeConfigService
+	client *client.GrpcClientV2
+
+	// internals
+	stream grpc.DependencyServiceV2_InstallClient
+	mu     sync.Mutex // guards sending to stream
+
+	// settings
+	syncInterval      time.Duration
+	reconnectInterval time.Duration
+}
+
+func (svc *WorkerServiceV2) Start() {
+	// start grpc client
+	if !svc.client.IsStarted() {
+		if err := svc.client.Start(); err != nil {
+			trace.PrintError(err)
+			return
+		}
+	}
+
+	// sync installed dependencies periodically
+	go func() {
+		for {
+			if svc.client.IsClosed() {
+				return
+			}
+			svc.sync()
+			time.Sleep(svc.syncInterval)
+		}
+	}()
+
+	// receive dependency tasks and reconnect if disconnected
+	for {
+		if svc.client.IsClosed() {
+			return
+		}
+		if err := svc.connect(); err != nil {
+			log.Warnf("[DependencyWorkerServiceV2] disconnected from master: %v", err)
+		}
+		time.Sleep(svc.reconnectInterval)
+	}
+}
+
+func (svc *WorkerServiceV2) connect() (err error) {
+	stream, err := svc.client.GetDependenciesClient().Install(context.Background())
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if err := stream.Send(&grpc.DependenciesServiceV2InstallRequest{
+		NodeKey: svc.cfgSvc.GetNodeKey(),
+	}); err != nil {
+		return trace.TraceError(err)
+	}
+	log.Infof("[DependencyWorkerServiceV2] connected to master")
+
+	svc.mu.Lock()
+	svc.stream = stream
+	svc.mu.Unlock()
+	defer func() {
+		svc.mu.Lock()
+		if svc.stream == stream {
+			svc.stream = nil
+		}
+		svc.mu.Unlock()
+	}()
+
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		var msg entity.DependencyTaskMessage
+		if err := json.Unmarshal(res.Data, &msg); err != nil {
+			trace.PrintError(err)
+			continue
+		}
+		go svc.run(&msg)
+	}
+}
+
+func (svc *WorkerServiceV2) run(msg *entity.DependencyTaskMessage) {
+	svc.sendProgress(&entity.DependencyTaskProgress{
+		TaskId: msg.TaskId,
+		Status: constants.TaskStatusRunning,
+	})
+	err := runTask(msg, func(lines []string) {
+		svc.sendProgress(&entity.DependencyTaskProgress{
+			TaskId: msg.TaskId,
+			Logs:   lines,
+		})
+	})
+	p := &entity.DependencyTaskProgress{
+		TaskId: msg.TaskId,
+		Status: constants.TaskStatusFinished,
+	}
+	if err != nil {
+		p.Status = constants.TaskStatusError
+		p.Error = err.Error()
+	}
+	svc.sendProgress(p)
+
+	svc.syncLang(msg.Lang)
+}
+
+// sendProgress reports the progress of a dependency task to master through
+// the Install stream, as JSON in the field proxy
+func (svc *WorkerServiceV2) sendProgress(p *entity.DependencyTaskProgress) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		trace.PrintError(err)
+		return
+	}
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if svc.stream == nil {
+		log.Warnf("[DependencyWorkerServiceV2] failed to report progress of task[%s]: disconnected from master", p.TaskId.Hex())
+		return
+	}
+	if err := svc.stream.Send(&grpc.DependenciesServiceV2InstallRequest{
+		NodeKey: svc.cfgSvc.GetNodeKey(),
+		Proxy:   string(data),
+	}); err != nil {
+		trace.PrintError(err)
+	}
+}
+
+func (svc *WorkerServiceV2) sync() {
+	for _, lang := range langs {
+		svc.syncLang(lang)
+	}
+}
+
+func (svc *WorkerServiceV2) syncLang(lang string) {
+	deps, err := listDependencies(lang)
+	if err != nil {
+		log.Warnf("[DependencyWorkerServiceV2] failed to list %s dependencies: %v", lang, err)
+		return
+	}
+	req := &grpc.DependenciesServiceV2SyncRequest{
+		NodeKey: svc.cfgSvc.GetNodeKey(),
+		Lang:    lang,
+	}
+	for _, d := range deps {
+		req.Dependencies = append(req.Dependencies, &grpc.Dependency{
+			Name:    d.Name,
+			Version: d.Version,
+		})
+	}
+	ctx, cancel := svc.client.Context()
+	defer cancel()
+	if _, err := svc.client.GetDependenciesClient().Sync(ctx, req); err != nil {
+		trace.PrintError(err)
+	}
+}
+
+func NewDependencyWorkerServiceV2() (svc *WorkerServiceV2, err error) {
+	svc = &WorkerServiceV2{
+		cfgSvc:            nodeconfig.GetNodeConfigService(),
+		syncInterval:      10 * time.Minute,
+		reconnectInterval: 5 * time.Second,
+	}
+	svc.client, err = client.GetGrpcClientV2()
+	if err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
@@ -0,0 +1,7 @@
+package entity
+
+type AuditLogDiff struct {
+	Field  string      `json:"field" bson:"field"`
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
@@ -0,0 +1,41 @@
+package entity
+
+import (
+	"time"
+)
+
+// ExternalIdentity is a user identity from an external authentication
+// source, e.g. LDAP or OpenID Connect
+type ExternalIdentity struct {
+	Source   string   `json:"source"`
+	Id       string   `json:"id"`
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Groups   []string `json:"groups"`
+}
+
+// LoginResult is the result of login, with a short-lived access token and
+// a refresh token to get a new one, or a challenge token to exchange for
+// them with a TOTP code if a second step is required
+type LoginResult struct {
+	Token             string    `json:"token,omitempty"`
+	RefreshToken      string    `json:"refresh_token,omitempty"`
+	ExpiresAt         time.Time `json:"expires_at,omitempty"`
+	TotpRequired      bool      `json:"totp_required,omitempty"`
+	TotpSetupRequired bool      `json:"totp_setup_required,omitempty"`
+	Challenge         string    `json:"challenge,omitempty"`
+}
+
+// LoginClient is the client of a login, recorded in its session
+type LoginClient struct {
+	Ip        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+}
+
+// TotpSetup is a TOTP secret to enrol in an authenticator app, with its
+// provisioning uri (to render as QR code) and recovery codes
+type TotpSetup struct {
+	Secret        string   `json:"secret"`
+	Uri           string   `json:"uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
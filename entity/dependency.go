@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type DependencyManifest struct {
+	Lang      string   `json:"lang"`       // constants.DependencyLang*
+	FileName  string   `json:"file_name"`  // manifest file name, e.g. requirements.txt
+	FilePaths []string `json:"file_paths"` // manifest and lock files found in workspace
+	Hash      string   `json:"hash"`       // hash of manifest and lock files
+}
+
+type Dependency struct {
+	Name    string `json:"name" bson:"name"`
+	Version string `json:"version" bson:"version"`
+}
+
+// DependencyTaskMessage is sent from master to a node to perform a
+// dependency action
+type DependencyTaskMessage struct {
+	TaskId       primitive.ObjectID `json:"task_id"`
+	Action       string             `json:"action"` // constants.DependencyAction*
+	Lang         string             `json:"lang"`
+	Dependencies []Dependency       `json:"dependencies"`
+	Proxy        string             `json:"proxy"` // index url or registry
+}
+
+// DependencyTaskProgress is sent from a worker to master to report the
+// progress of a dependency task, with the status once changed
+type DependencyTaskProgress struct {
+	TaskId primitive.ObjectID `json:"task_id"`
+	Status string             `json:"status,omitempty"`
+	Error  string             `json:"error,omitempty"`
+	Logs   []string           `json:"logs,omitempty"`
+}
+
+// DependencyNodeVersion is the installed version of a dependency on a node
+type DependencyNodeVersion struct {
+	NodeId  primitive.ObjectID `json:"node_id"`
+	Version string             `json:"version"`
+}
+
+// DependencyListItem is a dependency installed on one or more nodes
+type DependencyListItem struct {
+	Name  string                  `json:"name"`
+	Lang  string                  `json:"lang"`
+	Nodes []DependencyNodeVersion `json:"nodes"`
+	Drift bool                    `json:"drift"` // whether versions differ or it is missing on some nodes
+}
@@ -10,3 +10,30 @@ type GitPayload struct {
 type GitConfig struct {
 	Url string `json:"url" bson:"url"`
 }
+
+type GitWebhookEvent struct {
+	Provider   string   `json:"provider"`
+	Event      string   `json:"event"`
+	DeliveryId string   `json:"delivery_id"`
+	Urls       []string `json:"urls"`   // repository urls (web, http and ssh) found in payload
+	Ref        string   `json:"ref"`    // full ref name, e.g. refs/heads/main
+	Branch     string   `json:"branch"` // branch name, empty if ref is not a branch
+	Commit     string   `json:"commit"`
+	Signature  string   `json:"-"` // signature or token sent by the provider
+	Body       []byte   `json:"-"` // raw request body for signature verification
+}
+
+type GitDiff struct {
+	From  string        `json:"from"` // commit hash
+	To    string        `json:"to"`   // commit hash
+	Files []GitDiffFile `json:"files"`
+	Patch string        `json:"patch"` // unified diff
+}
+
+type GitDiffFile struct {
+	From      string `json:"from"` // path before change, empty if added
+	To        string `json:"to"`   // path after change, empty if deleted
+	IsBinary  bool   `json:"is_binary"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
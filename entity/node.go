@@ -1,17 +1,67 @@
 package entity
 
 type NodeInfo struct {
-	Key         string `json:"key"`
-	IsMaster    bool   `json:"is_master"`
-	Name        string `json:"name"`
-	Ip          string `json:"ip"`
-	Mac         string `json:"mac"`
-	Hostname    string `json:"hostname"`
-	Description string `json:"description"`
-	AuthKey     string `json:"auth_key"`
-	MaxRunners  int    `json:"max_runners"`
+	Key         string       `json:"key"`
+	IsMaster    bool         `json:"is_master"`
+	Name        string       `json:"name"`
+	Ip          string       `json:"ip"`
+	Mac         string       `json:"mac"`
+	Hostname    string       `json:"hostname"`
+	Description string       `json:"description"`
+	AuthKey     string       `json:"auth_key"`
+	MaxRunners  int          `json:"max_runners"`
+	Version     *NodeVersion `json:"version,omitempty"`
 }
 
 func (n NodeInfo) Value() interface{} {
 	return n
 }
+
+// NodeRegisterRequest is the data of a worker registering to masters, with
+// a certificate signing request (PEM) if mutual tls is enabled, and a join
+// token if it has not been issued a credential
+type NodeRegisterRequest struct {
+	NodeInfo
+	Csr       string `json:"csr,omitempty"`
+	Renew     bool   `json:"renew,omitempty"` // only renew the certificate of a registered worker
+	JoinToken string `json:"join_token,omitempty"`
+}
+
+// NodeCertificate is a certificate (PEM) issued to a worker with the
+// certificate of the issuing authority
+type NodeCertificate struct {
+	Certificate   string `json:"certificate,omitempty"`
+	CaCertificate string `json:"ca_certificate,omitempty"`
+}
+
+// NodeCredential is a credential issued to a worker joined with a join
+// token
+type NodeCredential struct {
+	Credential string `json:"credential,omitempty"`
+}
+
+// NodeVersion is the version and build info of a node
+type NodeVersion struct {
+	Version   string `json:"version" bson:"version"`
+	Protocol  int    `json:"protocol" bson:"protocol"`
+	Commit    string `json:"commit,omitempty" bson:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty" bson:"build_time,omitempty"`
+	GoVersion string `json:"go_version" bson:"go_version"`
+	Os        string `json:"os" bson:"os"`
+	Arch      string `json:"arch" bson:"arch"`
+}
+
+// NodeRegisterRefused is the registration response to an incompatible
+// worker, which is offered an update to become compatible
+type NodeRegisterRefused struct {
+	Update       *NodeUpdate `json:"update"`
+	Incompatible string      `json:"incompatible"` // reason of the worker being incompatible
+}
+
+// NodeUpdate is a worker binary served by masters for the platform of a
+// worker, which downloads it and verifies it by the checksum
+type NodeUpdate struct {
+	Version  string `json:"version"`
+	Checksum string `json:"checksum"` // sha256 in hex
+	Size     int64  `json:"size"`
+}
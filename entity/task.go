@@ -28,3 +28,18 @@ type StreamMessageTaskData struct {
 	Records []Result           `json:"data"`
 	Logs    []string           `json:"logs"`
 }
+
+// TaskFetchResult is the result of fetching a task by a node, with
+// decrypted secrets available to the task, which are resolved on master
+type TaskFetchResult struct {
+	TaskId  primitive.ObjectID `json:"task_id"`
+	Secrets []TaskEnvVariable  `json:"secrets"`
+}
+
+// TaskEnvVariable is a resolved environment variable of a task
+type TaskEnvVariable struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"` // scope the variable is from, e.g. "project" or "secret"
+	Secret bool   `json:"secret"` // whether the value is or references a secret
+}
@@ -0,0 +1,231 @@
+package environment
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"regexp"
+	"sort"
+)
+
+// Environment variables of a task are resolved from variables of the
+// scopes below, of which a later one overrides an earlier one of the same
+// key: global, project, spider, schedule, run options, and secrets (see
+// secret.ResolveSecrets for precedence among secrets).
+//
+// Values may reference other variables as ${NAME}, built-in variables of
+// the task (e.g. ${PROJECT_NAME}, see getBuiltinVariables) or variables of
+// the process environment if a lookup is given. "$${" escapes a literal
+// "${". Unresolved references are kept as they are.
+
+var keyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var referenceRegexp = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Sources are sources of environment variables of a task
+type Sources struct {
+	Task         *models.TaskV2
+	Spider       *models.SpiderV2
+	Project      *models.ProjectV2  // nil if the spider is not in a project
+	Schedule     *models.ScheduleV2 // nil if the task is not scheduled
+	Environments []models.EnvironmentV2
+	Secrets      []entity.TaskEnvVariable // decrypted secrets available to the task
+}
+
+// Resolve returns resolved environment variables of a task sorted by key.
+// lookup looks up variables of the process environment, e.g. os.LookupEnv,
+// and may be nil.
+func Resolve(src *Sources, lookup func(string) (string, bool)) (vars []entity.TaskEnvVariable, err error) {
+	index := map[string]int{}
+	set := func(v entity.TaskEnvVariable) {
+		if i, ok := index[v.Key]; ok {
+			vars[i] = v
+			return
+		}
+		index[v.Key] = len(vars)
+		vars = append(vars, v)
+	}
+
+	// scoped variables
+	envs := getTaskEnvironments(src)
+	sort.SliceStable(envs, func(i, j int) bool {
+		return getScopeLevel(&envs[i]) < getScopeLevel(&envs[j])
+	})
+	for _, e := range envs {
+		set(entity.TaskEnvVariable{Key: e.Key, Value: e.Value, Source: getScope(&e)})
+	}
+
+	// run options
+	if src.Task != nil {
+		var keys []string
+		for key := range src.Task.Envs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			set(entity.TaskEnvVariable{Key: key, Value: src.Task.Envs[key], Source: constants.EnvSourceRun})
+		}
+	}
+
+	// secrets
+	for _, s := range src.Secrets {
+		set(s)
+	}
+
+	interpolate(vars, getBuiltinVariables(src), lookup)
+
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Key < vars[j].Key
+	})
+	return vars, nil
+}
+
+// ValidateKey returns false if key is not a valid name of environment
+// variables
+func ValidateKey(key string) bool {
+	return keyRegexp.MatchString(key)
+}
+
+// interpolate replaces references in values of vars, and marks variables
+// referencing secrets as secret
+func interpolate(vars []entity.TaskEnvVariable, builtins map[string]string, lookup func(string) (string, bool)) {
+	index := map[string]int{}
+	for i, v := range vars {
+		index[v.Key] = i
+	}
+
+	const (
+		unresolved = iota
+		resolving
+		resolved
+	)
+	states := make([]int, len(vars))
+
+	var resolve func(i int)
+	resolve = func(i int) {
+		states[i] = resolving
+		vars[i].Value = referenceRegexp.ReplaceAllStringFunc(vars[i].Value, func(ref string) string {
+			if ref == "$${" {
+				return "${"
+			}
+			name := ref[2 : len(ref)-1]
+
+			// circular references (e.g. PATH=/opt/bin:${PATH}) fall back to
+			// built-in variables and the process environment
+			if j, ok := index[name]; ok && states[j] != resolving {
+				if states[j] == unresolved {
+					resolve(j)
+				}
+				if vars[j].Secret {
+					vars[i].Secret = true
+				}
+				return vars[j].Value
+			}
+			if value, ok := builtins[name]; ok {
+				return value
+			}
+			if lookup != nil {
+				if value, ok := lookup(name); ok {
+					return value
+				}
+			}
+			return ref
+		})
+		states[i] = resolved
+	}
+	for i := range vars {
+		if states[i] == unresolved {
+			resolve(i)
+		}
+	}
+}
+
+// getTaskEnvironments returns environment variables of scopes the task
+// belongs to
+func getTaskEnvironments(src *Sources) (envs []models.EnvironmentV2) {
+	for _, e := range src.Environments {
+		switch {
+		case !e.ScheduleId.IsZero():
+			if src.Schedule == nil || e.ScheduleId != src.Schedule.Id {
+				continue
+			}
+		case !e.SpiderId.IsZero():
+			if src.Spider == nil || e.SpiderId != src.Spider.Id {
+				continue
+			}
+		case !e.ProjectId.IsZero():
+			if src.Spider == nil || e.ProjectId != src.Spider.ProjectId {
+				continue
+			}
+		}
+		envs = append(envs, e)
+	}
+	return envs
+}
+
+func getScope(e *models.EnvironmentV2) string {
+	switch {
+	case !e.ScheduleId.IsZero():
+		return constants.EnvSourceSchedule
+	case !e.SpiderId.IsZero():
+		return constants.EnvSourceSpider
+	case !e.ProjectId.IsZero():
+		return constants.EnvSourceProject
+	default:
+		return constants.EnvSourceGlobal
+	}
+}
+
+func getScopeLevel(e *models.EnvironmentV2) int {
+	switch getScope(e) {
+	case constants.EnvSourceSchedule:
+		return 3
+	case constants.EnvSourceSpider:
+		return 2
+	case constants.EnvSourceProject:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// getBuiltinVariables returns variables of the task available in
+// references
+func getBuiltinVariables(src *Sources) (builtins map[string]string) {
+	builtins = map[string]string{}
+	if src.Task != nil {
+		builtins["TASK_ID"] = src.Task.Id.Hex()
+	}
+	if src.Spider != nil {
+		builtins["SPIDER_ID"] = src.Spider.Id.Hex()
+		builtins["SPIDER_NAME"] = src.Spider.Name
+	}
+	if src.Project != nil {
+		builtins["PROJECT_ID"] = src.Project.Id.Hex()
+		builtins["PROJECT_NAME"] = src.Project.Name
+	}
+	if src.Schedule != nil {
+		builtins["SCHEDULE_ID"] = src.Schedule.Id.Hex()
+		builtins["SCHEDULE_NAME"] = src.Schedule.Name
+	}
+	return builtins
+}
+
+// ToEnviron returns variables in the form of "KEY=value"
+func ToEnviron(vars []entity.TaskEnvVariable) (environ []string) {
+	for _, v := range vars {
+		environ = append(environ, v.Key+"="+v.Value)
+	}
+	return environ
+}
+
+// GetSecretValues returns values of secret variables, which are masked in
+// logs
+func GetSecretValues(vars []entity.TaskEnvVariable) (values []string) {
+	for _, v := range vars {
+		if v.Source == constants.EnvSourceSecret {
+			values = append(values, v.Value)
+		}
+	}
+	return values
+}
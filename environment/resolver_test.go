@@ -0,0 +1,85 @@
+package environment
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	p := &models.ProjectV2{Name: "news"}
+	p.SetId(primitive.NewObjectID())
+	s := &models.SpiderV2{Name: "headlines", ProjectId: p.Id}
+	s.SetId(primitive.NewObjectID())
+	sch := &models.ScheduleV2{Name: "daily", SpiderId: s.Id}
+	sch.SetId(primitive.NewObjectID())
+	task := &models.TaskV2{SpiderId: s.Id, ScheduleId: sch.Id, Envs: map[string]string{"E": "run"}}
+	task.SetId(primitive.NewObjectID())
+	otherId := primitive.NewObjectID()
+
+	src := &Sources{
+		Task:     task,
+		Spider:   s,
+		Project:  p,
+		Schedule: sch,
+		Environments: []models.EnvironmentV2{
+			{Key: "A", Value: "spider", SpiderId: s.Id, ProjectId: p.Id},
+			{Key: "A", Value: "global"},
+			{Key: "B", Value: "global"},
+			{Key: "B", Value: "project", ProjectId: p.Id},
+			{Key: "C", Value: "schedule", ScheduleId: sch.Id, SpiderId: s.Id, ProjectId: p.Id},
+			{Key: "C", Value: "spider", SpiderId: s.Id, ProjectId: p.Id},
+			{Key: "D", Value: "other", ProjectId: otherId},
+			{Key: "E", Value: "global"},
+			{Key: "OUTPUT", Value: "/data/${PROJECT_NAME}/${SPIDER_NAME}/${SCHEDULE_NAME}"},
+			{Key: "DB_URL", Value: "postgres://crawlab:${DB_PASSWORD}@db/${B}"},
+			{Key: "X", Value: "${Y}"},
+			{Key: "Y", Value: "${X}"},
+			{Key: "PATH", Value: "/opt/bin:${PATH}"},
+			{Key: "LITERAL", Value: "$${A} ${UNKNOWN}"},
+		},
+		Secrets: []entity.TaskEnvVariable{
+			{Key: "DB_PASSWORD", Value: "s3cr3t", Source: constants.EnvSourceSecret, Secret: true},
+		},
+	}
+	vars, err := Resolve(src, func(key string) (string, bool) {
+		if key == "PATH" {
+			return "/usr/bin", true
+		}
+		return "", false
+	})
+	require.Nil(t, err)
+
+	res := map[string]entity.TaskEnvVariable{}
+	for _, v := range vars {
+		res[v.Key] = v
+	}
+	require.Equal(t, "spider", res["A"].Value)
+	require.Equal(t, constants.EnvSourceSpider, res["A"].Source)
+	require.Equal(t, "project", res["B"].Value)
+	require.Equal(t, "schedule", res["C"].Value)
+	require.NotContains(t, res, "D")
+	require.Equal(t, "run", res["E"].Value)
+	require.Equal(t, constants.EnvSourceRun, res["E"].Source)
+	require.Equal(t, "/data/news/headlines/daily", res["OUTPUT"].Value)
+	require.Equal(t, "s3cr3t", res["DB_PASSWORD"].Value)
+	require.True(t, res["DB_PASSWORD"].Secret)
+	require.Equal(t, "postgres://crawlab:s3cr3t@db/project", res["DB_URL"].Value)
+	require.True(t, res["DB_URL"].Secret)
+	require.False(t, res["OUTPUT"].Secret)
+	require.Equal(t, "/opt/bin:/usr/bin", res["PATH"].Value)
+	require.Equal(t, "${A} ${UNKNOWN}", res["LITERAL"].Value)
+	require.Contains(t, []string{"${X}", "${Y}"}, res["X"].Value)
+	require.Equal(t, []string{"s3cr3t"}, GetSecretValues(vars))
+}
+
+func TestValidateKey(t *testing.T) {
+	require.True(t, ValidateKey("DB_URL"))
+	require.True(t, ValidateKey("_private1"))
+	require.False(t, ValidateKey("1ABC"))
+	require.False(t, ValidateKey("A-B"))
+	require.False(t, ValidateKey(""))
+}
@@ -0,0 +1,102 @@
+package environment
+
+import (
+	errors2 "errors"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/client"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/crawlab-team/go-trace"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetTaskSources returns sources of environment variables of a task of a
+// spider, from the database on master or from master on workers. Secrets
+// are given, as they are only decrypted on master.
+func GetTaskSources(t *models.TaskV2, s *models.SpiderV2, secrets []entity.TaskEnvVariable) (src *Sources, err error) {
+	src = &Sources{
+		Task:    t,
+		Spider:  s,
+		Secrets: secrets,
+	}
+
+	// project and schedule are only used for built-in variables, which are
+	// left unresolved if they are removed
+	if !s.ProjectId.IsZero() {
+		src.Project, err = getById[models.ProjectV2](s.ProjectId)
+		if err != nil {
+			trace.PrintError(err)
+		}
+	}
+	if !t.ScheduleId.IsZero() {
+		src.Schedule, err = getById[models.ScheduleV2](t.ScheduleId)
+		if err != nil {
+			trace.PrintError(err)
+		}
+	}
+
+	// all variables are fetched and filtered by scopes, as they are few
+	src.Environments, err = getMany[models.EnvironmentV2]()
+	if err != nil {
+		return nil, err
+	}
+
+	return src, nil
+}
+
+// Validate checks the key and the scope of an environment variable, and sets
+// its project and spider to those of its schedule or spider
+func Validate(e *models.EnvironmentV2) (err error) {
+	if !ValidateKey(e.Key) {
+		return errors.ErrorEnvironmentInvalidKey
+	}
+	switch {
+	case !e.ScheduleId.IsZero():
+		sch, err := service.NewModelServiceV2[models.ScheduleV2]().GetById(e.ScheduleId)
+		if err != nil {
+			return getScopeError(err)
+		}
+		e.SpiderId = sch.SpiderId
+		s, err := service.NewModelServiceV2[models.SpiderV2]().GetById(e.SpiderId)
+		if err != nil {
+			return getScopeError(err)
+		}
+		e.ProjectId = s.ProjectId
+	case !e.SpiderId.IsZero():
+		s, err := service.NewModelServiceV2[models.SpiderV2]().GetById(e.SpiderId)
+		if err != nil {
+			return getScopeError(err)
+		}
+		e.ProjectId = s.ProjectId
+	case !e.ProjectId.IsZero():
+		if _, err := service.NewModelServiceV2[models.ProjectV2]().GetById(e.ProjectId); err != nil {
+			return getScopeError(err)
+		}
+	}
+	return nil
+}
+
+func getScopeError(err error) error {
+	if errors2.Is(err, mongo.ErrNoDocuments) {
+		return errors.ErrorEnvironmentInvalidScope
+	}
+	return trace.TraceError(err)
+}
+
+func getById[T any](id primitive.ObjectID) (m *T, err error) {
+	if utils.IsMaster() {
+		return service.NewModelServiceV2[T]().GetById(id)
+	}
+	return client.NewModelServiceV2[T]().GetById(id)
+}
+
+func getMany[T any]() (res []T, err error) {
+	if utils.IsMaster() {
+		return service.NewModelServiceV2[T]().GetMany(bson.M{}, nil)
+	}
+	return client.NewModelServiceV2[T]().GetMany(nil, nil)
+}
@@ -6,24 +6,29 @@ import (
 )
 
 const (
-	ErrorPrefixController = "controller"
-	ErrorPrefixModel      = "model"
-	ErrorPrefixFilter     = "filter"
-	ErrorPrefixHttp       = "http"
-	ErrorPrefixGrpc       = "grpc"
-	ErrorPrefixNode       = "node"
-	ErrorPrefixInject     = "inject"
-	ErrorPrefixSpider     = "spider"
-	ErrorPrefixFs         = "fs"
-	ErrorPrefixTask       = "task"
-	ErrorPrefixSchedule   = "schedule"
-	ErrorPrefixUser       = "user"
-	ErrorPrefixStats      = "stats"
-	ErrorPrefixEvent      = "event"
-	ErrorPrefixProcess    = "process"
-	ErrorPrefixGit        = "git"
-	ErrorPrefixResult     = "result"
-	ErrorPrefixDataSource = "data_source"
+	ErrorPrefixController  = "controller"
+	ErrorPrefixModel       = "model"
+	ErrorPrefixFilter      = "filter"
+	ErrorPrefixHttp        = "http"
+	ErrorPrefixGrpc        = "grpc"
+	ErrorPrefixNode        = "node"
+	ErrorPrefixInject      = "inject"
+	ErrorPrefixSpider      = "spider"
+	ErrorPrefixFs          = "fs"
+	ErrorPrefixTask        = "task"
+	ErrorPrefixSchedule    = "schedule"
+	ErrorPrefixUser        = "user"
+	ErrorPrefixStats       = "stats"
+	ErrorPrefixEvent       = "event"
+	ErrorPrefixProcess     = "process"
+	ErrorPrefixGit         = "git"
+	ErrorPrefixResult      = "result"
+	ErrorPrefixDataSource  = "data_source"
+	ErrorPrefixDependency  = "dependency"
+	ErrorPrefixProject     = "project"
+	ErrorPrefixOidc        = "oidc"
+	ErrorPrefixSecret      = "secret"
+	ErrorPrefixEnvironment = "environment"
 )
 
 type ErrorPrefix string
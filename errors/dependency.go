@@ -0,0 +1,14 @@
+package errors
+
+func NewDependencyError(msg string) (err error) {
+	return NewError(ErrorPrefixDependency, msg)
+}
+
+var (
+	ErrorDependencyInvalidLang      = NewDependencyError("invalid lang")
+	ErrorDependencyInvalidAction    = NewDependencyError("invalid action")
+	ErrorDependencyInvalidName      = NewDependencyError("invalid name")
+	ErrorDependencyInvalidVersion   = NewDependencyError("invalid version")
+	ErrorDependencyNodeNotConnected = NewDependencyError("node not connected")
+	ErrorDependencyTaskNotExists    = NewDependencyError("task not exists")
+)
@@ -0,0 +1,10 @@
+package errors
+
+func NewEnvironmentError(msg string) (err error) {
+	return NewError(ErrorPrefixEnvironment, msg)
+}
+
+var (
+	ErrorEnvironmentInvalidKey   = NewEnvironmentError("invalid key")
+	ErrorEnvironmentInvalidScope = NewEnvironmentError("invalid scope")
+)
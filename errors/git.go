@@ -5,6 +5,14 @@ func NewGitError(msg string) (err error) {
 }
 
 var (
-	ErrorGitInvalidAuthType = NewGitError("invalid auth type")
-	ErrorGitNoMainBranch    = NewGitError("no main branch")
+	ErrorGitInvalidAuthType            = NewGitError("invalid auth type")
+	ErrorGitNoMainBranch               = NewGitError("no main branch")
+	ErrorGitInvalidPrivateKey          = NewGitError("invalid private key")
+	ErrorGitInvalidSshKeyType          = NewGitError("invalid ssh key type")
+	ErrorGitHostKeyMismatch            = NewGitError("host key mismatch")
+	ErrorGitCredentialInUse            = NewGitError("credential in use")
+	ErrorGitCredentialScopeMismatch    = NewGitError("credential is a deploy key of another repository")
+	ErrorGitWebhookInvalidPayload      = NewGitError("invalid webhook payload")
+	ErrorGitWebhookInvalidSignature    = NewGitError("invalid webhook signature")
+	ErrorGitWebhookNoMatchedRepository = NewGitError("no matched repository for webhook")
 )
@@ -17,4 +17,7 @@ var (
 	ErrorGrpcInvalidCode          = NewGrpcError("invalid code")
 	ErrorGrpcUnauthorized         = NewGrpcError("unauthorized")
 	ErrorGrpcInvalidNodeKey       = NewGrpcError("invalid node key")
+	ErrorGrpcCertificateRevoked   = NewGrpcError("certificate revoked")
+	ErrorGrpcInvalidCsr           = NewGrpcError("invalid certificate signing request")
+	ErrorGrpcTlsNotEnabled        = NewGrpcError("tls not enabled")
 )
@@ -12,3 +12,17 @@ var ErrorNodeInvalidCode = NewNodeError("invalid code")
 var ErrorNodeInvalidNodeKey = NewNodeError("invalid node key")
 var ErrorNodeMonitorError = NewNodeError("monitor error")
 var ErrorNodeNotExists = NewNodeError("not exists")
+var ErrorNodeInvalidSelector = NewNodeError("invalid selector")
+var ErrorNodeInvalidLabel = NewNodeError("invalid label")
+var ErrorNodeDraining = NewNodeError("draining")
+var ErrorNodeNotDraining = NewNodeError("not draining")
+var ErrorNodeInvalidJoinToken = NewNodeError("invalid join token")
+var ErrorNodeInvalidCredential = NewNodeError("invalid credential")
+var ErrorNodePendingApproval = NewNodeError("pending approval")
+var ErrorNodeNotPendingApproval = NewNodeError("not pending approval")
+var ErrorNodeIncompatibleVersion = NewNodeError("incompatible version")
+var ErrorNodeUpdateNotFound = NewNodeError("update not found")
+var ErrorNodeUpdateChecksum = NewNodeError("update checksum mismatch")
+var ErrorNodeUpdateNotSupported = NewNodeError("update not supported on this platform")
+var ErrorNodeUpdateUnchanged = NewNodeError("update unchanged")
+var ErrorNodeInvalidResourcesRange = NewNodeError("invalid resources range")
@@ -0,0 +1,13 @@
+package errors
+
+func NewOidcError(msg string) (err error) {
+	return NewError(ErrorPrefixOidc, msg)
+}
+
+var (
+	ErrorOidcNotEnabled      = NewOidcError("not enabled")
+	ErrorOidcInvalidState    = NewOidcError("invalid state")
+	ErrorOidcInvalidIdToken  = NewOidcError("invalid id token")
+	ErrorOidcInvalidResponse = NewOidcError("invalid response from provider")
+	ErrorOidcMissingClaim    = NewOidcError("missing claim")
+)
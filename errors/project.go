@@ -0,0 +1,11 @@
+package errors
+
+func NewProjectError(msg string) (err error) {
+	return NewError(ErrorPrefixProject, msg)
+}
+
+var (
+	ErrorProjectForbidden           = NewProjectError("forbidden")
+	ErrorProjectInvalidMemberRole   = NewProjectError("invalid member role")
+	ErrorProjectMemberAlreadyExists = NewProjectError("member already exists")
+)
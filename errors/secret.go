@@ -0,0 +1,12 @@
+package errors
+
+func NewSecretError(msg string) (err error) {
+	return NewError(ErrorPrefixSecret, msg)
+}
+
+var (
+	ErrorSecretInvalidKey    = NewSecretError("invalid key")
+	ErrorSecretUnknownKeyId  = NewSecretError("unknown encryption key")
+	ErrorSecretInvalidScope  = NewSecretError("invalid scope")
+	ErrorSecretAlreadyExists = NewSecretError("already exists")
+)
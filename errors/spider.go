@@ -7,4 +7,6 @@ func NewSpiderError(msg string) (err error) {
 var (
 	ErrorSpiderMissingRequiredOption = NewSpiderError("missing required option")
 	ErrorSpiderForbidden             = NewSpiderError("forbidden")
+	ErrorSpiderInvalidParamSchema    = NewSpiderError("invalid param schema")
+	ErrorSpiderInvalidParam          = NewSpiderError("invalid param")
 )
@@ -14,4 +14,24 @@ var (
 	ErrorUserMissingRequiredFields = NewUserError("missing required fields")
 	ErrorUserUnauthorized          = NewUserError("unauthorized")
 	ErrorUserInvalidPassword       = NewUserError("invalid password (length must be no less than 5)")
+	ErrorUserTokenExpired          = NewUserError("token expired")
+	ErrorUserTokenRevoked          = NewUserError("token revoked")
+	ErrorUserTokenInvalidScope     = NewUserError("invalid token scope")
+	ErrorUserTokenScopeExceeded    = NewUserError("token scopes exceed scopes of the current token")
+	ErrorUserAuthSourceConflict    = NewUserError("already exists with another auth source")
+	ErrorUserTotpRequired          = NewUserError("two-factor authentication required")
+	ErrorUserTotpSetupRequired     = NewUserError("two-factor authentication setup required")
+	ErrorUserTotpInvalidCode       = NewUserError("invalid two-factor authentication code")
+	ErrorUserTotpNotEnabled        = NewUserError("two-factor authentication not enabled")
+	ErrorUserTotpAlreadyEnabled    = NewUserError("two-factor authentication already enabled")
+	ErrorUserTotpMandatory         = NewUserError("two-factor authentication is mandatory for the role")
+	ErrorUserLocked                = NewUserError("temporarily locked due to too many failed attempts")
+	ErrorUserPasswordTooShort      = NewUserError("password too short")
+	ErrorUserPasswordTooWeak       = NewUserError("password too weak")
+	ErrorUserPasswordBreached      = NewUserError("password found in breached password list")
+	ErrorUserPasswordExpired       = NewUserError("password expired")
+	ErrorUserPasswordUnchanged     = NewUserError("new password must be different")
+	ErrorUserSessionExpired        = NewUserError("session expired")
+	ErrorUserSessionRevoked        = NewUserError("session revoked")
+	ErrorUserLdapPlaintext         = NewUserError("ldap bind over plaintext connection not allowed")
 )
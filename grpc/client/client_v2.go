@@ -11,14 +11,19 @@ import (
 	"github.com/crawlab-team/crawlab-core/grpc/middlewares"
 	"github.com/crawlab-team/crawlab-core/interfaces"
 	nodeconfig "github.com/crawlab-team/crawlab-core/node/config"
+	"github.com/crawlab-team/crawlab-core/node/credential"
+	"github.com/crawlab-team/crawlab-core/node/pki"
 	"github.com/crawlab-team/crawlab-core/utils"
 	grpc2 "github.com/crawlab-team/crawlab-grpc"
 	"github.com/crawlab-team/go-trace"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"io"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,20 +32,23 @@ type GrpcClientV2 struct {
 	nodeCfgSvc interfaces.NodeConfigService
 
 	// settings
-	address interfaces.Address
-	timeout time.Duration
+	address      interfaces.Address   // address of the connected master
+	addresses    []interfaces.Address // addresses of all masters to fail over between
+	addressIndex int
+	timeout      time.Duration
 
 	// internals
 	conn   *grpc.ClientConn
 	stream grpc2.NodeService_SubscribeClient
 	msgCh  chan *grpc2.StreamMessage
 	err    error
+	mu     sync.RWMutex // guards address, connection and clients, which are replaced on failover
 
 	// clients
-	NodeClient               grpc2.NodeServiceClient
-	TaskClient               grpc2.TaskServiceClient
-	ModelBaseServiceV2Client grpc2.ModelBaseServiceV2Client
-	DependenciesClient       grpc2.DependencyServiceV2Client
+	nodeClient               grpc2.NodeServiceClient
+	taskClient               grpc2.TaskServiceClient
+	modelBaseServiceV2Client grpc2.ModelBaseServiceV2Client
+	dependenciesClient       grpc2.DependencyServiceV2Client
 }
 
 func (c *GrpcClientV2) Init() (err error) {
@@ -56,6 +64,20 @@ func (c *GrpcClientV2) Start() (err error) {
 	// register rpc services
 	c.Register()
 
+	// a certificate is required to subscribe with mutual tls
+	if pki.IsEnabled() && !pki.GetStore().HasCertificate() {
+		if err := c.requestCertificate(); err != nil {
+			return err
+		}
+	}
+
+	// join with the join token to be issued a credential before subscribing
+	if credential.Load() == "" && viper.GetString("node.joinToken") != "" {
+		if _, err := c.register("", false); err != nil {
+			return err
+		}
+	}
+
 	// subscribe
 	if err := c.subscribe(); err != nil {
 		return err
@@ -64,17 +86,23 @@ func (c *GrpcClientV2) Start() (err error) {
 	// handle stream message
 	go c.handleStreamMessage()
 
+	// renew certificate
+	if pki.IsEnabled() {
+		go c.renewCertificate()
+	}
+
 	return nil
 }
 
 func (c *GrpcClientV2) Stop() (err error) {
 	// skip if connection is nil
-	if c.conn == nil {
+	conn := c.getConn()
+	if conn == nil {
 		return nil
 	}
 
 	// grpc server address
-	address := c.address.String()
+	address := c.getAddress().String()
 
 	// unsubscribe
 	if err := c.unsubscribe(); err != nil {
@@ -83,7 +111,7 @@ func (c *GrpcClientV2) Stop() (err error) {
 	log.Infof("grpc client unsubscribed from %s", address)
 
 	// close connection
-	if err := c.conn.Close(); err != nil {
+	if err := conn.Close(); err != nil {
 		return err
 	}
 	log.Infof("grpc client disconnected from %s", address)
@@ -92,15 +120,39 @@ func (c *GrpcClientV2) Stop() (err error) {
 }
 
 func (c *GrpcClientV2) Register() {
-	c.NodeClient = grpc2.NewNodeServiceClient(c.conn)
-	c.ModelBaseServiceV2Client = grpc2.NewModelBaseServiceV2Client(c.conn)
-	c.TaskClient = grpc2.NewTaskServiceClient(c.conn)
-	c.DependenciesClient = grpc2.NewDependencyServiceV2Client(c.conn)
+	c.mu.Lock()
+	c.nodeClient = grpc2.NewNodeServiceClient(c.conn)
+	c.modelBaseServiceV2Client = grpc2.NewModelBaseServiceV2Client(c.conn)
+	c.taskClient = grpc2.NewTaskServiceClient(c.conn)
+	c.dependenciesClient = grpc2.NewDependencyServiceV2Client(c.conn)
+	c.mu.Unlock()
 
 	// log
 	log.Infof("[GrpcClient] grpc client registered client services")
-	log.Debugf("[GrpcClient] NodeClient: %v", c.NodeClient)
-	log.Debugf("[GrpcClient] ModelBaseServiceV2Client: %v", c.ModelBaseServiceV2Client)
+}
+
+func (c *GrpcClientV2) GetNodeClient() grpc2.NodeServiceClient {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nodeClient
+}
+
+func (c *GrpcClientV2) GetTaskClient() grpc2.TaskServiceClient {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.taskClient
+}
+
+func (c *GrpcClientV2) GetModelBaseServiceV2Client() grpc2.ModelBaseServiceV2Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.modelBaseServiceV2Client
+}
+
+func (c *GrpcClientV2) GetDependenciesClient() grpc2.DependencyServiceV2Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.dependenciesClient
 }
 
 func (c *GrpcClientV2) Context() (ctx context.Context, cancel context.CancelFunc) {
@@ -115,16 +167,28 @@ func (c *GrpcClientV2) NewRequest(d interface{}) (req *grpc2.Request) {
 }
 
 func (c *GrpcClientV2) IsStarted() (res bool) {
-	return c.conn != nil
+	return c.getConn() != nil
 }
 
 func (c *GrpcClientV2) IsClosed() (res bool) {
-	if c.conn != nil {
-		return c.conn.GetState() == connectivity.Shutdown
+	if conn := c.getConn(); conn != nil {
+		return conn.GetState() == connectivity.Shutdown
 	}
 	return false
 }
 
+func (c *GrpcClientV2) getConn() (conn *grpc.ClientConn) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
+}
+
+func (c *GrpcClientV2) getAddress() (address interfaces.Address) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.address
+}
+
 func (c *GrpcClientV2) GetMessageChannel() (msgCh chan *grpc2.StreamMessage) {
 	return c.msgCh
 }
@@ -151,16 +215,18 @@ func (c *GrpcClientV2) unsubscribe() (err error) {
 		Key:      c.nodeCfgSvc.GetNodeKey(),
 		IsMaster: false,
 	})
-	if _, err = c.NodeClient.Unsubscribe(context.Background(), req); err != nil {
+	if _, err = c.GetNodeClient().Unsubscribe(context.Background(), req); err != nil {
 		return trace.TraceError(err)
 	}
 	return nil
 }
 
+// connect connects to a master, trying the addresses in turn until one of
+// them is connected
 func (c *GrpcClientV2) connect() (err error) {
 	op := func() error {
 		// grpc server address
-		address := c.address.String()
+		address := c.getAddress().String()
 
 		// timeout context
 		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
@@ -169,15 +235,27 @@ func (c *GrpcClientV2) connect() (err error) {
 		// connection
 		// TODO: configure dial options
 		var opts []grpc.DialOption
-		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if pki.IsEnabled() {
+			tlsCfg, err := pki.GetStore().GetClientTLSConfig()
+			if err != nil {
+				return err
+			}
+			opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
+		} else {
+			opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		}
 		opts = append(opts, grpc.WithBlock())
 		opts = append(opts, grpc.WithChainUnaryInterceptor(middlewares.GetAuthTokenUnaryChainInterceptor(c.nodeCfgSvc)))
 		opts = append(opts, grpc.WithChainStreamInterceptor(middlewares.GetAuthTokenStreamChainInterceptor(c.nodeCfgSvc)))
-		c.conn, err = grpc.DialContext(ctx, address, opts...)
+		conn, err := grpc.DialContext(ctx, address, opts...)
 		if err != nil {
 			_ = trace.TraceError(err)
+			c.nextAddress()
 			return errors.ErrorGrpcClientFailedToStart
 		}
+		c.mu.Lock()
+		c.conn = conn
+		c.mu.Unlock()
 		log.Infof("[GrpcClient] grpc client connected to %s", address)
 
 		return nil
@@ -185,13 +263,170 @@ func (c *GrpcClientV2) connect() (err error) {
 	return backoff.RetryNotify(op, backoff.NewExponentialBackOff(), utils.BackoffErrorNotify("grpc client connect"))
 }
 
+// nextAddress switches to the address of the next master
+func (c *GrpcClientV2) nextAddress() {
+	if len(c.addresses) < 2 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addressIndex = (c.addressIndex + 1) % len(c.addresses)
+	c.address = c.addresses[c.addressIndex]
+}
+
+// failover connects to the next master if the connection to the current
+// master is lost. It returns false if there is no other master.
+func (c *GrpcClientV2) failover() (ok bool) {
+	if len(c.addresses) < 2 || c.getConn().GetState() == connectivity.Ready {
+		return false
+	}
+	log.Warnf("[GrpcClient] lost connection to %s, failing over", c.getAddress().String())
+
+	c.nextAddress()
+	if err := c.reconnect(); err != nil {
+		trace.PrintError(err)
+		return false
+	}
+	return true
+}
+
+// requestCertificate registers the worker with a certificate signing
+// request, and reconnects with the issued certificate
+func (c *GrpcClientV2) requestCertificate() (err error) {
+	certRenewMu.Lock()
+	defer certRenewMu.Unlock()
+	store := pki.GetStore()
+	if store.HasCertificate() {
+		return c.reconnect()
+	}
+
+	csr, err := store.NewCertificateRequest(c.nodeCfgSvc.GetNodeKey())
+	if err != nil {
+		return err
+	}
+	res, err := c.register(csr, false)
+	if err != nil {
+		return err
+	}
+	if err := c.saveCertificate(res); err != nil {
+		return err
+	}
+	log.Infof("[GrpcClient] grpc client is issued a certificate")
+
+	// reconnect with the certificate, as the current connection is
+	// established without it
+	return c.reconnect()
+}
+
+// renewCertificate renews the certificate of the worker once two thirds of
+// its validity has passed. New connections use the renewed certificate.
+func (c *GrpcClientV2) renewCertificate() {
+	for {
+		if c.IsClosed() {
+			return
+		}
+
+		if err := c.renewCertificateOnce(); err != nil {
+			trace.PrintError(err)
+		}
+
+		time.Sleep(certRenewInterval)
+	}
+}
+
+func (c *GrpcClientV2) renewCertificateOnce() (err error) {
+	certRenewMu.Lock()
+	defer certRenewMu.Unlock()
+	store := pki.GetStore()
+	if !store.NeedsRenewal() {
+		return nil
+	}
+
+	csr, err := store.NewCertificateRequest(c.nodeCfgSvc.GetNodeKey())
+	if err != nil {
+		return err
+	}
+	res, err := c.register(csr, true)
+	if err != nil {
+		return err
+	}
+	if err := c.saveCertificate(res); err != nil {
+		return err
+	}
+	log.Infof("[GrpcClient] grpc client renewed its certificate")
+	return nil
+}
+
+// register registers the worker with a certificate signing request, and
+// with the join token if it has not been issued a credential, in which case
+// the issued credential is saved
+func (c *GrpcClientV2) register(csr string, renew bool) (res *grpc2.Response, err error) {
+	info, _ := c.nodeCfgSvc.GetBasicNodeInfo().(*entity.NodeInfo)
+	if info == nil || renew {
+		info = &entity.NodeInfo{Key: c.nodeCfgSvc.GetNodeKey()}
+	}
+	req := &entity.NodeRegisterRequest{
+		NodeInfo: *info,
+		Csr:      csr,
+		Renew:    renew,
+	}
+	if credential.Load() == "" {
+		req.JoinToken = viper.GetString("node.joinToken")
+	}
+	ctx, cancel := c.Context()
+	defer cancel()
+	res, err = c.GetNodeClient().Register(ctx, c.NewRequest(req))
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// credential
+	var cred entity.NodeCredential
+	if err := json.Unmarshal(res.Data, &cred); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if cred.Credential != "" {
+		if err := credential.Save(cred.Credential); err != nil {
+			return nil, err
+		}
+		log.Infof("[GrpcClient] grpc client is issued a credential")
+	}
+	return res, nil
+}
+
+func (c *GrpcClientV2) saveCertificate(res *grpc2.Response) (err error) {
+	var cert entity.NodeCertificate
+	if err := json.Unmarshal(res.Data, &cert); err != nil {
+		return trace.TraceError(err)
+	}
+	if cert.Certificate == "" {
+		return trace.TraceError(errors.ErrorGrpcInvalidCsr)
+	}
+	return pki.GetStore().SaveCertificate(cert.Certificate, cert.CaCertificate)
+}
+
+// reconnect replaces the connection with a new one. Rpc services are
+// registered on the new connection before closing the previous one, so that
+// the client is not regarded as closed.
+func (c *GrpcClientV2) reconnect() (err error) {
+	prev := c.getConn()
+	if err := c.connect(); err != nil {
+		return err
+	}
+	c.Register()
+	if prev != nil {
+		_ = prev.Close()
+	}
+	return nil
+}
+
 func (c *GrpcClientV2) subscribe() (err error) {
 	op := func() error {
 		req := c.NewRequest(&entity.NodeInfo{
 			Key:      c.nodeCfgSvc.GetNodeKey(),
 			IsMaster: false,
 		})
-		c.stream, err = c.NodeClient.Subscribe(context.Background(), req)
+		c.stream, err = c.GetNodeClient().Subscribe(context.Background(), req)
 		if err != nil {
 			return trace.TraceError(err)
 		}
@@ -235,6 +470,7 @@ func (c *GrpcClientV2) handleStreamMessage() {
 
 			// error
 			trace.PrintError(err)
+			c.failover()
 			c.stream = nil
 			time.Sleep(1 * time.Second)
 			continue
@@ -259,11 +495,21 @@ func NewGrpcClientV2() (c *GrpcClientV2, err error) {
 	}
 	client.nodeCfgSvc = nodeconfig.GetNodeConfigService()
 
-	if viper.GetString("grpc.address") != "" {
-		client.address, err = entity.NewAddressFromString(viper.GetString("grpc.address"))
+	// addresses of masters, from "grpc.addresses" or comma-separated
+	// "grpc.address"
+	addresses := viper.GetStringSlice("grpc.addresses")
+	if len(addresses) == 0 && viper.GetString("grpc.address") != "" {
+		addresses = strings.Split(viper.GetString("grpc.address"), ",")
+	}
+	for _, a := range addresses {
+		address, err := entity.NewAddressFromString(strings.TrimSpace(a))
 		if err != nil {
 			return nil, trace.TraceError(err)
 		}
+		client.addresses = append(client.addresses, address)
+	}
+	if len(client.addresses) > 0 {
+		client.address = client.addresses[0]
 	}
 
 	if err := client.Init(); err != nil {
@@ -273,6 +519,12 @@ func NewGrpcClientV2() (c *GrpcClientV2, err error) {
 	return client, nil
 }
 
+// certRenewMu prevents clients of the same worker from requesting
+// certificates concurrently
+var certRenewMu sync.Mutex
+
+const certRenewInterval = 1 * time.Hour
+
 var _clientV2 *GrpcClientV2
 
 func GetGrpcClientV2() (client *GrpcClientV2, err error) {
@@ -5,6 +5,7 @@ import (
 	"github.com/crawlab-team/crawlab-core/constants"
 	"github.com/crawlab-team/crawlab-core/errors"
 	"github.com/crawlab-team/crawlab-core/interfaces"
+	"github.com/crawlab-team/crawlab-core/node/credential"
 	"github.com/grpc-ecosystem/go-grpc-middleware/auth"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
@@ -39,24 +40,20 @@ func GetAuthTokenFunc(nodeCfgSvc interfaces.NodeConfigService) grpc_auth.AuthFun
 }
 
 func GetAuthTokenUnaryChainInterceptor(nodeCfgSvc interfaces.NodeConfigService) grpc.UnaryClientInterceptor {
-	// set auth key
-	md := metadata.Pairs(constants.GrpcHeaderAuthorization, nodeCfgSvc.GetAuthKey())
 	//header := metadata.MD{}
 	//header[constants.GrpcHeaderAuthorization] = []string{nodeCfgSvc.GetAuthKey()}
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		ctx = metadata.NewOutgoingContext(context.Background(), md)
+		ctx = metadata.NewOutgoingContext(context.Background(), getOutgoingMetadata(nodeCfgSvc))
 		//opts = append(opts, grpc.Header(&header))
 		return invoker(ctx, method, req, reply, cc, opts...)
 	}
 }
 
 func GetAuthTokenStreamChainInterceptor(nodeCfgSvc interfaces.NodeConfigService) grpc.StreamClientInterceptor {
-	// set auth key
-	md := metadata.Pairs(constants.GrpcHeaderAuthorization, nodeCfgSvc.GetAuthKey())
 	//header := metadata.MD{}
 	//header[constants.GrpcHeaderAuthorization] = []string{nodeCfgSvc.GetAuthKey()}
 	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
-		ctx = metadata.NewOutgoingContext(context.Background(), md)
+		ctx = metadata.NewOutgoingContext(context.Background(), getOutgoingMetadata(nodeCfgSvc))
 		//opts = append(opts, grpc.Header(&header))
 		s, err := streamer(ctx, desc, cc, method, opts...)
 		if err != nil {
@@ -65,3 +62,14 @@ func GetAuthTokenStreamChainInterceptor(nodeCfgSvc interfaces.NodeConfigService)
 		return s, nil
 	}
 }
+
+// getOutgoingMetadata returns headers of requests with the auth key, and the
+// node key and credential once the worker has joined
+func getOutgoingMetadata(nodeCfgSvc interfaces.NodeConfigService) (md metadata.MD) {
+	md = metadata.Pairs(constants.GrpcHeaderAuthorization, nodeCfgSvc.GetAuthKey())
+	if c := credential.Load(); c != "" {
+		md.Set(constants.GrpcHeaderNodeKey, nodeCfgSvc.GetNodeKey())
+		md.Set(constants.GrpcHeaderNodeCredential, c)
+	}
+	return md
+}
@@ -0,0 +1,84 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/node/credential"
+	"google.golang.org/grpc"
+	"strings"
+)
+
+// GetNodeCredentialUnaryServerInterceptor returns an interceptor which
+// authenticates requests with node credentials if required, and takes the
+// node key of requests from them
+func GetNodeCredentialUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !credential.IsRequired() {
+			return handler(ctx, req)
+		}
+		nodeKey, err := checkNodeCredential(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		if nodeKey != "" {
+			if err := setNodeKey(req, nodeKey); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// GetNodeCredentialStreamServerInterceptor returns an interceptor which
+// authenticates stream requests with node credentials if required, and
+// closes the stream once the credential is revoked
+func GetNodeCredentialStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !credential.IsRequired() {
+			return handler(srv, ss)
+		}
+		nodeKey, err := checkNodeCredential(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handleCheckedStream(srv, &nodeCredentialServerStream{ServerStream: ss, nodeKey: nodeKey}, handler, func() error {
+			_, err := checkNodeCredential(ss.Context(), info.FullMethod)
+			return err
+		})
+	}
+}
+
+type nodeCredentialServerStream struct {
+	grpc.ServerStream
+	nodeKey string
+}
+
+func (s *nodeCredentialServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return setNodeKey(m, s.nodeKey)
+}
+
+// checkNodeCredential verifies the node credential in the headers, and
+// returns the node key. Workers may register without credentials to join
+// with join tokens, and nodes pending approval may only call the node
+// service and fetch (no) tasks.
+func checkNodeCredential(ctx context.Context, method string) (nodeKey string, err error) {
+	nodeKey, c := credential.FromIncomingContext(ctx)
+	if c == "" && method == methodRegister {
+		return "", nil
+	}
+	status, err := credential.GetNodeCredentialServiceV2().Verify(nodeKey, c)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errors.ErrorGrpcUnauthorized, err)
+	}
+	if status == constants.NodeStatusPendingApproval &&
+		!strings.HasPrefix(method, "/grpc.NodeService/") &&
+		method != "/grpc.TaskService/Fetch" {
+		return "", errors.ErrorNodePendingApproval
+	}
+	return nodeKey, nil
+}
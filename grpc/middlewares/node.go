@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"context"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"sync/atomic"
+	"time"
+)
+
+// streamCheckInterval is the interval of re-checking the identity of nodes
+// of open streams, with which streams of revoked nodes are closed
+const streamCheckInterval = 10 * time.Second
+
+// getNodeKeyField returns the node key field of a request, which is any
+// message with a string field "node_key"
+func getNodeKeyField(req interface{}) (m protoreflect.Message, fd protoreflect.FieldDescriptor, ok bool) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil, nil, false
+	}
+	m = msg.ProtoReflect()
+	fd = m.Descriptor().Fields().ByName("node_key")
+	if fd == nil || fd.Kind() != protoreflect.StringKind || fd.IsList() {
+		return nil, nil, false
+	}
+	return m, fd, true
+}
+
+// setNodeKey sets the authenticated node key of a request, which must not
+// assert another node
+func setNodeKey(req interface{}, nodeKey string) (err error) {
+	m, fd, ok := getNodeKeyField(req)
+	if !ok {
+		return nil
+	}
+	if v := m.Get(fd).String(); v != "" && v != nodeKey {
+		return errors.ErrorGrpcInvalidNodeKey
+	}
+	m.Set(fd, protoreflect.ValueOfString(nodeKey))
+	return nil
+}
+
+// handleCheckedStream handles a stream, and closes it once the check of the
+// node identity fails, e.g. after the node is revoked
+func handleCheckedStream(srv interface{}, ss grpc.ServerStream, handler grpc.StreamHandler, check func() error) error {
+	ctx, cancel := context.WithCancel(ss.Context())
+	defer cancel()
+	cs := &checkedServerStream{ServerStream: ss, ctx: ctx}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- handler(srv, cs)
+	}()
+
+	ticker := time.NewTicker(streamCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+			if err := check(); err != nil {
+				// the handler returns once its context is cancelled or its
+				// next receive or send fails, which is waited for as the
+				// stream must not be used after returning
+				cs.closed.Store(true)
+				cancel()
+				<-done
+				return errors.ErrorGrpcUnauthorized
+			}
+		}
+	}
+}
+
+type checkedServerStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	closed atomic.Bool
+}
+
+func (s *checkedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *checkedServerStream) RecvMsg(m interface{}) error {
+	if s.closed.Load() {
+		return errors.ErrorGrpcUnauthorized
+	}
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	// closed while receiving
+	if s.closed.Load() {
+		return errors.ErrorGrpcUnauthorized
+	}
+	return nil
+}
+
+func (s *checkedServerStream) SendMsg(m interface{}) error {
+	if s.closed.Load() {
+		return errors.ErrorGrpcUnauthorized
+	}
+	return s.ServerStream.SendMsg(m)
+}
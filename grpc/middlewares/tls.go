@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"context"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/node/pki"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// methodRegister is the only method allowed without a client certificate,
+// with which workers are issued certificates
+const methodRegister = "/grpc.NodeService/Register"
+
+// GetNodeIdentityUnaryServerInterceptor returns an interceptor which takes
+// the node key of requests from the client certificate
+func GetNodeIdentityUnaryServerInterceptor(ca *pki.CA) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		nodeKey, ok, err := ca.GetPeerNodeKey(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if info.FullMethod != methodRegister {
+				return nil, errors.ErrorGrpcUnauthorized
+			}
+			return handler(ctx, req)
+		}
+		if r, fd, ok := getNodeKeyField(req); ok {
+			r.Set(fd, protoreflect.ValueOfString(nodeKey))
+		}
+		return handler(ctx, req)
+	}
+}
+
+// GetNodeIdentityStreamServerInterceptor returns an interceptor which takes
+// the node key of stream requests from the client certificate, and closes
+// the stream once the certificate is revoked
+func GetNodeIdentityStreamServerInterceptor(ca *pki.CA) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		nodeKey, ok, err := ca.GetPeerNodeKey(ss.Context())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.ErrorGrpcUnauthorized
+		}
+		return handleCheckedStream(srv, &nodeIdentityServerStream{ServerStream: ss, nodeKey: nodeKey}, handler, func() error {
+			_, _, err := ca.GetPeerNodeKey(ss.Context())
+			return err
+		})
+	}
+}
+
+type nodeIdentityServerStream struct {
+	grpc.ServerStream
+	nodeKey string
+}
+
+func (s *nodeIdentityServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if r, fd, ok := getNodeKeyField(m); ok {
+		r.Set(fd, protoreflect.ValueOfString(s.nodeKey))
+	}
+	return nil
+}
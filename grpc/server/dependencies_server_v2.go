@@ -2,31 +2,215 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/entity"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	log2 "github.com/crawlab-team/crawlab-core/task/log"
 	grpc "github.com/crawlab-team/crawlab-grpc"
+	"github.com/crawlab-team/go-trace"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+)
+
+var (
+	dependencyStreamsV2      = map[string]grpc.DependencyServiceV2_InstallServer{}
+	mutexDependencyStreamsV2 = &sync.Mutex{}
 )
 
 type DependenciesServerV2 struct {
 	grpc.UnimplementedDependencyServiceV2Server
 }
 
+// Connect from worker to master to check if dependency service is available
 func (svr DependenciesServerV2) Connect(stream grpc.DependencyServiceV2_ConnectServer) (err error) {
-	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			res, _ := HandleSuccess()
+			return stream.SendAndClose(res)
+		}
+		if err != nil {
+			return err
+		}
+	}
 }
 
+// Sync installed dependencies of a language from worker to master
 func (svr DependenciesServerV2) Sync(ctx context.Context, request *grpc.DependenciesServiceV2SyncRequest) (response *grpc.Response, err error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Sync not implemented")
+	n, err := service.NewModelServiceV2[models.NodeV2]().GetOne(bson.M{"key": request.NodeKey}, nil)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return HandleError(errors2.ErrorNodeNotExists)
+		}
+		return HandleError(err)
+	}
+	var deps []entity.Dependency
+	for _, d := range request.Dependencies {
+		deps = append(deps, entity.Dependency{
+			Name:    d.Name,
+			Version: d.Version,
+		})
+	}
+	if err := svr.SaveDependencies(n.Id, request.Lang, deps); err != nil {
+		return HandleError(err)
+	}
+	return HandleSuccess()
 }
 
+// Install is a long-lived stream opened by a worker, through which master
+// sends dependency tasks (constants.DependencyAction*) to the worker, and
+// the worker reports the progress of the tasks. The first message from the
+// worker only carries its node key, and the following messages carry the
+// progress (entity.DependencyTaskProgress) as JSON in the field proxy, as
+// the request has no field of raw data.
 func (svr DependenciesServerV2) Install(stream grpc.DependencyServiceV2_InstallServer) (err error) {
-	return status.Errorf(codes.Unimplemented, "method Install not implemented")
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	nodeKey := req.NodeKey
+	if nodeKey == "" {
+		return errors2.ErrorGrpcInvalidNodeKey
+	}
+	n, err := service.NewModelServiceV2[models.NodeV2]().GetOne(bson.M{"key": nodeKey}, nil)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return errors2.ErrorNodeNotExists
+		}
+		return trace.TraceError(err)
+	}
+
+	mutexDependencyStreamsV2.Lock()
+	dependencyStreamsV2[nodeKey] = stream
+	mutexDependencyStreamsV2.Unlock()
+	log.Infof("[DependenciesServerV2] node[%s] connected", nodeKey)
+
+	defer func() {
+		mutexDependencyStreamsV2.Lock()
+		if dependencyStreamsV2[nodeKey] == stream {
+			delete(dependencyStreamsV2, nodeKey)
+		}
+		mutexDependencyStreamsV2.Unlock()
+		log.Infof("[DependenciesServerV2] node[%s] disconnected", nodeKey)
+	}()
+
+	// receive progress until worker disconnects
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := svr.handleInstallProgress(n.Id, req); err != nil {
+			log.Errorf("[DependenciesServerV2] failed to handle progress from node[%s]: %v", nodeKey, err)
+		}
+	}
+}
+
+// handleInstallProgress writes the logs and updates the status of a
+// dependency task reported by the node it was sent to
+func (svr DependenciesServerV2) handleInstallProgress(nodeId primitive.ObjectID, req *grpc.DependenciesServiceV2InstallRequest) (err error) {
+	if req.Proxy == "" {
+		return nil
+	}
+	var p entity.DependencyTaskProgress
+	if err := json.Unmarshal([]byte(req.Proxy), &p); err != nil {
+		return trace.TraceError(err)
+	}
+	modelSvc := service.NewModelServiceV2[models.DependencyTaskV2]()
+	t, err := modelSvc.GetById(p.TaskId)
+	if err != nil {
+		return err
+	}
+	if t.NodeId != nodeId {
+		return errors2.ErrorDependencyTaskNotExists
+	}
+	if len(p.Logs) > 0 {
+		logDriver, err := log2.GetFileLogDriver()
+		if err != nil {
+			return err
+		}
+		if err := logDriver.WriteLines(t.Id.Hex(), p.Logs); err != nil {
+			return err
+		}
+	}
+	if p.Status != "" {
+		update := bson.M{"status": p.Status}
+		if p.Error != "" {
+			update["error"] = p.Error
+		}
+		if err := modelSvc.UpdateById(t.Id, bson.M{"$set": update}); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+	return nil
 }
 
 func (svr DependenciesServerV2) UninstallDependencies(stream grpc.DependencyServiceV2_UninstallDependenciesServer) (err error) {
+	// uninstall tasks are sent through Install stream
 	return status.Errorf(codes.Unimplemented, "method UninstallDependencies not implemented")
 }
 
+// SendTask sends a dependency task to a connected worker
+func (svr DependenciesServerV2) SendTask(nodeKey string, msg *entity.DependencyTaskMessage) (err error) {
+	mutexDependencyStreamsV2.Lock()
+	stream, ok := dependencyStreamsV2[nodeKey]
+	mutexDependencyStreamsV2.Unlock()
+	if !ok {
+		return errors2.ErrorGrpcStreamNotFound
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	res, _ := HandleSuccessWithData(data)
+	mutexDependencyStreamsV2.Lock()
+	defer mutexDependencyStreamsV2.Unlock()
+	if err := stream.Send(res); err != nil {
+		return trace.TraceError(err)
+	}
+	return nil
+}
+
+// SaveDependencies replaces installed dependencies of a language on a node
+func (svr DependenciesServerV2) SaveDependencies(nodeId primitive.ObjectID, lang string, deps []entity.Dependency) (err error) {
+	modelSvc := service.NewModelServiceV2[models.DependencyV2]()
+	if err := modelSvc.DeleteMany(bson.M{"node_id": nodeId, "lang": lang}); err != nil {
+		return err
+	}
+	if len(deps) == 0 {
+		return nil
+	}
+	var docs []models.DependencyV2
+	for _, d := range deps {
+		doc := models.DependencyV2{
+			NodeId:  nodeId,
+			Lang:    lang,
+			Name:    d.Name,
+			Version: d.Version,
+		}
+		doc.SetId(primitive.NewObjectID())
+		doc.SetCreated(primitive.NilObjectID)
+		doc.SetUpdated(primitive.NilObjectID)
+		docs = append(docs, doc)
+	}
+	if _, err := modelSvc.InsertMany(docs); err != nil {
+		return err
+	}
+	return nil
+}
+
 func NewDependenciesServerV2() *DependenciesServerV2 {
 	return &DependenciesServerV2{}
 }
@@ -20,6 +20,8 @@ var (
 		*new(models.DataCollectionV2),
 		*new(models.DataSourceV2),
 		*new(models.DependencySettingV2),
+		*new(models.DependencyTaskV2),
+		*new(models.DependencyV2),
 		*new(models.EnvironmentV2),
 		*new(models.GitV2),
 		*new(models.NodeV2),
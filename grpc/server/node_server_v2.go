@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/apex/log"
 	"github.com/crawlab-team/crawlab-core/constants"
 	"github.com/crawlab-team/crawlab-core/entity"
@@ -11,6 +12,10 @@ import (
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/models/service"
 	nodeconfig "github.com/crawlab-team/crawlab-core/node/config"
+	"github.com/crawlab-team/crawlab-core/node/credential"
+	"github.com/crawlab-team/crawlab-core/node/pki"
+	"github.com/crawlab-team/crawlab-core/node/resource"
+	"github.com/crawlab-team/crawlab-core/node/version"
 	"github.com/crawlab-team/crawlab-grpc"
 	errors2 "github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
@@ -33,10 +38,14 @@ type NodeServerV2 struct {
 func (svr NodeServerV2) Register(ctx context.Context, req *grpc.Request) (res *grpc.Response, err error) {
 	// unmarshall data
 	var node models.NodeV2
+	var registerReq entity.NodeRegisterRequest
 	if req.Data != nil {
 		if err := json.Unmarshal(req.Data, &node); err != nil {
 			return HandleError(err)
 		}
+		if err := json.Unmarshal(req.Data, &registerReq); err != nil {
+			return HandleError(err)
+		}
 
 		if node.IsMaster {
 			// error: cannot register master node
@@ -55,27 +64,97 @@ func (svr NodeServerV2) Register(ctx context.Context, req *grpc.Request) (res *g
 		return HandleError(errors.ErrorModelMissingRequiredData)
 	}
 
+	// credential
+	var joinToken *models.JoinTokenV2
+	if credential.IsRequired() {
+		joinToken, err = svr.checkRegisterCredential(ctx, nodeKey, registerReq.JoinToken)
+		if err != nil {
+			return HandleError(err)
+		}
+	}
+	requireApproval := joinToken != nil && (credential.IsApprovalRequired() || joinToken.RequireApproval)
+
+	// certificate
+	if pki.IsEnabled() {
+		// renew the certificate of a registered worker
+		if registerReq.Renew {
+			return svr.renewCertificate(ctx, nodeKey, registerReq.Csr)
+		}
+		if err := svr.checkRegisterCertificate(ctx, nodeKey, registerReq.Csr); err != nil {
+			return HandleError(err)
+		}
+	}
+
+	// version. Incompatible workers are not registered but told the update
+	// if any, which is the only way for them to become compatible.
+	skew, err := version.Check(version.GetCurrent(), node.Version)
+	if err != nil {
+		u, _ := version.GetUpdate(node.Version)
+		if u == nil {
+			return HandleError(err)
+		}
+		log.Warnf("[NodeServerV2] worker[%s] is refused and offered update %s: %v", nodeKey, u.Version, err)
+		return HandleSuccessWithData(entity.NodeRegisterRefused{
+			Update:       u,
+			Incompatible: err.Error(),
+		})
+	}
+	if skew != constants.NodeVersionSkewNone && skew != constants.NodeVersionSkewPatch {
+		log.Warnf("[NodeServerV2] worker[%s] is of %s version skew from master", nodeKey, skew)
+	}
+
 	// find in db
 	nodeDb, err := service.NewModelServiceV2[models.NodeV2]().GetOne(bson.M{"key": nodeKey}, nil)
-	if err == nil {
-		if node.IsMaster {
-			// error: cannot register master node
-			return HandleError(errors.ErrorGrpcNotAllowed)
+	if err != nil {
+		if !errors2.Is(err, mongo.ErrNoDocuments) {
+			return HandleError(err)
+		}
+		nodeDb = nil
+	}
+	if nodeDb != nil && nodeDb.IsMaster {
+		// error: cannot register master node
+		return HandleError(errors.ErrorGrpcNotAllowed)
+	}
+
+	// consume the join token before the node is changed, so that it is used
+	// only once, with the id of the node to be added if not exists
+	nodeId := primitive.NewObjectID()
+	if nodeDb != nil {
+		nodeId = nodeDb.Id
+	}
+	if joinToken != nil {
+		if _, err := credential.GetNodeCredentialServiceV2().UseJoinToken(registerReq.JoinToken, nodeId); err != nil {
+			return HandleError(err)
+		}
+	}
+
+	if nodeDb != nil {
+		// register existing, which stays pending until approved
+		if requireApproval || nodeDb.Status == constants.NodeStatusPendingApproval {
+			nodeDb.Status = constants.NodeStatusPendingApproval
+			nodeDb.Active = false
 		} else {
-			// register existing
 			nodeDb.Status = constants.NodeStatusRegistered
 			nodeDb.Active = true
-			err = service.NewModelServiceV2[models.NodeV2]().ReplaceById(nodeDb.Id, *nodeDb)
-			if err != nil {
-				return HandleError(err)
-			}
-			log.Infof("[NodeServerV2] updated worker[%s] in db. id: %s", nodeKey, node.Id.Hex())
 		}
-	} else if errors2.Is(err, mongo.ErrNoDocuments) {
+		nodeDb.Version = node.Version
+		err = service.NewModelServiceV2[models.NodeV2]().ReplaceById(nodeDb.Id, *nodeDb)
+		if err != nil {
+			return HandleError(err)
+		}
+		node = *nodeDb
+		log.Infof("[NodeServerV2] updated worker[%s] in db. id: %s", nodeKey, node.Id.Hex())
+	} else {
 		// register new
+		node.Id = nodeId
 		node.Key = nodeKey
-		node.Status = constants.NodeStatusRegistered
-		node.Active = true
+		if requireApproval {
+			node.Status = constants.NodeStatusPendingApproval
+			node.Active = false
+		} else {
+			node.Status = constants.NodeStatusRegistered
+			node.Active = true
+		}
 		node.ActiveAt = time.Now()
 		node.Enabled = true
 		if node.Name == "" {
@@ -83,19 +162,145 @@ func (svr NodeServerV2) Register(ctx context.Context, req *grpc.Request) (res *g
 		}
 		node.SetCreated(primitive.NilObjectID)
 		node.SetUpdated(primitive.NilObjectID)
-		_, err = service.NewModelServiceV2[models.NodeV2]().InsertOne(*nodeDb)
+		node.Id, err = service.NewModelServiceV2[models.NodeV2]().InsertOne(node)
 		if err != nil {
 			return HandleError(err)
 		}
 		log.Infof("[NodeServerV2] added worker[%s] in db. id: %s", nodeKey, node.Id.Hex())
-	} else {
-		// error
-		return HandleError(err)
 	}
+	credential.GetNodeCredentialServiceV2().Forget(nodeKey)
 
 	log.Infof("[NodeServerV2] master registered worker[%s]", req.GetNodeKey())
 
-	return HandleSuccessWithData(node)
+	// issue a credential to a worker joining with a join token
+	var c entity.NodeCredential
+	if joinToken != nil {
+		c.Credential, err = credential.GetNodeCredentialServiceV2().Issue(&node, joinToken.Id)
+		if err != nil {
+			return HandleError(err)
+		}
+	}
+
+	// issue a certificate
+	var cert entity.NodeCertificate
+	if pki.IsEnabled() && registerReq.Csr != "" {
+		cert, err = svr.issueCertificate(&node, registerReq.Csr)
+		if err != nil {
+			return HandleError(err)
+		}
+	}
+
+	// worker binary of another version served by masters
+	u, err := version.GetUpdate(node.Version)
+	if err != nil {
+		log.Errorf("[NodeServerV2] get update of worker[%s] error: %v", nodeKey, err)
+	}
+
+	return HandleSuccessWithData(struct {
+		models.NodeV2
+		entity.NodeCertificate
+		entity.NodeCredential
+		Update *entity.NodeUpdate `json:"update,omitempty"`
+	}{node, cert, c, u})
+}
+
+// checkRegisterCredential checks the credential of a registering worker. A
+// worker without a credential must send a valid join token, which is
+// returned to be used when the worker is registered. Join tokens cannot be
+// used for node keys with active credentials, which would otherwise be
+// taken over by anyone holding a join token.
+func (svr NodeServerV2) checkRegisterCredential(ctx context.Context, nodeKey string, joinToken string) (t *models.JoinTokenV2, err error) {
+	headerNodeKey, c := credential.FromIncomingContext(ctx)
+	if c != "" {
+		if headerNodeKey != nodeKey {
+			return nil, errors.ErrorGrpcInvalidNodeKey
+		}
+		if _, err := credential.GetNodeCredentialServiceV2().Verify(nodeKey, c); err != nil {
+			return nil, fmt.Errorf("%w: %v", errors.ErrorGrpcUnauthorized, err)
+		}
+		return nil, nil
+	}
+	if joinToken == "" {
+		return nil, fmt.Errorf("%w: join token is required", errors.ErrorGrpcUnauthorized)
+	}
+	ok, err := credential.GetNodeCredentialServiceV2().HasCredential(nodeKey)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, fmt.Errorf("%w: node[%s] has an active credential", errors.ErrorGrpcNotAllowed, nodeKey)
+	}
+	t, err = credential.GetNodeCredentialServiceV2().GetJoinToken(joinToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrorGrpcUnauthorized, err)
+	}
+	return t, nil
+}
+
+// checkRegisterCertificate checks the certificate of a registering worker.
+// A worker without a client certificate must send a certificate signing
+// request, and is not allowed to register if a valid certificate has been
+// issued to the node key, which may be used by another worker.
+func (svr NodeServerV2) checkRegisterCertificate(ctx context.Context, nodeKey string, csr string) (err error) {
+	ca, err := pki.GetCA()
+	if err != nil {
+		return err
+	}
+	if _, ok, err := ca.GetPeerNodeKey(ctx); err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+	if csr == "" {
+		return fmt.Errorf("%w: certificate signing request is required", errors.ErrorGrpcUnauthorized)
+	}
+	ok, err := pki.HasValidCertificate(nodeKey)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return fmt.Errorf("%w: node[%s] has a valid certificate", errors.ErrorGrpcNotAllowed, nodeKey)
+	}
+	return nil
+}
+
+// renewCertificate issues a new certificate to a worker authenticated by
+// its current certificate
+func (svr NodeServerV2) renewCertificate(ctx context.Context, nodeKey string, csr string) (res *grpc.Response, err error) {
+	ca, err := pki.GetCA()
+	if err != nil {
+		return HandleError(err)
+	}
+	if _, ok, err := ca.GetPeerNodeKey(ctx); err != nil {
+		return HandleError(err)
+	} else if !ok {
+		return HandleError(errors.ErrorGrpcUnauthorized)
+	}
+	node, err := service.NewModelServiceV2[models.NodeV2]().GetOne(bson.M{"key": nodeKey}, nil)
+	if err != nil {
+		if errors2.Is(err, mongo.ErrNoDocuments) {
+			return HandleError(errors.ErrorNodeNotExists)
+		}
+		return HandleError(err)
+	}
+	cert, err := svr.issueCertificate(node, csr)
+	if err != nil {
+		return HandleError(err)
+	}
+	return HandleSuccessWithData(cert)
+}
+
+func (svr NodeServerV2) issueCertificate(node *models.NodeV2, csr string) (cert entity.NodeCertificate, err error) {
+	ca, err := pki.GetCA()
+	if err != nil {
+		return cert, err
+	}
+	cert.Certificate, err = ca.IssueNodeCertificate(node, csr)
+	if err != nil {
+		return cert, err
+	}
+	cert.CaCertificate = ca.GetCertificatePem()
+	return cert, nil
 }
 
 // SendHeartbeat from worker to master
@@ -114,15 +319,35 @@ func (svr NodeServerV2) SendHeartbeat(ctx context.Context, req *grpc.Request) (r
 		return HandleError(errors.ErrorNodeUnregistered)
 	}
 
-	// update status
-	node.Status = constants.NodeStatusOnline
-	node.Active = true
+	// resources, which are not sent in heartbeats replying pings
+	var r *models.NodeResources
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &r); err == nil && r.CpuCount > 0 {
+			r.ReportedAt = time.Now()
+			node.Resources = r
+		} else {
+			r = nil
+		}
+	}
+
+	// update status, while nodes pending approval stay inactive
+	if node.Status != constants.NodeStatusPendingApproval {
+		node.Status = constants.NodeStatusOnline
+		node.Active = true
+	}
 	node.ActiveAt = time.Now()
 	err = service.NewModelServiceV2[models.NodeV2]().ReplaceById(node.Id, *node)
 	if err != nil {
 		return HandleError(err)
 	}
 
+	// resources history
+	if r != nil {
+		if err := resource.SaveHistory(node.Id, r); err != nil {
+			log.Errorf("[NodeServerV2] save resources of worker[%s] error: %v", node.Key, err)
+		}
+	}
+
 	return HandleSuccessWithData(node)
 }
 
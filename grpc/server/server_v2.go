@@ -10,6 +10,7 @@ import (
 	"github.com/crawlab-team/crawlab-core/grpc/middlewares"
 	"github.com/crawlab-team/crawlab-core/interfaces"
 	nodeconfig "github.com/crawlab-team/crawlab-core/node/config"
+	"github.com/crawlab-team/crawlab-core/node/pki"
 	grpc2 "github.com/crawlab-team/crawlab-grpc"
 	"github.com/crawlab-team/go-trace"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
@@ -19,6 +20,7 @@ import (
 	"github.com/spf13/viper"
 	"go/types"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"net"
 	"sync"
 )
@@ -118,10 +120,15 @@ func (svr *GrpcServerV2) Register() (err error) {
 	grpc2.RegisterNodeServiceServer(svr.svr, *svr.nodeSvr) // node service
 	grpc2.RegisterModelBaseServiceV2Server(svr.svr, *svr.modelBaseServiceSvr)
 	grpc2.RegisterTaskServiceServer(svr.svr, *svr.taskSvr)
+	grpc2.RegisterDependencyServiceV2Server(svr.svr, *svr.dependenciesSvr)
 
 	return nil
 }
 
+func (svr *GrpcServerV2) GetDependenciesServer() (dependenciesSvr *DependenciesServerV2) {
+	return svr.dependenciesSvr
+}
+
 func (svr *GrpcServerV2) recoveryHandlerFunc(p interface{}) (err error) {
 	err = errors.NewError(errors.ErrorPrefixGrpc, fmt.Sprintf("%v", p))
 	trace.PrintError(err)
@@ -222,17 +229,43 @@ func NewGrpcServerV2() (svr *GrpcServerV2, err error) {
 		grpc_recovery.WithRecoveryHandler(svr.recoveryHandlerFunc),
 	}
 
+	// interceptors
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		grpc_recovery.UnaryServerInterceptor(recoveryOpts...),
+		grpc_auth.UnaryServerInterceptor(middlewares.GetAuthTokenFunc(svr.nodeCfgSvc)),
+	}
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		grpc_recovery.StreamServerInterceptor(recoveryOpts...),
+		grpc_auth.StreamServerInterceptor(middlewares.GetAuthTokenFunc(svr.nodeCfgSvc)),
+	}
+	var serverOpts []grpc.ServerOption
+
+	// mutual tls
+	if pki.IsEnabled() && svr.nodeCfgSvc.IsMaster() {
+		ca, err := pki.GetCA()
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg, err := ca.GetServerTLSConfig(svr.address.String())
+		if err != nil {
+			return nil, err
+		}
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+		unaryInterceptors = append(unaryInterceptors, middlewares.GetNodeIdentityUnaryServerInterceptor(ca))
+		streamInterceptors = append(streamInterceptors, middlewares.GetNodeIdentityStreamServerInterceptor(ca))
+		log.Infof("grpc server uses mutual tls")
+	}
+
+	// node credentials
+	unaryInterceptors = append(unaryInterceptors, middlewares.GetNodeCredentialUnaryServerInterceptor())
+	streamInterceptors = append(streamInterceptors, middlewares.GetNodeCredentialStreamServerInterceptor())
+
 	// grpc server
-	svr.svr = grpc.NewServer(
-		grpc_middleware.WithUnaryServerChain(
-			grpc_recovery.UnaryServerInterceptor(recoveryOpts...),
-			grpc_auth.UnaryServerInterceptor(middlewares.GetAuthTokenFunc(svr.nodeCfgSvc)),
-		),
-		grpc_middleware.WithStreamServerChain(
-			grpc_recovery.StreamServerInterceptor(recoveryOpts...),
-			grpc_auth.StreamServerInterceptor(middlewares.GetAuthTokenFunc(svr.nodeCfgSvc)),
-		),
+	serverOpts = append(serverOpts,
+		grpc_middleware.WithUnaryServerChain(unaryInterceptors...),
+		grpc_middleware.WithStreamServerChain(streamInterceptors...),
 	)
+	svr.svr = grpc.NewServer(serverOpts...)
 
 	// initialize
 	if err := svr.Init(); err != nil {
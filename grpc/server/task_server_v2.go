@@ -11,7 +11,10 @@ import (
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/models/service"
 	nodeconfig "github.com/crawlab-team/crawlab-core/node/config"
+	"github.com/crawlab-team/crawlab-core/node/resource"
+	"github.com/crawlab-team/crawlab-core/node/selector"
 	"github.com/crawlab-team/crawlab-core/notification"
+	"github.com/crawlab-team/crawlab-core/secret"
 	"github.com/crawlab-team/crawlab-core/task/stats"
 	"github.com/crawlab-team/crawlab-core/utils"
 	"github.com/crawlab-team/crawlab-db/mongo"
@@ -76,7 +79,14 @@ func (svr TaskServerV2) Fetch(ctx context.Context, request *grpc.Request) (respo
 	if err != nil {
 		return nil, trace.TraceError(err)
 	}
-	var tid primitive.ObjectID
+	var res entity.TaskFetchResult
+
+	// nodes pending approval, draining nodes or nodes under resource
+	// pressure accept no new tasks
+	if n.Status == constants.NodeStatusPendingApproval || n.Drain != nil || resource.IsUnderPressure(n.Resources) {
+		return HandleSuccessWithData(res)
+	}
+
 	opts := &mongo.FindOptions{
 		Sort: bson.D{
 			{"p", 1},
@@ -86,18 +96,25 @@ func (svr TaskServerV2) Fetch(ctx context.Context, request *grpc.Request) (respo
 	}
 	if err := mongo.RunTransactionWithContext(ctx, func(sc mongo2.SessionContext) (err error) {
 		// get task queue item assigned to this node
-		tid, err = svr.getTaskQueueItemIdAndDequeue(bson.M{"nid": n.Id}, opts, n.Id)
+		query := resource.GetRequirementQuery(n.Resources)
+		query["nid"] = n.Id
+		tid, err := svr.getTaskQueueItemIdAndDequeue(query, opts, n.Id)
 		if err != nil {
 			return err
 		}
 		if !tid.IsZero() {
-			return nil
+			return svr.setTaskFetchResult(&res, tid)
 		}
 
-		// get task queue item assigned to any node (random mode)
-		tid, err = svr.getTaskQueueItemIdAndDequeue(bson.M{"nid": nil}, opts, n.Id)
+		// get task queue item assigned to any node (random mode) with a node
+		// selector matching labels of this node
+		query, err = svr.getUnassignedTaskQueueItemQuery(n)
+		if err != nil {
+			return err
+		}
+		tid, err = svr.getTaskQueueItemIdAndDequeue(query, opts, n.Id)
 		if !tid.IsZero() {
-			return nil
+			return svr.setTaskFetchResult(&res, tid)
 		}
 		if err != nil {
 			return err
@@ -106,7 +123,7 @@ func (svr TaskServerV2) Fetch(ctx context.Context, request *grpc.Request) (respo
 	}); err != nil {
 		return nil, err
 	}
-	return HandleSuccessWithData(tid)
+	return HandleSuccessWithData(res)
 }
 
 func (svr TaskServerV2) SendNotification(ctx context.Context, request *grpc.Request) (response *grpc.Response, err error) {
@@ -212,6 +229,56 @@ func (svr TaskServerV2) getTaskQueueItemIdAndDequeue(query bson.M, opts *mongo.F
 	return tq.Id, nil
 }
 
+// setTaskFetchResult sets the fetched task and secrets of its spider, so
+// that workers never decrypt secrets themselves
+func (svr TaskServerV2) setTaskFetchResult(res *entity.TaskFetchResult, tid primitive.ObjectID) (err error) {
+	t, err := service.NewModelServiceV2[models.TaskV2]().GetById(tid)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	s, err := service.NewModelServiceV2[models.SpiderV2]().GetById(t.SpiderId)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	res.Secrets, err = secret.GetSecretServiceV2().GetTaskSecrets(s)
+	if err != nil {
+		return err
+	}
+	res.TaskId = tid
+	return nil
+}
+
+// getUnassignedTaskQueueItemQuery returns the query of task queue items not
+// assigned to any node, of which node selectors are empty or match labels
+// of the node. Selectors are matched by an allow-list, so that items of
+// selectors added afterwards are not fetched before they are matched.
+func (svr TaskServerV2) getUnassignedTaskQueueItemQuery(n *models.NodeV2) (query bson.M, err error) {
+	col := service.NewModelServiceV2[models.TaskQueueItemV2]().GetCol()
+	values, err := col.GetCollection().Distinct(col.GetContext(), "ns", bson.M{
+		"nid": nil,
+		"ns":  bson.M{"$exists": true, "$ne": ""},
+	})
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	matched := []string{}
+	for _, v := range values {
+		ns, ok := v.(string)
+		if ok && selector.Match(ns, n.Labels) {
+			matched = append(matched, ns)
+		}
+	}
+
+	query = resource.GetRequirementQuery(n.Resources)
+	query["nid"] = nil
+	query["$or"] = []bson.M{
+		{"ns": bson.M{"$exists": false}},
+		{"ns": ""},
+		{"ns": bson.M{"$in": matched}},
+	}
+	return query, nil
+}
+
 func (svr TaskServerV2) deserialize(msg *grpc.StreamMessage) (data entity.StreamMessageTaskData, err error) {
 	if err := json.Unmarshal(msg.Data, &data); err != nil {
 		return data, trace.TraceError(err)
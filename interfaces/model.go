@@ -75,6 +75,15 @@ const (
 	ModelColNameRolePermission    = "role_permissions"
 	ModelColNameEnvironment       = "environments"
 	ModelColNameDependencySetting = "dependency_settings"
+	ModelColNameLease             = "leases"
+	ModelColNameCertAuthority     = "cert_authorities"
+	ModelColNameNodeCertificate   = "node_certificates"
+	ModelColNameJoinToken         = "join_tokens"
+	ModelColNameNodeCredential    = "node_credentials"
+	ModelColNameOidcState         = "oidc_states"
+	ModelColNameNodeResource      = "node_resources"
+	ModelColNameSession           = "sessions"
+	ModelColNameProjectMember     = "project_members"
 )
 
 type ModelWithTags interface {
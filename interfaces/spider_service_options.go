@@ -3,13 +3,16 @@ package interfaces
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type SpiderRunOptions struct {
-	Mode       string               `json:"mode"`
-	NodeIds    []primitive.ObjectID `json:"node_ids"`
-	Cmd        string               `json:"cmd"`
-	Param      string               `json:"param"`
-	ScheduleId primitive.ObjectID   `json:"schedule_id"`
-	Priority   int                  `json:"priority"`
-	UserId     primitive.ObjectID   `json:"-"`
+	Mode         string               `json:"mode"`
+	NodeIds      []primitive.ObjectID `json:"node_ids"`
+	NodeSelector string               `json:"node_selector"` // label selector of nodes
+	Cmd          string               `json:"cmd"`
+	Param        string               `json:"param"`
+	ScheduleId   primitive.ObjectID   `json:"schedule_id"`
+	Priority     int                  `json:"priority"`
+	Envs         map[string]string    `json:"envs"`   // environment variables overriding scoped ones
+	Params       map[string]any       `json:"params"` // typed parameters of the spider param schema
+	UserId       primitive.ObjectID   `json:"-"`
 }
 
 type SpiderCloneOptions struct {
@@ -0,0 +1,202 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/go-trace"
+	ldap2 "github.com/go-ldap/ldap/v3"
+	"github.com/spf13/viper"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Authenticator authenticates users against an LDAP directory configured
+// with "ldap.*" settings. It binds with the service account, searches for
+// the user with the user filter, then binds as the user to verify the
+// password. Groups of the user are CNs of its group attribute (memberOf).
+// Connections of "ldap://" urls are upgraded with StartTLS if "ldap.startTls"
+// is set, and binds over plaintext connections are refused unless
+// "ldap.allowPlaintext" is set.
+type Authenticator struct {
+	// settings
+	url                string
+	bindDn             string
+	bindPassword       string
+	baseDn             string
+	userFilter         string
+	idAttribute        string
+	usernameAttribute  string
+	emailAttribute     string
+	groupAttribute     string
+	roleMapping        map[string]string
+	startTls           bool
+	allowPlaintext     bool
+	insecureSkipVerify bool
+	timeout            time.Duration
+}
+
+func (a *Authenticator) GetAuthSource() string {
+	return constants.AuthSourceLdap
+}
+
+func (a *Authenticator) GetRoleMapping() map[string]string {
+	return a.roleMapping
+}
+
+func (a *Authenticator) Authenticate(username, password string) (identity *entity.ExternalIdentity, err error) {
+	if username == "" || password == "" {
+		return nil, errors.ErrorUserMismatch
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// service account
+	if a.bindDn != "" {
+		if err := conn.Bind(a.bindDn, a.bindPassword); err != nil {
+			return nil, trace.TraceError(err)
+		}
+	}
+
+	// user entry
+	attributes := []string{a.usernameAttribute, a.emailAttribute, a.groupAttribute}
+	if a.idAttribute != "" {
+		attributes = append(attributes, a.idAttribute)
+	}
+	filter := strings.ReplaceAll(a.userFilter, "%s", ldap2.EscapeFilter(username))
+	res, err := conn.Search(ldap2.NewSearchRequest(
+		a.baseDn,
+		ldap2.ScopeWholeSubtree,
+		ldap2.NeverDerefAliases,
+		2,
+		int(a.timeout/time.Second),
+		false,
+		filter,
+		attributes,
+		nil,
+	))
+	if err != nil {
+		if ldap2.IsErrorWithCode(err, ldap2.LDAPResultSizeLimitExceeded) {
+			return nil, errors.ErrorUserMismatch
+		}
+		return nil, trace.TraceError(err)
+	}
+	if len(res.Entries) != 1 {
+		return nil, errors.ErrorUserMismatch
+	}
+	e := res.Entries[0]
+
+	// verify password
+	if err := conn.Bind(e.DN, password); err != nil {
+		if ldap2.IsErrorWithCode(err, ldap2.LDAPResultInvalidCredentials) {
+			return nil, errors.ErrorUserMismatch
+		}
+		return nil, trace.TraceError(err)
+	}
+
+	identity = &entity.ExternalIdentity{
+		Source:   constants.AuthSourceLdap,
+		Id:       e.DN,
+		Username: e.GetEqualFoldAttributeValue(a.usernameAttribute),
+		Email:    e.GetEqualFoldAttributeValue(a.emailAttribute),
+	}
+	if a.idAttribute != "" && e.GetEqualFoldAttributeValue(a.idAttribute) != "" {
+		identity.Id = e.GetEqualFoldAttributeValue(a.idAttribute)
+	}
+	if identity.Username == "" {
+		identity.Username = username
+	}
+	for _, g := range e.GetEqualFoldAttributeValues(a.groupAttribute) {
+		identity.Groups = append(identity.Groups, GetGroupName(g))
+	}
+
+	return identity, nil
+}
+
+// dial connects to the directory over TLS, with "ldaps://" urls or StartTLS,
+// or over plaintext if allowed
+func (a *Authenticator) dial() (conn *ldap2.Conn, err error) {
+	u, err := url.Parse(a.url)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if u.Scheme == "ldap" && !a.startTls && !a.allowPlaintext {
+		return nil, errors.ErrorUserLdapPlaintext
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: a.insecureSkipVerify,
+	}
+	conn, err = ldap2.DialURL(a.url,
+		ldap2.DialWithDialer(&net.Dialer{Timeout: a.timeout}),
+		ldap2.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	conn.SetTimeout(a.timeout)
+	if u.Scheme == "ldap" && a.startTls {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, trace.TraceError(err)
+		}
+	}
+	return conn, nil
+}
+
+// GetGroupName returns the CN of a group DN, or the value itself if it is
+// not a DN
+func GetGroupName(dn string) string {
+	rdn := strings.SplitN(dn, ",", 2)[0]
+	parts := strings.SplitN(rdn, "=", 2)
+	if len(parts) != 2 || !strings.EqualFold(strings.TrimSpace(parts[0]), "cn") {
+		return dn
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+func NewAuthenticator() (a *Authenticator) {
+	a = &Authenticator{
+		url:                viper.GetString("ldap.url"),
+		bindDn:             viper.GetString("ldap.bindDn"),
+		bindPassword:       viper.GetString("ldap.bindPassword"),
+		baseDn:             viper.GetString("ldap.baseDn"),
+		userFilter:         viper.GetString("ldap.userFilter"),
+		idAttribute:        viper.GetString("ldap.idAttribute"),
+		usernameAttribute:  viper.GetString("ldap.usernameAttribute"),
+		emailAttribute:     viper.GetString("ldap.emailAttribute"),
+		groupAttribute:     viper.GetString("ldap.groupAttribute"),
+		roleMapping:        map[string]string{},
+		startTls:           viper.GetBool("ldap.startTls"),
+		allowPlaintext:     viper.GetBool("ldap.allowPlaintext"),
+		insecureSkipVerify: viper.GetBool("ldap.insecureSkipVerify"),
+		timeout:            viper.GetDuration("ldap.timeout"),
+	}
+	if a.userFilter == "" {
+		a.userFilter = "(uid=%s)"
+	}
+	if a.usernameAttribute == "" {
+		a.usernameAttribute = "uid"
+	}
+	if a.emailAttribute == "" {
+		a.emailAttribute = "mail"
+	}
+	if a.groupAttribute == "" {
+		a.groupAttribute = "memberOf"
+	}
+	if a.timeout == 0 {
+		a.timeout = 10 * time.Second
+	}
+	for group, key := range viper.GetStringMapString("ldap.roleMapping") {
+		a.roleMapping[strings.ToLower(group)] = key
+	}
+	return a
+}
@@ -0,0 +1,164 @@
+package ldap
+
+import (
+	"github.com/crawlab-team/crawlab-core/errors"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap2 "github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	testBindDn   = "cn=crawlab,dc=example,dc=com"
+	testUserDn   = "uid=alice,ou=people,dc=example,dc=com"
+	testPassword = "secret"
+)
+
+// serveMockLdap serves bind and search operations of a directory with a
+// service account and a single user "alice"
+func serveMockLdap(t *testing.T) (url string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveMockLdapConn(conn)
+		}
+	}()
+
+	return "ldap://" + l.Addr().String()
+}
+
+func serveMockLdapConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		msg, err := ber.ReadPacket(conn)
+		if err != nil || len(msg.Children) < 2 {
+			return
+		}
+		id := msg.Children[0].Value
+		op := msg.Children[1]
+		reply := func(res *ber.Packet) {
+			p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+			p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+			p.AppendChild(res)
+			_, _ = conn.Write(p.Bytes())
+		}
+		result := func(tag ber.Tag, code int64) *ber.Packet {
+			p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+			p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+			p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+			p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+			return p
+		}
+
+		switch op.Tag {
+		case ldap2.ApplicationBindRequest:
+			dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+			if (dn == testBindDn || dn == testUserDn) && password == testPassword {
+				reply(result(ldap2.ApplicationBindResponse, ldap2.LDAPResultSuccess))
+			} else {
+				reply(result(ldap2.ApplicationBindResponse, ldap2.LDAPResultInvalidCredentials))
+			}
+		case ldap2.ApplicationSearchRequest:
+			// (&(objectClass=person)(uid=<value>))
+			f := op.Children[6]
+			if f.Tag == ldap2.FilterAnd && len(f.Children) == 2 && f.Children[1].Children[1].Data.String() == "alice" {
+				entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap2.ApplicationSearchResultEntry, nil, "")
+				entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, testUserDn, ""))
+				attrs := ber.NewSequence("")
+				for _, attr := range []struct {
+					name   string
+					values []string
+				}{
+					{"uid", []string{"alice"}},
+					{"mail", []string{"alice@example.com"}},
+					{"memberOf", []string{"cn=Admins,ou=groups,dc=example,dc=com", "cn=dev,ou=groups,dc=example,dc=com"}},
+				} {
+					a := ber.NewSequence("")
+					a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attr.name, ""))
+					values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+					for _, v := range attr.values {
+						values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+					}
+					a.AppendChild(values)
+					attrs.AppendChild(a)
+				}
+				entry.AppendChild(attrs)
+				reply(entry)
+			}
+			reply(result(ldap2.ApplicationSearchResultDone, ldap2.LDAPResultSuccess))
+		case ldap2.ApplicationExtendedRequest:
+			// StartTLS not supported
+			reply(result(ldap2.ApplicationExtendedResponse, ldap2.LDAPResultProtocolError))
+		case ldap2.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func newTestAuthenticator(url string) *Authenticator {
+	return &Authenticator{
+		url:               url,
+		bindDn:            testBindDn,
+		bindPassword:      testPassword,
+		baseDn:            "dc=example,dc=com",
+		userFilter:        "(&(objectClass=person)(uid=%s))",
+		usernameAttribute: "uid",
+		emailAttribute:    "mail",
+		groupAttribute:    "memberOf",
+		allowPlaintext:    true,
+		timeout:           5 * time.Second,
+	}
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	a := newTestAuthenticator(serveMockLdap(t))
+
+	identity, err := a.Authenticate("alice", testPassword)
+	require.Nil(t, err)
+	require.Equal(t, testUserDn, identity.Id)
+	require.Equal(t, "alice", identity.Username)
+	require.Equal(t, "alice@example.com", identity.Email)
+	require.Equal(t, []string{"Admins", "dev"}, identity.Groups)
+
+	// wrong password
+	_, err = a.Authenticate("alice", "wrong")
+	require.ErrorIs(t, err, errors.ErrorUserMismatch)
+
+	// empty password (unauthenticated bind)
+	_, err = a.Authenticate("alice", "")
+	require.ErrorIs(t, err, errors.ErrorUserMismatch)
+
+	// not exists
+	_, err = a.Authenticate("bob", testPassword)
+	require.ErrorIs(t, err, errors.ErrorUserMismatch)
+
+	// wrong service account
+	a.bindPassword = "wrong"
+	_, err = a.Authenticate("alice", testPassword)
+	require.NotNil(t, err)
+	require.NotErrorIs(t, err, errors.ErrorUserMismatch)
+}
+
+func TestAuthenticator_Plaintext(t *testing.T) {
+	a := newTestAuthenticator(serveMockLdap(t))
+	a.allowPlaintext = false
+
+	// refused before connecting
+	_, err := a.Authenticate("alice", testPassword)
+	require.ErrorIs(t, err, errors.ErrorUserLdapPlaintext)
+
+	// mock server does not support StartTLS
+	a.startTls = true
+	_, err = a.Authenticate("alice", testPassword)
+	require.NotNil(t, err)
+	require.NotErrorIs(t, err, errors.ErrorUserMismatch)
+}
@@ -0,0 +1,129 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/crawlab-team/crawlab-core/audit"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+)
+
+// AuditDocFunc returns the document of a resource by id, to record the
+// changes of the resource in audit logs
+type AuditDocFunc func(id primitive.ObjectID) (doc bson.M, err error)
+
+// auditResponseWriter keeps a copy of the response body to get the id of
+// the created resource
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// AuditMiddlewareV2 records an audit log of a mutating request, with the
+// changes of the resource if getDoc is given. Batch requests with resource
+// ids in the payload "ids" are recorded with a log for each resource.
+func AuditMiddlewareV2(resource, action string, getDoc AuditDocFunc) gin.HandlerFunc {
+	auditSvc := audit.GetAuditServiceV2()
+	return func(c *gin.Context) {
+		// resource ids
+		var ids []primitive.ObjectID
+		if id, err := primitive.ObjectIDFromHex(c.Param("id")); err == nil {
+			ids = []primitive.ObjectID{id}
+		} else {
+			ids = getAuditBatchIds(c)
+		}
+
+		// documents before change
+		befores := make([]bson.M, len(ids))
+		if getDoc != nil {
+			for i, id := range ids {
+				befores[i], _ = getDoc(id)
+			}
+		}
+
+		// keep response body of create requests to get the created id
+		var w *auditResponseWriter
+		if len(ids) == 0 {
+			w = &auditResponseWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+			c.Writer = w
+		}
+
+		c.Next()
+
+		// created id
+		if w != nil {
+			var res struct {
+				Data struct {
+					Id primitive.ObjectID `json:"_id"`
+				} `json:"data"`
+			}
+			_ = json.Unmarshal(w.body.Bytes(), &res)
+			ids = []primitive.ObjectID{res.Data.Id}
+			befores = []bson.M{nil}
+		}
+
+		for i, id := range ids {
+			// document after change
+			var after bson.M
+			if getDoc != nil && !id.IsZero() {
+				after, _ = getDoc(id)
+			}
+
+			l := &models.AuditLogV2{
+				ActorType:  constants.AuditActorTypeAnonymous,
+				Action:     action,
+				Resource:   resource,
+				ResourceId: id,
+				Method:     c.Request.Method,
+				Path:       c.Request.URL.Path,
+				StatusCode: c.Writer.Status(),
+				Ip:         c.ClientIP(),
+				Diff:       audit.GetDiff(befores[i], after),
+			}
+			if value, ok := c.Get(constants.UserContextKey); ok {
+				if u, ok := value.(*models.UserV2); ok {
+					l.ActorType = constants.AuditActorTypeUser
+					l.ActorId = u.Id
+					l.ActorName = u.Username
+				}
+			}
+			if value, ok := c.Get(constants.TokenContextKey); ok {
+				if t, ok := value.(*models.TokenV2); ok {
+					l.ActorType = constants.AuditActorTypeToken
+					l.TokenId = t.Id
+				}
+			}
+			go auditSvc.Record(l)
+		}
+	}
+}
+
+// getAuditBatchIds returns the resource ids in the payload "ids" of batch
+// requests, and restores the request body for the handler
+func getAuditBatchIds(c *gin.Context) (ids []primitive.ObjectID) {
+	if c.Request.Body == nil {
+		return nil
+	}
+	data, err := io.ReadAll(c.Request.Body)
+	_ = c.Request.Body.Close()
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	var payload struct {
+		Ids []primitive.ObjectID `json:"ids"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil
+	}
+	return payload.Ids
+}
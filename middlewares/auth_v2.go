@@ -33,6 +33,19 @@ func AuthorizationMiddlewareV2() gin.HandlerFunc {
 		// token string
 		tokenStr := c.GetHeader("Authorization")
 
+		// validate api token, of which scopes are checked in permission middleware
+		if userSvc.IsApiToken(tokenStr) {
+			u, t, err := userSvc.CheckApiToken(tokenStr)
+			if err != nil {
+				utils.HandleErrorUnauthorized(c, errors.ErrorHttpUnauthorized)
+				return
+			}
+			c.Set(constants.UserContextKey, u)
+			c.Set(constants.TokenContextKey, t)
+			c.Next()
+			return
+		}
+
 		// validate token
 		u, err := userSvc.CheckToken(tokenStr)
 		if err != nil {
@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/project"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+// ProjectMiddlewareV2 denies requests of a single resource (with "id" param)
+// which belongs to a project the user cannot access. Viewing requires
+// membership of the project, changing requires owner or developer role,
+// and changing the project itself or its members requires owner role.
+func ProjectMiddlewareV2(resource string) gin.HandlerFunc {
+	projectSvc := project.GetProjectServiceV2()
+	return func(c *gin.Context) {
+		// user
+		value, _ := c.Get(constants.UserContextKey)
+		u, ok := value.(*models.UserV2)
+		if !ok || resource == "" || u.Role == constants.RoleAdmin {
+			c.Next()
+			return
+		}
+
+		// resource id
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		// project of the resource
+		projectId, ok, err := projectSvc.GetResourceProjectId(resource, id)
+		if err != nil {
+			utils.HandleErrorInternalServerError(c, err)
+			return
+		}
+		if !ok {
+			c.Next()
+			return
+		}
+
+		// check access
+		var allowed bool
+		switch {
+		case c.Request.Method == http.MethodGet:
+			allowed, err = projectSvc.CanRead(u, projectId)
+		case resource == "projects" || resource == "projects/members":
+			allowed, err = projectSvc.CanManage(u, projectId)
+		default:
+			allowed, err = projectSvc.CanWrite(u, projectId)
+		}
+		if err != nil {
+			utils.HandleErrorInternalServerError(c, err)
+			return
+		}
+		if !allowed {
+			utils.HandleErrorForbidden(c, errors.ErrorProjectForbidden)
+			return
+		}
+
+		c.Next()
+	}
+}
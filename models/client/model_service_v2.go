@@ -28,7 +28,7 @@ type ModelServiceV2[T any] struct {
 func (svc *ModelServiceV2[T]) GetById(id primitive.ObjectID) (model *T, err error) {
 	ctx, cancel := svc.c.Context()
 	defer cancel()
-	res, err := svc.c.ModelBaseServiceV2Client.GetById(ctx, &grpc.ModelServiceV2GetByIdRequest{
+	res, err := svc.c.GetModelBaseServiceV2Client().GetById(ctx, &grpc.ModelServiceV2GetByIdRequest{
 		NodeKey:   svc.cfg.GetNodeKey(),
 		ModelType: svc.modelType,
 		Id:        id.Hex(),
@@ -50,7 +50,7 @@ func (svc *ModelServiceV2[T]) GetOne(query bson.M, options *mongo.FindOptions) (
 	if err != nil {
 		return nil, err
 	}
-	res, err := svc.c.ModelBaseServiceV2Client.GetOne(ctx, &grpc.ModelServiceV2GetOneRequest{
+	res, err := svc.c.GetModelBaseServiceV2Client().GetOne(ctx, &grpc.ModelServiceV2GetOneRequest{
 		NodeKey:     svc.cfg.GetNodeKey(),
 		ModelType:   svc.modelType,
 		Query:       queryData,
@@ -73,7 +73,7 @@ func (svc *ModelServiceV2[T]) GetMany(query bson.M, options *mongo.FindOptions)
 	if err != nil {
 		return nil, err
 	}
-	res, err := svc.c.ModelBaseServiceV2Client.GetMany(ctx, &grpc.ModelServiceV2GetManyRequest{
+	res, err := svc.c.GetModelBaseServiceV2Client().GetMany(ctx, &grpc.ModelServiceV2GetManyRequest{
 		NodeKey:     svc.cfg.GetNodeKey(),
 		ModelType:   svc.modelType,
 		Query:       queryData,
@@ -88,7 +88,7 @@ func (svc *ModelServiceV2[T]) GetMany(query bson.M, options *mongo.FindOptions)
 func (svc *ModelServiceV2[T]) DeleteById(id primitive.ObjectID) (err error) {
 	ctx, cancel := svc.c.Context()
 	defer cancel()
-	_, err = svc.c.ModelBaseServiceV2Client.DeleteById(ctx, &grpc.ModelServiceV2DeleteByIdRequest{
+	_, err = svc.c.GetModelBaseServiceV2Client().DeleteById(ctx, &grpc.ModelServiceV2DeleteByIdRequest{
 		NodeKey:   svc.cfg.GetNodeKey(),
 		ModelType: svc.modelType,
 		Id:        id.Hex(),
@@ -106,7 +106,7 @@ func (svc *ModelServiceV2[T]) DeleteOne(query bson.M) (err error) {
 	if err != nil {
 		return err
 	}
-	_, err = svc.c.ModelBaseServiceV2Client.DeleteOne(ctx, &grpc.ModelServiceV2DeleteOneRequest{
+	_, err = svc.c.GetModelBaseServiceV2Client().DeleteOne(ctx, &grpc.ModelServiceV2DeleteOneRequest{
 		NodeKey:   svc.cfg.GetNodeKey(),
 		ModelType: svc.modelType,
 		Query:     queryData,
@@ -124,7 +124,7 @@ func (svc *ModelServiceV2[T]) DeleteMany(query bson.M) (err error) {
 	if err != nil {
 		return err
 	}
-	_, err = svc.c.ModelBaseServiceV2Client.DeleteMany(ctx, &grpc.ModelServiceV2DeleteManyRequest{
+	_, err = svc.c.GetModelBaseServiceV2Client().DeleteMany(ctx, &grpc.ModelServiceV2DeleteManyRequest{
 		NodeKey:   svc.cfg.GetNodeKey(),
 		ModelType: svc.modelType,
 		Query:     queryData,
@@ -142,7 +142,7 @@ func (svc *ModelServiceV2[T]) UpdateById(id primitive.ObjectID, update bson.M) (
 	if err != nil {
 		return err
 	}
-	_, err = svc.c.ModelBaseServiceV2Client.UpdateById(ctx, &grpc.ModelServiceV2UpdateByIdRequest{
+	_, err = svc.c.GetModelBaseServiceV2Client().UpdateById(ctx, &grpc.ModelServiceV2UpdateByIdRequest{
 		NodeKey:   svc.cfg.GetNodeKey(),
 		ModelType: svc.modelType,
 		Id:        id.Hex(),
@@ -165,7 +165,7 @@ func (svc *ModelServiceV2[T]) UpdateOne(query bson.M, update bson.M) (err error)
 	if err != nil {
 		return err
 	}
-	_, err = svc.c.ModelBaseServiceV2Client.UpdateOne(ctx, &grpc.ModelServiceV2UpdateOneRequest{
+	_, err = svc.c.GetModelBaseServiceV2Client().UpdateOne(ctx, &grpc.ModelServiceV2UpdateOneRequest{
 		NodeKey:   svc.cfg.GetNodeKey(),
 		ModelType: svc.modelType,
 		Query:     queryData,
@@ -188,7 +188,7 @@ func (svc *ModelServiceV2[T]) UpdateMany(query bson.M, update bson.M) (err error
 	if err != nil {
 		return err
 	}
-	_, err = svc.c.ModelBaseServiceV2Client.UpdateMany(ctx, &grpc.ModelServiceV2UpdateManyRequest{
+	_, err = svc.c.GetModelBaseServiceV2Client().UpdateMany(ctx, &grpc.ModelServiceV2UpdateManyRequest{
 		NodeKey:   svc.cfg.GetNodeKey(),
 		ModelType: svc.modelType,
 		Query:     queryData,
@@ -204,7 +204,7 @@ func (svc *ModelServiceV2[T]) ReplaceById(id primitive.ObjectID, model T) (err e
 	if err != nil {
 		return err
 	}
-	_, err = svc.c.ModelBaseServiceV2Client.ReplaceById(ctx, &grpc.ModelServiceV2ReplaceByIdRequest{
+	_, err = svc.c.GetModelBaseServiceV2Client().ReplaceById(ctx, &grpc.ModelServiceV2ReplaceByIdRequest{
 		NodeKey:   svc.cfg.GetNodeKey(),
 		ModelType: svc.modelType,
 		Id:        id.Hex(),
@@ -227,7 +227,7 @@ func (svc *ModelServiceV2[T]) ReplaceOne(query bson.M, model T) (err error) {
 	if err != nil {
 		return err
 	}
-	_, err = svc.c.ModelBaseServiceV2Client.ReplaceOne(ctx, &grpc.ModelServiceV2ReplaceOneRequest{
+	_, err = svc.c.GetModelBaseServiceV2Client().ReplaceOne(ctx, &grpc.ModelServiceV2ReplaceOneRequest{
 		NodeKey:   svc.cfg.GetNodeKey(),
 		ModelType: svc.modelType,
 		Query:     queryData,
@@ -246,7 +246,7 @@ func (svc *ModelServiceV2[T]) InsertOne(model T) (id primitive.ObjectID, err err
 	if err != nil {
 		return primitive.NilObjectID, err
 	}
-	res, err := svc.c.ModelBaseServiceV2Client.InsertOne(ctx, &grpc.ModelServiceV2InsertOneRequest{
+	res, err := svc.c.GetModelBaseServiceV2Client().InsertOne(ctx, &grpc.ModelServiceV2InsertOneRequest{
 		NodeKey:   svc.cfg.GetNodeKey(),
 		ModelType: svc.modelType,
 		Model:     modelData,
@@ -269,7 +269,7 @@ func (svc *ModelServiceV2[T]) InsertMany(models []T) (ids []primitive.ObjectID,
 	if err != nil {
 		return nil, err
 	}
-	res, err := svc.c.ModelBaseServiceV2Client.InsertMany(ctx, &grpc.ModelServiceV2InsertManyRequest{
+	res, err := svc.c.GetModelBaseServiceV2Client().InsertMany(ctx, &grpc.ModelServiceV2InsertManyRequest{
 		NodeKey:   svc.cfg.GetNodeKey(),
 		ModelType: svc.modelType,
 		Models:    modelsData,
@@ -287,7 +287,7 @@ func (svc *ModelServiceV2[T]) Count(query bson.M) (total int, err error) {
 	if err != nil {
 		return 0, err
 	}
-	res, err := svc.c.ModelBaseServiceV2Client.Count(ctx, &grpc.ModelServiceV2CountRequest{
+	res, err := svc.c.GetModelBaseServiceV2Client().Count(ctx, &grpc.ModelServiceV2CountRequest{
 		NodeKey:   svc.cfg.GetNodeKey(),
 		ModelType: svc.modelType,
 		Query:     queryData,
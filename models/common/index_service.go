@@ -84,9 +84,10 @@ func CreateIndexes() {
 		{Keys: bson.M{"key": 1}},
 	})
 
-	// tokens
+	// tokens (sparse as tokens created before api tokens have no hash)
 	mongo.GetMongoCol(interfaces.ModelColNameToken).MustCreateIndexes([]mongo2.IndexModel{
 		{Keys: bson.M{"name": 1}},
+		{Keys: bson.M{"token_hash": 1}, Options: options.Index().SetUnique(true).SetSparse(true)},
 	})
 
 	// variables
@@ -135,6 +136,58 @@ func CreateIndexes() {
 		{Keys: bson.D{{"permission_id", 1}, {"role_id", 1}}, Options: options.Index().SetUnique(true)},
 	})
 
+	// sessions (expired sessions are removed)
+	mongo.GetMongoCol(interfaces.ModelColNameSession).MustCreateIndexes([]mongo2.IndexModel{
+		{Keys: bson.M{"user_id": 1}},
+		{Keys: bson.M{"refresh_token_hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"prev_refresh_token_hash": 1}},
+		{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	// project members (each user is a member of a project only once)
+	mongo.GetMongoCol(interfaces.ModelColNameProjectMember).MustCreateIndexes([]mongo2.IndexModel{
+		{Keys: bson.D{{"user_id", 1}, {"project_id", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"project_id": 1}},
+	})
+
+	// leases
+	mongo.GetMongoCol(interfaces.ModelColNameLease).MustCreateIndexes([]mongo2.IndexModel{
+		{Keys: bson.M{"name": 1}, Options: options.Index().SetUnique(true)},
+	})
+
+	// certificates
+	mongo.GetMongoCol(interfaces.ModelColNameCertAuthority).MustCreateIndexes([]mongo2.IndexModel{
+		{Keys: bson.M{"name": 1}, Options: options.Index().SetUnique(true)},
+	})
+	mongo.GetMongoCol(interfaces.ModelColNameNodeCertificate).MustCreateIndexes([]mongo2.IndexModel{
+		{Keys: bson.M{"node_key": 1}},
+		{Keys: bson.M{"serial_number": 1}, Options: options.Index().SetUnique(true)},
+	})
+
+	// join tokens and node credentials
+	mongo.GetMongoCol(interfaces.ModelColNameJoinToken).MustCreateIndexes([]mongo2.IndexModel{
+		{Keys: bson.M{"token_hash": 1}, Options: options.Index().SetUnique(true)},
+	})
+	mongo.GetMongoCol(interfaces.ModelColNameNodeCredential).MustCreateIndexes([]mongo2.IndexModel{
+		{Keys: bson.M{"node_key": 1}},
+		{Keys: bson.M{"hash": 1}, Options: options.Index().SetUnique(true)},
+	})
+
+	// pending oidc logins
+	mongo.GetMongoCol(interfaces.ModelColNameOidcState).MustCreateIndexes([]mongo2.IndexModel{
+		{Keys: bson.M{"state_hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	// node resources history
+	mongo.GetMongoCol(interfaces.ModelColNameNodeResource).MustCreateIndexes([]mongo2.IndexModel{
+		{Keys: bson.D{{"node_id", 1}, {"created_ts", -1}}},
+		{
+			Keys:    bson.M{"created_ts": 1},
+			Options: options.Index().SetExpireAfterSeconds(3600 * 24 * 7),
+		},
+	})
+
 	// cache
 	mongo.GetMongoCol(constants.CacheColName).MustCreateIndexes([]mongo2.IndexModel{
 		{
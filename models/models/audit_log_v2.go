@@ -0,0 +1,24 @@
+package models
+
+import (
+	"github.com/crawlab-team/crawlab-core/entity"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AuditLogV2 struct {
+	any                     `collection:"audit_logs"`
+	BaseModelV2[AuditLogV2] `bson:",inline"`
+	ActorType               string                `json:"actor_type" bson:"actor_type"`
+	ActorId                 primitive.ObjectID    `json:"actor_id" bson:"actor_id"`
+	ActorName               string                `json:"actor_name" bson:"actor_name"`
+	TokenId                 primitive.ObjectID    `json:"token_id,omitempty" bson:"token_id,omitempty"`
+	Action                  string                `json:"action" bson:"action"`
+	Resource                string                `json:"resource" bson:"resource"`
+	ResourceId              primitive.ObjectID    `json:"resource_id" bson:"resource_id"`
+	Method                  string                `json:"method,omitempty" bson:"method,omitempty"`
+	Path                    string                `json:"path,omitempty" bson:"path,omitempty"`
+	StatusCode              int                   `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Ip                      string                `json:"ip,omitempty" bson:"ip,omitempty"`
+	Message                 string                `json:"message,omitempty" bson:"message,omitempty"`
+	Diff                    []entity.AuditLogDiff `json:"diff,omitempty" bson:"diff,omitempty"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"github.com/crawlab-team/crawlab-core/entity"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type DependencyTaskV2 struct {
+	any                           `collection:"dependency_tasks"`
+	BaseModelV2[DependencyTaskV2] `bson:",inline"`
+	NodeId                        primitive.ObjectID  `json:"node_id" bson:"node_id"`
+	Lang                          string              `json:"lang" bson:"lang"`
+	Action                        string              `json:"action" bson:"action"`
+	Dependencies                  []entity.Dependency `json:"dependencies" bson:"dependencies"`
+	Status                        string              `json:"status" bson:"status"`
+	Error                         string              `json:"error" bson:"error"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type DependencyV2 struct {
+	any                       `collection:"dependencies"`
+	BaseModelV2[DependencyV2] `bson:",inline"`
+	NodeId                    primitive.ObjectID `json:"node_id" bson:"node_id"`
+	Lang                      string             `json:"lang" bson:"lang"`
+	Name                      string             `json:"name" bson:"name"`
+	Version                   string             `json:"version" bson:"version"`
+}
@@ -1,8 +1,17 @@
 package models
 
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EnvironmentV2 is an environment variable of tasks, which is global if not
+// scoped to a project, spider or schedule
 type EnvironmentV2 struct {
 	any                        `collection:"environments"`
 	BaseModelV2[EnvironmentV2] `bson:",inline"`
-	Key                        string `json:"key" bson:"key"`
-	Value                      string `json:"value" bson:"value"`
+	Key                        string             `json:"key" bson:"key"`
+	Value                      string             `json:"value" bson:"value"`             // may reference other variables as ${NAME}
+	ProjectId                  primitive.ObjectID `json:"project_id" bson:"project_id"`   // project of a project, spider or schedule variable
+	SpiderId                   primitive.ObjectID `json:"spider_id" bson:"spider_id"`     // spider of a spider or schedule variable
+	ScheduleId                 primitive.ObjectID `json:"schedule_id" bson:"schedule_id"` // schedule of a schedule variable
 }
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type GitCredentialV2 struct {
+	any                          `collection:"git_credentials"`
+	BaseModelV2[GitCredentialV2] `bson:",inline"`
+	Name                         string             `json:"name" bson:"name"`
+	Description                  string             `json:"description" bson:"description"`
+	Type                         string             `json:"type" bson:"type"` // ssh or http
+	Username                     string             `json:"username" bson:"username"`
+	Password                     string             `json:"-" bson:"password"`            // encrypted password or access token (http)
+	PrivateKey                   string             `json:"-" bson:"private_key"`         // encrypted private key (ssh)
+	PublicKey                    string             `json:"public_key" bson:"public_key"` // authorized_keys format (ssh)
+	Fingerprint                  string             `json:"fingerprint" bson:"fingerprint"`
+	KnownHosts                   string             `json:"known_hosts" bson:"known_hosts"` // pinned host keys in known_hosts format (ssh)
+	GitId                        primitive.ObjectID `json:"git_id" bson:"git_id"`           // GitV2.Id if it is a deploy key of a single repository
+}
@@ -1,12 +1,23 @@
 package models
 
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
 type GitV2 struct {
 	any                `collection:"gits"`
 	BaseModelV2[GitV2] `bson:",inline"`
-	Url                string `json:"url" bson:"url"`
-	AuthType           string `json:"auth_type" bson:"auth_type"`
-	Username           string `json:"username" bson:"username"`
-	Password           string `json:"password" bson:"password"`
-	CurrentBranch      string `json:"current_branch" bson:"current_branch"`
-	AutoPull           bool   `json:"auto_pull" bson:"auto_pull"`
+	Url                string             `json:"url" bson:"url"`
+	AuthType           string             `json:"auth_type" bson:"auth_type"`
+	Username           string             `json:"username" bson:"username"`
+	Password           string             `json:"-" bson:"password,omitempty"`                  // deprecated: migrated to GitCredentialV2
+	CredentialId       primitive.ObjectID `json:"credential_id" bson:"credential_id,omitempty"` // GitCredentialV2.Id
+	CurrentBranch      string             `json:"current_branch" bson:"current_branch"`
+	CurrentRef         string             `json:"current_ref" bson:"current_ref"` // tag or commit hash checked out, empty if following current branch
+	AutoPull           bool               `json:"auto_pull" bson:"auto_pull"`
+
+	// webhook
+	WebhookEnabled bool   `json:"webhook_enabled" bson:"webhook_enabled"`   // whether to pull on webhook deliveries instead of polling
+	WebhookSecret  string `json:"-" bson:"webhook_secret"`                  // secret to verify webhook signatures, write-only
+	WebhookAutoRun bool   `json:"webhook_auto_run" bson:"webhook_auto_run"` // whether to run the spider after pulling
 }
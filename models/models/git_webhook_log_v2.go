@@ -0,0 +1,21 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type GitWebhookLogV2 struct {
+	any                          `collection:"git_webhook_logs"`
+	BaseModelV2[GitWebhookLogV2] `bson:",inline"`
+	Provider                     string               `json:"provider" bson:"provider"`       // github, gitlab, gitea or generic
+	Event                        string               `json:"event" bson:"event"`             // event name sent by the provider
+	DeliveryId                   string               `json:"delivery_id" bson:"delivery_id"` // delivery id sent by the provider
+	Url                          string               `json:"url" bson:"url"`                 // repository url
+	Branch                       string               `json:"branch" bson:"branch"`           // pushed branch
+	Commit                       string               `json:"commit" bson:"commit"`           // head commit after push
+	GitIds                       []primitive.ObjectID `json:"git_ids" bson:"git_ids"`         // matched GitV2.Id
+	TaskIds                      []primitive.ObjectID `json:"task_ids" bson:"task_ids"`       // tasks enqueued after pull
+	Status                       string               `json:"status" bson:"status"`
+	Error                        string               `json:"error" bson:"error"`
+	RemoteAddr                   string               `json:"remote_addr" bson:"remote_addr"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// LeaseV2 is a lease held by a node for a limited time, e.g. the leadership
+// of masters
+type LeaseV2 struct {
+	any                  `collection:"leases"`
+	BaseModelV2[LeaseV2] `bson:",inline"`
+	Name                 string    `json:"name" bson:"name"`
+	Holder               string    `json:"holder" bson:"holder"` // node key
+	AcquiredAt           time.Time `json:"acquired_at" bson:"acquired_at"`
+	ExpiresAt            time.Time `json:"expires_at" bson:"expires_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+type LoginAttemptV2 struct {
+	any                         `collection:"login_attempts"`
+	BaseModelV2[LoginAttemptV2] `bson:",inline"`
+	Key                         string    `json:"key" bson:"key"`
+	Failures                    int       `json:"failures" bson:"failures"`
+	LastFailedAt                time.Time `json:"last_failed_at" bson:"last_failed_at"`
+	LockedUntil                 time.Time `json:"locked_until" bson:"locked_until"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// CertAuthorityV2 is the certificate authority shared by masters to issue
+// certificates of nodes
+type CertAuthorityV2 struct {
+	any                          `collection:"cert_authorities"`
+	BaseModelV2[CertAuthorityV2] `bson:",inline"`
+	Name                         string `json:"name" bson:"name"`
+	Certificate                  string `json:"certificate" bson:"certificate"` // PEM
+	Key                          string `json:"-" bson:"key"`                   // PEM encrypted with a secret key
+	KeyId                        string `json:"-" bson:"key_id"`                // id of the secret key
+}
+
+// NodeCertificateV2 is a certificate issued to a worker node
+type NodeCertificateV2 struct {
+	any                            `collection:"node_certificates"`
+	BaseModelV2[NodeCertificateV2] `bson:",inline"`
+	NodeId                         primitive.ObjectID `json:"node_id" bson:"node_id"`
+	NodeKey                        string             `json:"node_key" bson:"node_key"`
+	SerialNumber                   string             `json:"serial_number" bson:"serial_number"` // hex
+	Fingerprint                    string             `json:"fingerprint" bson:"fingerprint"`     // sha256 of the certificate
+	NotBefore                      time.Time          `json:"not_before" bson:"not_before"`
+	NotAfter                       time.Time          `json:"not_after" bson:"not_after"`
+	RevokedAt                      *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	RevokedBy                      primitive.ObjectID `json:"revoked_by,omitempty" bson:"revoked_by,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// JoinTokenV2 is a one-time token with which a worker registers and is
+// issued a node credential
+type JoinTokenV2 struct {
+	any                      `collection:"join_tokens"`
+	BaseModelV2[JoinTokenV2] `bson:",inline"`
+	Name                     string             `json:"name" bson:"name"`
+	Token                    string             `json:"token,omitempty" bson:"-"` // plain token, only returned once on creation
+	TokenHash                string             `json:"-" bson:"token_hash"`
+	Prefix                   string             `json:"prefix" bson:"prefix"`
+	RequireApproval          bool               `json:"require_approval" bson:"require_approval"` // nodes joined with the token wait for approval
+	ExpiresAt                time.Time          `json:"expires_at" bson:"expires_at"`
+	UsedAt                   time.Time          `json:"used_at" bson:"used_at"`
+	UsedBy                   primitive.ObjectID `json:"used_by" bson:"used_by"` // node id
+}
+
+// NodeCredentialV2 is the secret with which a worker authenticates, of
+// which only the sha256 hash is stored
+type NodeCredentialV2 struct {
+	any                           `collection:"node_credentials"`
+	BaseModelV2[NodeCredentialV2] `bson:",inline"`
+	NodeId                        primitive.ObjectID `json:"node_id" bson:"node_id"`
+	NodeKey                       string             `json:"node_key" bson:"node_key"`
+	Hash                          string             `json:"-" bson:"hash"`
+	JoinTokenId                   primitive.ObjectID `json:"join_token_id" bson:"join_token_id"`
+	Revoked                       bool               `json:"revoked" bson:"revoked"`
+	RevokedAt                     time.Time          `json:"revoked_at" bson:"revoked_at"`
+	RevokedBy                     primitive.ObjectID `json:"revoked_by" bson:"revoked_by"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// NodeResources are resources of a node reported in heartbeats
+type NodeResources struct {
+	CpuCount        int       `json:"cpu_count" bson:"cpu_count"`
+	Load1           float64   `json:"load1" bson:"load1"`
+	Load5           float64   `json:"load5" bson:"load5"`
+	Load15          float64   `json:"load15" bson:"load15"`
+	MemoryTotal     uint64    `json:"memory_total" bson:"memory_total"`         // bytes
+	MemoryAvailable uint64    `json:"memory_available" bson:"memory_available"` // bytes
+	DiskTotal       uint64    `json:"disk_total" bson:"disk_total"`             // bytes of the disk of the workspace
+	DiskFree        uint64    `json:"disk_free" bson:"disk_free"`               // bytes of the disk of the workspace
+	WorkspaceSize   uint64    `json:"workspace_size" bson:"workspace_size"`     // bytes
+	ReportedAt      time.Time `json:"reported_at" bson:"reported_at"`
+}
+
+// NodeResourceV2 is a record of resources of a node in history
+type NodeResourceV2 struct {
+	any                         `collection:"node_resources"`
+	BaseModelV2[NodeResourceV2] `bson:",inline"`
+	NodeId                      primitive.ObjectID `json:"node_id" bson:"node_id"`
+	NodeResources               `bson:",inline"`
+}
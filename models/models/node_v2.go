@@ -1,24 +1,47 @@
 package models
 
 import (
+	"github.com/crawlab-team/crawlab-core/entity"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"time"
 )
 
 type NodeV2 struct {
 	any                 `collection:"nodes"`
 	BaseModelV2[NodeV2] `bson:",inline"`
-	Key                 string    `json:"key" bson:"key"`
-	Name                string    `json:"name" bson:"name"`
-	Ip                  string    `json:"ip" bson:"ip"`
-	Port                string    `json:"port" bson:"port"`
-	Mac                 string    `json:"mac" bson:"mac"`
-	Hostname            string    `json:"hostname" bson:"hostname"`
-	Description         string    `json:"description" bson:"description"`
-	IsMaster            bool      `json:"is_master" bson:"is_master"`
-	Status              string    `json:"status" bson:"status"`
-	Enabled             bool      `json:"enabled" bson:"enabled"`
-	Active              bool      `json:"active" bson:"active"`
-	ActiveAt            time.Time `json:"active_at" bson:"active_ts"`
-	AvailableRunners    int       `json:"available_runners" bson:"available_runners"`
-	MaxRunners          int       `json:"max_runners" bson:"max_runners"`
+	Key                 string              `json:"key" bson:"key"`
+	Name                string              `json:"name" bson:"name"`
+	Ip                  string              `json:"ip" bson:"ip"`
+	Port                string              `json:"port" bson:"port"`
+	Mac                 string              `json:"mac" bson:"mac"`
+	Hostname            string              `json:"hostname" bson:"hostname"`
+	Description         string              `json:"description" bson:"description"`
+	IsMaster            bool                `json:"is_master" bson:"is_master"`
+	Status              string              `json:"status" bson:"status"`
+	Enabled             bool                `json:"enabled" bson:"enabled"`
+	Active              bool                `json:"active" bson:"active"`
+	ActiveAt            time.Time           `json:"active_at" bson:"active_ts"`
+	AvailableRunners    int                 `json:"available_runners" bson:"available_runners"`
+	MaxRunners          int                 `json:"max_runners" bson:"max_runners"`
+	Labels              map[string]string   `json:"labels" bson:"labels,omitempty"`                 // key/value labels matched by node selectors
+	Drain               *NodeDrain          `json:"drain,omitempty" bson:"drain,omitempty"`         // set while the node is draining or drained
+	Resources           *NodeResources      `json:"resources,omitempty" bson:"resources,omitempty"` // latest reported resources
+	Version             *entity.NodeVersion `json:"version,omitempty" bson:"version,omitempty"`     // reported at registration
+}
+
+// NodeDrain is the state of draining a node, during which the node accepts
+// no new tasks
+type NodeDrain struct {
+	StartedAt     time.Time          `json:"started_at" bson:"started_at"`
+	StartedBy     primitive.ObjectID `json:"started_by" bson:"started_by"`
+	Deadline      time.Time          `json:"deadline" bson:"deadline"`             // running tasks are cancelled and re-queued after deadline, or waited for if zero
+	Reassign      bool               `json:"reassign" bson:"reassign"`             // whether queued tasks pinned to the node are reassigned to other nodes
+	RunningTasks  int                `json:"running_tasks" bson:"running_tasks"`   // tasks still running on the node
+	RequeuedTasks int                `json:"requeued_tasks" bson:"requeued_tasks"` // running tasks cancelled and re-queued after deadline
+	DrainedAt     time.Time          `json:"drained_at" bson:"drained_at"`         // zero until no task is running on the node
+}
+
+// IsDrained returns true if no task is running on the draining node
+func (d *NodeDrain) IsDrained() bool {
+	return d != nil && !d.DrainedAt.IsZero()
 }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// OidcStateV2 is a pending OpenID Connect login, kept until the provider
+// redirects back to the callback of any master. It is bound to the browser
+// starting the login by a cookie, of which only the hash is stored.
+type OidcStateV2 struct {
+	any                      `collection:"oidc_states"`
+	BaseModelV2[OidcStateV2] `bson:",inline"`
+	StateHash                string    `json:"-" bson:"state_hash"`
+	BindingHash              string    `json:"-" bson:"binding_hash"`
+	Nonce                    string    `json:"-" bson:"nonce"`
+	Verifier                 string    `json:"-" bson:"verifier"`
+	ExpiresAt                time.Time `json:"expires_at" bson:"expires_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ProjectMemberV2 struct {
+	any                          `collection:"project_members"`
+	BaseModelV2[ProjectMemberV2] `bson:",inline"`
+	ProjectId                    primitive.ObjectID `json:"project_id" bson:"project_id"`
+	UserId                       primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Role                         string             `json:"role" bson:"role"`
+}
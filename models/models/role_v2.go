@@ -6,4 +6,5 @@ type RoleV2 struct {
 	Key                 string `json:"key" bson:"key"`
 	Name                string `json:"name" bson:"name"`
 	Description         string `json:"description" bson:"description"`
+	RequireTotp         bool   `json:"require_totp" bson:"require_totp"`
 }
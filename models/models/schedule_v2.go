@@ -15,8 +15,10 @@ type ScheduleV2 struct {
 	EntryId                 cron.EntryID         `json:"entry_id" bson:"entry_id"`
 	Cmd                     string               `json:"cmd" bson:"cmd"`
 	Param                   string               `json:"param" bson:"param"`
+	Params                  map[string]any       `json:"params" bson:"params"` // typed parameters of the spider param schema
 	Mode                    string               `json:"mode" bson:"mode"`
 	NodeIds                 []primitive.ObjectID `json:"node_ids" bson:"node_ids"`
+	NodeSelector            string               `json:"node_selector" bson:"node_selector"`
 	Priority                int                  `json:"priority" bson:"priority"`
 	Enabled                 bool                 `json:"enabled" bson:"enabled"`
 	UserId                  primitive.ObjectID   `json:"user_id" bson:"user_id"`
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SecretV2 struct {
+	any                   `collection:"secrets"`
+	BaseModelV2[SecretV2] `bson:",inline"`
+	Key                   string             `json:"key" bson:"key"`               // name of the environment variable
+	Value                 string             `json:"value,omitempty" bson:"value"` // encrypted value
+	KeyId                 string             `json:"key_id" bson:"key_id"`         // id of the encryption key
+	Description           string             `json:"description" bson:"description"`
+	ProjectId             primitive.ObjectID `json:"project_id" bson:"project_id"` // project of a project or spider secret
+	SpiderId              primitive.ObjectID `json:"spider_id" bson:"spider_id"`   // spider of a spider secret
+}
+
+// MarshalJSON omits the value, so that secrets are write-only in API
+// responses. Values are still decoded from JSON in API requests.
+func (s SecretV2) MarshalJSON() ([]byte, error) {
+	type secret SecretV2
+	v := secret(s)
+	v.Value = ""
+	return json.Marshal(v)
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type SessionV2 struct {
+	any                    `collection:"sessions"`
+	BaseModelV2[SessionV2] `bson:",inline"`
+	UserId                 primitive.ObjectID `json:"user_id" bson:"user_id"`
+	RefreshTokenHash       string             `json:"-" bson:"refresh_token_hash"`
+	PrevRefreshTokenHash   string             `json:"-" bson:"prev_refresh_token_hash"`
+	Ip                     string             `json:"ip" bson:"ip"`
+	UserAgent              string             `json:"user_agent" bson:"user_agent"`
+	ExpiresAt              time.Time          `json:"expires_at" bson:"expires_at"`
+	LastUsedAt             time.Time          `json:"last_used_at" bson:"last_used_at"`
+	Revoked                bool               `json:"revoked" bson:"revoked"`
+	RevokedAt              time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	Current                bool               `json:"current" bson:"-"`
+}
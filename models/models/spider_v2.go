@@ -17,14 +17,36 @@ type SpiderV2 struct {
 	ProjectId             primitive.ObjectID   `json:"project_id" bson:"project_id"`         // Project.Id
 	Mode                  string               `json:"mode" bson:"mode"`                     // default Task.Mode
 	NodeIds               []primitive.ObjectID `json:"node_ids" bson:"node_ids"`             // default Task.NodeIds
+	NodeSelector          string               `json:"node_selector" bson:"node_selector"`   // default Task.NodeSelector
 	Stat                  *SpiderStatV2        `json:"stat,omitempty" bson:"-"`
 
 	// execution
-	Cmd         string `json:"cmd" bson:"cmd"`     // execute command
-	Param       string `json:"param" bson:"param"` // default task param
-	Priority    int    `json:"priority" bson:"priority"`
-	AutoInstall bool   `json:"auto_install" bson:"auto_install"`
+	Cmd               string        `json:"cmd" bson:"cmd"`                   // execute command
+	Param             string        `json:"param" bson:"param"`               // default task param
+	ParamSchema       []SpiderParam `json:"param_schema" bson:"param_schema"` // typed parameters of tasks
+	Priority          int           `json:"priority" bson:"priority"`
+	AutoInstall       bool          `json:"auto_install" bson:"auto_install"`
+	RequeueOnLostNode bool          `json:"requeue_on_lost_node" bson:"requeue_on_lost_node"` // whether tasks of lost nodes are re-queued on other nodes
+	MinMemory         int           `json:"min_memory" bson:"min_memory"`                     // minimum available memory (MB) of nodes to run tasks
+	MinCpu            int           `json:"min_cpu" bson:"min_cpu"`                           // minimum cpu count of nodes to run tasks
 
 	// settings
 	IncrementalSync bool `json:"incremental_sync" bson:"incremental_sync"` // whether to incrementally sync files
 }
+
+// SpiderParam is a typed parameter of tasks of a spider, which is passed to
+// the command as CRAWLAB_PARAM_<NAME> environment variable and as arguments
+// if Flag is set
+type SpiderParam struct {
+	Name        string `json:"name" bson:"name"`
+	Type        string `json:"type" bson:"type"` // string, integer, number or boolean
+	Default     any    `json:"default" bson:"default"`
+	Enum        []any  `json:"enum" bson:"enum"` // allowed values if not empty
+	Required    bool   `json:"required" bson:"required"`
+	Description string `json:"description" bson:"description"`
+
+	// Flag is the arguments to pass the value with, e.g. "--page" for
+	// "--page 3", "--page=" for "--page=3" or "-a page=" for "-a page=3".
+	// Boolean flags without "=" are passed without value if true.
+	Flag string `json:"flag" bson:"flag"`
+}
@@ -9,4 +9,7 @@ type TaskQueueItemV2 struct {
 	BaseModelV2[TaskQueueItemV2] `bson:",inline"`
 	Priority                     int                `json:"p" bson:"p"`
 	NodeId                       primitive.ObjectID `json:"nid,omitempty" bson:"nid,omitempty"`
+	NodeSelector                 string             `json:"ns,omitempty" bson:"ns,omitempty"` // label selector of nodes, matched when the task is fetched
+	MinMemory                    int                `json:"mm,omitempty" bson:"mm,omitempty"` // minimum available memory (MB) of nodes
+	MinCpu                       int                `json:"mc,omitempty" bson:"mc,omitempty"` // minimum cpu count of nodes
 }
@@ -19,8 +19,13 @@ type TaskV2 struct {
 	Type                string               `json:"type" bson:"type"`
 	Mode                string               `json:"mode" bson:"mode"`
 	NodeIds             []primitive.ObjectID `json:"node_ids" bson:"node_ids"`
+	NodeSelector        string               `json:"node_selector" bson:"node_selector"` // label selector of nodes to run the task
 	ParentId            primitive.ObjectID   `json:"parent_id" bson:"parent_id"`
 	Priority            int                  `json:"priority" bson:"priority"`
+	GitCommit           string               `json:"git_commit" bson:"git_commit"`                           // commit hash of spider git repository when the task was scheduled
+	Envs                map[string]string    `json:"envs,omitempty" bson:"envs,omitempty"`                   // environment variables of run options
+	Params              map[string]string    `json:"params,omitempty" bson:"params,omitempty"`               // validated typed parameters
+	RequeuedFrom        primitive.ObjectID   `json:"requeued_from,omitempty" bson:"requeued_from,omitempty"` // task cancelled and re-queued as this task
 	Stat                *TaskStatV2          `json:"stat,omitempty" bson:"-"`
 	HasSub              bool                 `json:"has_sub" json:"has_sub"`
 	SubTasks            []TaskV2             `json:"sub_tasks,omitempty" bson:"-"`
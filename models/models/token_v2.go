@@ -1,8 +1,19 @@
 package models
 
+import (
+	"time"
+)
+
 type TokenV2 struct {
 	any                  `collection:"tokens"`
 	BaseModelV2[TokenV2] `bson:",inline"`
-	Name                 string `json:"name" bson:"name"`
-	Token                string `json:"token" bson:"token"`
+	Name                 string    `json:"name" bson:"name"`
+	Token                string    `json:"token,omitempty" bson:"-"` // plain token, only returned once on creation
+	TokenHash            string    `json:"-" bson:"token_hash"`
+	Prefix               string    `json:"prefix" bson:"prefix"`
+	Scopes               []string  `json:"scopes" bson:"scopes"`
+	ExpiresAt            time.Time `json:"expires_at" bson:"expires_at"` // zero value means never expires
+	LastUsedAt           time.Time `json:"last_used_at" bson:"last_used_at"`
+	Revoked              bool      `json:"revoked" bson:"revoked"`
+	RevokedAt            time.Time `json:"revoked_at" bson:"revoked_at"`
 }
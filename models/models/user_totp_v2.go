@@ -0,0 +1,15 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type UserTotpV2 struct {
+	any                     `collection:"user_totps"`
+	BaseModelV2[UserTotpV2] `bson:",inline"`
+	UserId                  primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Secret                  string             `json:"-" bson:"secret"`
+	Enabled                 bool               `json:"enabled" bson:"enabled"`
+	RecoveryCodes           []string           `json:"-" bson:"recovery_codes"`
+	LastStep                int64              `json:"-" bson:"last_step"`
+}
@@ -1,10 +1,17 @@
 package models
 
+import (
+	"time"
+)
+
 type UserV2 struct {
 	any                 `collection:"users"`
 	BaseModelV2[UserV2] `bson:",inline"`
-	Username            string `json:"username" bson:"username"`
-	Password            string `json:"-,omitempty" bson:"password"`
-	Role                string `json:"role" bson:"role"`
-	Email               string `json:"email" bson:"email"`
+	Username            string    `json:"username" bson:"username"`
+	Password            string    `json:"-,omitempty" bson:"password"`
+	Role                string    `json:"role" bson:"role"`
+	Email               string    `json:"email" bson:"email"`
+	AuthSource          string    `json:"auth_source,omitempty" bson:"auth_source,omitempty"`
+	ExternalId          string    `json:"external_id,omitempty" bson:"external_id,omitempty"`
+	PasswordUpdatedAt   time.Time `json:"password_updated_at" bson:"password_updated_at"`
 }
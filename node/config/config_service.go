@@ -5,6 +5,7 @@ import (
 	"github.com/crawlab-team/crawlab-core/config"
 	"github.com/crawlab-team/crawlab-core/entity"
 	"github.com/crawlab-team/crawlab-core/interfaces"
+	"github.com/crawlab-team/crawlab-core/node/version"
 	"github.com/crawlab-team/crawlab-core/utils"
 	"github.com/crawlab-team/go-trace"
 	"os"
@@ -61,6 +62,7 @@ func (svc *Service) GetBasicNodeInfo() (res interfaces.Entity) {
 		IsMaster:   svc.IsMaster(),
 		AuthKey:    svc.GetAuthKey(),
 		MaxRunners: svc.GetMaxRunners(),
+		Version:    version.GetCurrent(),
 	}
 }
 
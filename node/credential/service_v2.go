@@ -0,0 +1,288 @@
+package credential
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	errors2 "errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/crawlab-team/go-trace"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/metadata"
+	"sync"
+	"time"
+)
+
+// Workers may be required to authenticate with per-node credentials instead
+// of the shared auth key alone. An admin creates a one-time join token, with
+// which a worker registers the first time and is issued a credential. The
+// worker then sends its node key and credential in the headers of each gRPC
+// request, and the node key of requests is taken from them. Credentials are
+// stored hashed and can be revoked per node, after which the worker has to
+// join again with a new token. New nodes may wait in pending approval
+// status, in which they fetch no tasks and can only call the node service,
+// until approved by an admin. Settings:
+//
+//	node.registration.requireToken     require join tokens and node credentials
+//	node.registration.requireApproval  new nodes wait for approval
+//	node.joinToken                     join token of a worker registering the first time
+
+// cacheDuration is the duration of caching verified credentials, after
+// which revocations on other masters take effect
+const cacheDuration = 30 * time.Second
+
+// IsRequired returns true if workers must authenticate with credentials
+func IsRequired() bool {
+	return viper.GetBool("node.registration.requireToken")
+}
+
+// IsApprovalRequired returns true if new nodes wait for approval
+func IsApprovalRequired() bool {
+	return viper.GetBool("node.registration.requireApproval")
+}
+
+type cacheItem struct {
+	hash      string
+	nodeId    primitive.ObjectID
+	status    string
+	checkedAt time.Time
+}
+
+type ServiceV2 struct {
+	cache map[string]cacheItem // by node key
+	mu    sync.Mutex
+}
+
+// CreateJoinToken creates a join token. The plain token is only set in the
+// returned model and is not stored.
+func (svc *ServiceV2) CreateJoinToken(name string, requireApproval bool, expiresAt time.Time, by primitive.ObjectID) (t *models.JoinTokenV2, err error) {
+	tokenStr, err := generate(constants.JoinTokenPrefix)
+	if err != nil {
+		return nil, err
+	}
+	t = &models.JoinTokenV2{
+		Name:            name,
+		TokenHash:       utils.EncryptSha256(tokenStr),
+		Prefix:          tokenStr[:len(constants.JoinTokenPrefix)+6],
+		RequireApproval: requireApproval,
+		ExpiresAt:       expiresAt,
+	}
+	t.SetCreated(by)
+	t.SetUpdated(by)
+	id, err := service.NewModelServiceV2[models.JoinTokenV2]().InsertOne(*t)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	t.SetId(id)
+	t.Token = tokenStr
+	return t, nil
+}
+
+// GetJoinToken returns a join token which is not used or expired
+func (svc *ServiceV2) GetJoinToken(tokenStr string) (t *models.JoinTokenV2, err error) {
+	t, err = service.NewModelServiceV2[models.JoinTokenV2]().GetOne(bson.M{"token_hash": utils.EncryptSha256(tokenStr)}, nil)
+	if err != nil {
+		return nil, errors.ErrorNodeInvalidJoinToken
+	}
+	if !t.UsedAt.IsZero() {
+		return nil, fmt.Errorf("%w: already used", errors.ErrorNodeInvalidJoinToken)
+	}
+	if !t.ExpiresAt.IsZero() && time.Now().After(t.ExpiresAt) {
+		return nil, fmt.Errorf("%w: expired", errors.ErrorNodeInvalidJoinToken)
+	}
+	return t, nil
+}
+
+// UseJoinToken validates a join token and marks it as used by a node, so
+// that it cannot be used again
+func (svc *ServiceV2) UseJoinToken(tokenStr string, nodeId primitive.ObjectID) (t *models.JoinTokenV2, err error) {
+	t, err = svc.GetJoinToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	modelSvc := service.NewModelServiceV2[models.JoinTokenV2]()
+
+	// mark as used only if not used concurrently
+	now := time.Now()
+	res, err := modelSvc.GetCol().GetCollection().UpdateOne(modelSvc.GetCol().GetContext(), bson.M{
+		"_id":     t.Id,
+		"used_at": t.UsedAt,
+	}, bson.M{"$set": bson.M{
+		"used_at":    now,
+		"used_by":    nodeId,
+		"updated_ts": now,
+	}})
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if res.ModifiedCount == 0 {
+		return nil, fmt.Errorf("%w: already used", errors.ErrorNodeInvalidJoinToken)
+	}
+	t.UsedAt = now
+	t.UsedBy = nodeId
+	return t, nil
+}
+
+// Issue issues a credential to a node and revokes its previous credentials.
+// The plain credential is returned and is not stored.
+func (svc *ServiceV2) Issue(n *models.NodeV2, joinTokenId primitive.ObjectID) (credential string, err error) {
+	if _, err := svc.Revoke(n.Id, primitive.NilObjectID); err != nil {
+		return "", err
+	}
+	credential, err = generate(constants.NodeCredentialPrefix)
+	if err != nil {
+		return "", err
+	}
+	c := models.NodeCredentialV2{
+		NodeId:      n.Id,
+		NodeKey:     n.Key,
+		Hash:        utils.EncryptSha256(credential),
+		JoinTokenId: joinTokenId,
+	}
+	c.SetCreated(primitive.NilObjectID)
+	c.SetUpdated(primitive.NilObjectID)
+	if _, err := service.NewModelServiceV2[models.NodeCredentialV2]().InsertOne(c); err != nil {
+		return "", trace.TraceError(err)
+	}
+	log.Infof("[NodeCredentialServiceV2] issued credential to node[%s]", n.Key)
+	return credential, nil
+}
+
+// Revoke revokes credentials of a node, and returns the number of revoked
+// credentials
+func (svc *ServiceV2) Revoke(nodeId primitive.ObjectID, by primitive.ObjectID) (n int, err error) {
+	modelSvc := service.NewModelServiceV2[models.NodeCredentialV2]()
+	query := bson.M{
+		"node_id": nodeId,
+		"revoked": false,
+	}
+	credentials, err := modelSvc.GetMany(query, nil)
+	if err != nil && !errors2.Is(err, mongo.ErrNoDocuments) {
+		return 0, trace.TraceError(err)
+	}
+	if len(credentials) == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	if err := modelSvc.UpdateMany(query, bson.M{"$set": bson.M{
+		"revoked":    true,
+		"revoked_at": now,
+		"revoked_by": by,
+		"updated_ts": now,
+		"updated_by": by,
+	}}); err != nil {
+		return 0, trace.TraceError(err)
+	}
+
+	svc.mu.Lock()
+	for _, c := range credentials {
+		delete(svc.cache, c.NodeKey)
+	}
+	svc.mu.Unlock()
+	return len(credentials), nil
+}
+
+// HasCredential returns true if a node key has an active credential
+func (svc *ServiceV2) HasCredential(nodeKey string) (ok bool, err error) {
+	n, err := service.NewModelServiceV2[models.NodeCredentialV2]().Count(bson.M{
+		"node_key": nodeKey,
+		"revoked":  false,
+	})
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	return n > 0, nil
+}
+
+// Verify verifies the credential of a node, and returns the status of the
+// node
+func (svc *ServiceV2) Verify(nodeKey string, credential string) (status string, err error) {
+	if nodeKey == "" || credential == "" {
+		return "", errors.ErrorNodeInvalidCredential
+	}
+	hash := utils.EncryptSha256(credential)
+
+	svc.mu.Lock()
+	item, ok := svc.cache[nodeKey]
+	svc.mu.Unlock()
+	if !ok || time.Since(item.checkedAt) > cacheDuration {
+		c, err := service.NewModelServiceV2[models.NodeCredentialV2]().GetOne(bson.M{
+			"node_key": nodeKey,
+			"revoked":  false,
+		}, nil)
+		if err != nil {
+			if errors2.Is(err, mongo.ErrNoDocuments) {
+				return "", errors.ErrorNodeInvalidCredential
+			}
+			return "", trace.TraceError(err)
+		}
+		n, err := service.NewModelServiceV2[models.NodeV2]().GetById(c.NodeId)
+		if err != nil {
+			return "", errors.ErrorNodeInvalidCredential
+		}
+		item = cacheItem{hash: c.Hash, nodeId: n.Id, status: n.Status, checkedAt: time.Now()}
+		svc.mu.Lock()
+		svc.cache[nodeKey] = item
+		svc.mu.Unlock()
+	}
+	if item.hash != hash {
+		return "", errors.ErrorNodeInvalidCredential
+	}
+	return item.status, nil
+}
+
+// Forget removes a node from the cache, e.g. after its status is changed
+func (svc *ServiceV2) Forget(nodeKey string) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	delete(svc.cache, nodeKey)
+}
+
+// FromIncomingContext returns the node key and credential in the headers of
+// a gRPC request
+func FromIncomingContext(ctx context.Context) (nodeKey string, credential string) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", ""
+	}
+	if v := md.Get(constants.GrpcHeaderNodeKey); len(v) == 1 {
+		nodeKey = v[0]
+	}
+	if v := md.Get(constants.GrpcHeaderNodeCredential); len(v) == 1 {
+		credential = v[0]
+	}
+	return nodeKey, credential
+}
+
+func generate(prefix string) (res string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", trace.TraceError(err)
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+func NewNodeCredentialServiceV2() (svc *ServiceV2) {
+	return &ServiceV2{
+		cache: map[string]cacheItem{},
+	}
+}
+
+var credentialSvcV2 *ServiceV2
+
+func GetNodeCredentialServiceV2() (svc *ServiceV2) {
+	if credentialSvcV2 != nil {
+		return credentialSvcV2
+	}
+	credentialSvcV2 = NewNodeCredentialServiceV2()
+	return credentialSvcV2
+}
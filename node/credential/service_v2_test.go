@@ -0,0 +1,42 @@
+package credential
+
+import (
+	"context"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	c1, err := generate(constants.NodeCredentialPrefix)
+	require.Nil(t, err)
+	c2, err := generate(constants.NodeCredentialPrefix)
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(c1, constants.NodeCredentialPrefix))
+	require.Len(t, c1, len(constants.NodeCredentialPrefix)+64)
+	require.NotEqual(t, c1, c2)
+}
+
+func TestFromIncomingContext(t *testing.T) {
+	nodeKey, c := FromIncomingContext(context.Background())
+	require.Empty(t, nodeKey)
+	require.Empty(t, c)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		constants.GrpcHeaderNodeKey, "worker-1",
+		constants.GrpcHeaderNodeCredential, "crawlab_node_abc",
+	))
+	nodeKey, c = FromIncomingContext(ctx)
+	require.Equal(t, "worker-1", nodeKey)
+	require.Equal(t, "crawlab_node_abc", c)
+}
+
+func TestVerifyEmpty(t *testing.T) {
+	svc := NewNodeCredentialServiceV2()
+	_, err := svc.Verify("", "crawlab_node_abc")
+	require.NotNil(t, err)
+	_, err = svc.Verify("worker-1", "")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,56 @@
+package credential
+
+import (
+	"github.com/crawlab-team/crawlab-core/config"
+	"github.com/crawlab-team/go-trace"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// credentialFileName is the file of the credential of a worker, next to
+// its config
+const credentialFileName = "credential"
+
+var (
+	credential       string
+	credentialLoaded bool
+	credentialMu     sync.Mutex
+)
+
+// Load returns the credential of the current worker, or empty if it has not
+// joined yet
+func Load() string {
+	credentialMu.Lock()
+	defer credentialMu.Unlock()
+	if credentialLoaded {
+		return credential
+	}
+	data, err := os.ReadFile(getPath())
+	if err == nil {
+		credential = strings.TrimSpace(string(data))
+	}
+	credentialLoaded = true
+	return credential
+}
+
+// Save saves the credential of the current worker
+func Save(c string) (err error) {
+	credentialMu.Lock()
+	defer credentialMu.Unlock()
+	path := getPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return trace.TraceError(err)
+	}
+	if err := os.WriteFile(path, []byte(c), 0600); err != nil {
+		return trace.TraceError(err)
+	}
+	credential = c
+	credentialLoaded = true
+	return nil
+}
+
+func getPath() string {
+	return filepath.Join(filepath.Dir(config.GetConfigPath()), credentialFileName)
+}
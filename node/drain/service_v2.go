@@ -0,0 +1,244 @@
+package drain
+
+import (
+	errors2 "errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/audit"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/task/scheduler"
+	"github.com/crawlab-team/go-trace"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// A draining node (models.NodeV2.Drain is set) fetches no new tasks. The
+// master checks draining nodes on each monitor round: queued tasks pinned to
+// the node are reassigned to any node if requested, running tasks are
+// cancelled and re-queued once the deadline has passed, and the node is
+// reported as drained when no task is running on it. The node accepts new
+// tasks again after it is resumed.
+
+type ServiceV2 struct {
+}
+
+// Drain starts draining a node. Running tasks are waited for if timeout is
+// zero.
+func (svc *ServiceV2) Drain(id primitive.ObjectID, timeout time.Duration, reassign bool, by primitive.ObjectID) (n *models.NodeV2, err error) {
+	modelSvc := service.NewModelServiceV2[models.NodeV2]()
+	n, err = modelSvc.GetById(id)
+	if err != nil {
+		return nil, err
+	}
+	if n.Drain != nil {
+		return nil, errors.ErrorNodeDraining
+	}
+
+	// started_at identifies the draining in updates, and is stored in
+	// milliseconds
+	n.Drain = &models.NodeDrain{
+		StartedAt: time.Now().Truncate(time.Millisecond),
+		StartedBy: by,
+		Reassign:  reassign,
+	}
+	if timeout > 0 {
+		n.Drain.Deadline = n.Drain.StartedAt.Add(timeout)
+	}
+	if err := modelSvc.UpdateById(id, bson.M{"$set": bson.M{"drain": n.Drain}}); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	log.Infof("[NodeDrainServiceV2] node[%s] started draining", n.Key)
+
+	if err := svc.Check(n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Resume ends draining a node so that it accepts new tasks again
+func (svc *ServiceV2) Resume(id primitive.ObjectID) (n *models.NodeV2, err error) {
+	modelSvc := service.NewModelServiceV2[models.NodeV2]()
+	n, err = modelSvc.GetById(id)
+	if err != nil {
+		return nil, err
+	}
+	if n.Drain == nil {
+		return nil, errors.ErrorNodeNotDraining
+	}
+	if err := modelSvc.UpdateById(id, bson.M{"$unset": bson.M{"drain": ""}}); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	n.Drain = nil
+	log.Infof("[NodeDrainServiceV2] node[%s] resumed", n.Key)
+	return n, nil
+}
+
+// Check updates the state of a draining node, reassigning its queued tasks,
+// re-queuing running tasks after deadline and reporting when it is drained
+func (svc *ServiceV2) Check(n *models.NodeV2) (err error) {
+	d := n.Drain
+	if d == nil {
+		return nil
+	}
+
+	// queued tasks pinned to the node, which may be enqueued after draining
+	// started, e.g. by schedules
+	if d.Reassign {
+		if err := svc.reassignQueuedTasks(n); err != nil {
+			return err
+		}
+	}
+	if d.IsDrained() {
+		return nil
+	}
+
+	schedulerSvc, err := scheduler.GetTaskSchedulerServiceV2()
+	if err != nil {
+		return err
+	}
+	tasks, err := schedulerSvc.GetRunningTasks(n.Id)
+	if err != nil {
+		return err
+	}
+
+	// cancels and re-queues a running task after deadline
+	requeue := func(t *models.TaskV2) (ok bool, err error) {
+		if err := schedulerSvc.Cancel(t.Id, d.StartedBy); err != nil {
+			trace.PrintError(err)
+			return false, nil
+		}
+		t2, err := schedulerSvc.Requeue(t)
+		if err != nil {
+			return false, err
+		}
+		audit.GetAuditServiceV2().RecordSystem(
+			constants.AuditActionTaskRequeue,
+			"tasks",
+			t.Id,
+			fmt.Sprintf("task[%s] on draining node[%s] is cancelled and re-queued as task[%s]", t.Id.Hex(), n.Key, t2.Id.Hex()),
+		)
+		return true, nil
+	}
+	if err := updateDrain(d, tasks, time.Now(), requeue); err != nil {
+		return err
+	}
+
+	// skip if the node is resumed or drained again meanwhile
+	col := service.NewModelServiceV2[models.NodeV2]().GetCol()
+	res, err := col.GetCollection().UpdateOne(col.GetContext(), bson.M{
+		"_id":              n.Id,
+		"drain.started_at": d.StartedAt,
+	}, bson.M{"$set": bson.M{"drain": d}})
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if res.MatchedCount == 0 {
+		return nil
+	}
+	if d.IsDrained() {
+		log.Infof("[NodeDrainServiceV2] node[%s] is drained", n.Key)
+		audit.GetAuditServiceV2().RecordSystem(
+			constants.AuditActionNodeDrained,
+			"nodes",
+			n.Id,
+			fmt.Sprintf("node[%s] is drained", n.Key),
+		)
+	}
+	return nil
+}
+
+// updateDrain updates the state of a draining node with tasks running on
+// it. Running tasks are re-queued after deadline, except those failed to be
+// cancelled, which may still be running and are cancelled again in the next
+// round. requeue returns false if the task is not cancelled.
+func updateDrain(d *models.NodeDrain, tasks []models.TaskV2, now time.Time, requeue func(t *models.TaskV2) (ok bool, err error)) (err error) {
+	if !d.Deadline.IsZero() && now.After(d.Deadline) && len(tasks) > 0 {
+		var remaining []models.TaskV2
+		for _, t := range tasks {
+			ok, err := requeue(&t)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				remaining = append(remaining, t)
+				continue
+			}
+			d.RequeuedTasks++
+		}
+		tasks = remaining
+	}
+
+	d.RunningTasks = len(tasks)
+	if d.RunningTasks == 0 {
+		d.DrainedAt = now
+	}
+	return nil
+}
+
+// CheckAll checks all draining nodes
+func (svc *ServiceV2) CheckAll() (err error) {
+	nodes, err := service.NewModelServiceV2[models.NodeV2]().GetMany(bson.M{
+		"drain": bson.M{"$ne": nil},
+	}, nil)
+	if err != nil {
+		if errors2.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return trace.TraceError(err)
+	}
+	for _, n := range nodes {
+		if err := svc.Check(&n); err != nil {
+			trace.PrintError(err)
+		}
+	}
+	return nil
+}
+
+// reassignQueuedTasks unpins queued tasks from the node so that they can be
+// fetched by other nodes
+func (svc *ServiceV2) reassignQueuedTasks(n *models.NodeV2) (err error) {
+	items, err := service.NewModelServiceV2[models.TaskQueueItemV2]().GetMany(bson.M{"nid": n.Id}, nil)
+	if err != nil {
+		if errors2.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return trace.TraceError(err)
+	}
+	schedulerSvc, err := scheduler.GetTaskSchedulerServiceV2()
+	if err != nil {
+		return err
+	}
+	for _, tq := range items {
+		t, err := service.NewModelServiceV2[models.TaskV2]().GetById(tq.Id)
+		if err != nil {
+			trace.PrintError(err)
+			continue
+		}
+		if err := schedulerSvc.Unpin(t); err != nil {
+			return err
+		}
+	}
+	if len(items) > 0 {
+		log.Infof("[NodeDrainServiceV2] reassigned %d queued task(s) of node[%s]", len(items), n.Key)
+	}
+	return nil
+}
+
+func NewNodeDrainServiceV2() (svc *ServiceV2) {
+	return &ServiceV2{}
+}
+
+var drainSvcV2 *ServiceV2
+
+func GetNodeDrainServiceV2() (svc *ServiceV2) {
+	if drainSvcV2 != nil {
+		return drainSvcV2
+	}
+	drainSvcV2 = NewNodeDrainServiceV2()
+	return drainSvcV2
+}
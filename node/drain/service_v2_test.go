@@ -0,0 +1,90 @@
+package drain
+
+import (
+	"errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+func newTasks(n int) (tasks []models.TaskV2) {
+	for i := 0; i < n; i++ {
+		t := models.TaskV2{}
+		t.SetId(primitive.NewObjectID())
+		tasks = append(tasks, t)
+	}
+	return tasks
+}
+
+func TestUpdateDrain_BeforeDeadline(t *testing.T) {
+	now := time.Now()
+	d := &models.NodeDrain{StartedAt: now.Add(-time.Minute), Deadline: now.Add(time.Minute)}
+	requeue := func(task *models.TaskV2) (bool, error) {
+		panic("must not re-queue before deadline")
+	}
+
+	// running tasks are waited for
+	require.Nil(t, updateDrain(d, newTasks(2), now, requeue))
+	require.Equal(t, 2, d.RunningTasks)
+	require.Equal(t, 0, d.RequeuedTasks)
+	require.False(t, d.IsDrained())
+
+	// drained once no task is running
+	require.Nil(t, updateDrain(d, nil, now, requeue))
+	require.Equal(t, 0, d.RunningTasks)
+	require.True(t, d.IsDrained())
+	require.Equal(t, now, d.DrainedAt)
+}
+
+func TestUpdateDrain_NoDeadline(t *testing.T) {
+	now := time.Now()
+	d := &models.NodeDrain{StartedAt: now.Add(-time.Hour)}
+	requeue := func(task *models.TaskV2) (bool, error) {
+		panic("must not re-queue without deadline")
+	}
+	require.Nil(t, updateDrain(d, newTasks(1), now, requeue))
+	require.Equal(t, 1, d.RunningTasks)
+	require.False(t, d.IsDrained())
+}
+
+func TestUpdateDrain_AfterDeadline(t *testing.T) {
+	now := time.Now()
+	d := &models.NodeDrain{StartedAt: now.Add(-time.Hour), Deadline: now.Add(-time.Minute)}
+	tasks := newTasks(3)
+
+	// the second task fails to be cancelled and remains running
+	failed := tasks[1].Id
+	var requeued []primitive.ObjectID
+	requeue := func(task *models.TaskV2) (bool, error) {
+		if task.Id == failed {
+			return false, nil
+		}
+		requeued = append(requeued, task.Id)
+		return true, nil
+	}
+	require.Nil(t, updateDrain(d, tasks, now, requeue))
+	require.Equal(t, []primitive.ObjectID{tasks[0].Id, tasks[2].Id}, requeued)
+	require.Equal(t, 2, d.RequeuedTasks)
+	require.Equal(t, 1, d.RunningTasks)
+	require.False(t, d.IsDrained())
+
+	// cancelled in the next round
+	require.Nil(t, updateDrain(d, []models.TaskV2{tasks[1]}, now, func(task *models.TaskV2) (bool, error) {
+		return true, nil
+	}))
+	require.Equal(t, 3, d.RequeuedTasks)
+	require.Equal(t, 0, d.RunningTasks)
+	require.True(t, d.IsDrained())
+}
+
+func TestUpdateDrain_RequeueError(t *testing.T) {
+	now := time.Now()
+	d := &models.NodeDrain{StartedAt: now.Add(-time.Hour), Deadline: now.Add(-time.Minute)}
+	err := errors.New("requeue error")
+	require.Equal(t, err, updateDrain(d, newTasks(1), now, func(task *models.TaskV2) (bool, error) {
+		return false, err
+	}))
+	require.False(t, d.IsDrained())
+}
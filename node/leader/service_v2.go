@@ -0,0 +1,203 @@
+package leader
+
+import (
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/audit"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/node/config"
+	"github.com/crawlab-team/go-trace"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+	"time"
+)
+
+// Masters elect a leader with a lease (models.LeaseV2) in the database. The
+// leader renews the lease every third of its ttl, and another master takes
+// over once the lease has expired, e.g. after the leader crashed. Singleton
+// loops (schedules, task cleanup, git sync and node monitor) run only on the
+// leader, while the API and gRPC are served by every master.
+//
+//	node.leader.ttl  duration of the lease, 15s by default
+
+const leaseName = "master"
+
+type ServiceV2 struct {
+	// settings
+	nodeKey string
+	ttl     time.Duration
+
+	// internals
+	leader    bool
+	expiresAt time.Time
+	stop      chan struct{}
+	stopOnce  sync.Once
+	mu        sync.RWMutex
+}
+
+// Start acquires and renews the lease until stopped
+func (svc *ServiceV2) Start() {
+	ticker := time.NewTicker(svc.ttl / 3)
+	defer ticker.Stop()
+	for {
+		svc.renew()
+
+		select {
+		case <-svc.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops renewing and releases the lease, so that another master can
+// take over without waiting for it to expire
+func (svc *ServiceV2) Stop() {
+	svc.stopOnce.Do(func() {
+		close(svc.stop)
+	})
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if !svc.leader {
+		return
+	}
+	svc.leader = false
+	if err := service.NewModelServiceV2[models.LeaseV2]().GetCol().Update(bson.M{
+		"name":   leaseName,
+		"holder": svc.nodeKey,
+	}, bson.M{"$set": bson.M{"expires_at": time.Now()}}); err != nil {
+		trace.PrintError(err)
+		return
+	}
+	log.Infof("[NodeLeaderServiceV2] master[%s] released leadership", svc.nodeKey)
+}
+
+// IsLeader returns true if the current master holds an unexpired lease
+func (svc *ServiceV2) IsLeader() bool {
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+	return svc.leader && time.Now().Before(svc.expiresAt)
+}
+
+// GetLeader returns the lease of the current leader
+func (svc *ServiceV2) GetLeader() (l *models.LeaseV2, err error) {
+	return service.NewModelServiceV2[models.LeaseV2]().GetOne(bson.M{
+		"name":       leaseName,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, nil)
+}
+
+func (svc *ServiceV2) renew() {
+	now := time.Now()
+	ok, err := svc.acquire(now)
+	if err != nil {
+		// keep leadership until the lease expires, as it may be renewed
+		// once the database is reachable again
+		trace.PrintError(err)
+		return
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if ok && !svc.leader {
+		log.Infof("[NodeLeaderServiceV2] master[%s] became leader", svc.nodeKey)
+		svc.onElected(now)
+	} else if !ok && svc.leader {
+		log.Warnf("[NodeLeaderServiceV2] master[%s] lost leadership", svc.nodeKey)
+	}
+	svc.leader = ok
+	if ok {
+		svc.expiresAt = now.Add(svc.ttl)
+	}
+}
+
+// acquire acquires or renews the lease. The lease is upserted if held by
+// the current master or expired, otherwise the upsert fails with a
+// duplicate key error on the unique index of name.
+func (svc *ServiceV2) acquire(now time.Time) (ok bool, err error) {
+	col := service.NewModelServiceV2[models.LeaseV2]().GetCol()
+	_, err = col.GetCollection().UpdateOne(col.GetContext(), bson.M{
+		"name": leaseName,
+		"$or": []bson.M{
+			{"holder": svc.nodeKey},
+			{"expires_at": bson.M{"$lt": now}},
+		},
+	}, bson.M{
+		"$set": bson.M{
+			"holder":     svc.nodeKey,
+			"expires_at": now.Add(svc.ttl),
+			"updated_ts": now,
+		},
+		"$setOnInsert": bson.M{
+			"created_ts": now,
+		},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, trace.TraceError(err)
+	}
+	return true, nil
+}
+
+func (svc *ServiceV2) onElected(now time.Time) {
+	modelSvc := service.NewModelServiceV2[models.LeaseV2]()
+	if err := modelSvc.GetCol().Update(bson.M{
+		"name":   leaseName,
+		"holder": svc.nodeKey,
+	}, bson.M{"$set": bson.M{"acquired_at": now}}); err != nil {
+		trace.PrintError(err)
+	}
+	l, err := modelSvc.GetOne(bson.M{"name": leaseName}, nil)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			trace.PrintError(err)
+		}
+		return
+	}
+	audit.GetAuditServiceV2().RecordSystem(
+		constants.AuditActionLeaderChange,
+		"leases",
+		l.Id,
+		fmt.Sprintf("master[%s] became leader", svc.nodeKey),
+	)
+}
+
+func NewNodeLeaderServiceV2() (svc *ServiceV2) {
+	svc = &ServiceV2{
+		nodeKey: config.GetNodeConfigService().GetNodeKey(),
+		ttl:     15 * time.Second,
+		stop:    make(chan struct{}),
+	}
+	if ttl := viper.GetDuration("node.leader.ttl"); ttl > 0 {
+		svc.ttl = ttl
+	}
+	return svc
+}
+
+var leaderSvcV2 *ServiceV2
+
+func GetNodeLeaderServiceV2() (svc *ServiceV2) {
+	if leaderSvcV2 != nil {
+		return leaderSvcV2
+	}
+	leaderSvcV2 = NewNodeLeaderServiceV2()
+	return leaderSvcV2
+}
+
+// IsLeader returns true if the current node is the leader of masters. It is
+// always false on worker nodes.
+func IsLeader() bool {
+	if !config.GetNodeConfigService().IsMaster() {
+		return false
+	}
+	return GetNodeLeaderServiceV2().IsLeader()
+}
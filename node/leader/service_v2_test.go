@@ -0,0 +1,123 @@
+package leader
+
+import (
+	"context"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-db/mongo"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	mongo2 "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"testing"
+	"time"
+)
+
+func setupTestDB() {
+	viper.Set("mongo.db", "testdb")
+	mongo.GetMongoCol("leases").MustCreateIndexes([]mongo2.IndexModel{
+		{Keys: bson.M{"name": 1}, Options: options.Index().SetUnique(true)},
+	})
+}
+
+func teardownTestDB() {
+	_ = mongo.GetMongoDb("testdb").Drop(context.Background())
+}
+
+func newTestService(nodeKey string, ttl time.Duration) *ServiceV2 {
+	return &ServiceV2{
+		nodeKey: nodeKey,
+		ttl:     ttl,
+		stop:    make(chan struct{}),
+	}
+}
+
+func getLease(t *testing.T) *models.LeaseV2 {
+	l, err := service.NewModelServiceV2[models.LeaseV2]().GetOne(bson.M{"name": leaseName}, nil)
+	require.Nil(t, err)
+	return l
+}
+
+func TestServiceV2_Acquire(t *testing.T) {
+	setupTestDB()
+	defer teardownTestDB()
+
+	ttl := 15 * time.Second
+	svc1 := newTestService("master-1", ttl)
+	svc2 := newTestService("master-2", ttl)
+	now := time.Now().Truncate(time.Millisecond)
+
+	// acquire
+	ok, err := svc1.acquire(now)
+	require.Nil(t, err)
+	require.True(t, ok)
+	ok, err = svc2.acquire(now)
+	require.Nil(t, err)
+	require.False(t, ok)
+	require.Equal(t, "master-1", getLease(t).Holder)
+
+	// renew
+	now = now.Add(ttl / 3)
+	ok, err = svc1.acquire(now)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.True(t, getLease(t).ExpiresAt.Equal(now.Add(ttl)))
+
+	// not taken over before expiry
+	ok, err = svc2.acquire(now.Add(ttl - time.Millisecond))
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	// taken over after expiry
+	now = now.Add(ttl + time.Millisecond)
+	ok, err = svc2.acquire(now)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, "master-2", getLease(t).Holder)
+	ok, err = svc1.acquire(now)
+	require.Nil(t, err)
+	require.False(t, ok)
+}
+
+func TestServiceV2_RenewAndStop(t *testing.T) {
+	setupTestDB()
+	defer teardownTestDB()
+
+	svc1 := newTestService("master-1", 15*time.Second)
+	svc2 := newTestService("master-2", 15*time.Second)
+
+	svc1.renew()
+	svc2.renew()
+	require.True(t, svc1.IsLeader())
+	require.False(t, svc2.IsLeader())
+
+	// released on stop, so that another master takes over without waiting
+	// for the lease to expire
+	svc1.Stop()
+	require.False(t, svc1.IsLeader())
+	svc2.renew()
+	require.True(t, svc2.IsLeader())
+}
+
+func TestServiceV2_Start(t *testing.T) {
+	setupTestDB()
+	defer teardownTestDB()
+
+	svc := newTestService("master-1", 15*time.Second)
+	done := make(chan struct{})
+	go func() {
+		svc.Start()
+		close(done)
+	}()
+	require.Eventually(t, svc.IsLeader, 5*time.Second, 10*time.Millisecond)
+
+	// returns once stopped without waiting for the next renewal
+	svc.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("not stopped")
+	}
+	svc.Stop()
+}
@@ -0,0 +1,377 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	errors2 "errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/secret"
+	"github.com/crawlab-team/go-trace"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const caName = "grpc"
+
+const caValidity = 10 * 365 * 24 * time.Hour
+
+// revocationInterval is the interval of refreshing revoked certificates,
+// which may be revoked on other masters
+const revocationInterval = 30 * time.Second
+
+// CA is the certificate authority of masters
+type CA struct {
+	cert    *x509.Certificate
+	certPem string
+	key     *ecdsa.PrivateKey
+
+	// revoked serial numbers
+	revoked   map[string]bool
+	revokedAt time.Time
+	mu        sync.Mutex
+}
+
+// GetCertificatePem returns the certificate of the CA
+func (ca *CA) GetCertificatePem() string {
+	return ca.certPem
+}
+
+// GetServerTLSConfig issues a server certificate of the current master and
+// returns the tls config of the gRPC server. Client certificates are
+// verified if given, as workers register without them.
+func (ca *CA) GetServerTLSConfig(address string) (cfg *tls.Config, err error) {
+	hosts := []string{"localhost", "127.0.0.1"}
+	if hostname, err := os.Hostname(); err == nil {
+		hosts = append(hosts, hostname)
+	}
+	if host, _, err := net.SplitHostPort(address); err == nil && host != "" {
+		hosts = append(hosts, host)
+	}
+	for _, h := range viper.GetStringSlice("grpc.tls.hosts") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	tmpl, err := newTemplate("Crawlab master", caValidity)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Sign issues a client certificate of a node key for a certificate signing
+// request (PEM)
+func (ca *CA) Sign(csrPem string, nodeKey string, validity time.Duration) (cert *x509.Certificate, certPem string, err error) {
+	block, _ := pem.Decode([]byte(csrPem))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, "", errors.ErrorGrpcInvalidCsr
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", errors.ErrorGrpcInvalidCsr, err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", errors.ErrorGrpcInvalidCsr, err)
+	}
+	if csr.Subject.CommonName != nodeKey {
+		return nil, "", fmt.Errorf("%w: common name is not the node key", errors.ErrorGrpcInvalidCsr)
+	}
+
+	tmpl, err := newTemplate(nodeKey, validity)
+	if err != nil {
+		return nil, "", err
+	}
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, "", trace.TraceError(err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		return nil, "", trace.TraceError(err)
+	}
+	return cert, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), nil
+}
+
+// IssueNodeCertificate issues a certificate of a node and records it
+func (ca *CA) IssueNodeCertificate(n *models.NodeV2, csrPem string) (certPem string, err error) {
+	cert, certPem, err := ca.Sign(csrPem, n.Key, GetValidity())
+	if err != nil {
+		return "", err
+	}
+	fingerprint := sha256.Sum256(cert.Raw)
+	c := models.NodeCertificateV2{
+		NodeId:       n.Id,
+		NodeKey:      n.Key,
+		SerialNumber: cert.SerialNumber.Text(16),
+		Fingerprint:  hex.EncodeToString(fingerprint[:]),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+	}
+	c.SetCreated(primitive.NilObjectID)
+	c.SetUpdated(primitive.NilObjectID)
+	if _, err := service.NewModelServiceV2[models.NodeCertificateV2]().InsertOne(c); err != nil {
+		return "", trace.TraceError(err)
+	}
+	log.Infof("[PKI] issued certificate[%s] to node[%s], valid until %s", c.SerialNumber, n.Key, c.NotAfter.Format(time.RFC3339))
+	return certPem, nil
+}
+
+// IsRevoked returns true if a certificate is revoked
+func (ca *CA) IsRevoked(cert *x509.Certificate) bool {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if time.Since(ca.revokedAt) > revocationInterval {
+		certs, err := service.NewModelServiceV2[models.NodeCertificateV2]().GetMany(bson.M{
+			"revoked_at": bson.M{"$ne": nil},
+			"not_after":  bson.M{"$gt": time.Now()},
+		}, nil)
+		if err != nil && !errors2.Is(err, mongo.ErrNoDocuments) {
+			// keep the previous revocations if the database is unreachable
+			trace.PrintError(err)
+		} else {
+			ca.revoked = map[string]bool{}
+			for _, c := range certs {
+				ca.revoked[c.SerialNumber] = true
+			}
+			ca.revokedAt = time.Now()
+		}
+	}
+	return ca.revoked[cert.SerialNumber.Text(16)]
+}
+
+// GetPeerNodeKey returns the node key of the client certificate of a gRPC
+// request. It returns false if no certificate is given, and an error if the
+// certificate is revoked.
+func (ca *CA) GetPeerNodeKey(ctx context.Context) (nodeKey string, ok bool, err error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false, nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", false, nil
+	}
+	cert := info.State.VerifiedChains[0][0]
+	if ca.IsRevoked(cert) {
+		return "", false, errors.ErrorGrpcCertificateRevoked
+	}
+	return cert.Subject.CommonName, true, nil
+}
+
+// HasValidCertificate returns true if a node has a certificate neither
+// expired nor revoked
+func HasValidCertificate(nodeKey string) (ok bool, err error) {
+	count, err := service.NewModelServiceV2[models.NodeCertificateV2]().Count(bson.M{
+		"node_key":   nodeKey,
+		"revoked_at": nil,
+		"not_after":  bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	return count > 0, nil
+}
+
+// Revoke revokes all certificates of a node, and returns the number of
+// revoked certificates
+func Revoke(nodeId primitive.ObjectID, by primitive.ObjectID) (n int, err error) {
+	modelSvc := service.NewModelServiceV2[models.NodeCertificateV2]()
+	query := bson.M{
+		"node_id":    nodeId,
+		"revoked_at": nil,
+	}
+	count, err := modelSvc.Count(query)
+	if err != nil {
+		return 0, trace.TraceError(err)
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := modelSvc.UpdateMany(query, bson.M{"$set": bson.M{
+		"revoked_at": time.Now(),
+		"revoked_by": by,
+		"updated_ts": time.Now(),
+		"updated_by": by,
+	}}); err != nil {
+		return 0, trace.TraceError(err)
+	}
+	if _ca != nil {
+		// refresh on the next check
+		_ca.mu.Lock()
+		_ca.revokedAt = time.Time{}
+		_ca.mu.Unlock()
+	}
+	return count, nil
+}
+
+// loadCA loads the CA from the database, or creates it if not exists
+func loadCA() (res *CA, err error) {
+	modelSvc := service.NewModelServiceV2[models.CertAuthorityV2]()
+	m, err := modelSvc.GetOne(bson.M{"name": caName}, nil)
+	if err != nil {
+		if !errors2.Is(err, mongo.ErrNoDocuments) {
+			return nil, trace.TraceError(err)
+		}
+		m, err = createCA()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	block, _ := pem.Decode([]byte(m.Certificate))
+	if block == nil {
+		return nil, trace.TraceError(fmt.Errorf("invalid ca certificate"))
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	keyPem, err := secret.GetSecretServiceV2().Decrypt(&models.SecretV2{Value: m.Key, KeyId: m.KeyId})
+	if err != nil {
+		return nil, err
+	}
+	block, _ = pem.Decode([]byte(keyPem))
+	if block == nil {
+		return nil, trace.TraceError(fmt.Errorf("invalid ca key"))
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return &CA{cert: cert, certPem: m.Certificate, key: key}, nil
+}
+
+// createCA creates the CA. If another master has created it concurrently,
+// the one of the other master is returned.
+func createCA() (m *models.CertAuthorityV2, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	tmpl, err := newTemplate("Crawlab gRPC CA", caValidity)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	encryptedKey, keyId, err := secret.GetSecretServiceV2().Encrypt(string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})))
+	if err != nil {
+		return nil, err
+	}
+
+	modelSvc := service.NewModelServiceV2[models.CertAuthorityV2]()
+	m = &models.CertAuthorityV2{
+		Name:        caName,
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		Key:         encryptedKey,
+		KeyId:       keyId,
+	}
+	m.SetCreated(primitive.NilObjectID)
+	m.SetUpdated(primitive.NilObjectID)
+	if _, err := modelSvc.InsertOne(*m); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return modelSvc.GetOne(bson.M{"name": caName}, nil)
+		}
+		return nil, trace.TraceError(err)
+	}
+	log.Infof("[PKI] created certificate authority")
+	return m, nil
+}
+
+func newTemplate(commonName string, validity time.Duration) (tmpl *x509.Certificate, err error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-5 * time.Minute), // tolerate clock skew
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, nil
+}
+
+var _ca *CA
+var _caMu sync.Mutex
+
+// GetCA returns the CA of masters, and writes its certificate to the tls
+// directory to be copied to workers
+func GetCA() (res *CA, err error) {
+	_caMu.Lock()
+	defer _caMu.Unlock()
+	if _ca != nil {
+		return _ca, nil
+	}
+	res, err = loadCA()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(GetDir(), 0700); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if err := writeFile(filepath.Join(GetDir(), caFileName), []byte(res.certPem)); err != nil {
+		return nil, err
+	}
+	_ca = res
+	return _ca, nil
+}
@@ -0,0 +1,234 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/config"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/go-trace"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Masters and workers may communicate over gRPC with mutual TLS. Masters
+// share a small certificate authority (CA) in the database, of which the
+// private key is encrypted with the secret keys (see secret.GetKeys). Each
+// master issues its own server certificate on start and writes the CA
+// certificate to its tls directory, from which it is to be copied to the
+// tls directory of workers.
+//
+// A worker without a certificate registers with a certificate signing
+// request over TLS without a client certificate, authenticated by the auth
+// key, and is issued a certificate of which the common name is its node
+// key. Other requests must present the certificate, and the node key of
+// requests is taken from it. Workers renew their certificates once two
+// thirds of the validity has passed, and certificates of a compromised
+// worker can be revoked. Settings:
+//
+//	grpc.tls.enabled   enable mutual TLS
+//	grpc.tls.dir       directory of the CA certificate and the certificate and key of a worker
+//	grpc.tls.hosts     host names or IPs of masters in server certificates
+//	grpc.tls.validity  validity of node certificates, 720h by default
+
+const (
+	caFileName   = "ca.crt"
+	certFileName = "node.crt"
+	keyFileName  = "node.key"
+)
+
+const defaultValidity = 30 * 24 * time.Hour
+
+// IsEnabled returns true if gRPC is served over mutual TLS
+func IsEnabled() bool {
+	return viper.GetBool("grpc.tls.enabled")
+}
+
+// GetDir returns the tls directory
+func GetDir() string {
+	if dir := viper.GetString("grpc.tls.dir"); dir != "" {
+		return dir
+	}
+	return filepath.Join(filepath.Dir(config.GetConfigPath()), "tls")
+}
+
+// GetValidity returns the validity of node certificates
+func GetValidity() time.Duration {
+	if d := viper.GetDuration("grpc.tls.validity"); d > 0 {
+		return d
+	}
+	return defaultValidity
+}
+
+// Store keeps the certificate and key of the current worker in the tls
+// directory
+type Store struct {
+	dir        string
+	cert       *tls.Certificate
+	pendingKey *ecdsa.PrivateKey // key of the latest certificate signing request
+	mu         sync.Mutex
+}
+
+// GetClientTLSConfig returns the tls config of gRPC clients. The client
+// certificate is read on each handshake, so that new connections use a
+// renewed certificate, and no certificate is presented before the worker
+// is issued one.
+func (s *Store) GetClientTLSConfig() (cfg *tls.Config, err error) {
+	caPem, err := os.ReadFile(filepath.Join(s.dir, caFileName))
+	if err != nil {
+		return nil, trace.TraceError(fmt.Errorf("%w: ca certificate not found in %s", errors.ErrorGrpcTlsNotEnabled, s.dir))
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPem) {
+		return nil, trace.TraceError(fmt.Errorf("%w: invalid ca certificate", errors.ErrorGrpcTlsNotEnabled))
+	}
+	return &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := s.getCertificate(); cert != nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}, nil
+}
+
+// HasCertificate returns true if the worker has been issued a certificate
+func (s *Store) HasCertificate() bool {
+	return s.getCertificate() != nil
+}
+
+// NeedsRenewal returns true if the worker has no certificate or two thirds
+// of the validity of its certificate has passed
+func (s *Store) NeedsRenewal() bool {
+	cert := s.getCertificate()
+	if cert == nil || cert.Leaf == nil {
+		return true
+	}
+	validity := cert.Leaf.NotAfter.Sub(cert.Leaf.NotBefore)
+	return time.Now().After(cert.Leaf.NotBefore.Add(validity * 2 / 3))
+}
+
+// NewCertificateRequest generates a new key and returns a certificate
+// signing request (PEM) of the node key with it
+func (s *Store) NewCertificateRequest(nodeKey string) (csrPem string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: nodeKey},
+	}, key)
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	s.mu.Lock()
+	s.pendingKey = key
+	s.mu.Unlock()
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})), nil
+}
+
+// SaveCertificate saves a certificate issued for the latest certificate
+// signing request, and the CA certificate
+func (s *Store) SaveCertificate(certPem, caPem string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pendingKey == nil {
+		return trace.TraceError(errors.ErrorGrpcInvalidCsr)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(s.pendingKey)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	cert, err := parseKeyPair([]byte(certPem), keyPem)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return trace.TraceError(err)
+	}
+	for name, data := range map[string][]byte{
+		keyFileName:  keyPem,
+		certFileName: []byte(certPem),
+		caFileName:   []byte(caPem),
+	} {
+		if err := writeFile(filepath.Join(s.dir, name), data); err != nil {
+			return err
+		}
+	}
+	s.cert = cert
+	s.pendingKey = nil
+	return nil
+}
+
+func (s *Store) getCertificate() (cert *tls.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cert != nil {
+		return s.cert
+	}
+	certPem, err := os.ReadFile(filepath.Join(s.dir, certFileName))
+	if err != nil {
+		return nil
+	}
+	keyPem, err := os.ReadFile(filepath.Join(s.dir, keyFileName))
+	if err != nil {
+		return nil
+	}
+	s.cert, err = parseKeyPair(certPem, keyPem)
+	if err != nil {
+		trace.PrintError(err)
+		return nil
+	}
+	return s.cert
+}
+
+func NewStore(dir string) (s *Store) {
+	return &Store{dir: dir}
+}
+
+var store *Store
+
+func GetStore() (s *Store) {
+	if store != nil {
+		return store
+	}
+	store = NewStore(GetDir())
+	return store
+}
+
+func parseKeyPair(certPem, keyPem []byte) (cert *tls.Certificate, err error) {
+	c, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	c.Leaf, err = x509.ParseCertificate(c.Certificate[0])
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return &c, nil
+}
+
+// writeFile writes a file atomically, so that a certificate and its key
+// are not read half-written
+func writeFile(path string, data []byte) (err error) {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return trace.TraceError(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return trace.TraceError(err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newTestCA(t *testing.T) *CA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl, err := newTemplate("test", time.Hour)
+	require.Nil(t, err)
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return &CA{
+		cert:    cert,
+		certPem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		key:     key,
+	}
+}
+
+func TestStore(t *testing.T) {
+	ca := newTestCA(t)
+	s := NewStore(t.TempDir())
+	require.False(t, s.HasCertificate())
+	require.True(t, s.NeedsRenewal())
+
+	csr, err := s.NewCertificateRequest("worker-1")
+	require.Nil(t, err)
+	cert, certPem, err := ca.Sign(csr, "worker-1", time.Hour)
+	require.Nil(t, err)
+	require.Equal(t, "worker-1", cert.Subject.CommonName)
+	require.Nil(t, s.SaveCertificate(certPem, ca.GetCertificatePem()))
+	require.True(t, s.HasCertificate())
+	require.False(t, s.NeedsRenewal())
+
+	// read from the directory
+	s2 := NewStore(s.dir)
+	require.True(t, s2.HasCertificate())
+	cfg, err := s2.GetClientTLSConfig()
+	require.Nil(t, err)
+	c, err := cfg.GetClientCertificate(nil)
+	require.Nil(t, err)
+	require.Equal(t, cert.Raw, c.Certificate[0])
+
+	// verified by the CA
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	require.Nil(t, err)
+}
+
+func TestSignInvalid(t *testing.T) {
+	ca := newTestCA(t)
+	s := NewStore(t.TempDir())
+
+	// common name other than the node key
+	csr, err := s.NewCertificateRequest("worker-1")
+	require.Nil(t, err)
+	_, _, err = ca.Sign(csr, "worker-2", time.Hour)
+	require.True(t, errors.Is(err, errors2.ErrorGrpcInvalidCsr))
+
+	_, _, err = ca.Sign("invalid", "worker-1", time.Hour)
+	require.True(t, errors.Is(err, errors2.ErrorGrpcInvalidCsr))
+}
@@ -0,0 +1,174 @@
+package resource
+
+import (
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/go-trace"
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/load"
+	"github.com/shirou/gopsutil/mem"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Nodes report their resources in heartbeats, which are stored in the node
+// (models.NodeV2.Resources) and in history (models.NodeResourceV2). A node
+// is under pressure if its resources cross thresholds of the settings below,
+// in which case it fetches no new tasks:
+//
+//	node.pressure.maxLoadPerCpu       1-minute load average per cpu
+//	node.pressure.minMemoryAvailable  available memory in MB
+//	node.pressure.minDiskFree         free disk space of the workspace in MB
+//
+// Thresholds not set are not checked. Resources reported longer than
+// staleDuration ago are considered unknown.
+
+const staleDuration = 3 * time.Minute
+
+// workspaceInterval is the interval of calculating the size of the
+// workspace, as walking it is expensive
+const workspaceInterval = 5 * time.Minute
+
+// Collector collects resources of the current node
+type Collector struct {
+	workspacePath    string
+	workspaceSize    uint64
+	workspaceAt      time.Time
+	workspaceWalking bool // whether the workspace is being walked
+	mu               sync.Mutex
+}
+
+// Collect returns resources of the current node. Resources which cannot be
+// collected on the platform (e.g. load average on Windows) are left zero.
+func (c *Collector) Collect() (r *models.NodeResources) {
+	r = &models.NodeResources{ReportedAt: time.Now()}
+	if n, err := cpu.Counts(true); err == nil {
+		r.CpuCount = n
+	}
+	if avg, err := load.Avg(); err == nil {
+		r.Load1, r.Load5, r.Load15 = avg.Load1, avg.Load5, avg.Load15
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		r.MemoryTotal, r.MemoryAvailable = vm.Total, vm.Available
+	}
+	diskPath := c.workspacePath
+	if _, err := os.Stat(diskPath); err != nil {
+		diskPath = "/"
+	}
+	if u, err := disk.Usage(diskPath); err == nil {
+		r.DiskTotal, r.DiskFree = u.Total, u.Free
+	}
+	r.WorkspaceSize = c.getWorkspaceSize()
+	return r
+}
+
+// getWorkspaceSize returns the last calculated size of the workspace, and
+// recalculates it in the background if outdated, so that heartbeats are not
+// delayed by walking the workspace
+func (c *Collector) getWorkspaceSize() (size uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.workspaceWalking && (c.workspaceAt.IsZero() || time.Since(c.workspaceAt) >= workspaceInterval) {
+		c.workspaceWalking = true
+		go c.walkWorkspace()
+	}
+	return c.workspaceSize
+}
+
+func (c *Collector) walkWorkspace() {
+	var size uint64
+	_ = filepath.WalkDir(c.workspacePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += uint64(info.Size())
+			}
+		}
+		return nil
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.workspaceSize = size
+	c.workspaceAt = time.Now()
+	c.workspaceWalking = false
+}
+
+func NewCollector() (c *Collector) {
+	return &Collector{
+		workspacePath: viper.GetString("workspace"),
+	}
+}
+
+var collector *Collector
+
+func GetCollector() (c *Collector) {
+	if collector != nil {
+		return collector
+	}
+	collector = NewCollector()
+	return collector
+}
+
+// IsKnown returns true if resources are reported recently
+func IsKnown(r *models.NodeResources) bool {
+	return r != nil && r.CpuCount > 0 && time.Since(r.ReportedAt) < staleDuration
+}
+
+// IsUnderPressure returns true if resources cross thresholds of the
+// settings. Unknown resources are not under pressure.
+func IsUnderPressure(r *models.NodeResources) bool {
+	if !IsKnown(r) {
+		return false
+	}
+	if maxLoad := viper.GetFloat64("node.pressure.maxLoadPerCpu"); maxLoad > 0 && r.Load1/float64(r.CpuCount) > maxLoad {
+		return true
+	}
+	if minMemory := viper.GetUint64("node.pressure.minMemoryAvailable"); minMemory > 0 && r.MemoryAvailable < minMemory*mb {
+		return true
+	}
+	if minDisk := viper.GetUint64("node.pressure.minDiskFree"); minDisk > 0 && r.DiskTotal > 0 && r.DiskFree < minDisk*mb {
+		return true
+	}
+	return false
+}
+
+// GetRequirementQuery returns the query of task queue items of which the
+// minimum memory and cpu (see models.SpiderV2) are met by resources. Only
+// items without requirements are matched if resources are unknown.
+func GetRequirementQuery(r *models.NodeResources) (query bson.M) {
+	if !IsKnown(r) {
+		return bson.M{
+			"mm": bson.M{"$exists": false},
+			"mc": bson.M{"$exists": false},
+		}
+	}
+	return bson.M{
+		"mm": bson.M{"$not": bson.M{"$gt": int(r.MemoryAvailable / mb)}},
+		"mc": bson.M{"$not": bson.M{"$gt": r.CpuCount}},
+	}
+}
+
+// SaveHistory saves resources of a node in history
+func SaveHistory(nodeId primitive.ObjectID, r *models.NodeResources) (err error) {
+	h := models.NodeResourceV2{
+		NodeId:        nodeId,
+		NodeResources: *r,
+	}
+	h.SetCreated(primitive.NilObjectID)
+	h.SetUpdated(primitive.NilObjectID)
+	if _, err := service.NewModelServiceV2[models.NodeResourceV2]().InsertOne(h); err != nil {
+		return trace.TraceError(err)
+	}
+	return nil
+}
+
+const mb = 1024 * 1024
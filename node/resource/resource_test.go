@@ -0,0 +1,68 @@
+package resource
+
+import (
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"time"
+)
+
+func TestIsUnderPressure(t *testing.T) {
+	viper.Set("node.pressure.maxLoadPerCpu", 2.0)
+	viper.Set("node.pressure.minMemoryAvailable", 512)
+	viper.Set("node.pressure.minDiskFree", 1024)
+	defer func() {
+		viper.Set("node.pressure.maxLoadPerCpu", nil)
+		viper.Set("node.pressure.minMemoryAvailable", nil)
+		viper.Set("node.pressure.minDiskFree", nil)
+	}()
+
+	r := &models.NodeResources{
+		CpuCount:        4,
+		Load1:           4,
+		MemoryAvailable: 1024 * mb,
+		DiskTotal:       4096 * mb,
+		DiskFree:        2048 * mb,
+		ReportedAt:      time.Now(),
+	}
+	require.False(t, IsUnderPressure(r))
+
+	r.Load1 = 9
+	require.True(t, IsUnderPressure(r))
+	r.Load1 = 4
+
+	r.MemoryAvailable = 256 * mb
+	require.True(t, IsUnderPressure(r))
+	r.MemoryAvailable = 1024 * mb
+
+	r.DiskFree = 512 * mb
+	require.True(t, IsUnderPressure(r))
+
+	// stale resources are unknown
+	r.ReportedAt = time.Now().Add(-time.Hour)
+	require.False(t, IsUnderPressure(r))
+	require.False(t, IsUnderPressure(nil))
+}
+
+func TestGetRequirementQuery(t *testing.T) {
+	require.Equal(t, bson.M{
+		"mm": bson.M{"$exists": false},
+		"mc": bson.M{"$exists": false},
+	}, GetRequirementQuery(nil))
+
+	r := &models.NodeResources{CpuCount: 8, MemoryAvailable: 2048 * mb, ReportedAt: time.Now()}
+	require.Equal(t, bson.M{
+		"mm": bson.M{"$not": bson.M{"$gt": 2048}},
+		"mc": bson.M{"$not": bson.M{"$gt": 8}},
+	}, GetRequirementQuery(r))
+}
+
+func TestCollect(t *testing.T) {
+	c := &Collector{workspacePath: t.TempDir()}
+	r := c.Collect()
+	require.Greater(t, r.CpuCount, 0)
+	require.Greater(t, r.MemoryTotal, uint64(0))
+	require.False(t, r.ReportedAt.IsZero())
+}
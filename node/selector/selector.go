@@ -0,0 +1,193 @@
+package selector
+
+import (
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"regexp"
+	"strings"
+)
+
+// A node selector is a comma-separated list of requirements on labels of
+// nodes (models.NodeV2.Labels), all of which must be met by a node:
+//
+//	region=eu               label equals value ("==" is also accepted)
+//	gpu!=true               label is missing or not equal to value
+//	proxy in (dc,residential)
+//	proxy notin (none)      label is missing or not in values
+//	gpu                     label exists
+//	!gpu                    label does not exist
+//
+// An empty selector matches any node.
+
+const (
+	opEquals    = "="
+	opNotEquals = "!="
+	opIn        = "in"
+	opNotIn     = "notin"
+	opExists    = "exists"
+	opNotExists = "!exists"
+)
+
+var keyRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+
+var valueRegexp = regexp.MustCompile(`^[A-Za-z0-9._/-]*$`)
+
+var setRegexp = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+type requirement struct {
+	key    string
+	op     string
+	values []string
+}
+
+func (r *requirement) matches(labels map[string]string) bool {
+	v, ok := labels[r.key]
+	switch r.op {
+	case opEquals:
+		return ok && v == r.values[0]
+	case opNotEquals:
+		return !ok || v != r.values[0]
+	case opIn:
+		return ok && contains(r.values, v)
+	case opNotIn:
+		return !ok || !contains(r.values, v)
+	case opExists:
+		return ok
+	case opNotExists:
+		return !ok
+	default:
+		return false
+	}
+}
+
+// Selector is a parsed node selector
+type Selector struct {
+	requirements []requirement
+}
+
+// Matches returns true if labels meet all requirements of the selector
+func (s *Selector) Matches(labels map[string]string) bool {
+	for _, r := range s.requirements {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty returns true if the selector matches any node
+func (s *Selector) Empty() bool {
+	return len(s.requirements) == 0
+}
+
+// Parse parses a node selector expression
+func Parse(expr string) (s *Selector, err error) {
+	s = &Selector{}
+	for _, part := range split(expr) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			if strings.TrimSpace(expr) == "" {
+				continue
+			}
+			return nil, fmt.Errorf("%w: empty requirement in \"%s\"", errors.ErrorNodeInvalidSelector, expr)
+		}
+		r, err := parseRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		s.requirements = append(s.requirements, r)
+	}
+	return s, nil
+}
+
+// Validate returns error if a node selector expression is invalid
+func Validate(expr string) (err error) {
+	_, err = Parse(expr)
+	return err
+}
+
+// Match returns true if labels match a node selector expression. An
+// invalid expression matches no node.
+func Match(expr string, labels map[string]string) bool {
+	s, err := Parse(expr)
+	if err != nil {
+		return false
+	}
+	return s.Matches(labels)
+}
+
+// ValidateLabels returns error if keys or values of node labels are invalid
+func ValidateLabels(labels map[string]string) (err error) {
+	for k, v := range labels {
+		if !keyRegexp.MatchString(k) {
+			return fmt.Errorf("%w: invalid key \"%s\"", errors.ErrorNodeInvalidLabel, k)
+		}
+		if !valueRegexp.MatchString(v) {
+			return fmt.Errorf("%w: invalid value \"%s\" of %s", errors.ErrorNodeInvalidLabel, v, k)
+		}
+	}
+	return nil
+}
+
+func parseRequirement(part string) (r requirement, err error) {
+	invalid := fmt.Errorf("%w: invalid requirement \"%s\"", errors.ErrorNodeInvalidSelector, part)
+
+	if m := setRegexp.FindStringSubmatch(part); m != nil {
+		r = requirement{key: m[1], op: m[2]}
+		for _, v := range strings.Split(m[3], ",") {
+			v = strings.TrimSpace(v)
+			if v == "" || !valueRegexp.MatchString(v) {
+				return r, invalid
+			}
+			r.values = append(r.values, v)
+		}
+	} else if key, value, ok := strings.Cut(part, "!="); ok {
+		r = requirement{key: strings.TrimSpace(key), op: opNotEquals, values: []string{strings.TrimSpace(value)}}
+	} else if key, value, ok := strings.Cut(part, "="); ok {
+		value = strings.TrimPrefix(value, "=")
+		r = requirement{key: strings.TrimSpace(key), op: opEquals, values: []string{strings.TrimSpace(value)}}
+	} else if strings.HasPrefix(part, "!") {
+		r = requirement{key: strings.TrimSpace(part[1:]), op: opNotExists}
+	} else {
+		r = requirement{key: part, op: opExists}
+	}
+
+	if !keyRegexp.MatchString(r.key) {
+		return r, invalid
+	}
+	for _, v := range r.values {
+		if !valueRegexp.MatchString(v) {
+			return r, invalid
+		}
+	}
+	return r, nil
+}
+
+// split splits expr by commas outside parentheses
+func split(expr string) (parts []string) {
+	depth := 0
+	start := 0
+	for i, c := range expr {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package selector
+
+import (
+	"errors"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	labels := map[string]string{
+		"region": "eu",
+		"proxy":  "residential",
+		"gpu":    "false",
+	}
+	for expr, expected := range map[string]bool{
+		"":                           true,
+		"region=eu":                  true,
+		"region==eu":                 true,
+		"region=us":                  false,
+		"region!=us":                 true,
+		"zone!=a":                    true,
+		"proxy in (dc, residential)": true,
+		"proxy in (dc)":              false,
+		"proxy notin (dc)":           true,
+		"zone notin (a)":             true,
+		"gpu":                        true,
+		"!gpu":                       false,
+		"!zone":                      true,
+		"region=eu,proxy in (a,residential),gpu=false": true,
+		"region=eu, gpu=true":                          false,
+	} {
+		require.Equal(t, expected, Match(expr, labels), expr)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, expr := range []string{
+		"region=eu,",
+		"=eu",
+		"region=e u",
+		"proxy in ()",
+		"proxy in (a,,b)",
+		"-region",
+	} {
+		err := Validate(expr)
+		require.True(t, errors.Is(err, errors2.ErrorNodeInvalidSelector), expr)
+		require.False(t, Match(expr, nil), expr)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	require.Nil(t, ValidateLabels(map[string]string{"region": "eu", "example.com/gpu": ""}))
+	require.NotNil(t, ValidateLabels(map[string]string{"region ": "eu"}))
+	require.NotNil(t, ValidateLabels(map[string]string{"region": "e,u"}))
+}
@@ -2,17 +2,24 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"github.com/apex/log"
 	"github.com/cenkalti/backoff/v4"
+	"github.com/crawlab-team/crawlab-core/audit"
 	config2 "github.com/crawlab-team/crawlab-core/config"
 	"github.com/crawlab-team/crawlab-core/constants"
 	"github.com/crawlab-team/crawlab-core/container"
+	"github.com/crawlab-team/crawlab-core/dependency"
 	"github.com/crawlab-team/crawlab-core/grpc/server"
 	"github.com/crawlab-team/crawlab-core/interfaces"
 	"github.com/crawlab-team/crawlab-core/models/common"
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/models/service"
 	"github.com/crawlab-team/crawlab-core/node/config"
+	"github.com/crawlab-team/crawlab-core/node/drain"
+	"github.com/crawlab-team/crawlab-core/node/leader"
+	"github.com/crawlab-team/crawlab-core/node/resource"
+	"github.com/crawlab-team/crawlab-core/node/version"
 	"github.com/crawlab-team/crawlab-core/notification"
 	"github.com/crawlab-team/crawlab-core/schedule"
 	"github.com/crawlab-team/crawlab-core/spider/admin"
@@ -22,6 +29,7 @@ import (
 	"github.com/crawlab-team/crawlab-core/utils"
 	grpc "github.com/crawlab-team/crawlab-grpc"
 	"github.com/crawlab-team/go-trace"
+	"github.com/spf13/viper"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mongo2 "go.mongodb.org/mongo-driver/mongo"
@@ -39,12 +47,18 @@ type MasterServiceV2 struct {
 	notificationSvc *notification.Service
 	spiderAdminSvc  *admin.ServiceV2
 	systemSvc       *system.Service
+	dependencySvc   *dependency.ServiceV2
+	auditSvc        *audit.ServiceV2
+	leaderSvc       *leader.ServiceV2
 
 	// settings
 	cfgPath         string
 	address         interfaces.Address
 	monitorInterval time.Duration
 	stopOnError     bool
+
+	lostNodeGracePeriod time.Duration // offline duration after which tasks of a node are handled as lost
+	nodeActiveTimeout   time.Duration // duration without heartbeats after which a node not connected to this master is offline
 }
 
 func (svc *MasterServiceV2) Init() (err error) {
@@ -66,6 +80,9 @@ func (svc *MasterServiceV2) Start() {
 		panic(err)
 	}
 
+	// start leader election
+	go svc.leaderSvc.Start()
+
 	// start monitoring worker nodes
 	go svc.Monitor()
 
@@ -84,6 +101,12 @@ func (svc *MasterServiceV2) Start() {
 	// start spider admin service
 	go svc.spiderAdminSvc.Start()
 
+	// start dependency service
+	go svc.dependencySvc.Start()
+
+	// start audit service
+	go svc.auditSvc.Start()
+
 	// wait for quit signal
 	svc.Wait()
 
@@ -96,6 +119,7 @@ func (svc *MasterServiceV2) Wait() {
 }
 
 func (svc *MasterServiceV2) Stop() {
+	svc.leaderSvc.Stop()
 	_ = svc.server.Stop()
 	log.Infof("master[%s] service has stopped", svc.GetConfigService().GetNodeKey())
 }
@@ -140,6 +164,10 @@ func (svc *MasterServiceV2) SetMonitorInterval(duration time.Duration) {
 	svc.monitorInterval = duration
 }
 
+func (svc *MasterServiceV2) SetLostNodeGracePeriod(duration time.Duration) {
+	svc.lostNodeGracePeriod = duration
+}
+
 func (svc *MasterServiceV2) Register() (err error) {
 	nodeKey := svc.GetConfigService().GetNodeKey()
 	nodeName := svc.GetConfigService().GetNodeName()
@@ -156,6 +184,7 @@ func (svc *MasterServiceV2) Register() (err error) {
 			Enabled:    true,
 			Active:     true,
 			ActiveAt:   time.Now(),
+			Version:    version.GetCurrent(),
 		}
 		node.SetCreated(primitive.NilObjectID)
 		node.SetUpdated(primitive.NilObjectID)
@@ -171,6 +200,7 @@ func (svc *MasterServiceV2) Register() (err error) {
 		node.Status = constants.NodeStatusOnline
 		node.Active = true
 		node.ActiveAt = time.Now()
+		node.Version = version.GetCurrent()
 		err = service.NewModelServiceV2[models.NodeV2]().ReplaceById(node.Id, *node)
 		if err != nil {
 			return err
@@ -200,6 +230,11 @@ func (svc *MasterServiceV2) monitor() (err error) {
 		return err
 	}
 
+	// other nodes are only monitored by the leader
+	if !svc.leaderSvc.IsLeader() {
+		return nil
+	}
+
 	// all worker nodes
 	workerNodes, err := svc.getAllWorkerNodes()
 	if err != nil {
@@ -211,17 +246,26 @@ func (svc *MasterServiceV2) monitor() (err error) {
 	wg.Add(len(workerNodes))
 	for _, n := range workerNodes {
 		go func(n *models.NodeV2) {
-			// subscribe
+			// other masters update their own status
+			if n.IsMaster {
+				if !svc.isNodeActive(n) {
+					go svc.setWorkerNodeOffline(n)
+				}
+				wg.Done()
+				return
+			}
+
+			// subscribe. Workers may be connected to other masters, in which
+			// case they are online as long as they send heartbeats.
 			ok := svc.subscribeNode(n)
-			if !ok {
+			if !ok && !svc.isNodeActive(n) {
 				go svc.setWorkerNodeOffline(n)
 				wg.Done()
 				return
 			}
 
 			// ping client
-			ok = svc.pingNodeClient(n)
-			if !ok {
+			if ok && !svc.pingNodeClient(n) {
 				go svc.setWorkerNodeOffline(n)
 				wg.Done()
 				return
@@ -241,6 +285,16 @@ func (svc *MasterServiceV2) monitor() (err error) {
 
 	wg.Wait()
 
+	// check draining nodes
+	if err := drain.GetNodeDrainServiceV2().CheckAll(); err != nil {
+		return err
+	}
+
+	// handle lost worker nodes
+	if err := svc.handleLostNodes(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -259,6 +313,40 @@ func (svc *MasterServiceV2) getAllWorkerNodes() (nodes []models.NodeV2, err erro
 	return nodes, nil
 }
 
+// isLostNode returns whether a node is offline for longer than the grace
+// period
+func isLostNode(n *models.NodeV2, now time.Time, gracePeriod time.Duration) bool {
+	return !n.Active &&
+		n.Status == constants.NodeStatusOffline &&
+		n.ActiveAt.Before(now.Add(-gracePeriod))
+}
+
+// handleLostNodes handles tasks of worker nodes offline for longer than the
+// grace period
+func (svc *MasterServiceV2) handleLostNodes() (err error) {
+	nodes, err := service.NewModelServiceV2[models.NodeV2]().GetMany(bson.M{
+		"key":    bson.M{"$ne": svc.cfgSvc.GetNodeKey()},
+		"active": false,
+		"status": constants.NodeStatusOffline,
+	}, nil)
+	if err != nil {
+		if errors.Is(err, mongo2.ErrNoDocuments) {
+			return nil
+		}
+		return trace.TraceError(err)
+	}
+	now := time.Now()
+	for _, n := range nodes {
+		if !isLostNode(&n, now, svc.lostNodeGracePeriod) {
+			continue
+		}
+		if err := svc.schedulerSvc.HandleLostNode(&n); err != nil {
+			trace.PrintError(err)
+		}
+	}
+	return nil
+}
+
 func (svc *MasterServiceV2) updateMasterNodeStatus() (err error) {
 	nodeKey := svc.GetConfigService().GetNodeKey()
 	node, err := service.NewModelServiceV2[models.NodeV2]().GetOne(bson.M{"key": nodeKey}, nil)
@@ -268,10 +356,14 @@ func (svc *MasterServiceV2) updateMasterNodeStatus() (err error) {
 	node.Status = constants.NodeStatusOnline
 	node.Active = true
 	node.ActiveAt = time.Now()
+	node.Resources = resource.GetCollector().Collect()
 	err = service.NewModelServiceV2[models.NodeV2]().ReplaceById(node.Id, *node)
 	if err != nil {
 		return err
 	}
+	if err := resource.SaveHistory(node.Id, node.Resources); err != nil {
+		trace.PrintError(err)
+	}
 	return nil
 }
 
@@ -283,18 +375,30 @@ func (svc *MasterServiceV2) setWorkerNodeOffline(node *models.NodeV2) {
 	}, backoff.WithMaxRetries(backoff.NewConstantBackOff(1*time.Second), 3))
 	if err != nil {
 		trace.PrintError(err)
+		return
 	}
+	audit.GetAuditServiceV2().RecordSystem(
+		constants.AuditActionNodeOffline,
+		"nodes",
+		node.Id,
+		fmt.Sprintf("node[%s] is offline", node.Key),
+	)
 }
 
 func (svc *MasterServiceV2) subscribeNode(n *models.NodeV2) (ok bool) {
 	_, err := svc.server.GetSubscribe("node:" + n.Key)
 	if err != nil {
-		log.Errorf("cannot subscribe worker node[%s]: %v", n.Key, err)
+		log.Debugf("cannot subscribe worker node[%s] on this master: %v", n.Key, err)
 		return false
 	}
 	return true
 }
 
+// isNodeActive returns true if the node has updated its status recently
+func (svc *MasterServiceV2) isNodeActive(n *models.NodeV2) (ok bool) {
+	return time.Since(n.ActiveAt) < svc.nodeActiveTimeout
+}
+
 func (svc *MasterServiceV2) pingNodeClient(n *models.NodeV2) (ok bool) {
 	if err := svc.server.SendStreamMessage("node:"+n.Key, grpc.StreamMessageCode_PING); err != nil {
 		log.Errorf("cannot ping worker node client[%s]: %v", n.Key, err)
@@ -326,6 +430,12 @@ func NewMasterServiceV2() (res interfaces.NodeMasterService, err error) {
 		cfgPath:         config2.GetConfigPath(),
 		monitorInterval: 15 * time.Second,
 		stopOnError:     false,
+
+		lostNodeGracePeriod: 2 * time.Minute,
+		nodeActiveTimeout:   1 * time.Minute,
+	}
+	if d := viper.GetDuration("node.lostGracePeriod"); d > 0 {
+		svc.lostNodeGracePeriod = d
 	}
 
 	// server options
@@ -379,6 +489,18 @@ func NewMasterServiceV2() (res interfaces.NodeMasterService, err error) {
 	// system service
 	svc.systemSvc = system.GetService()
 
+	// dependency service
+	svc.dependencySvc, err = dependency.GetDependencyServiceV2()
+	if err != nil {
+		return nil, err
+	}
+
+	// audit service
+	svc.auditSvc = audit.GetAuditServiceV2()
+
+	// leader service
+	svc.leaderSvc = leader.GetNodeLeaderServiceV2()
+
 	// init
 	if err := svc.Init(); err != nil {
 		return nil, err
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestIsLostNode(t *testing.T) {
+	now := time.Now()
+	gracePeriod := 5 * time.Minute
+	newNode := func(active bool, status string, activeAt time.Time) *models.NodeV2 {
+		return &models.NodeV2{Active: active, Status: status, ActiveAt: activeAt}
+	}
+
+	// offline for longer than the grace period
+	require.True(t, isLostNode(newNode(false, constants.NodeStatusOffline, now.Add(-10*time.Minute)), now, gracePeriod))
+
+	// offline within the grace period
+	require.False(t, isLostNode(newNode(false, constants.NodeStatusOffline, now.Add(-time.Minute)), now, gracePeriod))
+
+	// active or online again
+	require.False(t, isLostNode(newNode(true, constants.NodeStatusOffline, now.Add(-10*time.Minute)), now, gracePeriod))
+	require.False(t, isLostNode(newNode(false, constants.NodeStatusOnline, now.Add(-10*time.Minute)), now, gracePeriod))
+}
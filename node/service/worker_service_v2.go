@@ -3,12 +3,18 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/apex/log"
 	config2 "github.com/crawlab-team/crawlab-core/config"
 	"github.com/crawlab-team/crawlab-core/container"
+	"github.com/crawlab-team/crawlab-core/dependency"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
 	"github.com/crawlab-team/crawlab-core/grpc/client"
 	"github.com/crawlab-team/crawlab-core/interfaces"
 	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/node/resource"
+	"github.com/crawlab-team/crawlab-core/node/version"
 	"github.com/crawlab-team/crawlab-core/task/handler"
 	"github.com/crawlab-team/crawlab-core/utils"
 	grpc "github.com/crawlab-team/crawlab-grpc"
@@ -18,9 +24,10 @@ import (
 
 type WorkerServiceV2 struct {
 	// dependencies
-	cfgSvc     interfaces.NodeConfigService
-	client     *client.GrpcClientV2
-	handlerSvc *handler.ServiceV2
+	cfgSvc        interfaces.NodeConfigService
+	client        *client.GrpcClientV2
+	handlerSvc    *handler.ServiceV2
+	dependencySvc *dependency.WorkerServiceV2
 
 	// settings
 	cfgPath           string
@@ -55,6 +62,9 @@ func (svc *WorkerServiceV2) Start() {
 	// start handler
 	go svc.handlerSvc.Start()
 
+	// start dependency service
+	go svc.dependencySvc.Start()
+
 	// wait for quit signal
 	svc.Wait()
 
@@ -75,15 +85,44 @@ func (svc *WorkerServiceV2) Register() {
 	ctx, cancel := svc.client.Context()
 	defer cancel()
 	req := svc.client.NewRequest(svc.GetConfigService().GetBasicNodeInfo())
-	res, err := svc.client.NodeClient.Register(ctx, req)
+	res, err := svc.client.GetNodeClient().Register(ctx, req)
 	if err != nil {
 		panic(err)
 	}
+	// update and reason of refusal, if any
+	var data entity.NodeRegisterRefused
+	if err := json.Unmarshal(res.Data, &data); err != nil {
+		panic(err)
+	}
+
+	// refused for incompatible version, unless updated
+	if data.Incompatible != "" {
+		svc.update(data.Update)
+		panic(fmt.Errorf("%w: %s", errors.ErrorNodeIncompatibleVersion, data.Incompatible))
+	}
+
 	if err := json.Unmarshal(res.Data, svc.n); err != nil {
 		panic(err)
 	}
 	log.Infof("worker[%s] registered to master. id: %s", svc.GetConfigService().GetNodeKey(), svc.n.GetId().Hex())
-	return
+
+	// update to the worker binary served by masters, before any task is run
+	svc.update(data.Update)
+}
+
+// update applies the worker binary served by masters if auto update is
+// enabled, which restarts the worker
+func (svc *WorkerServiceV2) update(u *entity.NodeUpdate) {
+	if u == nil {
+		return
+	}
+	if !version.IsAutoUpdateEnabled() {
+		log.Infof("worker[%s] update %s is available", svc.GetConfigService().GetNodeKey(), u.Version)
+		return
+	}
+	if err := version.Apply(u); err != nil {
+		log.Errorf("worker[%s] update to %s error: %v", svc.GetConfigService().GetNodeKey(), u.Version, err)
+	}
 }
 
 func (svc *WorkerServiceV2) Recv() {
@@ -108,7 +147,7 @@ func (svc *WorkerServiceV2) handleStreamMessage(msg *grpc.StreamMessage) (err er
 	log.Debugf("[WorkerServiceV2] handle msg: %v", msg)
 	switch msg.Code {
 	case grpc.StreamMessageCode_PING:
-		if _, err := svc.client.NodeClient.SendHeartbeat(context.Background(), svc.client.NewRequest(svc.cfgSvc.GetBasicNodeInfo())); err != nil {
+		if _, err := svc.client.GetNodeClient().SendHeartbeat(context.Background(), svc.client.NewRequest(svc.cfgSvc.GetBasicNodeInfo())); err != nil {
 			return trace.TraceError(err)
 		}
 	case grpc.StreamMessageCode_RUN_TASK:
@@ -174,8 +213,14 @@ func (svc *WorkerServiceV2) SetHeartbeatInterval(duration time.Duration) {
 func (svc *WorkerServiceV2) reportStatus() {
 	ctx, cancel := context.WithTimeout(context.Background(), svc.heartbeatInterval)
 	defer cancel()
-	_, err := svc.client.NodeClient.SendHeartbeat(ctx, &grpc.Request{
+	data, err := json.Marshal(resource.GetCollector().Collect())
+	if err != nil {
+		trace.PrintError(err)
+		return
+	}
+	_, err = svc.client.GetNodeClient().SendHeartbeat(ctx, &grpc.Request{
 		NodeKey: svc.cfgSvc.GetNodeKey(),
+		Data:    data,
 	})
 	if err != nil {
 		trace.PrintError(err)
@@ -216,6 +261,12 @@ func NewWorkerServiceV2() (res *WorkerServiceV2, err error) {
 		return nil, err
 	}
 
+	// dependency service
+	svc.dependencySvc, err = dependency.NewDependencyWorkerServiceV2()
+	if err != nil {
+		return nil, err
+	}
+
 	// init
 	if err := svc.Init(); err != nil {
 		return nil, err
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package version
+
+import (
+	"github.com/crawlab-team/go-trace"
+	"os"
+	"syscall"
+)
+
+const restartSupported = true
+
+// restart replaces the current process with the executable, with the same
+// arguments and environment
+func restart(exe string) (err error) {
+	return trace.TraceError(syscall.Exec(exe, os.Args, os.Environ()))
+}
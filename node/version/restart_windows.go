@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package version
+
+import "github.com/crawlab-team/crawlab-core/errors"
+
+// restartSupported is false as the executable of a running process cannot
+// be replaced on Windows
+const restartSupported = false
+
+func restart(exe string) (err error) {
+	return errors.ErrorNodeUpdateNotSupported
+}
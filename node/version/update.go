@@ -0,0 +1,202 @@
+package version
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/go-trace"
+	"github.com/spf13/viper"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Masters may serve worker binaries, one for each platform named <os>-<arch>
+// (e.g. linux-amd64) in a directory. Workers registering with another
+// version are told the version and checksum of the binary of their platform
+// in the registration response, and workers with auto update enabled
+// download it from the api endpoint of masters, verify it by the checksum,
+// replace their executable with it and restart into it. Workers refused
+// for incompatible versions are still told the update, so that they can
+// update themselves. An update of the same checksum as the running
+// executable is not applied, so that a wrong version setting does not make
+// workers update in a loop. Settings:
+//
+//	node.update.dir      directory of worker binaries served by masters
+//	node.update.version  version of the worker binaries, by default the master version
+//	node.update.auto     whether workers update themselves
+//
+// Binaries are not signed. They are only verified by the checksum received
+// in the registration response, which is as trustworthy as the grpc
+// connection to masters: without TLS (see pki), anyone on the network may
+// serve a binary with its checksum, so auto update should only be enabled
+// with TLS or on trusted networks.
+
+// platformRegexp is the pattern of os and arch of binaries, which must not
+// be paths
+var platformRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+type checksumItem struct {
+	modTime  time.Time
+	size     int64
+	checksum string
+}
+
+var (
+	checksums   = map[string]checksumItem{}
+	checksumsMu sync.Mutex
+)
+
+// IsAutoUpdateEnabled returns true if the current worker updates itself
+func IsAutoUpdateEnabled() bool {
+	return viper.GetBool("node.update.auto")
+}
+
+// GetUpdatePath returns the path of the worker binary of a platform
+func GetUpdatePath(goos, goarch string) (path string, err error) {
+	dir := viper.GetString("node.update.dir")
+	if dir == "" || !platformRegexp.MatchString(goos) || !platformRegexp.MatchString(goarch) {
+		return "", errors.ErrorNodeUpdateNotFound
+	}
+	path = filepath.Join(dir, goos+"-"+goarch)
+	if _, err := os.Stat(path); err != nil {
+		return "", errors.ErrorNodeUpdateNotFound
+	}
+	return path, nil
+}
+
+// GetUpdate returns the worker binary for a worker, or nil if no binary of
+// its platform is served or it is of the same version as the worker
+func GetUpdate(worker *entity.NodeVersion) (u *entity.NodeUpdate, err error) {
+	if worker == nil {
+		return nil, nil
+	}
+	v := viper.GetString("node.update.version")
+	if v == "" {
+		v = GetCurrent().Version
+	}
+	if v == worker.Version {
+		return nil, nil
+	}
+	path, err := GetUpdatePath(worker.Os, worker.Arch)
+	if err != nil {
+		return nil, nil
+	}
+	checksum, size, err := getChecksum(path)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.NodeUpdate{
+		Version:  v,
+		Checksum: checksum,
+		Size:     size,
+	}, nil
+}
+
+// getChecksum returns the sha256 checksum of a file, which is cached until
+// the file is modified
+func getChecksum(path string) (checksum string, size int64, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, trace.TraceError(err)
+	}
+	checksumsMu.Lock()
+	defer checksumsMu.Unlock()
+	if item, ok := checksums[path]; ok && item.modTime.Equal(info.ModTime()) && item.size == info.Size() {
+		return item.checksum, item.size, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, trace.TraceError(err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", 0, trace.TraceError(err)
+	}
+	checksum = hex.EncodeToString(h.Sum(nil))
+	checksums[path] = checksumItem{modTime: info.ModTime(), size: info.Size(), checksum: checksum}
+	return checksum, info.Size(), nil
+}
+
+// Apply downloads the worker binary of an update from masters, verifies it
+// by the checksum, replaces the executable of the current worker with it and
+// restarts into it. It only returns on error.
+func Apply(u *entity.NodeUpdate) (err error) {
+	if !restartSupported {
+		return errors.ErrorNodeUpdateNotSupported
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return trace.TraceError(err)
+	}
+
+	// skip if the update is the running executable
+	if checksum, _, err := getChecksum(exe); err == nil && strings.EqualFold(checksum, u.Checksum) {
+		return fmt.Errorf("%w: %s is the current binary", errors.ErrorNodeUpdateUnchanged, u.Version)
+	}
+
+	// download next to the executable, so that it can be renamed over it
+	log.Infof("[NodeVersion] downloading worker update %s", u.Version)
+	tmpPath, err := download(u, filepath.Dir(exe), filepath.Base(exe))
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, exe); err != nil {
+		_ = os.Remove(tmpPath)
+		return trace.TraceError(err)
+	}
+
+	log.Infof("[NodeVersion] updated worker to %s, restarting", u.Version)
+	return restart(exe)
+}
+
+func download(u *entity.NodeUpdate, dir, name string) (path string, err error) {
+	query := url.Values{}
+	query.Set("os", runtime.GOOS)
+	query.Set("arch", runtime.GOARCH)
+	updateURL := fmt.Sprintf("%s/updates/worker?%s", viper.GetString("api.endpoint"), query.Encode())
+	resp, err := http.Get(updateURL)
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: status %d", errors.ErrorNodeUpdateNotFound, resp.StatusCode)
+	}
+
+	f, err := os.CreateTemp(dir, name+".update-*")
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	path = f.Name()
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	_ = f.Close()
+	if err != nil {
+		_ = os.Remove(path)
+		return "", trace.TraceError(err)
+	}
+	if checksum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(checksum, u.Checksum) {
+		_ = os.Remove(path)
+		return "", fmt.Errorf("%w: %s, expected %s", errors.ErrorNodeUpdateChecksum, checksum, u.Checksum)
+	}
+	if err := os.Chmod(path, 0755); err != nil {
+		_ = os.Remove(path)
+		return "", trace.TraceError(err)
+	}
+	return path, nil
+}
@@ -0,0 +1,99 @@
+package version
+
+import (
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/config"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/spf13/viper"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Workers report their version and build info at registration, which masters
+// check against their own. Workers of another protocol or major version are
+// refused, and those of another minor version or not reporting versions are
+// only warned about unless strict. Settings:
+//
+//	node.version.strict  refuse workers of another minor version or unknown version
+
+// GetCurrent returns the version and build info of the current node
+func GetCurrent() (v *entity.NodeVersion) {
+	return &entity.NodeVersion{
+		Version:   config.GetVersion(),
+		Protocol:  config.ProtocolVersion,
+		Commit:    config.Commit,
+		BuildTime: config.BuildTime,
+		GoVersion: runtime.Version(),
+		Os:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+}
+
+// GetSkew returns the skew of a worker version from the master version,
+// which is one of constants.NodeVersionSkew*
+func GetSkew(master, worker *entity.NodeVersion) (skew string) {
+	if worker == nil || worker.Version == "" {
+		return constants.NodeVersionSkewUnknown
+	}
+	if master.Protocol != worker.Protocol {
+		return constants.NodeVersionSkewProtocol
+	}
+	m, ok1 := parse(master.Version)
+	w, ok2 := parse(worker.Version)
+	if !ok1 || !ok2 {
+		if master.Version != worker.Version {
+			return constants.NodeVersionSkewUnknown
+		}
+		return constants.NodeVersionSkewNone
+	}
+	switch {
+	case m[0] != w[0]:
+		return constants.NodeVersionSkewMajor
+	case m[1] != w[1]:
+		return constants.NodeVersionSkewMinor
+	case m[2] != w[2] || master.Version != worker.Version:
+		return constants.NodeVersionSkewPatch
+	}
+	return constants.NodeVersionSkewNone
+}
+
+// Check returns the skew of a worker version from the master version, and
+// error if the worker is incompatible with the master
+func Check(master, worker *entity.NodeVersion) (skew string, err error) {
+	skew = GetSkew(master, worker)
+	switch skew {
+	case constants.NodeVersionSkewProtocol:
+		return skew, fmt.Errorf("%w: protocol %d of worker, %d of master", errors.ErrorNodeIncompatibleVersion, worker.Protocol, master.Protocol)
+	case constants.NodeVersionSkewMajor:
+		return skew, fmt.Errorf("%w: %s of worker, %s of master", errors.ErrorNodeIncompatibleVersion, worker.Version, master.Version)
+	case constants.NodeVersionSkewMinor, constants.NodeVersionSkewUnknown:
+		if viper.GetBool("node.version.strict") {
+			return skew, fmt.Errorf("%w: %s skew from master %s", errors.ErrorNodeIncompatibleVersion, skew, master.Version)
+		}
+	}
+	return skew, nil
+}
+
+// parse parses a version like v0.6.3 or v0.6.3-beta into major, minor and
+// patch numbers
+func parse(v string) (res [3]int, ok bool) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return res, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return res, false
+		}
+		res[i] = n
+	}
+	return res, true
+}
@@ -0,0 +1,74 @@
+package version
+
+import (
+	"errors"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetSkew(t *testing.T) {
+	master := &entity.NodeVersion{Version: "v0.6.3", Protocol: 1}
+	cases := map[string]*entity.NodeVersion{
+		constants.NodeVersionSkewNone:     {Version: "v0.6.3", Protocol: 1},
+		constants.NodeVersionSkewPatch:    {Version: "v0.6.2", Protocol: 1},
+		constants.NodeVersionSkewMinor:    {Version: "v0.5.3", Protocol: 1},
+		constants.NodeVersionSkewMajor:    {Version: "v1.6.3", Protocol: 1},
+		constants.NodeVersionSkewProtocol: {Version: "v0.6.3", Protocol: 2},
+		constants.NodeVersionSkewUnknown:  nil,
+	}
+	for skew, worker := range cases {
+		require.Equal(t, skew, GetSkew(master, worker))
+	}
+	require.Equal(t, constants.NodeVersionSkewPatch, GetSkew(master, &entity.NodeVersion{Version: "v0.6.3-beta", Protocol: 1}))
+}
+
+func TestCheck(t *testing.T) {
+	defer viper.Set("node.version.strict", false)
+	master := &entity.NodeVersion{Version: "v0.6.3", Protocol: 1}
+
+	_, err := Check(master, &entity.NodeVersion{Version: "v0.6.3", Protocol: 2})
+	require.True(t, errors.Is(err, errors2.ErrorNodeIncompatibleVersion))
+
+	skew, err := Check(master, &entity.NodeVersion{Version: "v0.5.0", Protocol: 1})
+	require.Nil(t, err)
+	require.Equal(t, constants.NodeVersionSkewMinor, skew)
+
+	viper.Set("node.version.strict", true)
+	_, err = Check(master, &entity.NodeVersion{Version: "v0.5.0", Protocol: 1})
+	require.True(t, errors.Is(err, errors2.ErrorNodeIncompatibleVersion))
+	_, err = Check(master, &entity.NodeVersion{Version: "v0.6.0", Protocol: 1})
+	require.Nil(t, err)
+}
+
+func TestGetUpdate(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("node.update.dir", dir)
+	viper.Set("node.update.version", "v0.7.0")
+	defer viper.Set("node.update.dir", "")
+	defer viper.Set("node.update.version", "")
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "linux-amd64"), []byte("binary"), 0755))
+
+	u, err := GetUpdate(&entity.NodeVersion{Version: "v0.6.3", Os: "linux", Arch: "amd64"})
+	require.Nil(t, err)
+	require.NotNil(t, u)
+	require.Equal(t, "v0.7.0", u.Version)
+	require.Equal(t, int64(6), u.Size)
+	require.Len(t, u.Checksum, 64)
+
+	// same version or no binary of the platform
+	u, err = GetUpdate(&entity.NodeVersion{Version: "v0.7.0", Os: "linux", Arch: "amd64"})
+	require.Nil(t, err)
+	require.Nil(t, u)
+	u, err = GetUpdate(&entity.NodeVersion{Version: "v0.6.3", Os: "linux", Arch: "arm64"})
+	require.Nil(t, err)
+	require.Nil(t, u)
+
+	_, err = GetUpdatePath("..", "linux-amd64")
+	require.True(t, errors.Is(err, errors2.ErrorNodeUpdateNotFound))
+}
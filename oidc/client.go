@@ -0,0 +1,283 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/go-trace"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config is the configuration of an OpenID Connect provider (client)
+type Config struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+	Scopes       []string
+}
+
+// ProviderMetadata is the provider configuration returned by the discovery
+// endpoint (/.well-known/openid-configuration)
+type ProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Client performs the authorization code flow with PKCE against an OpenID
+// Connect provider and validates id tokens with keys of the provider.
+type Client struct {
+	// settings
+	cfg        Config
+	httpClient *http.Client
+
+	// internals
+	metadata *ProviderMetadata
+	keys     map[string]*rsa.PublicKey
+	mu       sync.Mutex
+}
+
+// Discover fetches and caches the provider metadata
+func (c *Client) Discover(ctx context.Context) (metadata *ProviderMetadata, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.discover(ctx)
+}
+
+// AuthCodeUrl returns the url of the authorization endpoint to redirect the
+// user to, with the S256 code challenge of verifier
+func (c *Client) AuthCodeUrl(ctx context.Context, state, nonce, verifier string) (u string, err error) {
+	metadata, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", c.cfg.ClientId)
+	params.Set("redirect_uri", c.cfg.RedirectUrl)
+	params.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", GetCodeChallenge(verifier))
+	params.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return metadata.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange exchanges an authorization code for tokens and returns the raw
+// id token
+func (c *Client) Exchange(ctx context.Context, code, verifier string) (idToken string, err error) {
+	metadata, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.cfg.RedirectUrl)
+	form.Set("client_id", c.cfg.ClientId)
+	form.Set("code_verifier", verifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientId), url.QueryEscape(c.cfg.ClientSecret))
+	}
+	var res struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := c.doJson(req, &res); err != nil {
+		return "", err
+	}
+	if res.Error != "" {
+		return "", trace.TraceError(fmt.Errorf("%w: %s %s", errors.ErrorOidcInvalidResponse, res.Error, res.ErrorDescription))
+	}
+	if res.IdToken == "" {
+		return "", trace.TraceError(errors.ErrorOidcInvalidResponse)
+	}
+	return res.IdToken, nil
+}
+
+// VerifyIdToken validates signature, issuer, audience, expiry and nonce of
+// an id token, and returns its claims
+func (c *Client) VerifyIdToken(ctx context.Context, rawIdToken, nonce string) (claims jwt.MapClaims, err error) {
+	metadata, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims = jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(
+		rawIdToken,
+		claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return c.getKey(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(c.cfg.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, trace.TraceError(fmt.Errorf("%w: %v", errors.ErrorOidcInvalidIdToken, err))
+	}
+	if value, _ := claims["nonce"].(string); value != nonce {
+		return nil, trace.TraceError(fmt.Errorf("%w: nonce mismatch", errors.ErrorOidcInvalidIdToken))
+	}
+	return claims, nil
+}
+
+func (c *Client) discover(ctx context.Context) (metadata *ProviderMetadata, err error) {
+	if c.metadata != nil {
+		return c.metadata, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	metadata = &ProviderMetadata{}
+	if err := c.doJson(req, metadata); err != nil {
+		return nil, err
+	}
+	if metadata.Issuer != c.cfg.Issuer {
+		return nil, trace.TraceError(fmt.Errorf("%w: issuer mismatch %s", errors.ErrorOidcInvalidResponse, metadata.Issuer))
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JwksUri == "" {
+		return nil, trace.TraceError(fmt.Errorf("%w: missing endpoints", errors.ErrorOidcInvalidResponse))
+	}
+	c.metadata = metadata
+	return metadata, nil
+}
+
+// getKey returns the public key of kid, and refetches keys of the provider
+// if not found, as keys may have been rotated
+func (c *Client) getKey(ctx context.Context, kid string) (key *rsa.PublicKey, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key := c.findKey(kid); key != nil {
+		return key, nil
+	}
+	if err := c.fetchKeys(ctx); err != nil {
+		return nil, err
+	}
+	if key := c.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key not found: %s", kid)
+}
+
+func (c *Client) findKey(kid string) (key *rsa.PublicKey) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key
+		}
+	}
+	return c.keys[kid]
+}
+
+func (c *Client) fetchKeys(ctx context.Context) (err error) {
+	metadata, err := c.discover(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JwksUri, nil)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	var res struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := c.doJson(req, &res); err != nil {
+		return err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range res.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := parseRsaKey(k)
+		if err != nil {
+			return err
+		}
+		keys[k.Kid] = key
+	}
+	c.keys = keys
+	return nil
+}
+
+func (c *Client) doJson(req *http.Request, v interface{}) (err error) {
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusInternalServerError {
+		return trace.TraceError(fmt.Errorf("%w: status %d", errors.ErrorOidcInvalidResponse, res.StatusCode))
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return trace.TraceError(fmt.Errorf("%w: %v", errors.ErrorOidcInvalidResponse, err))
+	}
+	return nil
+}
+
+func parseRsaKey(k jsonWebKey) (key *rsa.PublicKey, err error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+// GetCodeChallenge returns the S256 code challenge of a PKCE code verifier
+func GetCodeChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+func NewClient(cfg Config, httpClient *http.Client) (c *Client) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 15 * time.Second}
+	}
+	return &Client{
+		cfg:        cfg,
+		httpClient: httpClient,
+	}
+}
@@ -0,0 +1,150 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// mockProvider is a minimal OpenID Connect provider issuing id tokens for
+// a single authorization code
+type mockProvider struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	code      string
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) (p *mockProvider) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	p = &mockProvider{key: key, code: "test-code"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(ProviderMetadata{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize",
+			TokenEndpoint:         p.server.URL + "/token",
+			JwksUri:               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []jsonWebKey{{
+				Kid: "test",
+				Kty: "RSA",
+				Alg: "RS256",
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("code") != p.code || GetCodeChallenge(r.PostForm.Get("code_verifier")) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": p.sign(t, p.claims)})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func (p *mockProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	s, err := token.SignedString(p.key)
+	require.Nil(t, err)
+	return s
+}
+
+func TestClient_Login(t *testing.T) {
+	p := newMockProvider(t)
+	c := NewClient(Config{
+		Issuer:      p.server.URL,
+		ClientId:    "crawlab",
+		RedirectUrl: "http://localhost:8080/oidc/callback",
+		Scopes:      []string{"openid", "profile", "groups"},
+	}, nil)
+	ctx := context.Background()
+
+	// authorization url
+	authUrl, err := c.AuthCodeUrl(ctx, "state", "nonce", "verifier")
+	require.Nil(t, err)
+	u, err := url.Parse(authUrl)
+	require.Nil(t, err)
+	require.Equal(t, "/authorize", u.Path)
+	require.Equal(t, "state", u.Query().Get("state"))
+	require.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	p.challenge = u.Query().Get("code_challenge")
+	p.nonce = u.Query().Get("nonce")
+	p.claims = jwt.MapClaims{
+		"iss":                p.server.URL,
+		"aud":                "crawlab",
+		"sub":                "user-1",
+		"preferred_username": "alice",
+		"groups":             []string{"Admins", "dev"},
+		"nonce":              p.nonce,
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	}
+
+	// wrong verifier
+	_, err = c.Exchange(ctx, p.code, "wrong")
+	require.NotNil(t, err)
+
+	// id token
+	rawIdToken, err := c.Exchange(ctx, p.code, "verifier")
+	require.Nil(t, err)
+	claims, err := c.VerifyIdToken(ctx, rawIdToken, "nonce")
+	require.Nil(t, err)
+	require.Equal(t, "user-1", claims["sub"])
+	require.Equal(t, []string{"Admins", "dev"}, getGroups(claims, "groups"))
+
+	// wrong nonce
+	_, err = c.VerifyIdToken(ctx, rawIdToken, "other")
+	require.NotNil(t, err)
+
+	// wrong audience
+	claims = jwt.MapClaims{}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	claims["aud"] = "other"
+	_, err = c.VerifyIdToken(ctx, p.sign(t, claims), "nonce")
+	require.NotNil(t, err)
+
+	// expired
+	claims["aud"] = "crawlab"
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = c.VerifyIdToken(ctx, p.sign(t, claims), "nonce")
+	require.NotNil(t, err)
+
+	// signed by another key
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, p.claims)
+	token.Header["kid"] = "test"
+	s, err := token.SignedString(key)
+	require.Nil(t, err)
+	_, err = c.VerifyIdToken(ctx, s, "nonce")
+	require.NotNil(t, err)
+}
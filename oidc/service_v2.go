@@ -0,0 +1,250 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	errors2 "errors"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/user"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/crawlab-team/go-trace"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+	"time"
+)
+
+// ServiceV2 signs users in with an OpenID Connect provider configured with
+// "oidc.*" settings. Users are provisioned on first login, and groups in
+// the groups claim are mapped to roles with "oidc.roleMapping" (group name
+// in lower case -> role key, or "admin" for admin users). Signed-in users
+// go through the same checks and second step (2FA) as password logins.
+//
+// Pending logins are stored in the database (OidcStateV2) so that the
+// callback can be handled by any master, and are bound to the browser
+// starting the login by a random binding value set in a cookie.
+type ServiceV2 struct {
+	// dependencies
+	client *Client
+
+	// settings
+	enabled       bool
+	usernameClaim string
+	groupsClaim   string
+	roleMapping   map[string]string
+	sessionTtl    time.Duration
+}
+
+func (svc *ServiceV2) Enabled() bool {
+	return svc.enabled
+}
+
+// GetSessionTtl returns the duration in which a login must be completed
+func (svc *ServiceV2) GetSessionTtl() time.Duration {
+	return svc.sessionTtl
+}
+
+// GetLoginUrl starts a login and returns the authorization url to redirect
+// the user to, and the binding value to be set in a cookie of the browser
+func (svc *ServiceV2) GetLoginUrl(ctx context.Context) (u string, binding string, err error) {
+	if !svc.enabled {
+		return "", "", errors.ErrorOidcNotEnabled
+	}
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	binding, err = randomString()
+	if err != nil {
+		return "", "", err
+	}
+	u, err = svc.client.AuthCodeUrl(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	s := models.OidcStateV2{
+		StateHash:   utils.EncryptSha256(state),
+		BindingHash: utils.EncryptSha256(binding),
+		Nonce:       nonce,
+		Verifier:    verifier,
+		ExpiresAt:   time.Now().Add(svc.sessionTtl),
+	}
+	s.SetCreated(primitive.NilObjectID)
+	s.SetUpdated(primitive.NilObjectID)
+	if _, err := service.NewModelServiceV2[models.OidcStateV2]().InsertOne(s); err != nil {
+		return "", "", trace.TraceError(err)
+	}
+
+	return u, binding, nil
+}
+
+// Callback completes a login with the state and code from the provider and
+// the binding value in the cookie of the browser, and returns tokens of a
+// new session of the signed-in user, or a challenge token if a second step
+// is required
+func (svc *ServiceV2) Callback(ctx context.Context, state, code, binding string, client *entity.LoginClient) (res *entity.LoginResult, u *models.UserV2, err error) {
+	if !svc.enabled {
+		return nil, nil, errors.ErrorOidcNotEnabled
+	}
+
+	// pending login (used only once)
+	s, err := svc.takeState(state)
+	if err != nil {
+		return nil, nil, err
+	}
+	if binding == "" || utils.EncryptSha256(binding) != s.BindingHash || time.Now().After(s.ExpiresAt) {
+		return nil, nil, errors.ErrorOidcInvalidState
+	}
+
+	// id token
+	rawIdToken, err := svc.client.Exchange(ctx, code, s.Verifier)
+	if err != nil {
+		return nil, nil, err
+	}
+	claims, err := svc.client.VerifyIdToken(ctx, rawIdToken, s.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// user
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, nil, trace.TraceError(errors.ErrorOidcMissingClaim)
+	}
+	email, _ := claims["email"].(string)
+	username, _ := claims[svc.usernameClaim].(string)
+	if username == "" {
+		username = email
+	}
+	if username == "" {
+		username = sub
+	}
+	userSvc, err := user.GetUserServiceV2()
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err = userSvc.SyncExternalUser(&entity.ExternalIdentity{
+		Source:   constants.AuthSourceOidc,
+		Id:       sub,
+		Username: username,
+		Email:    email,
+		Groups:   getGroups(claims, svc.groupsClaim),
+	}, svc.roleMapping)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// session, or second step
+	res, err = userSvc.LoginExternal(u, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return res, u, nil
+}
+
+// takeState removes and returns the pending login of a state, so that it
+// cannot be used again
+func (svc *ServiceV2) takeState(state string) (s *models.OidcStateV2, err error) {
+	if state == "" {
+		return nil, errors.ErrorOidcInvalidState
+	}
+	col := service.NewModelServiceV2[models.OidcStateV2]().GetCol()
+	if err := col.GetCollection().FindOneAndDelete(col.GetContext(), bson.M{
+		"state_hash": utils.EncryptSha256(state),
+	}).Decode(&s); err != nil {
+		if errors2.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.ErrorOidcInvalidState
+		}
+		return nil, trace.TraceError(err)
+	}
+	return s, nil
+}
+
+// getGroups returns groups in the groups claim, which is either a list or
+// a comma-separated string
+func getGroups(claims jwt.MapClaims, claim string) (groups []string) {
+	switch v := claims[claim].(type) {
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok && s != "" {
+				groups = append(groups, s)
+			}
+		}
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				groups = append(groups, s)
+			}
+		}
+	}
+	return groups
+}
+
+func randomString() (s string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", trace.TraceError(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func NewOidcServiceV2() (svc *ServiceV2) {
+	scopes := viper.GetStringSlice("oidc.scopes")
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+	usernameClaim := viper.GetString("oidc.usernameClaim")
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	groupsClaim := viper.GetString("oidc.groupsClaim")
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	roleMapping := map[string]string{}
+	for group, key := range viper.GetStringMapString("oidc.roleMapping") {
+		roleMapping[strings.ToLower(group)] = key
+	}
+	return &ServiceV2{
+		client: NewClient(Config{
+			Issuer:       viper.GetString("oidc.issuer"),
+			ClientId:     viper.GetString("oidc.clientId"),
+			ClientSecret: viper.GetString("oidc.clientSecret"),
+			RedirectUrl:  viper.GetString("oidc.redirectUrl"),
+			Scopes:       scopes,
+		}, nil),
+		enabled:       viper.GetString("oidc.issuer") != "",
+		usernameClaim: usernameClaim,
+		groupsClaim:   groupsClaim,
+		roleMapping:   roleMapping,
+		sessionTtl:    10 * time.Minute,
+	}
+}
+
+var oidcSvcV2 *ServiceV2
+
+func GetOidcServiceV2() (svc *ServiceV2) {
+	if oidcSvcV2 != nil {
+		return oidcSvcV2
+	}
+	oidcSvcV2 = NewOidcServiceV2()
+	return oidcSvcV2
+}
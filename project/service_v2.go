@@ -0,0 +1,260 @@
+package project
+
+import (
+	"errors"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"strings"
+)
+
+// ServiceV2 scopes resources to projects. Normal users can only access
+// resources in projects they are members (ProjectMemberV2) of, and can only
+// write to projects in which they are owner or developer. Admin users can
+// access all resources. Resources in no project (zero project id), e.g.
+// those created before projects, are shared by all users as without
+// projects.
+type ServiceV2 struct {
+}
+
+// GetMemberRole returns role of a user in a project, or empty string if the
+// user is not a member of the project.
+func (svc *ServiceV2) GetMemberRole(userId, projectId primitive.ObjectID) (role string, err error) {
+	m, err := service.NewModelServiceV2[models.ProjectMemberV2]().GetOne(bson.M{
+		"project_id": projectId,
+		"user_id":    userId,
+	}, nil)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		return "", err
+	}
+	return m.Role, nil
+}
+
+// CanRead returns true if a user can view resources in a project
+func (svc *ServiceV2) CanRead(u *models.UserV2, projectId primitive.ObjectID) (ok bool, err error) {
+	if u.Role == constants.RoleAdmin || projectId.IsZero() {
+		return true, nil
+	}
+	role, err := svc.GetMemberRole(u.Id, projectId)
+	if err != nil {
+		return false, err
+	}
+	return role != "", nil
+}
+
+// CanWrite returns true if a user can create or change resources in a project
+func (svc *ServiceV2) CanWrite(u *models.UserV2, projectId primitive.ObjectID) (ok bool, err error) {
+	if u.Role == constants.RoleAdmin || projectId.IsZero() {
+		return true, nil
+	}
+	role, err := svc.GetMemberRole(u.Id, projectId)
+	if err != nil {
+		return false, err
+	}
+	return role == constants.ProjectMemberRoleOwner || role == constants.ProjectMemberRoleDeveloper, nil
+}
+
+// CanManage returns true if a user can manage members of a project
+func (svc *ServiceV2) CanManage(u *models.UserV2, projectId primitive.ObjectID) (ok bool, err error) {
+	if u.Role == constants.RoleAdmin {
+		return true, nil
+	}
+	role, err := svc.GetMemberRole(u.Id, projectId)
+	if err != nil {
+		return false, err
+	}
+	return role == constants.ProjectMemberRoleOwner, nil
+}
+
+// GetProjectIds returns ids of projects a user is member of, or can write
+// to if write is true
+func (svc *ServiceV2) GetProjectIds(userId primitive.ObjectID, write bool) (ids []primitive.ObjectID, err error) {
+	query := bson.M{"user_id": userId}
+	if write {
+		query["role"] = bson.M{"$in": []string{
+			constants.ProjectMemberRoleOwner,
+			constants.ProjectMemberRoleDeveloper,
+		}}
+	}
+	members, err := service.NewModelServiceV2[models.ProjectMemberV2]().GetMany(query, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		ids = append(ids, m.ProjectId)
+	}
+	return ids, nil
+}
+
+// GetFilter returns the query restricting resources to projects of a user
+// (or projects the user can write to if write is true) and resources in no
+// project on the given field ("_id" of projects, "project_id" or
+// "spider_id"), or nil if the user is not restricted.
+func (svc *ServiceV2) GetFilter(u *models.UserV2, field string, write bool) (query bson.M, err error) {
+	if u == nil || u.Role == constants.RoleAdmin || field == "" {
+		return nil, nil
+	}
+	projectIds, err := svc.GetProjectIds(u.Id, write)
+	if err != nil {
+		return nil, err
+	}
+	if projectIds == nil {
+		projectIds = []primitive.ObjectID{}
+	}
+	if field == "_id" {
+		return bson.M{field: bson.M{"$in": projectIds}}, nil
+	}
+
+	// projects of the user, or no project (zero or missing)
+	ids := []any{nil, primitive.NilObjectID}
+	for _, id := range projectIds {
+		ids = append(ids, id)
+	}
+	if field != "spider_id" {
+		return bson.M{field: bson.M{"$in": ids}}, nil
+	}
+
+	// spiders in the projects, or no spider
+	spiderIds := []any{nil, primitive.NilObjectID}
+	spiders, err := service.NewModelServiceV2[models.SpiderV2]().GetMany(bson.M{"project_id": bson.M{"$in": ids}}, nil)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	for _, s := range spiders {
+		spiderIds = append(spiderIds, s.Id)
+	}
+	return bson.M{field: bson.M{"$in": spiderIds}}, nil
+}
+
+// GetResourceProjectId returns id of the project a resource belongs to.
+// ok is false if the resource is not scoped to projects.
+func (svc *ServiceV2) GetResourceProjectId(resource string, id primitive.ObjectID) (projectId primitive.ObjectID, ok bool, err error) {
+	var spiderId primitive.ObjectID
+	switch resource {
+	case "projects":
+		return id, true, nil
+	case "projects/members":
+		m, err := service.NewModelServiceV2[models.ProjectMemberV2]().GetById(id)
+		if err != nil {
+			return projectId, true, ignoreNotFound(err)
+		}
+		return m.ProjectId, true, nil
+	case "data-sources":
+		ds, err := service.NewModelServiceV2[models.DataSourceV2]().GetById(id)
+		if err != nil {
+			return projectId, true, ignoreNotFound(err)
+		}
+		return ds.ProjectId, true, nil
+	case "spiders":
+		spiderId = id
+	case "tasks":
+		t, err := service.NewModelServiceV2[models.TaskV2]().GetById(id)
+		if err != nil {
+			return projectId, true, ignoreNotFound(err)
+		}
+		spiderId = t.SpiderId
+	case "schedules":
+		s, err := service.NewModelServiceV2[models.ScheduleV2]().GetById(id)
+		if err != nil {
+			return projectId, true, ignoreNotFound(err)
+		}
+		spiderId = s.SpiderId
+	case "results":
+		s, err := service.NewModelServiceV2[models.SpiderV2]().GetOne(bson.M{"col_id": id}, nil)
+		if err != nil {
+			return projectId, true, ignoreNotFound(err)
+		}
+		return s.ProjectId, true, nil
+	default:
+		return projectId, false, nil
+	}
+	s, err := service.NewModelServiceV2[models.SpiderV2]().GetById(spiderId)
+	if err != nil {
+		return projectId, true, ignoreNotFound(err)
+	}
+	return s.ProjectId, true, nil
+}
+
+// GetProjectField returns the field of a model to filter by projects, which
+// is "_id" for projects, "project_id" for models belonging to projects and
+// "spider_id" for models belonging to spiders, or empty string if the model
+// is not scoped to projects.
+func GetProjectField[T any]() (field string) {
+	typ := reflect.TypeOf(*new(T))
+	if typ == nil {
+		return ""
+	}
+	if typ == reflect.TypeOf(models.ProjectV2{}) {
+		return "_id"
+	}
+	field, _ = getProjectFieldIndex(typ)
+	return field
+}
+
+// GetModelProjectId returns id of the project a model belongs to, by its
+// "project_id" field or the project of the spider in its "spider_id" field.
+// ok is false if the model is not scoped to projects.
+func (svc *ServiceV2) GetModelProjectId(model any) (projectId primitive.ObjectID, ok bool, err error) {
+	v := reflect.Indirect(reflect.ValueOf(model))
+	if v.Kind() != reflect.Struct {
+		return projectId, false, nil
+	}
+	field, i := getProjectFieldIndex(v.Type())
+	if field == "" {
+		return projectId, false, nil
+	}
+	id, _ := v.Field(i).Interface().(primitive.ObjectID)
+	if field == "project_id" || id.IsZero() {
+		return id, true, nil
+	}
+	s, err := service.NewModelServiceV2[models.SpiderV2]().GetById(id)
+	if err != nil {
+		return projectId, true, ignoreNotFound(err)
+	}
+	return s.ProjectId, true, nil
+}
+
+// getProjectFieldIndex returns the bson name and index of "project_id" or
+// "spider_id" field of a struct type
+func getProjectFieldIndex(typ reflect.Type) (field string, index int) {
+	if typ.Kind() != reflect.Struct {
+		return "", -1
+	}
+	for _, name := range []string{"project_id", "spider_id"} {
+		for i := 0; i < typ.NumField(); i++ {
+			tag := strings.Split(typ.Field(i).Tag.Get("bson"), ",")[0]
+			if tag == name {
+				return name, i
+			}
+		}
+	}
+	return "", -1
+}
+
+func ignoreNotFound(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	return err
+}
+
+func NewProjectServiceV2() (svc *ServiceV2) {
+	return &ServiceV2{}
+}
+
+var projectSvcV2 *ServiceV2
+
+func GetProjectServiceV2() (svc *ServiceV2) {
+	if projectSvcV2 != nil {
+		return projectSvcV2
+	}
+	projectSvcV2 = NewProjectServiceV2()
+	return projectSvcV2
+}
@@ -0,0 +1,51 @@
+package project
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestGetProjectField(t *testing.T) {
+	require.Equal(t, "_id", GetProjectField[models.ProjectV2]())
+	require.Equal(t, "project_id", GetProjectField[models.SpiderV2]())
+	require.Equal(t, "project_id", GetProjectField[models.DataSourceV2]())
+	require.Equal(t, "project_id", GetProjectField[models.ProjectMemberV2]())
+	require.Equal(t, "spider_id", GetProjectField[models.TaskV2]())
+	require.Equal(t, "spider_id", GetProjectField[models.ScheduleV2]())
+	require.Equal(t, "", GetProjectField[models.NodeV2]())
+}
+
+func TestServiceV2_GetModelProjectId(t *testing.T) {
+	svc := NewProjectServiceV2()
+
+	projectId := primitive.NewObjectID()
+	id, ok, err := svc.GetModelProjectId(&models.SpiderV2{ProjectId: projectId})
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, projectId, id)
+
+	id, ok, err = svc.GetModelProjectId(&models.TaskV2{})
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.True(t, id.IsZero())
+
+	_, ok, err = svc.GetModelProjectId(&models.NodeV2{})
+	require.Nil(t, err)
+	require.False(t, ok)
+}
+
+func TestServiceV2_CanReadWriteNoProject(t *testing.T) {
+	svc := NewProjectServiceV2()
+	u := &models.UserV2{Role: constants.RoleNormal}
+
+	ok, err := svc.CanRead(u, primitive.NilObjectID)
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	ok, err = svc.CanWrite(u, primitive.NilObjectID)
+	require.Nil(t, err)
+	require.True(t, ok)
+}
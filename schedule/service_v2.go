@@ -1,10 +1,14 @@
 package schedule
 
 import (
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/audit"
 	"github.com/crawlab-team/crawlab-core/config"
+	"github.com/crawlab-team/crawlab-core/constants"
 	"github.com/crawlab-team/crawlab-core/interfaces"
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/node/leader"
 	"github.com/crawlab-team/crawlab-core/spider/admin"
 	"github.com/crawlab-team/crawlab-core/utils"
 	"github.com/crawlab-team/go-trace"
@@ -31,10 +35,20 @@ type ServiceV2 struct {
 	cron      *cron.Cron
 	logger    cron.Logger
 	schedules []models.ScheduleV2
+	entries   map[primitive.ObjectID]scheduleEntry // cron entries of schedules on the leader
+	isLeader  bool
 	stopped   bool
 	mu        sync.Mutex
 }
 
+type scheduleEntry struct {
+	id   cron.EntryID
+	cron string
+}
+
+// leaderCheckInterval is the interval of checking leadership of the master
+const leaderCheckInterval = 5 * time.Second
+
 func (svc *ServiceV2) GetLocation() (loc *time.Location) {
 	return svc.loc
 }
@@ -90,12 +104,18 @@ func (svc *ServiceV2) Enable(s models.ScheduleV2, by primitive.ObjectID) (err er
 	svc.mu.Lock()
 	defer svc.mu.Unlock()
 
-	id, err := svc.cron.AddFunc(s.Cron, svc.schedule(s.Id))
-	if err != nil {
+	// cron entries are only added on the leader, which takes over enabled
+	// schedules on update
+	if leader.IsLeader() {
+		id, err := svc.addEntry(s)
+		if err != nil {
+			return err
+		}
+		s.EntryId = id
+	} else if _, err := cron.ParseStandard(s.Cron); err != nil {
 		return trace.TraceError(err)
 	}
 	s.Enabled = true
-	s.EntryId = id
 	s.SetUpdated(by)
 	return svc.modelSvc.ReplaceById(s.Id, s)
 }
@@ -104,7 +124,7 @@ func (svc *ServiceV2) Disable(s models.ScheduleV2, by primitive.ObjectID) (err e
 	svc.mu.Lock()
 	defer svc.mu.Unlock()
 
-	svc.cron.Remove(s.EntryId)
+	svc.removeEntry(s.Id)
 	s.Enabled = false
 	s.EntryId = -1
 	s.SetUpdated(by)
@@ -112,14 +132,22 @@ func (svc *ServiceV2) Disable(s models.ScheduleV2, by primitive.ObjectID) (err e
 }
 
 func (svc *ServiceV2) Update() {
+	var updatedAt time.Time
 	for {
 		if svc.stopped {
 			return
 		}
 
-		svc.update()
+		// update immediately once leadership changes, so that schedules are
+		// taken over without waiting for the update interval
+		isLeader := leader.IsLeader()
+		if isLeader != svc.isLeader || time.Since(updatedAt) >= svc.updateInterval {
+			svc.isLeader = isLeader
+			svc.update(isLeader)
+			updatedAt = time.Now()
+		}
 
-		time.Sleep(svc.updateInterval)
+		time.Sleep(leaderCheckInterval)
 	}
 }
 
@@ -127,46 +155,70 @@ func (svc *ServiceV2) GetCron() (c *cron.Cron) {
 	return svc.cron
 }
 
-func (svc *ServiceV2) update() {
+// update syncs cron entries with enabled schedules on the leader, and
+// removes all entries on other masters
+func (svc *ServiceV2) update(isLeader bool) {
+	if !isLeader {
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+		for id := range svc.entries {
+			svc.removeEntry(id)
+		}
+		return
+	}
+
 	// fetch enabled schedules
 	if err := svc.fetch(); err != nil {
 		trace.PrintError(err)
 		return
 	}
 
-	// entry id map
-	entryIdsMap := svc.getEntryIdsMap()
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
 
-	// iterate enabled schedules
+	// add entries of schedules enabled or changed on other masters
+	enabled := map[primitive.ObjectID]bool{}
 	for _, s := range svc.schedules {
-		_, ok := entryIdsMap[s.EntryId]
-		if ok {
-			entryIdsMap[s.EntryId] = true
-		} else {
-			if !s.Enabled {
-				err := svc.Enable(s, s.GetCreatedBy())
-				if err != nil {
-					trace.PrintError(err)
-					continue
-				}
-			}
+		enabled[s.Id] = true
+		if e, ok := svc.entries[s.Id]; ok && e.cron == s.Cron {
+			continue
+		}
+		id, err := svc.addEntry(s)
+		if err != nil {
+			trace.PrintError(err)
+			continue
+		}
+		if err := svc.modelSvc.UpdateById(s.Id, bson.M{"$set": bson.M{"entry_id": id}}); err != nil {
+			trace.PrintError(err)
 		}
 	}
 
-	// remove non-existent entries
-	for id, ok := range entryIdsMap {
-		if !ok {
-			svc.cron.Remove(id)
+	// remove entries of disabled or deleted schedules
+	for id := range svc.entries {
+		if !enabled[id] {
+			svc.removeEntry(id)
 		}
 	}
 }
 
-func (svc *ServiceV2) getEntryIdsMap() (res map[cron.EntryID]bool) {
-	res = map[cron.EntryID]bool{}
-	for _, e := range svc.cron.Entries() {
-		res[e.ID] = false
+// addEntry adds or replaces the cron entry of a schedule
+func (svc *ServiceV2) addEntry(s models.ScheduleV2) (id cron.EntryID, err error) {
+	svc.removeEntry(s.Id)
+	id, err = svc.cron.AddFunc(s.Cron, svc.schedule(s.Id))
+	if err != nil {
+		return 0, trace.TraceError(err)
+	}
+	svc.entries[s.Id] = scheduleEntry{id: id, cron: s.Cron}
+	return id, nil
+}
+
+func (svc *ServiceV2) removeEntry(scheduleId primitive.ObjectID) {
+	e, ok := svc.entries[scheduleId]
+	if !ok {
+		return
 	}
-	return res
+	svc.cron.Remove(e.id)
+	delete(svc.entries, scheduleId)
 }
 
 func (svc *ServiceV2) fetch() (err error) {
@@ -182,6 +234,11 @@ func (svc *ServiceV2) fetch() (err error) {
 
 func (svc *ServiceV2) schedule(id primitive.ObjectID) (fn func()) {
 	return func() {
+		// a master which has just lost leadership may still have entries
+		if !leader.IsLeader() {
+			return
+		}
+
 		// schedule
 		s, err := svc.modelSvc.GetById(id)
 		if err != nil {
@@ -198,13 +255,15 @@ func (svc *ServiceV2) schedule(id primitive.ObjectID) (fn func()) {
 
 		// options
 		opts := &interfaces.SpiderRunOptions{
-			Mode:       s.Mode,
-			NodeIds:    s.NodeIds,
-			Cmd:        s.Cmd,
-			Param:      s.Param,
-			Priority:   s.Priority,
-			ScheduleId: s.Id,
-			UserId:     s.GetCreatedBy(),
+			Mode:         s.Mode,
+			NodeIds:      s.NodeIds,
+			NodeSelector: s.NodeSelector,
+			Cmd:          s.Cmd,
+			Param:        s.Param,
+			Params:       s.Params,
+			Priority:     s.Priority,
+			ScheduleId:   s.Id,
+			UserId:       s.GetCreatedBy(),
 		}
 
 		// normalize options
@@ -214,6 +273,9 @@ func (svc *ServiceV2) schedule(id primitive.ObjectID) (fn func()) {
 		if len(opts.NodeIds) == 0 {
 			opts.NodeIds = spider.NodeIds
 		}
+		if opts.NodeSelector == "" {
+			opts.NodeSelector = spider.NodeSelector
+		}
 		if opts.Cmd == "" {
 			opts.Cmd = spider.Cmd
 		}
@@ -229,9 +291,19 @@ func (svc *ServiceV2) schedule(id primitive.ObjectID) (fn func()) {
 		}
 
 		// schedule or assign a task in the task queue
-		if _, err := svc.adminSvc.Schedule(s.SpiderId, opts); err != nil {
+		taskIds, err := svc.adminSvc.Schedule(s.SpiderId, opts)
+		if err != nil {
 			trace.PrintError(err)
+			return
 		}
+
+		// audit
+		audit.GetAuditServiceV2().RecordSystem(
+			constants.AuditActionScheduleFire,
+			"schedules",
+			s.Id,
+			fmt.Sprintf("schedule[%s] fired %d task(s) of spider[%s]", s.Name, len(taskIds), spider.Name),
+		)
 	}
 }
 
@@ -244,6 +316,7 @@ func NewScheduleServiceV2() (svc2 *ServiceV2, err error) {
 		delay:          false,
 		skip:           false,
 		updateInterval: 1 * time.Minute,
+		entries:        map[primitive.ObjectID]scheduleEntry{},
 	}
 	svc.adminSvc, err = admin.GetSpiderAdminServiceV2()
 	if err != nil {
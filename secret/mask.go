@@ -0,0 +1,62 @@
+package secret
+
+import (
+	"sort"
+	"strings"
+)
+
+// MaskedValue replaces values of secrets in task logs
+const MaskedValue = "******"
+
+// maskMinLength is the minimal length of values to mask, as masking every
+// occurrence of very short values would make logs unreadable while hardly
+// hiding anything
+const maskMinLength = 4
+
+// Masker replaces values of secrets in log lines
+type Masker struct {
+	replacer *strings.Replacer
+}
+
+// Mask returns line with values of secrets replaced
+func (m *Masker) Mask(line string) string {
+	if m == nil || m.replacer == nil {
+		return line
+	}
+	return m.replacer.Replace(line)
+}
+
+// NewMasker returns a masker of values. Each line of a multi-line value is
+// also masked, as logs are written line by line.
+func NewMasker(values []string) (m *Masker) {
+	var items []string
+	seen := map[string]bool{}
+	add := func(v string) {
+		if len(v) < maskMinLength || seen[v] {
+			return
+		}
+		seen[v] = true
+		items = append(items, v)
+	}
+	for _, v := range values {
+		add(v)
+		if strings.Contains(v, "\n") {
+			for _, line := range strings.Split(v, "\n") {
+				add(strings.TrimSpace(line))
+			}
+		}
+	}
+	if len(items) == 0 {
+		return &Masker{}
+	}
+
+	// longer values first so that they are not partially masked
+	sort.Slice(items, func(i, j int) bool {
+		return len(items[i]) > len(items[j])
+	})
+	var oldnew []string
+	for _, v := range items {
+		oldnew = append(oldnew, v, MaskedValue)
+	}
+	return &Masker{replacer: strings.NewReplacer(oldnew...)}
+}
@@ -0,0 +1,252 @@
+package secret
+
+import (
+	errors2 "errors"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/crawlab-team/go-trace"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"regexp"
+	"time"
+)
+
+// Secrets (SecretV2) are environment variables of tasks encrypted at rest.
+// They are encrypted with the first key in the "secret.keys" setting (or the
+// default server key if not set), and the id of the key is stored with each
+// secret so that it can still be decrypted with a previous key listed after
+// the current one. RotateKeys re-encrypts secrets with the current key,
+// after which previous keys can be removed. Secrets are only decrypted on
+// the master, which passes those available to a task to the node fetching
+// it (see GetTaskSecrets).
+
+var secretKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type ServiceV2 struct {
+}
+
+// Encrypt encrypts value with the current key, and returns the cipher text
+// and the id of the key
+func (svc *ServiceV2) Encrypt(value string) (res string, keyId string, err error) {
+	key := GetKeys()[0]
+	res, err = utils.EncryptAESWithKey(value, key)
+	if err != nil {
+		return "", "", trace.TraceError(err)
+	}
+	return res, GetKeyId(key), nil
+}
+
+// Decrypt returns the plain value of a secret
+func (svc *ServiceV2) Decrypt(s *models.SecretV2) (value string, err error) {
+	key, ok := getKey(s.KeyId)
+	if !ok {
+		return "", trace.TraceError(errors.ErrorSecretUnknownKeyId)
+	}
+	value, err = utils.DecryptAESWithKey(s.Value, key)
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	return value, nil
+}
+
+// Validate checks the key and the scope of a secret, and sets its project
+// to the project of its spider if it is scoped to a spider
+func (svc *ServiceV2) Validate(s *models.SecretV2) (err error) {
+	if !secretKeyRegexp.MatchString(s.Key) {
+		return errors.ErrorSecretInvalidKey
+	}
+
+	// scope
+	if !s.SpiderId.IsZero() {
+		spider, err := service.NewModelServiceV2[models.SpiderV2]().GetById(s.SpiderId)
+		if err != nil {
+			if errors2.Is(err, mongo.ErrNoDocuments) {
+				return errors.ErrorSecretInvalidScope
+			}
+			return trace.TraceError(err)
+		}
+		s.ProjectId = spider.ProjectId
+	} else if !s.ProjectId.IsZero() {
+		if _, err := service.NewModelServiceV2[models.ProjectV2]().GetById(s.ProjectId); err != nil {
+			if errors2.Is(err, mongo.ErrNoDocuments) {
+				return errors.ErrorSecretInvalidScope
+			}
+			return trace.TraceError(err)
+		}
+	}
+
+	// unique in scope
+	query := bson.M{
+		"key":        s.Key,
+		"project_id": s.ProjectId,
+		"spider_id":  s.SpiderId,
+	}
+	if !s.Id.IsZero() {
+		query["_id"] = bson.M{"$ne": s.Id}
+	}
+	count, err := service.NewModelServiceV2[models.SecretV2]().Count(query)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if count > 0 {
+		return errors.ErrorSecretAlreadyExists
+	}
+
+	return nil
+}
+
+// RotateKeys re-encrypts secrets not encrypted with the current key, and
+// returns the number of re-encrypted secrets
+func (svc *ServiceV2) RotateKeys(by primitive.ObjectID) (n int, err error) {
+	modelSvc := service.NewModelServiceV2[models.SecretV2]()
+	currentKeyId := GetKeyId(GetKeys()[0])
+	secrets, err := modelSvc.GetMany(bson.M{"key_id": bson.M{"$ne": currentKeyId}}, nil)
+	if err != nil && !errors2.Is(err, mongo.ErrNoDocuments) {
+		return 0, trace.TraceError(err)
+	}
+	for _, s := range secrets {
+		value, err := svc.Decrypt(&s)
+		if err != nil {
+			return n, err
+		}
+		encrypted, keyId, err := svc.Encrypt(value)
+		if err != nil {
+			return n, err
+		}
+		if err := modelSvc.UpdateById(s.Id, bson.M{"$set": bson.M{
+			"value":      encrypted,
+			"key_id":     keyId,
+			"updated_by": by,
+			"updated_ts": time.Now(),
+		}}); err != nil {
+			return n, trace.TraceError(err)
+		}
+		n++
+	}
+	log.Infof("[SecretServiceV2] re-encrypted %d secrets with key %s", n, currentKeyId)
+	return n, nil
+}
+
+// GetTaskSecrets returns decrypted secrets available to tasks of a spider
+func (svc *ServiceV2) GetTaskSecrets(spider *models.SpiderV2) (vars []entity.TaskEnvVariable, err error) {
+	secrets, err := service.NewModelServiceV2[models.SecretV2]().GetMany(bson.M{
+		"$or": []bson.M{
+			{"spider_id": spider.Id},
+			{"project_id": spider.ProjectId, "spider_id": primitive.NilObjectID},
+			{"project_id": primitive.NilObjectID, "spider_id": primitive.NilObjectID},
+		},
+	}, nil)
+	if err != nil && !errors2.Is(err, mongo.ErrNoDocuments) {
+		return nil, trace.TraceError(err)
+	}
+	for _, s := range ResolveSecrets(secrets, spider) {
+		value, err := svc.Decrypt(&s)
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, entity.TaskEnvVariable{
+			Key:    s.Key,
+			Value:  value,
+			Source: constants.EnvSourceSecret,
+			Secret: true,
+		})
+	}
+	return vars, nil
+}
+
+// ResolveSecrets returns secrets available to tasks of a spider, i.e.
+// global secrets and secrets of its project or itself, of distinct keys. A
+// spider secret overrides a project secret, which overrides a global secret.
+func ResolveSecrets(secrets []models.SecretV2, spider *models.SpiderV2) (res []models.SecretV2) {
+	indexes := map[string]int{}
+	for _, s := range secrets {
+		if !isSpiderSecret(&s, spider) {
+			continue
+		}
+		i, ok := indexes[s.Key]
+		if !ok {
+			indexes[s.Key] = len(res)
+			res = append(res, s)
+			continue
+		}
+		if getScopeLevel(&s) > getScopeLevel(&res[i]) {
+			res[i] = s
+		}
+	}
+	return res
+}
+
+func isSpiderSecret(s *models.SecretV2, spider *models.SpiderV2) bool {
+	switch {
+	case !s.SpiderId.IsZero():
+		return s.SpiderId == spider.Id
+	case !s.ProjectId.IsZero():
+		return s.ProjectId == spider.ProjectId
+	default:
+		return true
+	}
+}
+
+func getScopeLevel(s *models.SecretV2) int {
+	switch {
+	case !s.SpiderId.IsZero():
+		return 2
+	case !s.ProjectId.IsZero():
+		return 1
+	default:
+		return 0
+	}
+}
+
+// GetKeys returns encryption keys, of which the first is the current key
+// and the others are previous keys
+func GetKeys() (keys []string) {
+	for _, key := range viper.GetStringSlice("secret.keys") {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		keys = []string{utils.GetSecretKey()}
+	}
+	return keys
+}
+
+// GetKeyId returns the id of an encryption key, which is a short hash of it
+func GetKeyId(key string) string {
+	return utils.EncryptSha256(key)[:8]
+}
+
+func getKey(keyId string) (key string, ok bool) {
+	// secrets without key id were encrypted with the default server key
+	if keyId == "" {
+		keyId = GetKeyId(utils.GetSecretKey())
+	}
+	for _, key := range append(GetKeys(), utils.GetSecretKey()) {
+		if GetKeyId(key) == keyId {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func NewSecretServiceV2() (svc *ServiceV2) {
+	return &ServiceV2{}
+}
+
+var secretSvcV2 *ServiceV2
+
+func GetSecretServiceV2() (svc *ServiceV2) {
+	if secretSvcV2 != nil {
+		return secretSvcV2
+	}
+	secretSvcV2 = NewSecretServiceV2()
+	return secretSvcV2
+}
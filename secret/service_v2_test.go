@@ -0,0 +1,80 @@
+package secret
+
+import (
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestServiceV2_EncryptDecrypt(t *testing.T) {
+	defer viper.Set("secret.keys", nil)
+	svc := NewSecretServiceV2()
+	oldKey := "0123456789abcdef0123456789abcdef"
+	newKey := "fedcba9876543210"
+
+	// default key
+	s := &models.SecretV2{}
+	var err error
+	s.Value, s.KeyId, err = svc.Encrypt("p@ssw0rd")
+	require.Nil(t, err)
+	value, err := svc.Decrypt(s)
+	require.Nil(t, err)
+	require.Equal(t, "p@ssw0rd", value)
+
+	// encrypted with old key
+	viper.Set("secret.keys", []string{oldKey})
+	s.Value, s.KeyId, err = svc.Encrypt("p@ssw0rd")
+	require.Nil(t, err)
+	require.Equal(t, GetKeyId(oldKey), s.KeyId)
+
+	// decrypted with previous key after rotation
+	viper.Set("secret.keys", []string{newKey, oldKey})
+	value, err = svc.Decrypt(s)
+	require.Nil(t, err)
+	require.Equal(t, "p@ssw0rd", value)
+
+	// unknown key after previous key removed
+	viper.Set("secret.keys", []string{newKey})
+	_, err = svc.Decrypt(s)
+	require.NotNil(t, err)
+}
+
+func TestResolveSecrets(t *testing.T) {
+	projectId := primitive.NewObjectID()
+	spider := &models.SpiderV2{ProjectId: projectId}
+	spider.SetId(primitive.NewObjectID())
+	otherId := primitive.NewObjectID()
+
+	secrets := []models.SecretV2{
+		{Key: "A", Value: "spider", SpiderId: spider.Id, ProjectId: projectId},
+		{Key: "A", Value: "global"},
+		{Key: "A", Value: "project", ProjectId: projectId},
+		{Key: "B", Value: "global"},
+		{Key: "B", Value: "project", ProjectId: projectId},
+		{Key: "C", Value: "other project", ProjectId: otherId},
+		{Key: "D", Value: "other spider", SpiderId: otherId},
+		{Key: "E", Value: "global"},
+	}
+	res := ResolveSecrets(secrets, spider)
+	values := map[string]string{}
+	for _, s := range res {
+		values[s.Key] = s.Value
+	}
+	require.Equal(t, map[string]string{
+		"A": "spider",
+		"B": "project",
+		"E": "global",
+	}, values)
+}
+
+func TestMasker_Mask(t *testing.T) {
+	m := NewMasker([]string{"abc", "s3cr3t", "s3cr3t-long", "-----BEGIN KEY-----\nMIIEvQIBADANBg\n-----END KEY-----"})
+	require.Equal(t, "token=****** abc", m.Mask("token=s3cr3t abc"))
+	require.Equal(t, "token=******", m.Mask("token=s3cr3t-long"))
+	require.Equal(t, "key ******", m.Mask("key MIIEvQIBADANBg"))
+	require.Equal(t, "no secrets", NewMasker(nil).Mask("no secrets"))
+	var nilMasker *Masker
+	require.Equal(t, "no secrets", nilMasker.Mask("no secrets"))
+}
@@ -2,14 +2,20 @@ package admin
 
 import (
 	"context"
+	errors2 "errors"
+	"fmt"
 	"github.com/apex/log"
 	config2 "github.com/crawlab-team/crawlab-core/config"
 	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
 	"github.com/crawlab-team/crawlab-core/errors"
 	"github.com/crawlab-team/crawlab-core/interfaces"
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/models/service"
 	"github.com/crawlab-team/crawlab-core/node/config"
+	"github.com/crawlab-team/crawlab-core/node/leader"
+	"github.com/crawlab-team/crawlab-core/node/selector"
+	"github.com/crawlab-team/crawlab-core/spider/param"
 	"github.com/crawlab-team/crawlab-core/task/scheduler"
 	"github.com/crawlab-team/crawlab-core/utils"
 	vcs "github.com/crawlab-team/crawlab-vcs"
@@ -19,9 +25,11 @@ import (
 	"github.com/spf13/viper"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -38,6 +46,9 @@ type ServiceV2 struct {
 }
 
 func (svc *ServiceV2) Start() (err error) {
+	if err := svc.migrateGitCredentials(); err != nil {
+		trace.PrintError(err)
+	}
 	return svc.SyncGit()
 }
 
@@ -65,6 +76,173 @@ func (svc *ServiceV2) SyncGitOne(g *models.GitV2) (err error) {
 	return nil
 }
 
+func (svc *ServiceV2) PullGit(g *models.GitV2) (err error) {
+	// skip if pinned to a tag or commit
+	if g.CurrentRef != "" {
+		log.Infof("[SpiderAdminService] skip pulling git %s pinned to %s", g.Id.Hex(), g.CurrentRef)
+		return nil
+	}
+
+	// git client
+	workspacePath := viper.GetString("workspace")
+	gitClient, err := utils.NewGitClientV2(vcs.WithPath(filepath.Join(workspacePath, g.Id.Hex())))
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// set auth
+	if err := svc.InitGitClientAuth(g, gitClient); err != nil {
+		return err
+	}
+
+	// reset and pull
+	if err := gitClient.Reset(); err != nil {
+		return trace.TraceError(err)
+	}
+	opts := []vcs.GitPullOption{
+		vcs.WithRemoteNamePull(vcs.GitRemoteNameOrigin),
+	}
+	if g.CurrentBranch != "" {
+		opts = append(opts, vcs.WithBranchNamePull(g.CurrentBranch))
+	}
+	if err := gitClient.Pull(opts...); err != nil {
+		return trace.TraceError(err)
+	}
+
+	return nil
+}
+
+// InitGitClientAuth sets auth of git client with the credential referenced
+// by git, if any.
+func (svc *ServiceV2) InitGitClientAuth(g *models.GitV2, gitClient *utils.GitClientV2) (err error) {
+	var cred *models.GitCredentialV2
+	if !g.CredentialId.IsZero() {
+		cred, err = service.NewModelServiceV2[models.GitCredentialV2]().GetById(g.CredentialId)
+		if err != nil {
+			return trace.TraceError(err)
+		}
+		// deploy keys can only be used by the git they were generated for
+		if !cred.GitId.IsZero() && cred.GitId != g.Id {
+			return trace.TraceError(errors.ErrorGitCredentialScopeMismatch)
+		}
+	}
+	return utils.InitGitClientAuthV2(g, cred, gitClient)
+}
+
+// migrateGitCredentials moves passwords and private keys stored in plain
+// text on gits into encrypted credentials.
+func (svc *ServiceV2) migrateGitCredentials() (err error) {
+	gits, err := service.NewModelServiceV2[models.GitV2]().GetMany(bson.M{
+		"password":      bson.M{"$nin": []any{nil, ""}},
+		"credential_id": bson.M{"$exists": false},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	for _, g := range gits {
+		cred := models.GitCredentialV2{
+			Name:     g.Url,
+			Type:     g.AuthType,
+			Username: g.Username,
+		}
+		switch g.AuthType {
+		case constants.GitAuthTypeSsh:
+			cred.PublicKey, cred.Fingerprint, _ = utils.GetSshPublicKey(g.Password)
+			cred.PrivateKey, err = utils.EncryptAES(g.Password)
+		default:
+			cred.Type = constants.GitAuthTypeHttp
+			cred.Password, err = utils.EncryptAES(g.Password)
+		}
+		if err != nil {
+			return err
+		}
+		cred.SetCreated(primitive.NilObjectID)
+		cred.SetUpdated(primitive.NilObjectID)
+		id, err := service.NewModelServiceV2[models.GitCredentialV2]().InsertOne(cred)
+		if err != nil {
+			return err
+		}
+		if err := service.NewModelServiceV2[models.GitV2]().UpdateById(g.Id, bson.M{
+			"$set":   bson.M{"credential_id": id},
+			"$unset": bson.M{"password": ""},
+		}); err != nil {
+			return err
+		}
+		log.Infof("[SpiderAdminService] migrated git %s to credential %s", g.Id.Hex(), id.Hex())
+	}
+	return nil
+}
+
+// HandleGitWebhook matches a webhook event to git repositories by url and
+// branch, verifies its signature with the secret of each repository and
+// then pulls (and optionally runs) the verified ones in the background.
+// Only deliveries verified are logged, and only the status is returned as
+// the caller is not authenticated.
+func (svc *ServiceV2) HandleGitWebhook(evt *entity.GitWebhookEvent, remoteAddr string) (status string, err error) {
+	// matched gits
+	gits, err := svc.getGitWebhookMatchedGits(evt)
+	if err != nil {
+		return "", err
+	}
+
+	// verify signature
+	var verifiedGits []models.GitV2
+	for _, g := range gits {
+		secret := g.WebhookSecret
+		if secret == "" {
+			secret = viper.GetString("git.webhook.secret")
+		}
+		if !utils.VerifyGitWebhookSignature(evt, secret) {
+			continue
+		}
+		verifiedGits = append(verifiedGits, g)
+	}
+	if len(verifiedGits) == 0 {
+		// deliveries not verified are not logged, as anyone can send them
+		if len(gits) == 0 {
+			return constants.GitWebhookStatusIgnored, nil
+		}
+		return "", errors.ErrorGitWebhookInvalidSignature
+	}
+
+	// log
+	l := &models.GitWebhookLogV2{
+		Provider:   evt.Provider,
+		Event:      evt.Event,
+		DeliveryId: evt.DeliveryId,
+		Branch:     evt.Branch,
+		Commit:     evt.Commit,
+		Status:     constants.GitWebhookStatusProcessing,
+		RemoteAddr: remoteAddr,
+	}
+	if len(evt.Urls) > 0 {
+		l.Url = evt.Urls[0]
+	}
+	for _, g := range verifiedGits {
+		l.GitIds = append(l.GitIds, g.Id)
+	}
+	l.SetId(primitive.NewObjectID())
+	l.SetCreated(primitive.NilObjectID)
+	l.SetUpdated(primitive.NilObjectID)
+
+	// skip events other than branch push (e.g. ping, tag push)
+	if !utils.IsGitWebhookPushEvent(evt) {
+		l.Status = constants.GitWebhookStatusIgnored
+		return l.Status, svc.saveGitWebhookLog(l)
+	}
+
+	// save log
+	if err := svc.saveGitWebhookLog(l); err != nil {
+		return "", err
+	}
+
+	// pull and run in the background so that the provider is not kept
+	// waiting
+	go svc.processGitWebhook(l, verifiedGits)
+
+	return l.Status, nil
+}
+
 func (svc *ServiceV2) Export(id primitive.ObjectID) (filePath string, err error) {
 	// spider fs
 	workspacePath := viper.GetString("workspace")
@@ -81,17 +259,35 @@ func (svc *ServiceV2) Export(id primitive.ObjectID) (filePath string, err error)
 }
 
 func (svc *ServiceV2) scheduleTasks(s *models.SpiderV2, opts *interfaces.SpiderRunOptions) (taskIds []primitive.ObjectID, err error) {
+	// typed parameters
+	params, err := param.Validate(s.ParamSchema, opts.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	// node selector
+	if opts.NodeSelector == "" {
+		opts.NodeSelector = s.NodeSelector
+	}
+	if err := selector.Validate(opts.NodeSelector); err != nil {
+		return nil, err
+	}
+
 	// main task
 	mainTask := &models.TaskV2{
-		SpiderId:   s.Id,
-		Mode:       opts.Mode,
-		NodeIds:    opts.NodeIds,
-		Cmd:        opts.Cmd,
-		Param:      opts.Param,
-		ScheduleId: opts.ScheduleId,
-		Priority:   opts.Priority,
-		UserId:     opts.UserId,
-		CreateTs:   time.Now(),
+		SpiderId:     s.Id,
+		Mode:         opts.Mode,
+		NodeIds:      opts.NodeIds,
+		NodeSelector: opts.NodeSelector,
+		Cmd:          opts.Cmd,
+		Param:        opts.Param,
+		ScheduleId:   opts.ScheduleId,
+		Priority:     opts.Priority,
+		Envs:         opts.Envs,
+		Params:       params,
+		UserId:       opts.UserId,
+		CreateTs:     time.Now(),
+		GitCommit:    svc.getGitCommit(s.Id),
 	}
 	mainTask.SetId(primitive.NewObjectID())
 
@@ -120,15 +316,19 @@ func (svc *ServiceV2) scheduleTasks(s *models.SpiderV2, opts *interfaces.SpiderR
 		}
 		for _, nodeId := range nodeIds {
 			t := &models.TaskV2{
-				SpiderId:   s.Id,
-				Mode:       opts.Mode,
-				Cmd:        opts.Cmd,
-				Param:      opts.Param,
-				NodeId:     nodeId,
-				ScheduleId: opts.ScheduleId,
-				Priority:   opts.Priority,
-				UserId:     opts.UserId,
-				CreateTs:   time.Now(),
+				SpiderId:     s.Id,
+				Mode:         opts.Mode,
+				NodeSelector: opts.NodeSelector,
+				Cmd:          opts.Cmd,
+				Param:        opts.Param,
+				NodeId:       nodeId,
+				ScheduleId:   opts.ScheduleId,
+				Priority:     opts.Priority,
+				Envs:         opts.Envs,
+				Params:       params,
+				UserId:       opts.UserId,
+				CreateTs:     time.Now(),
+				GitCommit:    mainTask.GitCommit,
 			}
 			t.SetId(primitive.NewObjectID())
 			t2, err := svc.schedulerSvc.Enqueue(t, opts.UserId)
@@ -172,10 +372,46 @@ func (svc *ServiceV2) getNodeIds(opts *interfaces.SpiderRunOptions) (nodeIds []p
 		}
 	} else if opts.Mode == constants.RunTypeSelectedNodes {
 		nodeIds = opts.NodeIds
+	} else if opts.Mode == constants.RunTypeMatchedNodes {
+		nodes, err := svc.getMatchedNodes(opts.NodeSelector)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			nodeIds = append(nodeIds, node.Id)
+		}
 	}
 	return nodeIds, nil
 }
 
+// getMatchedNodes returns online nodes matching a node selector
+func (svc *ServiceV2) getMatchedNodes(expr string) (nodes []models.NodeV2, err error) {
+	sel, err := selector.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	query := bson.M{
+		"active":  true,
+		"enabled": true,
+		"status":  constants.NodeStatusOnline,
+	}
+	allNodes, err := service.NewModelServiceV2[models.NodeV2]().GetMany(query, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range allNodes {
+		if sel.Matches(node.Labels) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+func (svc *ServiceV2) getGitCommit(id primitive.ObjectID) (hash string) {
+	workspacePath := viper.GetString("workspace")
+	return utils.GetGitHeadCommit(filepath.Join(workspacePath, id.Hex()))
+}
+
 func (svc *ServiceV2) isMultiTask(opts *interfaces.SpiderRunOptions) (res bool) {
 	if opts.Mode == constants.RunTypeAllNodes {
 		query := bson.M{
@@ -193,12 +429,23 @@ func (svc *ServiceV2) isMultiTask(opts *interfaces.SpiderRunOptions) (res bool)
 		return false
 	} else if opts.Mode == constants.RunTypeSelectedNodes {
 		return len(opts.NodeIds) > 1
+	} else if opts.Mode == constants.RunTypeMatchedNodes {
+		nodes, err := svc.getMatchedNodes(opts.NodeSelector)
+		if err != nil {
+			trace.PrintError(err)
+			return false
+		}
+		return len(nodes) > 1
 	} else {
 		return false
 	}
 }
 
 func (svc *ServiceV2) syncGit() {
+	// only sync on the leader
+	if !leader.IsLeader() {
+		return
+	}
 	if svc.syncLock {
 		log.Infof("[SpiderAdminService] sync git is locked, skip")
 		return
@@ -230,6 +477,10 @@ func (svc *ServiceV2) syncGit() {
 				"$in": spiderIds,
 			},
 			"auto_pull": true,
+			// repositories with webhook enabled are pulled on deliveries
+			"webhook_enabled": bson.M{"$ne": true},
+			// repositories pinned to a tag or commit are not pulled
+			"current_ref": bson.M{"$in": []any{nil, ""}},
 		}, nil)
 		if err != nil {
 			trace.PrintError(err)
@@ -258,13 +509,16 @@ func (svc *ServiceV2) syncGitOne(g *models.GitV2) {
 
 	// git client
 	workspacePath := viper.GetString("workspace")
-	gitClient, err := vcs.NewGitClient(vcs.WithPath(filepath.Join(workspacePath, g.Id.Hex())))
+	gitClient, err := utils.NewGitClientV2(vcs.WithPath(filepath.Join(workspacePath, g.Id.Hex())))
 	if err != nil {
 		return
 	}
 
 	// set auth
-	utils.InitGitClientAuthV2(g, gitClient)
+	if err := svc.InitGitClientAuth(g, gitClient); err != nil {
+		trace.PrintError(err)
+		return
+	}
 
 	// check if remote has changes
 	ok, err := gitClient.IsRemoteChanged()
@@ -291,6 +545,110 @@ func (svc *ServiceV2) syncGitOne(g *models.GitV2) {
 	<-ctx.Done()
 }
 
+func (svc *ServiceV2) getGitWebhookMatchedGits(evt *entity.GitWebhookEvent) (gits []models.GitV2, err error) {
+	// normalized urls of the event
+	urls := map[string]bool{}
+	for _, u := range evt.Urls {
+		urls[utils.NormalizeGitUrl(u)] = true
+	}
+
+	// gits with webhook enabled
+	allGits, err := service.NewModelServiceV2[models.GitV2]().GetMany(bson.M{
+		"webhook_enabled": true,
+	}, nil)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// filter by url and branch
+	for _, g := range allGits {
+		if !urls[utils.NormalizeGitUrl(g.Url)] {
+			continue
+		}
+		if g.CurrentBranch != "" && g.CurrentBranch != evt.Branch {
+			continue
+		}
+		gits = append(gits, g)
+	}
+
+	return gits, nil
+}
+
+func (svc *ServiceV2) processGitWebhook(l *models.GitWebhookLogV2, gits []models.GitV2) {
+	var errs []string
+	for _, g := range gits {
+		// pull
+		if err := svc.PullGit(&g); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", g.Id.Hex(), err))
+			continue
+		}
+		log.Infof("[SpiderAdminService] pulled git %s on webhook delivery %s", g.Id.Hex(), l.Id.Hex())
+
+		// run
+		if !g.WebhookAutoRun {
+			continue
+		}
+		taskIds, err := svc.scheduleGitWebhookRun(&g)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", g.Id.Hex(), err))
+			continue
+		}
+		l.TaskIds = append(l.TaskIds, taskIds...)
+	}
+
+	// update log
+	if len(errs) > 0 {
+		l.Status = constants.GitWebhookStatusError
+		l.Error = strings.Join(errs, "; ")
+	} else {
+		l.Status = constants.GitWebhookStatusSuccess
+	}
+	if err := svc.saveGitWebhookLog(l); err != nil {
+		trace.PrintError(err)
+	}
+}
+
+// scheduleGitWebhookRun runs the spider of a git, as the creator of the git
+// or otherwise the spider
+func (svc *ServiceV2) scheduleGitWebhookRun(g *models.GitV2) (taskIds []primitive.ObjectID, err error) {
+	// spider (which shares the same id with git)
+	s, err := service.NewModelServiceV2[models.SpiderV2]().GetById(g.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// options
+	opts := &interfaces.SpiderRunOptions{
+		Mode:     s.Mode,
+		NodeIds:  s.NodeIds,
+		Cmd:      s.Cmd,
+		Param:    s.Param,
+		Priority: s.Priority,
+		UserId:   g.GetCreatedBy(),
+	}
+	if opts.UserId.IsZero() {
+		opts.UserId = s.GetCreatedBy()
+	}
+	if opts.Priority == 0 {
+		opts.Priority = 5
+	}
+
+	return svc.scheduleTasks(s, opts)
+}
+
+func (svc *ServiceV2) saveGitWebhookLog(l *models.GitWebhookLogV2) (err error) {
+	modelSvc := service.NewModelServiceV2[models.GitWebhookLogV2]()
+	l.SetUpdated(primitive.NilObjectID)
+	if _, err := modelSvc.GetById(l.Id); err != nil {
+		if !errors2.Is(err, mongo.ErrNoDocuments) {
+			return trace.TraceError(err)
+		}
+		_, err = modelSvc.InsertOne(*l)
+		return err
+	}
+	return modelSvc.ReplaceById(l.Id, *l)
+}
+
 func NewSpiderAdminServiceV2() (svc2 *ServiceV2, err error) {
 	svc := &ServiceV2{
 		nodeCfgSvc: config.GetNodeConfigService(),
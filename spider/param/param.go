@@ -0,0 +1,256 @@
+package param
+
+import (
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Typed parameters of tasks are declared in the param schema of a spider
+// (models.SpiderParam). Values of run options and schedules are validated
+// against the schema and normalized to strings, which are passed to the
+// command as CRAWLAB_PARAM_<NAME> environment variables and as quoted
+// arguments of params with flags.
+
+var nameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateSchema returns error if a param schema is invalid
+func ValidateSchema(schema []models.SpiderParam) (err error) {
+	names := map[string]bool{}
+	for _, p := range schema {
+		if !nameRegexp.MatchString(p.Name) {
+			return fmt.Errorf("%w: invalid name \"%s\"", errors.ErrorSpiderInvalidParamSchema, p.Name)
+		}
+		if names[strings.ToUpper(p.Name)] {
+			return fmt.Errorf("%w: duplicate name \"%s\"", errors.ErrorSpiderInvalidParamSchema, p.Name)
+		}
+		names[strings.ToUpper(p.Name)] = true
+		if p.Flag != "" && !isOptionFlag(p.Flag) {
+			return fmt.Errorf("%w: invalid flag \"%s\" of %s", errors.ErrorSpiderInvalidParamSchema, p.Flag, p.Name)
+		}
+		switch p.Type {
+		case constants.SpiderParamTypeString, constants.SpiderParamTypeInteger, constants.SpiderParamTypeNumber, constants.SpiderParamTypeBoolean:
+		default:
+			return fmt.Errorf("%w: invalid type \"%s\" of %s", errors.ErrorSpiderInvalidParamSchema, p.Type, p.Name)
+		}
+		for _, v := range p.Enum {
+			if _, err := normalize(&p, v); err != nil {
+				return fmt.Errorf("%w: invalid enum value of %s", errors.ErrorSpiderInvalidParamSchema, p.Name)
+			}
+		}
+		if p.Default != nil {
+			if _, err := validateValue(&p, p.Default); err != nil {
+				return fmt.Errorf("%w: invalid default of %s", errors.ErrorSpiderInvalidParamSchema, p.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate validates values against a param schema, and returns values
+// normalized to strings with defaults of missing params. Unknown params are
+// rejected so that typos are found before running.
+func Validate(schema []models.SpiderParam, values map[string]any) (res map[string]string, err error) {
+	params := map[string]*models.SpiderParam{}
+	for i := range schema {
+		params[schema[i].Name] = &schema[i]
+	}
+	for name := range values {
+		if _, ok := params[name]; !ok {
+			return nil, fmt.Errorf("%w: unknown param \"%s\"", errors.ErrorSpiderInvalidParam, name)
+		}
+	}
+
+	res = map[string]string{}
+	for i := range schema {
+		p := &schema[i]
+		v, ok := values[p.Name]
+		if !ok || v == nil {
+			v = p.Default
+		}
+		if v == nil {
+			if p.Required {
+				return nil, fmt.Errorf("%w: %s is required", errors.ErrorSpiderInvalidParam, p.Name)
+			}
+			continue
+		}
+		s, err := validateValue(p, v)
+		if err != nil {
+			return nil, err
+		}
+		res[p.Name] = s
+	}
+	return res, nil
+}
+
+// GetArgs returns arguments of params with flags, in the order of the
+// schema
+func GetArgs(schema []models.SpiderParam, values map[string]string) (args []string) {
+	for _, p := range schema {
+		v, ok := values[p.Name]
+		if !ok {
+			continue
+		}
+		flag := strings.Fields(p.Flag)
+		if len(flag) == 0 {
+			continue
+		}
+		last := flag[len(flag)-1]
+		if strings.HasSuffix(last, "=") {
+			args = append(args, flag[:len(flag)-1]...)
+			args = append(args, last+v)
+			continue
+		}
+		if p.Type == constants.SpiderParamTypeBoolean {
+			if v == "true" {
+				args = append(args, flag...)
+			}
+			continue
+		}
+		args = append(args, flag...)
+		args = append(args, v)
+	}
+	return args
+}
+
+// isOptionFlag returns true if all fields of a flag are options, e.g.
+// "--pages=" or "-n", so that values cannot be passed as commands
+func isOptionFlag(flag string) bool {
+	fields := strings.Fields(flag)
+	if len(fields) == 0 {
+		return false
+	}
+	for _, f := range fields {
+		if !strings.HasPrefix(f, "-") || strings.Trim(f, "-=") == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// GetEnvs returns environment variables of params in the form of
+// "CRAWLAB_PARAM_<NAME>=value", sorted by name
+func GetEnvs(values map[string]string) (envs []string) {
+	for name, v := range values {
+		envs = append(envs, constants.SpiderParamEnvPrefix+strings.ToUpper(name)+"="+v)
+	}
+	sort.Strings(envs)
+	return envs
+}
+
+// ToValues converts normalized values of a task back to values to validate,
+// e.g. when a task is restarted
+func ToValues(params map[string]string) (values map[string]any) {
+	if params == nil {
+		return nil
+	}
+	values = map[string]any{}
+	for name, v := range params {
+		values[name] = v
+	}
+	return values
+}
+
+func validateValue(p *models.SpiderParam, v any) (s string, err error) {
+	s, err = normalize(p, v)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s must be of type %s", errors.ErrorSpiderInvalidParam, p.Name, p.Type)
+	}
+	if len(p.Enum) == 0 {
+		return s, nil
+	}
+	var allowed []string
+	for _, e := range p.Enum {
+		es, _ := normalize(p, e)
+		if es == s {
+			return s, nil
+		}
+		allowed = append(allowed, es)
+	}
+	return "", fmt.Errorf("%w: %s must be one of %s", errors.ErrorSpiderInvalidParam, p.Name, strings.Join(allowed, ", "))
+}
+
+// normalize converts a value decoded from JSON or BSON to a string of the
+// type of the param
+func normalize(p *models.SpiderParam, v any) (s string, err error) {
+	switch p.Type {
+	case constants.SpiderParamTypeString:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+		f, err := toFloat(v)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case constants.SpiderParamTypeInteger:
+		if v, ok := v.(string); ok {
+			if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return strconv.FormatInt(i, 10), nil
+			}
+		}
+		if v, ok := v.(int64); ok {
+			return strconv.FormatInt(v, 10), nil
+		}
+		f, err := toFloat(v)
+		if err != nil {
+			return "", err
+		}
+		if f != math.Trunc(f) {
+			return "", fmt.Errorf("not an integer: %v", v)
+		}
+		return strconv.FormatInt(int64(f), 10), nil
+	case constants.SpiderParamTypeNumber:
+		f, err := toFloat(v)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case constants.SpiderParamTypeBoolean:
+		switch v := v.(type) {
+		case bool:
+			return strconv.FormatBool(v), nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return "", err
+			}
+			return strconv.FormatBool(b), nil
+		}
+		return "", fmt.Errorf("not a boolean: %v", v)
+	default:
+		return "", fmt.Errorf("invalid type: %s", p.Type)
+	}
+}
+
+func toFloat(v any) (f float64, err error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return 0, fmt.Errorf("not a number: %s", v)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("not a number: %v", v)
+	}
+}
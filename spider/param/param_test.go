@@ -0,0 +1,90 @@
+package param
+
+import (
+	"errors"
+	"github.com/crawlab-team/crawlab-core/constants"
+	errors2 "github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var testSchema = []models.SpiderParam{
+	{Name: "keyword", Type: constants.SpiderParamTypeString, Required: true, Flag: "--keyword"},
+	{Name: "pages", Type: constants.SpiderParamTypeInteger, Default: float64(10), Flag: "--pages="},
+	{Name: "delay", Type: constants.SpiderParamTypeNumber},
+	{Name: "headless", Type: constants.SpiderParamTypeBoolean, Flag: "--headless"},
+	{Name: "site", Type: constants.SpiderParamTypeString, Enum: []any{"a", "b"}},
+}
+
+func TestValidateSchema(t *testing.T) {
+	require.Nil(t, ValidateSchema(testSchema))
+
+	for _, schema := range [][]models.SpiderParam{
+		{{Name: "1st", Type: constants.SpiderParamTypeString}},
+		{{Name: "a", Type: "date"}},
+		{{Name: "a", Type: constants.SpiderParamTypeString}, {Name: "A", Type: constants.SpiderParamTypeString}},
+		{{Name: "a", Type: constants.SpiderParamTypeInteger, Default: 1.5}},
+		{{Name: "a", Type: constants.SpiderParamTypeInteger, Enum: []any{1, "x"}}},
+		{{Name: "a", Type: constants.SpiderParamTypeString, Enum: []any{"x"}, Default: "y"}},
+		{{Name: "a", Type: constants.SpiderParamTypeString, Flag: " "}},
+		{{Name: "a", Type: constants.SpiderParamTypeString, Flag: "keyword"}},
+		{{Name: "a", Type: constants.SpiderParamTypeString, Flag: "--"}},
+	} {
+		err := ValidateSchema(schema)
+		require.True(t, errors.Is(err, errors2.ErrorSpiderInvalidParamSchema), schema)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	res, err := Validate(testSchema, map[string]any{
+		"keyword":  "go",
+		"delay":    "0.5",
+		"headless": true,
+		"site":     "b",
+	})
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{
+		"keyword":  "go",
+		"pages":    "10",
+		"delay":    "0.5",
+		"headless": "true",
+		"site":     "b",
+	}, res)
+
+	// values of restarted tasks
+	res2, err := Validate(testSchema, ToValues(res))
+	require.Nil(t, err)
+	require.Equal(t, res, res2)
+
+	for _, values := range []map[string]any{
+		{},
+		{"keyword": "go", "unknown": 1},
+		{"keyword": "go", "pages": 1.5},
+		{"keyword": "go", "pages": "ten"},
+		{"keyword": "go", "delay": true},
+		{"keyword": "go", "headless": "maybe"},
+		{"keyword": "go", "site": "c"},
+	} {
+		_, err := Validate(testSchema, values)
+		require.True(t, errors.Is(err, errors2.ErrorSpiderInvalidParam), values)
+	}
+}
+
+func TestGetArgs(t *testing.T) {
+	args := GetArgs(testSchema, map[string]string{
+		"keyword":  "hello world",
+		"pages":    "3",
+		"delay":    "1",
+		"headless": "false",
+	})
+	require.Equal(t, []string{"--keyword", "hello world", "--pages=3"}, args)
+
+	args = GetArgs(testSchema, map[string]string{"headless": "true"})
+	require.Equal(t, []string{"--headless"}, args)
+}
+
+func TestGetEnvs(t *testing.T) {
+	envs := GetEnvs(map[string]string{"pages": "3", "keyword": "go"})
+	require.Equal(t, []string{"CRAWLAB_PARAM_KEYWORD=go", "CRAWLAB_PARAM_PAGES=3"}, envs)
+}
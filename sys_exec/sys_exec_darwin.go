@@ -5,6 +5,7 @@ package sys_exec
 
 import (
 	"os/exec"
+	"strings"
 	"syscall"
 )
 
@@ -22,3 +23,18 @@ func SetPgid(cmd *exec.Cmd) {
 		cmd.SysProcAttr.Setpgid = true
 	}
 }
+
+// QuoteArg quotes an argument to be passed to the shell of BuildCmd as is
+func QuoteArg(arg string) string {
+	safe := arg != ""
+	for _, r := range arg {
+		if !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+.,:/@%", r) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
@@ -3,8 +3,23 @@
 
 package sys_exec
 
-import "os/exec"
+import (
+	"os/exec"
+	"strings"
+)
 
 func BuildCmd(cmdStr string) *exec.Cmd {
 	return exec.Command("cmd", "/C", cmdStr)
 }
+
+// QuoteArg quotes an argument to be passed to the shell of BuildCmd as is.
+// "%" is expanded by cmd even in quotes, so it is escaped by "^" out of
+// quotes, which also prevents it from forming a variable reference.
+func QuoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"&|<>^%()") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `"`, `""`)
+	arg = strings.ReplaceAll(arg, "%", `"^%"`)
+	return `"` + arg + `"`
+}
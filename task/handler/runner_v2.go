@@ -10,12 +10,15 @@ import (
 	"github.com/crawlab-team/crawlab-core/constants"
 	"github.com/crawlab-team/crawlab-core/container"
 	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/environment"
 	"github.com/crawlab-team/crawlab-core/errors"
 	fs2 "github.com/crawlab-team/crawlab-core/fs"
 	"github.com/crawlab-team/crawlab-core/interfaces"
 	"github.com/crawlab-team/crawlab-core/models/client"
 	"github.com/crawlab-team/crawlab-core/models/models"
 	service2 "github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/secret"
+	"github.com/crawlab-team/crawlab-core/spider/param"
 	"github.com/crawlab-team/crawlab-core/sys_exec"
 	"github.com/crawlab-team/crawlab-core/utils"
 	grpc "github.com/crawlab-team/crawlab-grpc"
@@ -30,11 +33,58 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
 )
 
+var dependencyInstallLocks = sync.Map{}
+
+// dependencyEnvRefs counts running tasks using each dependency environment.
+// Outdated environments are only removed once no task uses them.
+var dependencyEnvRefs = struct {
+	sync.Mutex
+	refs     map[string]int
+	outdated map[string]bool
+}{
+	refs:     map[string]int{},
+	outdated: map[string]bool{},
+}
+
+func acquireDependencyEnv(envPath string) {
+	dependencyEnvRefs.Lock()
+	defer dependencyEnvRefs.Unlock()
+	dependencyEnvRefs.refs[envPath]++
+	delete(dependencyEnvRefs.outdated, envPath)
+}
+
+func releaseDependencyEnv(envPath string) {
+	dependencyEnvRefs.Lock()
+	defer dependencyEnvRefs.Unlock()
+	dependencyEnvRefs.refs[envPath]--
+	if dependencyEnvRefs.refs[envPath] > 0 {
+		return
+	}
+	delete(dependencyEnvRefs.refs, envPath)
+	if dependencyEnvRefs.outdated[envPath] {
+		delete(dependencyEnvRefs.outdated, envPath)
+		_ = os.RemoveAll(envPath)
+	}
+}
+
+// removeOutdatedDependencyEnv removes an outdated environment, or defers it
+// until tasks using it are finished
+func removeOutdatedDependencyEnv(envPath string) {
+	dependencyEnvRefs.Lock()
+	defer dependencyEnvRefs.Unlock()
+	if dependencyEnvRefs.refs[envPath] > 0 {
+		dependencyEnvRefs.outdated[envPath] = true
+		return
+	}
+	_ = os.RemoveAll(envPath)
+}
+
 type RunnerV2 struct {
 	// dependencies
 	svc   *ServiceV2             // task handler service
@@ -45,22 +95,32 @@ type RunnerV2 struct {
 	bufferSize       int
 
 	// internals
-	cmd  *exec.Cmd                        // process command instance
-	pid  int                              // process id
-	tid  primitive.ObjectID               // task id
-	t    *models.TaskV2                   // task model.Task
-	s    *models.SpiderV2                 // spider model.Spider
-	ch   chan constants.TaskSignal        // channel to communicate between Service and RunnerV2
-	err  error                            // standard process error
-	envs []models.Env                     // environment variables
-	cwd  string                           // working directory
-	c    interfaces.GrpcClient            // grpc client
-	sub  grpc.TaskService_SubscribeClient // grpc task service stream client
+	ctx    context.Context                  // cancelled when the task is cancelled
+	cancel context.CancelFunc               // cancels ctx
+	mu     sync.Mutex                       // guards starting and killing cmd
+	cmd    *exec.Cmd                        // process command instance
+	pid    int                              // process id
+	tid    primitive.ObjectID               // task id
+	t      *models.TaskV2                   // task model.Task
+	s      *models.SpiderV2                 // spider model.Spider
+	ch     chan constants.TaskSignal        // channel to communicate between Service and RunnerV2
+	err    error                            // standard process error
+	envs   []models.Env                     // environment variables
+	cwd    string                           // working directory
+	c      interfaces.GrpcClient            // grpc client
+	sub    grpc.TaskService_SubscribeClient // grpc task service stream client
+
+	// dependency internals
+	depPaths    []string // executable paths of installed dependency environments
+	depEnvs     []string // environment variables of installed dependency environments
+	depEnvPaths []string // dependency environments used by the task
 
 	// log internals
 	scannerStdout *bufio.Reader
 	scannerStderr *bufio.Reader
 	logBatchSize  int
+	masker        *secret.Masker           // masks values of secrets in logs
+	secrets       []entity.TaskEnvVariable // decrypted secrets passed by master
 }
 
 func (r *RunnerV2) Init() (err error) {
@@ -97,19 +157,48 @@ func (r *RunnerV2) Run() (err error) {
 	// log task started
 	log.Infof("task[%s] started", r.tid.Hex())
 
+	// release dependency environments after the task ends
+	defer r.releaseDependencyEnvs()
+
+	// install dependencies
+	if r.s.AutoInstall {
+		// update task status (installing dependencies)
+		if err := r.updateTask(constants.TaskStatusRunning, nil); err != nil {
+			return err
+		}
+		if err := r.installDependencies(); err != nil {
+			if r.ctx.Err() != nil {
+				return r.updateTask(constants.TaskStatusCancelled, constants.ErrTaskCancelled)
+			}
+			return r.updateTask(constants.TaskStatusError, err)
+		}
+	}
+
 	// configure cmd
 	r.configureCmd()
 
 	// configure environment variables
 	r.configureEnv()
 
+	// configure environment variables of scopes and secrets
+	if err := r.configureVariables(); err != nil {
+		return r.updateTask(constants.TaskStatusError, err)
+	}
+
 	// configure logging
 	r.configureLogging()
 
-	// start process
+	// start process unless cancelled
+	r.mu.Lock()
+	if r.ctx.Err() != nil {
+		r.mu.Unlock()
+		return r.updateTask(constants.TaskStatusCancelled, constants.ErrTaskCancelled)
+	}
 	if err := r.cmd.Start(); err != nil {
+		r.mu.Unlock()
 		return r.updateTask(constants.TaskStatusError, err)
 	}
+	r.mu.Unlock()
 
 	// start logging
 	go r.startLogging()
@@ -164,6 +253,17 @@ func (r *RunnerV2) Run() (err error) {
 }
 
 func (r *RunnerV2) Cancel() (err error) {
+	// stop installing dependencies, or starting the process
+	r.cancel()
+
+	// skip if the process is not started
+	r.mu.Lock()
+	started := r.cmd != nil && r.cmd.Process != nil
+	r.mu.Unlock()
+	if !started {
+		return nil
+	}
+
 	// kill process
 	opts := &sys_exec.KillProcessOptions{
 		Timeout: r.svc.GetCancelTimeout(),
@@ -220,6 +320,11 @@ func (r *RunnerV2) configureCmd() {
 		cmdStr += " " + r.s.Param
 	}
 
+	// typed parameters with flags
+	for _, arg := range param.GetArgs(r.s.ParamSchema, r.t.Params) {
+		cmdStr += " " + sys_exec.QuoteArg(arg)
+	}
+
 	// get cmd instance
 	r.cmd = sys_exec.BuildCmd(cmdStr)
 
@@ -305,15 +410,178 @@ func (r *RunnerV2) configureEnv() {
 		r.cmd.Env = append(r.cmd.Env, "CRAWLAB_GRPC_AUTH_KEY="+constants.DefaultGrpcAuthKey)
 	}
 
-	// global environment variables
-	envs, err := client.NewModelServiceV2[models.EnvironmentV2]().GetMany(nil, nil)
+	// typed parameters
+	r.cmd.Env = append(r.cmd.Env, param.GetEnvs(r.t.Params)...)
+
+	// dependency environments
+	if len(r.depPaths) > 0 {
+		paths := append(r.depPaths, os.Getenv("PATH"))
+		r.cmd.Env = append(r.cmd.Env, "PATH="+strings.Join(paths, string(os.PathListSeparator)))
+	}
+	r.cmd.Env = append(r.cmd.Env, r.depEnvs...)
+}
+
+// configureVariables injects environment variables of scopes the task
+// belongs to and secrets available to the spider, and masks values of
+// secrets in logs. Variables may reference those of the process environment.
+func (r *RunnerV2) configureVariables() (err error) {
+	src, err := environment.GetTaskSources(r.t, r.s, r.secrets)
 	if err != nil {
-		trace.PrintError(err)
-		return
+		return err
+	}
+	environ := map[string]string{}
+	for _, e := range r.cmd.Env {
+		if key, value, ok := strings.Cut(e, "="); ok {
+			environ[key] = value
+		}
+	}
+	vars, err := environment.Resolve(src, func(key string) (value string, ok bool) {
+		value, ok = environ[key]
+		return value, ok
+	})
+	if err != nil {
+		return err
+	}
+	r.cmd.Env = append(r.cmd.Env, environment.ToEnviron(vars)...)
+	r.masker = secret.NewMasker(environment.GetSecretValues(vars))
+	return nil
+}
+
+// installDependencies installs dependencies of manifests detected in the
+// workspace into cached environments of the spider. An environment is only
+// (re)installed when its manifest hash changes.
+func (r *RunnerV2) installDependencies() (err error) {
+	manifests, err := utils.GetDependencyManifests(r.cwd)
+	if err != nil {
+		return err
+	}
+	for _, m := range manifests {
+		envPath := utils.GetDependencyEnvPath(r.s.Id.Hex(), m)
+		acquireDependencyEnv(envPath)
+		r.depEnvPaths = append(r.depEnvPaths, envPath)
+		if err := r.installDependency(m, envPath); err != nil {
+			return err
+		}
+		switch m.Lang {
+		case constants.DependencyLangPython:
+			r.depPaths = append(r.depPaths, filepath.Join(envPath, getPythonVenvBinDir()))
+			r.depEnvs = append(r.depEnvs, "VIRTUAL_ENV="+envPath)
+		case constants.DependencyLangNode:
+			r.depPaths = append(r.depPaths, filepath.Join(envPath, "node_modules", ".bin"))
+			r.depEnvs = append(r.depEnvs, "NODE_PATH="+strings.Join([]string{
+				filepath.Join(envPath, "node_modules"),
+				os.Getenv("NODE_PATH"),
+			}, string(os.PathListSeparator)))
+		case constants.DependencyLangGo:
+			r.depEnvs = append(r.depEnvs, getGoDependencyEnvs(envPath)...)
+		}
 	}
-	for _, env := range envs {
-		r.cmd.Env = append(r.cmd.Env, env.Key+"="+env.Value)
+	return nil
+}
+
+func (r *RunnerV2) releaseDependencyEnvs() {
+	for _, envPath := range r.depEnvPaths {
+		releaseDependencyEnv(envPath)
 	}
+	r.depEnvPaths = nil
+}
+
+func (r *RunnerV2) installDependency(m entity.DependencyManifest, envPath string) (err error) {
+	// prevent concurrent tasks of the same spider from installing the same environment
+	lock, _ := dependencyInstallLocks.LoadOrStore(envPath, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	// skip if already installed
+	markerPath := filepath.Join(envPath, constants.DependencyEnvInstalledMarker)
+	if utils.Exists(markerPath) {
+		return nil
+	}
+
+	r.writeLogLines([]string{fmt.Sprintf("[Crawlab] installing %s dependencies from %s", m.Lang, m.FileName)})
+
+	// remove outdated environments of the same language
+	outdatedPaths, _ := filepath.Glob(filepath.Join(filepath.Dir(envPath), m.Lang+"-*"))
+	for _, p := range outdatedPaths {
+		if p != envPath {
+			removeOutdatedDependencyEnv(p)
+		}
+	}
+	if err := os.MkdirAll(envPath, os.ModePerm); err != nil {
+		return trace.TraceError(err)
+	}
+
+	// install
+	switch m.Lang {
+	case constants.DependencyLangPython:
+		err = r.runDependencyCmd(r.cwd, nil, "python3", "-m", "venv", envPath)
+		if err == nil {
+			pip := filepath.Join(envPath, getPythonVenvBinDir(), "pip")
+			err = r.runDependencyCmd(r.cwd, nil, pip, "install", "-r", m.FilePaths[0])
+		}
+	case constants.DependencyLangNode:
+		// node_modules is installed in the environment instead of the workspace
+		for _, filePath := range m.FilePaths {
+			if err = utils.CopyFile(filePath, filepath.Join(envPath, filepath.Base(filePath))); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = r.runDependencyCmd(envPath, nil, "npm", "install")
+		}
+	case constants.DependencyLangGo:
+		// modules are downloaded to the environment instead of the
+		// module cache of the worker
+		err = r.runDependencyCmd(r.cwd, getGoDependencyEnvs(envPath), "go", "mod", "download")
+	}
+	if err != nil {
+		r.writeLogLines([]string{fmt.Sprintf("[Crawlab] failed to install %s dependencies: %v", m.Lang, err)})
+		_ = os.RemoveAll(envPath)
+		return err
+	}
+
+	// mark as installed
+	if err := os.WriteFile(markerPath, []byte(m.Hash), os.ModePerm); err != nil {
+		return trace.TraceError(err)
+	}
+	r.writeLogLines([]string{fmt.Sprintf("[Crawlab] installed %s dependencies", m.Lang)})
+
+	return nil
+}
+
+// runDependencyCmd runs an install command with additional environment
+// variables and writes its output to task log
+func (r *RunnerV2) runDependencyCmd(dir string, envs []string, name string, args ...string) (err error) {
+	cmd := exec.CommandContext(r.ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), envs...)
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reader := bufio.NewReaderSize(pr, r.bufferSize)
+		for {
+			line, err := reader.ReadString(byte('\n'))
+			if line != "" {
+				r.writeLogLines([]string{strings.TrimSuffix(line, "\n")})
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	r.writeLogLines([]string{"[Crawlab] " + name + " " + strings.Join(args, " ")})
+	err = cmd.Run()
+	_ = pw.Close()
+	<-done
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	return nil
 }
 
 func (r *RunnerV2) syncFiles() (err error) {
@@ -497,6 +765,9 @@ func (r *RunnerV2) initSub() (err error) {
 }
 
 func (r *RunnerV2) writeLogLines(lines []string) {
+	for i, line := range lines {
+		lines[i] = r.masker.Mask(line)
+	}
 	data, err := json.Marshal(&entity.StreamMessageTaskData{
 		TaskId: r.tid,
 		Logs:   lines,
@@ -622,7 +893,25 @@ func (r *RunnerV2) _updateSpiderStat(status string) {
 
 }
 
-func NewTaskRunnerV2(id primitive.ObjectID, svc *ServiceV2) (r2 *RunnerV2, err error) {
+// getGoDependencyEnvs returns environment variables of a go dependency
+// environment. The module cache is writable so that outdated environments
+// can be removed.
+func getGoDependencyEnvs(envPath string) []string {
+	return []string{
+		"GOPATH=" + envPath,
+		"GOMODCACHE=" + filepath.Join(envPath, "pkg", "mod"),
+		"GOFLAGS=" + strings.TrimSpace(os.Getenv("GOFLAGS")+" -modcacherw"),
+	}
+}
+
+func getPythonVenvBinDir() string {
+	if runtime.GOOS == "windows" {
+		return "Scripts"
+	}
+	return "bin"
+}
+
+func NewTaskRunnerV2(id primitive.ObjectID, svc *ServiceV2, secrets []entity.TaskEnvVariable) (r2 *RunnerV2, err error) {
 	// validate options
 	if id.IsZero() {
 		return nil, constants.ErrInvalidOptions
@@ -634,9 +923,11 @@ func NewTaskRunnerV2(id primitive.ObjectID, svc *ServiceV2) (r2 *RunnerV2, err e
 		bufferSize:       1024 * 1024,
 		svc:              svc,
 		tid:              id,
+		secrets:          secrets,
 		ch:               make(chan constants.TaskSignal),
 		logBatchSize:     20,
 	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
 
 	// task
 	r.t, err = svc.GetTaskById(id)
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"github.com/apex/log"
 	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
 	errors2 "github.com/crawlab-team/crawlab-core/errors"
 	grpcclient "github.com/crawlab-team/crawlab-core/grpc/client"
 	"github.com/crawlab-team/crawlab-core/interfaces"
@@ -50,8 +51,10 @@ func (svc *ServiceV2) Start() {
 	go svc.Fetch()
 }
 
+// Run runs a task without secrets, which are only passed to tasks fetched
+// from master
 func (svc *ServiceV2) Run(taskId primitive.ObjectID) (err error) {
-	return svc.run(taskId)
+	return svc.run(taskId, nil)
 }
 
 func (svc *ServiceV2) Reset() {
@@ -81,8 +84,8 @@ func (svc *ServiceV2) Fetch() {
 			continue
 		}
 
-		// skip if node is not active or enabled
-		if !n.Active || !n.Enabled {
+		// skip if node is not active or enabled, or is draining
+		if !n.Active || !n.Enabled || n.Drain != nil {
 			continue
 		}
 
@@ -97,11 +100,12 @@ func (svc *ServiceV2) Fetch() {
 		}
 
 		// fetch task
-		tid, err := svc.fetch()
+		res, err := svc.fetch()
 		if err != nil {
 			trace.PrintError(err)
 			continue
 		}
+		tid := res.TaskId
 
 		// skip if no task id
 		if tid.IsZero() {
@@ -109,7 +113,7 @@ func (svc *ServiceV2) Fetch() {
 		}
 
 		// run task
-		if err := svc.run(tid); err != nil {
+		if err := svc.run(tid, res.Secrets); err != nil {
 			trace.PrintError(err)
 			t, err := svc.GetTaskById(tid)
 			if err == nil && t.Status != constants.TaskStatusCancelled {
@@ -328,20 +332,20 @@ func (svc *ServiceV2) reportStatus() (err error) {
 	return nil
 }
 
-func (svc *ServiceV2) fetch() (tid primitive.ObjectID, err error) {
+func (svc *ServiceV2) fetch() (res entity.TaskFetchResult, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), svc.fetchTimeout)
 	defer cancel()
-	res, err := svc.c.TaskClient.Fetch(ctx, svc.c.NewRequest(nil))
+	grpcRes, err := svc.c.GetTaskClient().Fetch(ctx, svc.c.NewRequest(nil))
 	if err != nil {
-		return tid, trace.TraceError(err)
+		return res, trace.TraceError(err)
 	}
-	if err := json.Unmarshal(res.Data, &tid); err != nil {
-		return tid, trace.TraceError(err)
+	if err := json.Unmarshal(grpcRes.Data, &res); err != nil {
+		return res, trace.TraceError(err)
 	}
-	return tid, nil
+	return res, nil
 }
 
-func (svc *ServiceV2) run(taskId primitive.ObjectID) (err error) {
+func (svc *ServiceV2) run(taskId primitive.ObjectID, secrets []entity.TaskEnvVariable) (err error) {
 	// attempt to get runner from pool
 	_, ok := svc.runners.Load(taskId)
 	if ok {
@@ -349,7 +353,7 @@ func (svc *ServiceV2) run(taskId primitive.ObjectID) (err error) {
 	}
 
 	// create a new task runner
-	r, err := NewTaskRunnerV2(taskId, svc)
+	r, err := NewTaskRunnerV2(taskId, svc, secrets)
 	if err != nil {
 		return trace.TraceError(err)
 	}
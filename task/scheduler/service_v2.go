@@ -2,12 +2,16 @@ package scheduler
 
 import (
 	errors2 "errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/audit"
 	"github.com/crawlab-team/crawlab-core/constants"
 	"github.com/crawlab-team/crawlab-core/container"
 	"github.com/crawlab-team/crawlab-core/errors"
 	"github.com/crawlab-team/crawlab-core/interfaces"
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/node/leader"
 	"github.com/crawlab-team/crawlab-core/utils"
 	grpc "github.com/crawlab-team/crawlab-grpc"
 	"github.com/crawlab-team/go-trace"
@@ -51,6 +55,13 @@ func (svc *ServiceV2) Enqueue(t *models.TaskV2, by primitive.ObjectID) (t2 *mode
 		Priority: t.Priority,
 		NodeId:   t.NodeId,
 	}
+	if t.NodeId.IsZero() {
+		tq.NodeSelector = t.NodeSelector
+	}
+	if s, err := service.NewModelServiceV2[models.SpiderV2]().GetById(t.SpiderId); err == nil {
+		tq.MinMemory = s.MinMemory
+		tq.MinCpu = s.MinCpu
+	}
 	tq.SetId(t.Id)
 
 	// task stat
@@ -75,6 +86,219 @@ func (svc *ServiceV2) Enqueue(t *models.TaskV2, by primitive.ObjectID) (t2 *mode
 	return t, nil
 }
 
+// Requeue enqueues a copy of a task to run again on any node, e.g. after it
+// was cancelled on a draining node. The copy is run as and created by the
+// creator of the task, so that it runs with the same permissions.
+func (svc *ServiceV2) Requeue(t *models.TaskV2) (t2 *models.TaskV2, err error) {
+	userId := t.UserId
+	if userId.IsZero() {
+		// user id is not persisted
+		userId = t.GetCreatedBy()
+	}
+	t2 = &models.TaskV2{
+		SpiderId:     t.SpiderId,
+		Cmd:          t.Cmd,
+		Param:        t.Param,
+		ScheduleId:   t.ScheduleId,
+		Type:         t.Type,
+		Mode:         t.Mode,
+		NodeIds:      t.NodeIds,
+		NodeSelector: t.NodeSelector,
+		ParentId:     t.ParentId,
+		Priority:     t.Priority,
+		GitCommit:    t.GitCommit,
+		Envs:         t.Envs,
+		Params:       t.Params,
+		RequeuedFrom: t.Id,
+		UserId:       userId,
+		CreateTs:     time.Now(),
+	}
+	t2.SetId(primitive.NewObjectID())
+	return svc.Enqueue(t2, userId)
+}
+
+// GetRunningTasks returns tasks running on a node, including tasks fetched
+// by the node but not yet started
+func (svc *ServiceV2) GetRunningTasks(nodeId primitive.ObjectID) (tasks []models.TaskV2, err error) {
+	candidates, err := service.NewModelServiceV2[models.TaskV2]().GetMany(bson.M{
+		"node_id": nodeId,
+		"status": bson.M{"$in": []string{
+			constants.TaskStatusPending,
+			constants.TaskStatusRunning,
+		}},
+	}, nil)
+	if err != nil && !errors2.Is(err, mongo2.ErrNoDocuments) {
+		return nil, trace.TraceError(err)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// pending tasks still in the queue are not fetched yet
+	items, err := service.NewModelServiceV2[models.TaskQueueItemV2]().GetMany(bson.M{"nid": nodeId}, nil)
+	if err != nil && !errors2.Is(err, mongo2.ErrNoDocuments) {
+		return nil, trace.TraceError(err)
+	}
+	queued := map[primitive.ObjectID]bool{}
+	for _, tq := range items {
+		queued[tq.Id] = true
+	}
+	for _, t := range candidates {
+		if !queued[t.Id] {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks, nil
+}
+
+// Unpin unpins a queued task from its node so that it can be fetched by any
+// node matching its node selector
+func (svc *ServiceV2) Unpin(t *models.TaskV2) (err error) {
+	update := bson.M{"$unset": bson.M{"nid": ""}}
+	if t.NodeSelector != "" {
+		update["$set"] = bson.M{"ns": t.NodeSelector}
+	}
+	if err := service.NewModelServiceV2[models.TaskQueueItemV2]().UpdateById(t.Id, update); err != nil {
+		return trace.TraceError(err)
+	}
+	t.NodeId = primitive.NilObjectID
+	if err := service.NewModelServiceV2[models.TaskV2]().UpdateById(t.Id, bson.M{"$set": bson.M{"node_id": t.NodeId}}); err != nil {
+		return trace.TraceError(err)
+	}
+	return nil
+}
+
+// canRequeueOnLostNode returns whether a task of a lost node may be
+// re-queued on other nodes, which is opted in by its spider
+func canRequeueOnLostNode(s *models.SpiderV2) bool {
+	return s != nil && s.RequeueOnLostNode
+}
+
+// canRunOnOtherNodes returns whether a queued task pinned to a lost node may
+// be unpinned to run on other nodes instead of being unschedulable
+func canRunOnOtherNodes(t *models.TaskV2, s *models.SpiderV2) bool {
+	return t.NodeSelector != "" || canRequeueOnLostNode(s)
+}
+
+// markTaskLost marks a running task as lost, and returns false if the task
+// is not running anymore, e.g. it is finished or already handled by another
+// master, so that each task is only re-queued once
+func (svc *ServiceV2) markTaskLost(t *models.TaskV2, errMsg string) (ok bool, err error) {
+	t.Status = constants.TaskStatusLost
+	t.Error = errMsg
+	t.SetUpdated(primitive.NilObjectID)
+	col := service.NewModelServiceV2[models.TaskV2]().GetCol()
+	res, err := col.GetCollection().UpdateOne(col.GetContext(), bson.M{
+		"_id":    t.Id,
+		"status": constants.TaskStatusRunning,
+	}, bson.M{"$set": bson.M{
+		"status":     t.Status,
+		"error":      t.Error,
+		"updated_ts": t.UpdatedAt,
+		"updated_by": t.UpdatedBy,
+	}})
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// HandleLostNode handles tasks of a node lost for longer than the grace
+// period. Running tasks are marked as lost, and re-queued on other nodes if
+// their spiders allow it. Queued tasks pinned to the node are unpinned if
+// they may run on other nodes, i.e. they have node selectors or their
+// spiders allow re-queuing, or otherwise marked as unschedulable.
+func (svc *ServiceV2) HandleLostNode(n *models.NodeV2) (err error) {
+	spiders := map[primitive.ObjectID]*models.SpiderV2{}
+	getSpider := func(t *models.TaskV2) *models.SpiderV2 {
+		s, ok := spiders[t.SpiderId]
+		if !ok {
+			s, _ = service.NewModelServiceV2[models.SpiderV2]().GetById(t.SpiderId)
+			spiders[t.SpiderId] = s
+		}
+		return s
+	}
+	errMsg := fmt.Sprintf("node[%s] is lost", n.Key)
+
+	// running tasks
+	tasks, err := svc.GetRunningTasks(n.Id)
+	if err != nil {
+		return err
+	}
+	var lost, requeued, unschedulable int
+	for _, t := range tasks {
+		if t.Status != constants.TaskStatusRunning {
+			continue
+		}
+		ok, err := svc.markTaskLost(&t, errMsg)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		lost++
+		if !canRequeueOnLostNode(getSpider(&t)) {
+			continue
+		}
+		t2, err := svc.Requeue(&t)
+		if err != nil {
+			return err
+		}
+		requeued++
+		audit.GetAuditServiceV2().RecordSystem(
+			constants.AuditActionTaskRequeue,
+			"tasks",
+			t.Id,
+			fmt.Sprintf("task[%s] on lost node[%s] is re-queued as task[%s]", t.Id.Hex(), n.Key, t2.Id.Hex()),
+		)
+	}
+
+	// queued tasks pinned to the node
+	queueModelSvc := service.NewModelServiceV2[models.TaskQueueItemV2]()
+	items, err := queueModelSvc.GetMany(bson.M{"nid": n.Id}, nil)
+	if err != nil && !errors2.Is(err, mongo2.ErrNoDocuments) {
+		return trace.TraceError(err)
+	}
+	for _, tq := range items {
+		t, err := service.NewModelServiceV2[models.TaskV2]().GetById(tq.Id)
+		if err != nil {
+			if errors2.Is(err, mongo2.ErrNoDocuments) {
+				_ = queueModelSvc.DeleteById(tq.Id)
+				continue
+			}
+			return trace.TraceError(err)
+		}
+		if canRunOnOtherNodes(t, getSpider(t)) {
+			if err := svc.Unpin(t); err != nil {
+				return err
+			}
+			requeued++
+			continue
+		}
+		if err := queueModelSvc.DeleteById(tq.Id); err != nil {
+			return trace.TraceError(err)
+		}
+		t.Status = constants.TaskStatusUnschedulable
+		t.Error = errMsg
+		if err := svc.SaveTask(t, primitive.NilObjectID); err != nil {
+			return trace.TraceError(err)
+		}
+		unschedulable++
+	}
+
+	if lost+requeued+unschedulable > 0 {
+		log.Infof("[TaskSchedulerServiceV2] node[%s] is lost: %d task(s) lost, %d re-queued, %d unschedulable", n.Key, lost, requeued, unschedulable)
+		audit.GetAuditServiceV2().RecordSystem(
+			constants.AuditActionNodeLost,
+			"nodes",
+			n.Id,
+			fmt.Sprintf("node[%s] is lost: %d task(s) lost, %d re-queued, %d unschedulable", n.Key, lost, requeued, unschedulable),
+		)
+	}
+	return nil
+}
+
 func (svc *ServiceV2) Cancel(id primitive.ObjectID, by primitive.ObjectID) (err error) {
 	// task
 	t, err := service.NewModelServiceV2[models.TaskV2]().GetById(id)
@@ -145,22 +369,21 @@ func (svc *ServiceV2) SaveTask(t *models.TaskV2, by primitive.ObjectID) (err err
 	}
 }
 
-// initTaskStatus initialize task status of existing tasks
+// initTaskStatus initialize task status of existing tasks. Only tasks of
+// the current master are set as abnormal, as other masters may be running
+// and tasks of workers are handled once the workers are lost.
 func (svc *ServiceV2) initTaskStatus() {
-	// set status of running tasks as TaskStatusAbnormal
-	runningTasks, err := service.NewModelServiceV2[models.TaskV2]().GetMany(bson.M{
-		"status": bson.M{
-			"$in": []string{
-				constants.TaskStatusPending,
-				constants.TaskStatusRunning,
-			},
-		},
-	}, nil)
+	n, err := service.NewModelServiceV2[models.NodeV2]().GetOne(bson.M{"key": svc.nodeCfgSvc.GetNodeKey()}, nil)
 	if err != nil {
-		if errors2.Is(err, mongo2.ErrNoDocuments) {
-			return
+		if !errors2.Is(err, mongo2.ErrNoDocuments) {
+			trace.PrintError(err)
 		}
+		return
+	}
+	runningTasks, err := svc.GetRunningTasks(n.Id)
+	if err != nil {
 		trace.PrintError(err)
+		return
 	}
 	for _, t := range runningTasks {
 		go func(t *models.TaskV2) {
@@ -170,9 +393,6 @@ func (svc *ServiceV2) initTaskStatus() {
 			}
 		}(&t)
 	}
-	if err := service.NewModelServiceV2[models.TaskQueueItemV2]().DeleteMany(nil); err != nil {
-		return
-	}
 }
 
 func (svc *ServiceV2) isMasterNode(t *models.TaskV2) (ok bool, err error) {
@@ -191,6 +411,12 @@ func (svc *ServiceV2) isMasterNode(t *models.TaskV2) (ok bool, err error) {
 
 func (svc *ServiceV2) cleanupTasks() {
 	for {
+		// only cleanup on the leader
+		if !leader.IsLeader() {
+			time.Sleep(time.Minute)
+			continue
+		}
+
 		// task stats over 30 days ago
 		taskStats, err := service.NewModelServiceV2[models.TaskStatV2]().GetMany(bson.M{
 			"create_ts": bson.M{
@@ -222,6 +448,14 @@ func (svc *ServiceV2) cleanupTasks() {
 			}); err != nil {
 				trace.PrintError(err)
 			}
+
+			// audit
+			audit.GetAuditServiceV2().RecordSystem(
+				constants.AuditActionCleanup,
+				"tasks",
+				primitive.NilObjectID,
+				fmt.Sprintf("removed %d task(s) older than 30 days", len(ids)),
+			)
 		}
 
 		time.Sleep(30 * time.Minute)
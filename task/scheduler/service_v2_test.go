@@ -0,0 +1,27 @@
+package scheduler
+
+import (
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCanRequeueOnLostNode(t *testing.T) {
+	require.True(t, canRequeueOnLostNode(&models.SpiderV2{RequeueOnLostNode: true}))
+	require.False(t, canRequeueOnLostNode(&models.SpiderV2{}))
+
+	// spider is deleted
+	require.False(t, canRequeueOnLostNode(nil))
+}
+
+func TestCanRunOnOtherNodes(t *testing.T) {
+	// node selector
+	require.True(t, canRunOnOtherNodes(&models.TaskV2{NodeSelector: "region=us"}, nil))
+
+	// re-queued on lost node
+	require.True(t, canRunOnOtherNodes(&models.TaskV2{}, &models.SpiderV2{RequeueOnLostNode: true}))
+
+	// unschedulable
+	require.False(t, canRunOnOtherNodes(&models.TaskV2{}, &models.SpiderV2{}))
+	require.False(t, canRunOnOtherNodes(&models.TaskV2{}, nil))
+}
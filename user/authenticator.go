@@ -0,0 +1,21 @@
+package user
+
+import (
+	"github.com/crawlab-team/crawlab-core/entity"
+)
+
+// Authenticator verifies credentials of users against an external
+// authentication source, of which users are synced as UserV2 on login.
+type Authenticator interface {
+	// GetAuthSource returns the name of the source, stored as auth_source
+	// of synced users
+	GetAuthSource() string
+
+	// GetRoleMapping returns mapping of group names in lower case to role
+	// keys, or constants.RoleAdmin for admin users
+	GetRoleMapping() map[string]string
+
+	// Authenticate returns the identity of the user if the credentials are
+	// valid, or errors.ErrorUserMismatch if not
+	Authenticate(username, password string) (identity *entity.ExternalIdentity, err error)
+}
@@ -0,0 +1,149 @@
+package user
+
+import (
+	errors2 "errors"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/go-trace"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The default role (key constants.RoleNormal) is assigned to normal users
+// when they are created, and to existing normal users without roles on
+// init. It grants the access normal users had before roles and
+// permissions, i.e. all actions on all resources, except changing users,
+// roles and permissions. It is only created if not exists, so that admins
+// may change or restrict it.
+
+// defaultRoleDeniedResources are resources whose changes are denied by the
+// default role, as they would allow users to grant themselves access
+var defaultRoleDeniedResources = []string{
+	"permissions",
+	"roles",
+	"roles/permissions",
+	"users",
+	"users/roles",
+}
+
+// getDefaultRolePermissions returns permissions granted by the default role
+func getDefaultRolePermissions() (permissions []models.PermissionV2) {
+	permissions = append(permissions, models.PermissionV2{
+		Key:   constants.RoleNormal + ":*",
+		Name:  "Default",
+		Type:  constants.PermissionAll,
+		Allow: []string{constants.PermissionAll},
+	})
+	for _, resource := range defaultRoleDeniedResources {
+		permissions = append(permissions, models.PermissionV2{
+			Key:  constants.RoleNormal + ":" + resource,
+			Name: "Default (" + resource + ")",
+			Type: resource,
+			Deny: []string{
+				constants.PermissionActionCreate,
+				constants.PermissionActionEdit,
+				constants.PermissionActionDelete,
+			},
+		})
+	}
+	return permissions
+}
+
+// InitDefaultRole returns the default role, which is created with its
+// permissions if not exists
+func (svc *ServiceV2) InitDefaultRole() (r *models.RoleV2, err error) {
+	roleSvc := service.NewModelServiceV2[models.RoleV2]()
+	r, err = roleSvc.GetOne(bson.M{"key": constants.RoleNormal}, nil)
+	if err == nil {
+		return r, nil
+	}
+	if !errors2.Is(err, mongo.ErrNoDocuments) {
+		return nil, trace.TraceError(err)
+	}
+
+	r = &models.RoleV2{
+		Key:         constants.RoleNormal,
+		Name:        "Normal",
+		Description: "Default role of normal users",
+	}
+	r.SetCreated(primitive.NilObjectID)
+	r.SetUpdated(primitive.NilObjectID)
+	id, err := roleSvc.InsertOne(*r)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// created concurrently
+			return roleSvc.GetOne(bson.M{"key": constants.RoleNormal}, nil)
+		}
+		return nil, trace.TraceError(err)
+	}
+	r.SetId(id)
+
+	permissionSvc := service.NewModelServiceV2[models.PermissionV2]()
+	rolePermissionSvc := service.NewModelServiceV2[models.RolePermissionV2]()
+	for _, p := range getDefaultRolePermissions() {
+		p.SetCreated(primitive.NilObjectID)
+		p.SetUpdated(primitive.NilObjectID)
+		pid, err := permissionSvc.InsertOne(p)
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		rp := models.RolePermissionV2{
+			RoleId:       r.Id,
+			PermissionId: pid,
+		}
+		rp.SetCreated(primitive.NilObjectID)
+		rp.SetUpdated(primitive.NilObjectID)
+		if _, err := rolePermissionSvc.InsertOne(rp); err != nil {
+			return nil, trace.TraceError(err)
+		}
+	}
+	GetPermissionServiceV2().ClearCache()
+	log.Infof("[UserServiceV2] created default role of normal users")
+
+	return r, nil
+}
+
+// assignDefaultRole assigns the default role to a user
+func (svc *ServiceV2) assignDefaultRole(userId primitive.ObjectID) (err error) {
+	r, err := svc.InitDefaultRole()
+	if err != nil {
+		return err
+	}
+	ur := models.UserRoleV2{
+		UserId: userId,
+		RoleId: r.Id,
+	}
+	ur.SetCreated(primitive.NilObjectID)
+	ur.SetUpdated(primitive.NilObjectID)
+	if _, err := service.NewModelServiceV2[models.UserRoleV2]().InsertOne(ur); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return trace.TraceError(err)
+	}
+	GetPermissionServiceV2().ClearCache()
+	return nil
+}
+
+// migrateDefaultRole assigns the default role to normal users without any
+// roles, i.e. those created before roles and permissions
+func (svc *ServiceV2) migrateDefaultRole() (err error) {
+	users, err := svc.modelSvc.GetMany(bson.M{"role": constants.RoleNormal}, nil)
+	if err != nil && !errors2.Is(err, mongo.ErrNoDocuments) {
+		return trace.TraceError(err)
+	}
+	userRoleSvc := service.NewModelServiceV2[models.UserRoleV2]()
+	for _, u := range users {
+		count, err := userRoleSvc.Count(bson.M{"user_id": u.Id})
+		if err != nil {
+			return trace.TraceError(err)
+		}
+		if count > 0 {
+			continue
+		}
+		if err := svc.assignDefaultRole(u.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	errors2 "errors"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/crawlab-team/go-trace"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+)
+
+// SyncExternalUser returns the user of an external identity, which is
+// created if not exists, and syncs its roles from groups of the identity
+// with roleMapping.
+func (svc *ServiceV2) SyncExternalUser(identity *entity.ExternalIdentity, roleMapping map[string]string) (u *models.UserV2, err error) {
+	u, err = svc.provisionExternalUser(identity)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.syncExternalUserRoles(u, identity.Groups, roleMapping); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (svc *ServiceV2) provisionExternalUser(identity *entity.ExternalIdentity) (u *models.UserV2, err error) {
+	if identity.Id == "" || identity.Username == "" {
+		return nil, trace.TraceError(errors.ErrorUserMissingRequiredFields)
+	}
+
+	u, err = svc.modelSvc.GetOne(bson.M{"auth_source": identity.Source, "external_id": identity.Id}, nil)
+	if err == nil {
+		// email may have changed in the source
+		if identity.Email != "" && identity.Email != u.Email {
+			u.Email = identity.Email
+			if err := svc.modelSvc.UpdateById(u.Id, bson.M{"$set": bson.M{"email": u.Email}}); err != nil {
+				return nil, trace.TraceError(err)
+			}
+		}
+		return u, nil
+	}
+	if !errors2.Is(err, mongo.ErrNoDocuments) {
+		return nil, trace.TraceError(err)
+	}
+
+	// a user of the same username from another source is not taken over
+	if count, err := svc.modelSvc.Count(bson.M{"username": identity.Username}); err != nil {
+		return nil, trace.TraceError(err)
+	} else if count > 0 {
+		return nil, trace.TraceError(errors.ErrorUserAuthSourceConflict)
+	}
+
+	// password is random as it is never used
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	u = &models.UserV2{
+		Username:   identity.Username,
+		Password:   utils.EncryptMd5(hex.EncodeToString(b)),
+		Role:       constants.RoleNormal,
+		Email:      identity.Email,
+		AuthSource: identity.Source,
+		ExternalId: identity.Id,
+	}
+	u.SetCreated(primitive.NilObjectID)
+	u.SetUpdated(primitive.NilObjectID)
+	id, err := svc.modelSvc.InsertOne(*u)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	u.SetId(id)
+	if err := svc.assignDefaultRole(u.Id); err != nil {
+		return nil, err
+	}
+	log.Infof("[UserServiceV2] provisioned user %s from %s", u.Username, identity.Source)
+
+	return u, nil
+}
+
+// syncExternalUserRoles assigns roles mapped from groups to a user, and
+// removes mapped roles of groups the user no longer belongs to. Roles not
+// in the mapping are left unchanged.
+func (svc *ServiceV2) syncExternalUserRoles(u *models.UserV2, groups []string, roleMapping map[string]string) (err error) {
+	if len(roleMapping) == 0 {
+		return nil
+	}
+
+	isAdmin, roleKeys := GetMappedRoleKeys(groups, roleMapping)
+
+	// admin role
+	mappedKeys := []string{}
+	hasAdminMapping := false
+	for _, key := range roleMapping {
+		if key == constants.RoleAdmin {
+			hasAdminMapping = true
+			continue
+		}
+		mappedKeys = append(mappedKeys, key)
+	}
+	if hasAdminMapping {
+		role := constants.RoleNormal
+		if isAdmin {
+			role = constants.RoleAdmin
+		}
+		if u.Role != role {
+			u.Role = role
+			if err := svc.modelSvc.UpdateById(u.Id, bson.M{"$set": bson.M{"role": role}}); err != nil {
+				return trace.TraceError(err)
+			}
+		}
+	}
+
+	// mapped roles
+	roles, err := service.NewModelServiceV2[models.RoleV2]().GetMany(bson.M{"key": bson.M{"$in": mappedKeys}}, nil)
+	if err != nil && !errors2.Is(err, mongo.ErrNoDocuments) {
+		return trace.TraceError(err)
+	}
+	var addRoleIds, removeRoleIds []primitive.ObjectID
+	for _, r := range roles {
+		if utils.Contains(roleKeys, r.Key) {
+			addRoleIds = append(addRoleIds, r.Id)
+		} else {
+			removeRoleIds = append(removeRoleIds, r.Id)
+		}
+	}
+
+	userRoleSvc := service.NewModelServiceV2[models.UserRoleV2]()
+	if len(removeRoleIds) > 0 {
+		if err := userRoleSvc.DeleteMany(bson.M{"user_id": u.Id, "role_id": bson.M{"$in": removeRoleIds}}); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+	for _, roleId := range addRoleIds {
+		count, err := userRoleSvc.Count(bson.M{"user_id": u.Id, "role_id": roleId})
+		if err != nil {
+			return trace.TraceError(err)
+		}
+		if count > 0 {
+			continue
+		}
+		ur := models.UserRoleV2{
+			UserId: u.Id,
+			RoleId: roleId,
+		}
+		ur.SetCreated(primitive.NilObjectID)
+		ur.SetUpdated(primitive.NilObjectID)
+		if _, err := userRoleSvc.InsertOne(ur); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+	GetPermissionServiceV2().ClearCache()
+
+	return nil
+}
+
+// GetMappedRoleKeys returns keys of roles mapped from groups, and whether
+// any of the groups is mapped to admin. Group names are matched in lower
+// case.
+func GetMappedRoleKeys(groups []string, roleMapping map[string]string) (isAdmin bool, roleKeys []string) {
+	for _, g := range groups {
+		key, ok := roleMapping[strings.ToLower(g)]
+		if !ok {
+			continue
+		}
+		if key == constants.RoleAdmin {
+			isAdmin = true
+			continue
+		}
+		if !utils.Contains(roleKeys, key) {
+			roleKeys = append(roleKeys, key)
+		}
+	}
+	return isAdmin, roleKeys
+}
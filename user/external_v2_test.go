@@ -0,0 +1,21 @@
+package user
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGetMappedRoleKeys(t *testing.T) {
+	mapping := map[string]string{
+		"admins":     "admin",
+		"developers": "developer",
+		"dev":        "developer",
+	}
+	isAdmin, keys := GetMappedRoleKeys([]string{"Admins", "dev", "Developers", "other"}, mapping)
+	require.True(t, isAdmin)
+	require.Equal(t, []string{"developer"}, keys)
+
+	isAdmin, keys = GetMappedRoleKeys(nil, mapping)
+	require.False(t, isAdmin)
+	require.Nil(t, keys)
+}
@@ -0,0 +1,178 @@
+package user
+
+import (
+	errors2 "errors"
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/go-trace"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// Failed login attempts are counted per username and per client ip in
+// LoginAttemptV2. Once the failures of a key reach the maximum attempts, it
+// is locked for a duration doubling with each further failure. Failures are
+// forgotten after the attempt window without failures.
+
+const (
+	loginAttemptKeyPrefixUsername = "username:"
+	loginAttemptKeyPrefixIp       = "ip:"
+)
+
+// loginGuardOptions are settings of login throttling from "login.*"
+type loginGuardOptions struct {
+	maxAttempts   int
+	maxIpAttempts int
+	window        time.Duration
+	lockoutBase   time.Duration
+	lockoutMax    time.Duration
+}
+
+func getLoginGuardOptions() (opts loginGuardOptions) {
+	opts = loginGuardOptions{
+		maxAttempts:   viper.GetInt("login.maxAttempts"),
+		maxIpAttempts: viper.GetInt("login.maxIpAttempts"),
+		window:        viper.GetDuration("login.attemptWindow"),
+		lockoutBase:   viper.GetDuration("login.lockoutBase"),
+		lockoutMax:    viper.GetDuration("login.lockoutMax"),
+	}
+	if opts.maxAttempts <= 0 {
+		opts.maxAttempts = 5
+	}
+	if opts.maxIpAttempts <= 0 {
+		opts.maxIpAttempts = 20
+	}
+	if opts.window <= 0 {
+		opts.window = 15 * time.Minute
+	}
+	if opts.lockoutBase <= 0 {
+		opts.lockoutBase = time.Minute
+	}
+	if opts.lockoutMax <= 0 {
+		opts.lockoutMax = time.Hour
+	}
+	return opts
+}
+
+// UnlockUser clears failed login attempts of a user
+func (svc *ServiceV2) UnlockUser(username string) (err error) {
+	return service.NewModelServiceV2[models.LoginAttemptV2]().DeleteMany(bson.M{"key": loginAttemptKeyPrefixUsername + username})
+}
+
+// checkLoginLocked returns errors.ErrorUserLocked if the username or the ip
+// is locked
+func (svc *ServiceV2) checkLoginLocked(username, ip string) (err error) {
+	attempts, err := service.NewModelServiceV2[models.LoginAttemptV2]().GetMany(bson.M{
+		"key":          bson.M{"$in": getLoginAttemptKeys(username, ip)},
+		"locked_until": bson.M{"$gt": time.Now()},
+	}, nil)
+	if err != nil && !errors2.Is(err, mongo.ErrNoDocuments) {
+		return trace.TraceError(err)
+	}
+	var lockedUntil time.Time
+	for _, a := range attempts {
+		if a.LockedUntil.After(lockedUntil) {
+			lockedUntil = a.LockedUntil
+		}
+	}
+	if !lockedUntil.IsZero() {
+		return fmt.Errorf("%w (retry after %s)", errors.ErrorUserLocked, lockedUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login attempt of the username and the
+// ip, and locks them if exceeding maximum attempts
+func (svc *ServiceV2) recordLoginFailure(username, ip string) {
+	opts := getLoginGuardOptions()
+	for _, key := range getLoginAttemptKeys(username, ip) {
+		maxAttempts := opts.maxAttempts
+		if key == loginAttemptKeyPrefixIp+ip {
+			maxAttempts = opts.maxIpAttempts
+		}
+		if err := svc.recordLoginAttemptFailure(key, maxAttempts, opts); err != nil {
+			trace.PrintError(err)
+		}
+	}
+}
+
+func (svc *ServiceV2) recordLoginAttemptFailure(key string, maxAttempts int, opts loginGuardOptions) (err error) {
+	modelSvc := service.NewModelServiceV2[models.LoginAttemptV2]()
+	col := modelSvc.GetCol()
+	now := time.Now()
+
+	// forget failures out of window
+	if err := col.Update(bson.M{
+		"key":            key,
+		"last_failed_at": bson.M{"$lt": now.Add(-opts.window)},
+		"locked_until":   bson.M{"$lt": now},
+	}, bson.M{"$set": bson.M{"failures": 0}}); err != nil && !errors2.Is(err, mongo.ErrNoDocuments) {
+		return trace.TraceError(err)
+	}
+
+	// count failure
+	if err := col.UpdateWithOptions(bson.M{"key": key}, bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"last_failed_at": now, "updated_ts": now},
+		"$setOnInsert": bson.M{
+			"created_ts":   now,
+			"locked_until": time.Time{},
+		},
+	}, options.Update().SetUpsert(true)); err != nil {
+		return trace.TraceError(err)
+	}
+
+	// lock
+	a, err := modelSvc.GetOne(bson.M{"key": key}, nil)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if d := GetLockoutDuration(a.Failures, maxAttempts, opts.lockoutBase, opts.lockoutMax); d > 0 {
+		if err := modelSvc.UpdateById(a.Id, bson.M{"$set": bson.M{"locked_until": now.Add(d)}}); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+	return nil
+}
+
+// resetLoginFailures clears failed login attempts of the username after a
+// successful login. Failures of the ip are kept, so that they cannot be
+// reset with a known account.
+func (svc *ServiceV2) resetLoginFailures(username string) {
+	if err := svc.UnlockUser(username); err != nil {
+		trace.PrintError(err)
+	}
+}
+
+func getLoginAttemptKeys(username, ip string) (keys []string) {
+	keys = []string{loginAttemptKeyPrefixUsername + username}
+	if ip != "" {
+		keys = append(keys, loginAttemptKeyPrefixIp+ip)
+	}
+	return keys
+}
+
+// GetLockoutDuration returns the duration to lock after failures, which is
+// base once reaching maxAttempts and doubles with each further failure, up
+// to max
+func GetLockoutDuration(failures, maxAttempts int, base, max time.Duration) (d time.Duration) {
+	if failures < maxAttempts {
+		return 0
+	}
+	d = base
+	for i := maxAttempts; i < failures; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
@@ -0,0 +1,22 @@
+package user
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGetLockoutDuration(t *testing.T) {
+	base, max := time.Minute, time.Hour
+	require.Equal(t, time.Duration(0), GetLockoutDuration(4, 5, base, max))
+	require.Equal(t, time.Minute, GetLockoutDuration(5, 5, base, max))
+	require.Equal(t, 2*time.Minute, GetLockoutDuration(6, 5, base, max))
+	require.Equal(t, 32*time.Minute, GetLockoutDuration(10, 5, base, max))
+	require.Equal(t, time.Hour, GetLockoutDuration(11, 5, base, max))
+	require.Equal(t, time.Hour, GetLockoutDuration(100, 5, base, max))
+}
+
+func TestGetLoginAttemptKeys(t *testing.T) {
+	require.Equal(t, []string{"username:alice", "ip:10.0.0.1"}, getLoginAttemptKeys("alice", "10.0.0.1"))
+	require.Equal(t, []string{"username:alice"}, getLoginAttemptKeys("alice", ""))
+}
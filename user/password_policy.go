@@ -0,0 +1,170 @@
+package user
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/go-trace"
+	"github.com/spf13/viper"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// PasswordPolicy is the policy of local user passwords, configured with
+// "password.*" settings
+type PasswordPolicy struct {
+	// MinLength is the minimal length of passwords
+	MinLength int
+
+	// MinClasses is the minimal number of character classes (lowercase,
+	// uppercase, digits and symbols) in passwords
+	MinClasses int
+
+	// BreachedListPath is the path of a local file of breached passwords,
+	// one per line either in plain text or as SHA1 hex (optionally followed
+	// by ":<count>" as in Have I Been Pwned downloads)
+	BreachedListPath string
+
+	// ExpiryDays is days after which passwords must be changed, or 0 if
+	// passwords never expire
+	ExpiryDays int
+}
+
+// Validate returns error if password does not comply with the policy
+func (p *PasswordPolicy) Validate(password string) (err error) {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("%w (length must be no less than %d)", errors.ErrorUserPasswordTooShort, p.MinLength)
+	}
+	if GetPasswordClasses(password) < p.MinClasses {
+		return fmt.Errorf("%w (must contain at least %d of lowercase letters, uppercase letters, digits and symbols)", errors.ErrorUserPasswordTooWeak, p.MinClasses)
+	}
+	if p.BreachedListPath != "" {
+		breached, err := isBreachedPassword(p.BreachedListPath, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return errors.ErrorUserPasswordBreached
+		}
+	}
+	return nil
+}
+
+// IsExpired returns true if a password updated at updatedAt has expired
+func (p *PasswordPolicy) IsExpired(updatedAt time.Time) bool {
+	if p.ExpiryDays <= 0 {
+		return false
+	}
+	return time.Since(updatedAt) > time.Duration(p.ExpiryDays)*24*time.Hour
+}
+
+// GetPasswordClasses returns the number of character classes in password
+func GetPasswordClasses(password string) (n int) {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	for _, ok := range []bool{lower, upper, digit, symbol} {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
+
+func GetPasswordPolicy() (p *PasswordPolicy) {
+	p = &PasswordPolicy{
+		MinLength:        viper.GetInt("password.minLength"),
+		MinClasses:       viper.GetInt("password.minClasses"),
+		BreachedListPath: viper.GetString("password.breachedListPath"),
+		ExpiryDays:       viper.GetInt("password.expiryDays"),
+	}
+	if p.MinLength <= 0 {
+		p.MinLength = 5
+	}
+	return p
+}
+
+// breachedList is the cached SHA1 hashes of a breached password list, which
+// is reloaded if the file changes
+type breachedList struct {
+	path    string
+	modTime time.Time
+	hashes  map[string]bool
+}
+
+var breachedListCache *breachedList
+var breachedListMu sync.Mutex
+
+func isBreachedPassword(path, password string) (ok bool, err error) {
+	breachedListMu.Lock()
+	defer breachedListMu.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	if breachedListCache == nil || breachedListCache.path != path || !breachedListCache.modTime.Equal(info.ModTime()) {
+		hashes, err := loadBreachedList(path)
+		if err != nil {
+			return false, err
+		}
+		breachedListCache = &breachedList{
+			path:    path,
+			modTime: info.ModTime(),
+			hashes:  hashes,
+		}
+	}
+
+	h := sha1.Sum([]byte(password))
+	return breachedListCache.hashes[strings.ToUpper(hex.EncodeToString(h[:]))], nil
+}
+
+func loadBreachedList(path string) (hashes map[string]bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	defer f.Close()
+
+	hashes = map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if hash := strings.SplitN(line, ":", 2)[0]; isSha1Hex(hash) {
+			hashes[strings.ToUpper(hash)] = true
+			continue
+		}
+		h := sha1.Sum([]byte(line))
+		hashes[strings.ToUpper(hex.EncodeToString(h[:]))] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return hashes, nil
+}
+
+func isSha1Hex(s string) bool {
+	if len(s) != sha1.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
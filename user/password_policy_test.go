@@ -0,0 +1,43 @@
+package user
+
+import (
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	p := &PasswordPolicy{MinLength: 8, MinClasses: 3}
+	require.ErrorIs(t, p.Validate("Ab1!"), errors.ErrorUserPasswordTooShort)
+	require.ErrorIs(t, p.Validate("abcdefgh1"), errors.ErrorUserPasswordTooWeak)
+	require.Nil(t, p.Validate("Abcdefgh1"))
+	require.Nil(t, p.Validate("abcdefg1!"))
+
+	// breached list of "Password1" in plain text, and "Welcome1" and
+	// "Summer2024" as sha1 hashes
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.Nil(t, os.WriteFile(path, []byte("Password1\nD318F44739DCED66793B1A603028133A76AE680E\n6ea164759adccdf0b63c3e6a8a52792691f4c37b:42\n"), os.FileMode(0644)))
+	p.BreachedListPath = path
+	require.ErrorIs(t, p.Validate("Password1"), errors.ErrorUserPasswordBreached)
+	require.ErrorIs(t, p.Validate("Welcome1"), errors.ErrorUserPasswordBreached)
+	require.ErrorIs(t, p.Validate("Summer2024"), errors.ErrorUserPasswordBreached)
+	require.Nil(t, p.Validate("Abcdefgh1"))
+}
+
+func TestPasswordPolicy_IsExpired(t *testing.T) {
+	p := &PasswordPolicy{}
+	require.False(t, p.IsExpired(time.Now().Add(-1000*24*time.Hour)))
+	p.ExpiryDays = 90
+	require.False(t, p.IsExpired(time.Now().Add(-89*24*time.Hour)))
+	require.True(t, p.IsExpired(time.Now().Add(-91*24*time.Hour)))
+}
+
+func TestGetPasswordClasses(t *testing.T) {
+	require.Equal(t, 0, GetPasswordClasses(""))
+	require.Equal(t, 1, GetPasswordClasses("abc"))
+	require.Equal(t, 2, GetPasswordClasses("abcABC"))
+	require.Equal(t, 4, GetPasswordClasses("aB3 "))
+}
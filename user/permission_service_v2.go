@@ -0,0 +1,317 @@
+package user
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sync"
+	"time"
+)
+
+// PermissionServiceV2 checks whether a user is allowed to perform an action
+// on a resource, according to the permissions (PermissionV2) of the roles
+// (RoleV2) assigned to the user.
+//
+// A permission applies to resources of its Type ("*" for all resources).
+// If Target is empty the permission applies to all resources of the type,
+// otherwise only to resources whose id, spider id or project id is in Target.
+// Actions in Deny take precedence over actions in Allow.
+type PermissionServiceV2 struct {
+	// settings
+	cacheTtl time.Duration
+
+	// internals
+	cache map[primitive.ObjectID]*permissionCacheItem
+	mu    sync.RWMutex
+}
+
+type permissionCacheItem struct {
+	permissions []models.PermissionV2
+	expiresAt   time.Time
+}
+
+// Check returns true if the user is allowed to perform action on resource.
+// id is the id of the requested resource, or nil ObjectID if the request is
+// not for a single resource, in which case only permissions not scoped to
+// targets apply.
+func (svc *PermissionServiceV2) Check(u *models.UserV2, resource, action string, id primitive.ObjectID) (ok bool, err error) {
+	// admin is allowed to do anything
+	if u.Role == constants.RoleAdmin {
+		return true, nil
+	}
+
+	permissions, err := svc.GetUserPermissions(u.Id)
+	if err != nil {
+		return false, err
+	}
+
+	var targets []string
+	if !id.IsZero() {
+		targets, err = svc.getTargets(resource, id)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return checkPermissions(permissions, resource, action, targets), nil
+}
+
+// GetFilter returns the query restricting a list of resources to those the
+// user is allowed to perform action on, by permissions scoped to targets.
+// ok is false if the user is not allowed on any resource, and query is nil
+// if the user is not restricted.
+func (svc *PermissionServiceV2) GetFilter(u *models.UserV2, resource, action string) (query bson.M, ok bool, err error) {
+	// admin is allowed to do anything
+	if u.Role == constants.RoleAdmin {
+		return nil, true, nil
+	}
+
+	permissions, err := svc.GetUserPermissions(u.Id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	all, allow, deny := getPermissionTargets(permissions, resource, action)
+	if !all && len(allow) == 0 {
+		return nil, false, nil
+	}
+	var queries []bson.M
+	if !all {
+		q, err := svc.getTargetsQuery(resource, allow)
+		if err != nil {
+			return nil, false, err
+		}
+		queries = append(queries, q)
+	}
+	if len(deny) > 0 {
+		q, err := svc.getTargetsQuery(resource, deny)
+		if err != nil {
+			return nil, false, err
+		}
+		queries = append(queries, bson.M{"$nor": []bson.M{q}})
+	}
+	switch len(queries) {
+	case 0:
+		return nil, true, nil
+	case 1:
+		return queries[0], true, nil
+	default:
+		return bson.M{"$and": queries}, true, nil
+	}
+}
+
+// GetUserPermissions returns permissions of all roles assigned to a user
+func (svc *PermissionServiceV2) GetUserPermissions(userId primitive.ObjectID) (permissions []models.PermissionV2, err error) {
+	svc.mu.RLock()
+	item, ok := svc.cache[userId]
+	svc.mu.RUnlock()
+	if ok && time.Now().Before(item.expiresAt) {
+		return item.permissions, nil
+	}
+
+	// roles
+	userRoles, err := service.NewModelServiceV2[models.UserRoleV2]().GetMany(bson.M{"user_id": userId}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var roleIds []primitive.ObjectID
+	for _, ur := range userRoles {
+		roleIds = append(roleIds, ur.RoleId)
+	}
+
+	// permissions
+	if len(roleIds) > 0 {
+		rolePermissions, err := service.NewModelServiceV2[models.RolePermissionV2]().GetMany(bson.M{"role_id": bson.M{"$in": roleIds}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		var permissionIds []primitive.ObjectID
+		for _, rp := range rolePermissions {
+			permissionIds = append(permissionIds, rp.PermissionId)
+		}
+		if len(permissionIds) > 0 {
+			permissions, err = service.NewModelServiceV2[models.PermissionV2]().GetMany(bson.M{"_id": bson.M{"$in": permissionIds}}, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	svc.mu.Lock()
+	svc.cache[userId] = &permissionCacheItem{
+		permissions: permissions,
+		expiresAt:   time.Now().Add(svc.cacheTtl),
+	}
+	svc.mu.Unlock()
+
+	return permissions, nil
+}
+
+// ClearCache clears cached permissions of all users, which should be called
+// when permissions, roles or their assignments are changed.
+func (svc *PermissionServiceV2) ClearCache() {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.cache = map[primitive.ObjectID]*permissionCacheItem{}
+}
+
+// getTargets returns ids a permission can be scoped to for a resource,
+// i.e. the resource itself, and its spider and project if any.
+func (svc *PermissionServiceV2) getTargets(resource string, id primitive.ObjectID) (targets []string, err error) {
+	targets = []string{id.Hex()}
+
+	var spiderId primitive.ObjectID
+	switch resource {
+	case "spiders":
+		spiderId = id
+	case "tasks":
+		t, err := service.NewModelServiceV2[models.TaskV2]().GetById(id)
+		if err != nil {
+			return targets, nil
+		}
+		spiderId = t.SpiderId
+	case "schedules":
+		s, err := service.NewModelServiceV2[models.ScheduleV2]().GetById(id)
+		if err != nil {
+			return targets, nil
+		}
+		spiderId = s.SpiderId
+	default:
+		return targets, nil
+	}
+	if spiderId.IsZero() {
+		return targets, nil
+	}
+	if spiderId != id {
+		targets = append(targets, spiderId.Hex())
+	}
+
+	s, err := service.NewModelServiceV2[models.SpiderV2]().GetById(spiderId)
+	if err != nil {
+		return targets, nil
+	}
+	if !s.ProjectId.IsZero() {
+		targets = append(targets, s.ProjectId.Hex())
+	}
+
+	return targets, nil
+}
+
+// getTargetsQuery returns the query of resources matching targets, i.e.
+// resources whose id, spider id or project id is in targets, as getTargets
+func (svc *PermissionServiceV2) getTargetsQuery(resource string, targets []string) (query bson.M, err error) {
+	ids := []primitive.ObjectID{}
+	for _, t := range targets {
+		if id, err := primitive.ObjectIDFromHex(t); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	or := []bson.M{{"_id": bson.M{"$in": ids}}}
+	switch resource {
+	case "spiders":
+		or = append(or, bson.M{"project_id": bson.M{"$in": ids}})
+	case "tasks", "schedules":
+		spiderIds := append([]primitive.ObjectID{}, ids...)
+		spiders, err := service.NewModelServiceV2[models.SpiderV2]().GetMany(bson.M{"project_id": bson.M{"$in": ids}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range spiders {
+			spiderIds = append(spiderIds, s.Id)
+		}
+		or = append(or, bson.M{"spider_id": bson.M{"$in": spiderIds}})
+	}
+	return bson.M{"$or": or}, nil
+}
+
+// getPermissionTargets returns whether permissions allow action on all
+// resources, and targets of permissions scoped to targets allowing or
+// denying action on resource. Nothing is allowed if a permission not scoped
+// to targets denies the action.
+func getPermissionTargets(permissions []models.PermissionV2, resource, action string) (all bool, allow, deny []string) {
+	for _, p := range permissions {
+		if p.Type != resource && p.Type != constants.PermissionAll {
+			continue
+		}
+		scoped := len(p.Target) > 0 && !utils.Contains(p.Target, constants.PermissionAll)
+		if matchPermissionAction(p.Deny, action) {
+			if !scoped {
+				return false, nil, nil
+			}
+			deny = append(deny, p.Target...)
+			continue
+		}
+		if matchPermissionAction(p.Allow, action) {
+			if scoped {
+				allow = append(allow, p.Target...)
+			} else {
+				all = true
+			}
+		}
+	}
+	return all, allow, deny
+}
+
+// checkPermissions returns true if any of the permissions allows action on
+// resource with given targets and none of them denies it.
+func checkPermissions(permissions []models.PermissionV2, resource, action string, targets []string) (ok bool) {
+	for _, p := range permissions {
+		if p.Type != resource && p.Type != constants.PermissionAll {
+			continue
+		}
+		if !matchPermissionTargets(p.Target, targets) {
+			continue
+		}
+		if matchPermissionAction(p.Deny, action) {
+			return false
+		}
+		if matchPermissionAction(p.Allow, action) {
+			ok = true
+		}
+	}
+	return ok
+}
+
+func matchPermissionTargets(permissionTargets, targets []string) bool {
+	if len(permissionTargets) == 0 {
+		return true
+	}
+	for _, t := range permissionTargets {
+		if t == constants.PermissionAll {
+			return true
+		}
+		if utils.Contains(targets, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPermissionAction(actions []string, action string) bool {
+	for _, a := range actions {
+		if a == action || a == constants.PermissionAll {
+			return true
+		}
+	}
+	return false
+}
+
+func NewPermissionServiceV2() (svc *PermissionServiceV2) {
+	return &PermissionServiceV2{
+		cacheTtl: time.Minute,
+		cache:    map[primitive.ObjectID]*permissionCacheItem{},
+	}
+}
+
+var permissionSvcV2 *PermissionServiceV2
+
+func GetPermissionServiceV2() (svc *PermissionServiceV2) {
+	if permissionSvcV2 != nil {
+		return permissionSvcV2
+	}
+	permissionSvcV2 = NewPermissionServiceV2()
+	return permissionSvcV2
+}
@@ -0,0 +1,106 @@
+package user
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	projectId := primitive.NewObjectID().Hex()
+	spiderId := primitive.NewObjectID().Hex()
+	permissions := []models.PermissionV2{
+		{
+			Type:  "spiders",
+			Allow: []string{constants.PermissionActionView},
+		},
+		{
+			Type:   "spiders",
+			Target: []string{projectId},
+			Allow:  []string{constants.PermissionAll},
+			Deny:   []string{constants.PermissionActionDelete},
+		},
+		{
+			Type:  constants.PermissionAll,
+			Allow: []string{constants.PermissionActionView},
+			Deny:  []string{constants.PermissionActionRun},
+		},
+	}
+
+	// unscoped permissions
+	require.True(t, checkPermissions(permissions, "spiders", constants.PermissionActionView, nil))
+	require.True(t, checkPermissions(permissions, "nodes", constants.PermissionActionView, nil))
+	require.False(t, checkPermissions(permissions, "nodes", constants.PermissionActionEdit, nil))
+	require.False(t, checkPermissions(permissions, "spiders", constants.PermissionActionCreate, nil))
+
+	// scoped to project
+	require.True(t, checkPermissions(permissions, "spiders", constants.PermissionActionEdit, []string{spiderId, projectId}))
+	require.False(t, checkPermissions(permissions, "spiders", constants.PermissionActionEdit, []string{spiderId}))
+
+	// deny takes precedence
+	require.False(t, checkPermissions(permissions, "spiders", constants.PermissionActionDelete, []string{spiderId, projectId}))
+	require.False(t, checkPermissions(permissions, "spiders", constants.PermissionActionRun, []string{spiderId, projectId}))
+
+	// no permissions
+	require.False(t, checkPermissions(nil, "spiders", constants.PermissionActionView, nil))
+}
+
+func TestGetPermissionTargets(t *testing.T) {
+	spiderId := primitive.NewObjectID().Hex()
+	projectId := primitive.NewObjectID().Hex()
+	permissions := []models.PermissionV2{
+		{
+			Type:   "spiders",
+			Target: []string{spiderId},
+			Allow:  []string{constants.PermissionActionView},
+		},
+		{
+			Type:   "spiders",
+			Target: []string{projectId},
+			Deny:   []string{constants.PermissionActionView},
+		},
+		{
+			Type:  "tasks",
+			Allow: []string{constants.PermissionActionView},
+		},
+		{
+			Type: "nodes",
+			Deny: []string{constants.PermissionAll},
+		},
+	}
+
+	// scoped to targets
+	all, allow, deny := getPermissionTargets(permissions, "spiders", constants.PermissionActionView)
+	require.False(t, all)
+	require.Equal(t, []string{spiderId}, allow)
+	require.Equal(t, []string{projectId}, deny)
+
+	// not scoped
+	all, allow, deny = getPermissionTargets(permissions, "tasks", constants.PermissionActionView)
+	require.True(t, all)
+	require.Empty(t, allow)
+	require.Empty(t, deny)
+
+	// denied
+	all, allow, _ = getPermissionTargets(permissions, "nodes", constants.PermissionActionView)
+	require.False(t, all)
+	require.Empty(t, allow)
+}
+
+func TestGetDefaultRolePermissions(t *testing.T) {
+	permissions := getDefaultRolePermissions()
+
+	// access of normal users before roles and permissions
+	require.True(t, checkPermissions(permissions, "spiders", constants.PermissionActionView, nil))
+	require.True(t, checkPermissions(permissions, "spiders", constants.PermissionActionDelete, nil))
+	require.True(t, checkPermissions(permissions, "tasks", constants.PermissionActionRun, nil))
+	require.True(t, checkPermissions(permissions, "users", constants.PermissionActionView, nil))
+
+	// users cannot grant themselves access
+	require.False(t, checkPermissions(permissions, "users", constants.PermissionActionEdit, nil))
+	require.False(t, checkPermissions(permissions, "roles", constants.PermissionActionCreate, nil))
+	require.False(t, checkPermissions(permissions, "users/roles", constants.PermissionActionCreate, nil))
+	require.False(t, checkPermissions(permissions, "permissions", constants.PermissionActionDelete, nil))
+}
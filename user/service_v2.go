@@ -1,9 +1,13 @@
 package user
 
 import (
+	errors2 "errors"
+	"github.com/apex/log"
 	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
 	"github.com/crawlab-team/crawlab-core/errors"
 	"github.com/crawlab-team/crawlab-core/interfaces"
+	"github.com/crawlab-team/crawlab-core/ldap"
 	"github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/models/service"
 	"github.com/crawlab-team/crawlab-core/utils"
@@ -11,6 +15,7 @@ import (
 	"github.com/crawlab-team/go-trace"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -21,9 +26,15 @@ type ServiceV2 struct {
 	jwtSecret        string
 	jwtSigningMethod jwt.SigningMethod
 	modelSvc         *service.ModelServiceV2[models.UserV2]
+	authenticators   []Authenticator
 }
 
 func (svc *ServiceV2) Init() (err error) {
+	// normal users created before roles and permissions
+	if err := svc.migrateDefaultRole(); err != nil {
+		return err
+	}
+
 	_, err = svc.modelSvc.GetOne(bson.M{"username": constants.DefaultAdminUsername}, nil)
 	if err == nil {
 		return nil
@@ -31,7 +42,8 @@ func (svc *ServiceV2) Init() (err error) {
 	if err.Error() != mongo.ErrNoDocuments.Error() {
 		return err
 	}
-	return svc.Create(
+	// default admin is created regardless of password policy
+	return svc.create(
 		constants.DefaultAdminUsername,
 		constants.DefaultAdminPassword,
 		constants.RoleAdmin,
@@ -49,13 +61,17 @@ func (svc *ServiceV2) SetJwtSigningMethod(method jwt.SigningMethod) {
 }
 
 func (svc *ServiceV2) Create(username, password, role, email string, by primitive.ObjectID) (err error) {
+	if err := GetPasswordPolicy().Validate(password); err != nil {
+		return err
+	}
+	return svc.create(username, password, role, email, by)
+}
+
+func (svc *ServiceV2) create(username, password, role, email string, by primitive.ObjectID) (err error) {
 	// validate options
 	if username == "" || password == "" {
 		return trace.TraceError(errors.ErrorUserMissingRequiredFields)
 	}
-	if len(password) < 5 {
-		return trace.TraceError(errors.ErrorUserInvalidPassword)
-	}
 
 	// normalize options
 	if role == "" {
@@ -71,32 +87,89 @@ func (svc *ServiceV2) Create(username, password, role, email string, by primitiv
 	return mongo2.RunTransaction(func(ctx mongo.SessionContext) error {
 		// add user
 		u := models.UserV2{
-			Username: username,
-			Role:     role,
-			Password: utils.EncryptMd5(password),
-			Email:    email,
+			Username:          username,
+			Role:              role,
+			Password:          utils.EncryptMd5(password),
+			Email:             email,
+			PasswordUpdatedAt: time.Now(),
 		}
 		u.SetCreated(by)
 		u.SetUpdated(by)
-		_, err = svc.modelSvc.InsertOne(u)
+		id, err := svc.modelSvc.InsertOne(u)
+		if err != nil {
+			return err
+		}
 
-		return err
+		// default role of normal users
+		if role == constants.RoleNormal {
+			return svc.assignDefaultRole(id)
+		}
+		return nil
 	})
 }
 
-func (svc *ServiceV2) Login(username, password string) (token string, u *models.UserV2, err error) {
-	u, err = svc.modelSvc.GetOne(bson.M{"username": username}, nil)
-	if err != nil {
-		return "", nil, err
+// RegisterAuthenticator adds an external authentication source to Login
+func (svc *ServiceV2) RegisterAuthenticator(a Authenticator) {
+	svc.authenticators = append(svc.authenticators, a)
+}
+
+// Login verifies credentials of a user logging in from client, and returns
+// tokens of a new session, or a challenge token if a second step is
+// required (2FA enabled or mandatory)
+func (svc *ServiceV2) Login(username, password string, client *entity.LoginClient) (res *entity.LoginResult, u *models.UserV2, err error) {
+	if err := svc.checkLoginLocked(username, client.Ip); err != nil {
+		return nil, nil, err
 	}
-	if u.Password != utils.EncryptMd5(password) {
-		return "", nil, errors.ErrorUserMismatch
+	u, err = svc.authenticate(username, password)
+	if err != nil {
+		if errors2.Is(err, errors.ErrorUserMismatch) {
+			svc.recordLoginFailure(username, client.Ip)
+		}
+		return nil, nil, err
 	}
-	token, err = svc.makeToken(u)
+	svc.resetLoginFailures(username)
+	res, err = svc.completeLogin(u, client)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
-	return token, u, nil
+	return res, u, nil
+}
+
+// LoginExternal logs in a user authenticated by an external identity
+// provider (e.g. OpenID Connect), with the same checks and second step as
+// Login
+func (svc *ServiceV2) LoginExternal(u *models.UserV2, client *entity.LoginClient) (res *entity.LoginResult, err error) {
+	if err := svc.checkLoginLocked(u.Username, client.Ip); err != nil {
+		return nil, err
+	}
+	return svc.completeLogin(u, client)
+}
+
+// completeLogin creates a session of an authenticated user, or returns a
+// challenge token if a second step is required
+func (svc *ServiceV2) completeLogin(u *models.UserV2, client *entity.LoginClient) (res *entity.LoginResult, err error) {
+	// expired password must be changed with ChangeExpiredPassword
+	if svc.isPasswordExpired(u) {
+		return nil, errors.ErrorUserPasswordExpired
+	}
+
+	// second step with a challenge token if 2FA is enabled or mandatory
+	if err := svc.checkTotp(u); err != nil {
+		if !errors2.Is(err, errors.ErrorUserTotpRequired) && !errors2.Is(err, errors.ErrorUserTotpSetupRequired) {
+			return nil, err
+		}
+		challenge, err2 := svc.makeChallengeToken(u)
+		if err2 != nil {
+			return nil, err2
+		}
+		return &entity.LoginResult{
+			TotpRequired:      errors2.Is(err, errors.ErrorUserTotpRequired),
+			TotpSetupRequired: errors2.Is(err, errors.ErrorUserTotpSetupRequired),
+			Challenge:         challenge,
+		}, nil
+	}
+
+	return svc.CreateSession(u, client)
 }
 
 func (svc *ServiceV2) CheckToken(tokenStr string) (u *models.UserV2, err error) {
@@ -104,17 +177,47 @@ func (svc *ServiceV2) CheckToken(tokenStr string) (u *models.UserV2, err error)
 }
 
 func (svc *ServiceV2) ChangePassword(id primitive.ObjectID, password string, by primitive.ObjectID) (err error) {
-	u, err := svc.modelSvc.GetById(id)
+	if err := GetPasswordPolicy().Validate(password); err != nil {
+		return err
+	}
+	return svc.modelSvc.UpdateById(id, bson.M{"$set": bson.M{
+		"password":            utils.EncryptMd5(password),
+		"password_updated_at": time.Now(),
+		"updated_by":          by,
+		"updated_ts":          time.Now(),
+	}})
+}
+
+// ChangeExpiredPassword changes the expired password of a local user with
+// its credentials, as the user cannot log in to change it
+func (svc *ServiceV2) ChangeExpiredPassword(username, password, newPassword, ip string) (err error) {
+	if err := svc.checkLoginLocked(username, ip); err != nil {
+		return err
+	}
+	u, err := svc.authenticate(username, password)
 	if err != nil {
+		if errors2.Is(err, errors.ErrorUserMismatch) {
+			svc.recordLoginFailure(username, ip)
+		}
 		return err
 	}
-	u.Password = utils.EncryptMd5(password)
-	u.SetCreatedBy(by)
-	return svc.modelSvc.ReplaceById(id, *u)
+	svc.resetLoginFailures(username)
+	if !isLocalUser(u) {
+		return errors.ErrorUserMismatch
+	}
+	if newPassword == password {
+		return errors.ErrorUserPasswordUnchanged
+	}
+	return svc.ChangePassword(u.Id, newPassword, u.Id)
 }
 
+// MakeToken creates a session of a user and returns its access token
 func (svc *ServiceV2) MakeToken(user *models.UserV2) (tokenStr string, err error) {
-	return svc.makeToken(user)
+	res, err := svc.CreateSession(user, nil)
+	if err != nil {
+		return "", err
+	}
+	return res.Token, nil
 }
 
 func (svc *ServiceV2) GetCurrentUser(c *gin.Context) (user interfaces.User, err error) {
@@ -130,17 +233,19 @@ func (svc *ServiceV2) GetCurrentUser(c *gin.Context) (user interfaces.User, err
 	return u, nil
 }
 
-func (svc *ServiceV2) makeToken(user *models.UserV2) (tokenStr string, err error) {
+func (svc *ServiceV2) makeToken(user *models.UserV2, sessionId primitive.ObjectID, expiresAt time.Time) (tokenStr string, err error) {
 	token := jwt.NewWithClaims(svc.jwtSigningMethod, jwt.MapClaims{
 		"id":       user.Id,
 		"username": user.Username,
+		"sid":      sessionId,
 		"nbf":      time.Now().Unix(),
+		"exp":      expiresAt.Unix(),
 	})
 	return token.SignedString([]byte(svc.jwtSecret))
 }
 
 func (svc *ServiceV2) checkToken(tokenStr string) (user *models.UserV2, err error) {
-	token, err := jwt.Parse(tokenStr, svc.getSecretFunc())
+	token, err := jwt.Parse(tokenStr, svc.getSecretFunc(), jwt.WithExpirationRequired())
 	if err != nil {
 		return
 	}
@@ -151,6 +256,12 @@ func (svc *ServiceV2) checkToken(tokenStr string) (user *models.UserV2, err erro
 		return
 	}
 
+	// challenge tokens of login steps
+	if _, ok := claim["purpose"]; ok {
+		err = errors.ErrorUserInvalidToken
+		return
+	}
+
 	if !token.Valid {
 		err = errors.ErrorUserInvalidToken
 		return
@@ -172,9 +283,72 @@ func (svc *ServiceV2) checkToken(tokenStr string) (user *models.UserV2, err erro
 		return
 	}
 
+	// session
+	sid, _ := claim["sid"].(string)
+	sessionId, err := primitive.ObjectIDFromHex(sid)
+	if err != nil {
+		err = errors.ErrorUserInvalidToken
+		return
+	}
+	if err = svc.checkSession(sessionId, user.Id); err != nil {
+		return
+	}
+
 	return
 }
 
+// authenticate verifies credentials of local users with their passwords,
+// which does not depend on external sources so that local admin accounts
+// still work when they are down, and other users with the authenticators.
+func (svc *ServiceV2) authenticate(username, password string) (u *models.UserV2, err error) {
+	u, err = svc.modelSvc.GetOne(bson.M{"username": username}, nil)
+	if err != nil && !errors2.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	// local user
+	if u != nil && isLocalUser(u) {
+		if u.Password != utils.EncryptMd5(password) {
+			return nil, errors.ErrorUserMismatch
+		}
+		return u, nil
+	}
+
+	// external user
+	for _, a := range svc.authenticators {
+		if u != nil && u.AuthSource != a.GetAuthSource() {
+			continue
+		}
+		identity, err := a.Authenticate(username, password)
+		if err != nil {
+			if !errors2.Is(err, errors.ErrorUserMismatch) {
+				log.Errorf("[UserServiceV2] %s authentication error: %v", a.GetAuthSource(), err)
+			}
+			continue
+		}
+		return svc.SyncExternalUser(identity, a.GetRoleMapping())
+	}
+
+	return nil, errors.ErrorUserMismatch
+}
+
+// isPasswordExpired returns true if the password of a local user has
+// expired, which is counted from creation if never changed
+func (svc *ServiceV2) isPasswordExpired(u *models.UserV2) bool {
+	if !isLocalUser(u) {
+		return false
+	}
+	updatedAt := u.PasswordUpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = u.CreatedAt
+	}
+	return GetPasswordPolicy().IsExpired(updatedAt)
+}
+
+func isLocalUser(u *models.UserV2) bool {
+	return u.AuthSource == "" || u.AuthSource == constants.AuthSourceLocal
+}
+
 func (svc *ServiceV2) getSecretFunc() jwt.Keyfunc {
 	return func(token *jwt.Token) (interface{}, error) {
 		return []byte(svc.jwtSecret), nil
@@ -194,6 +368,11 @@ func NewUserServiceV2() (svc *ServiceV2, err error) {
 		return nil, trace.TraceError(err)
 	}
 
+	// external authentication sources
+	if viper.GetString("ldap.url") != "" {
+		svc.RegisterAuthenticator(ldap.NewAuthenticator())
+	}
+
 	return svc, nil
 }
 
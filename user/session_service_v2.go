@@ -0,0 +1,258 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	errors2 "errors"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/crawlab-team/go-trace"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// Each login creates a session (SessionV2), for which short-lived access
+// tokens (JWT with the session id "sid") are issued. A new access token is
+// obtained with the refresh token of the session, which is rotated on each
+// refresh and stored only as sha256 hash. Reusing a rotated refresh token
+// revokes the session, as the token may have been stolen. Revoked sessions
+// invalidate their access tokens immediately.
+
+// sessionLastUsedInterval is the minimal interval to update last used time
+const sessionLastUsedInterval = time.Minute
+
+func getAccessTokenTtl() time.Duration {
+	if d := viper.GetDuration("auth.accessTokenTtl"); d > 0 {
+		return d
+	}
+	return 15 * time.Minute
+}
+
+func getRefreshTokenTtl() time.Duration {
+	if d := viper.GetDuration("auth.refreshTokenTtl"); d > 0 {
+		return d
+	}
+	return 7 * 24 * time.Hour
+}
+
+// CreateSession creates a session of a user logged in from client, and
+// returns its access token and refresh token
+func (svc *ServiceV2) CreateSession(u *models.UserV2, client *entity.LoginClient) (res *entity.LoginResult, err error) {
+	if client == nil {
+		client = &entity.LoginClient{}
+	}
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	s := models.SessionV2{
+		UserId:           u.Id,
+		RefreshTokenHash: utils.EncryptSha256(refreshToken),
+		Ip:               client.Ip,
+		UserAgent:        client.UserAgent,
+		ExpiresAt:        time.Now().Add(getRefreshTokenTtl()),
+		LastUsedAt:       time.Now(),
+	}
+	s.SetCreated(u.Id)
+	s.SetUpdated(u.Id)
+	id, err := service.NewModelServiceV2[models.SessionV2]().InsertOne(s)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return svc.getLoginResult(u, id, refreshToken)
+}
+
+// RefreshSession rotates the refresh token of a session, and returns a new
+// access token with the new refresh token
+func (svc *ServiceV2) RefreshSession(refreshToken string, client *entity.LoginClient) (res *entity.LoginResult, u *models.UserV2, err error) {
+	modelSvc := service.NewModelServiceV2[models.SessionV2]()
+	hash := utils.EncryptSha256(refreshToken)
+	s, err := modelSvc.GetOne(bson.M{"refresh_token_hash": hash}, nil)
+	if err != nil {
+		if !errors2.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil, trace.TraceError(err)
+		}
+
+		// reuse of a rotated refresh token
+		if s, err := modelSvc.GetOne(bson.M{"prev_refresh_token_hash": hash, "revoked": false}, nil); err == nil {
+			log.Warnf("[UserServiceV2] refresh token of session %s reused, revoking session", s.Id.Hex())
+			if err := svc.RevokeSession(s.Id, s.UserId); err != nil {
+				trace.PrintError(err)
+			}
+		}
+		return nil, nil, errors.ErrorUserInvalidToken
+	}
+	if s.Revoked {
+		return nil, nil, errors.ErrorUserSessionRevoked
+	}
+	if time.Now().After(s.ExpiresAt) {
+		return nil, nil, errors.ErrorUserSessionExpired
+	}
+
+	u, err = svc.modelSvc.GetById(s.UserId)
+	if err != nil {
+		return nil, nil, errors.ErrorUserNotExists
+	}
+
+	// rotate refresh token
+	newRefreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	update := bson.M{
+		"refresh_token_hash":      utils.EncryptSha256(newRefreshToken),
+		"prev_refresh_token_hash": hash,
+		"expires_at":              time.Now().Add(getRefreshTokenTtl()),
+		"last_used_at":            time.Now(),
+		"updated_ts":              time.Now(),
+	}
+	if client != nil && client.Ip != "" {
+		update["ip"] = client.Ip
+	}
+	// rotated only if not rotated concurrently with the same refresh token,
+	// which is reuse
+	col := modelSvc.GetCol()
+	updateRes, err := col.GetCollection().UpdateOne(col.GetContext(), bson.M{
+		"_id":                s.Id,
+		"refresh_token_hash": hash,
+		"revoked":            false,
+	}, bson.M{"$set": update})
+	if err != nil {
+		return nil, nil, trace.TraceError(err)
+	}
+	if updateRes.ModifiedCount == 0 {
+		log.Warnf("[UserServiceV2] refresh token of session %s reused, revoking session", s.Id.Hex())
+		if err := svc.RevokeSession(s.Id, s.UserId); err != nil {
+			trace.PrintError(err)
+		}
+		return nil, nil, errors.ErrorUserInvalidToken
+	}
+
+	res, err = svc.getLoginResult(u, s.Id, newRefreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, u, nil
+}
+
+// GetActiveSessions returns sessions of a user not revoked or expired
+func (svc *ServiceV2) GetActiveSessions(userId primitive.ObjectID) (sessions []models.SessionV2, err error) {
+	sessions, err = service.NewModelServiceV2[models.SessionV2]().GetMany(bson.M{
+		"user_id":    userId,
+		"revoked":    false,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, nil)
+	if err != nil && !errors2.Is(err, mongo.ErrNoDocuments) {
+		return nil, trace.TraceError(err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes a session, of which access tokens and refresh token
+// can no longer be used
+func (svc *ServiceV2) RevokeSession(id primitive.ObjectID, by primitive.ObjectID) (err error) {
+	return service.NewModelServiceV2[models.SessionV2]().UpdateById(id, bson.M{"$set": bson.M{
+		"revoked":    true,
+		"revoked_at": time.Now(),
+		"updated_by": by,
+		"updated_ts": time.Now(),
+	}})
+}
+
+// RevokeUserSessions revokes all sessions of a user, i.e. logs the user out
+// everywhere
+func (svc *ServiceV2) RevokeUserSessions(userId primitive.ObjectID, by primitive.ObjectID) (err error) {
+	return service.NewModelServiceV2[models.SessionV2]().UpdateMany(bson.M{
+		"user_id": userId,
+		"revoked": false,
+	}, bson.M{"$set": bson.M{
+		"revoked":    true,
+		"revoked_at": time.Now(),
+		"updated_by": by,
+		"updated_ts": time.Now(),
+	}})
+}
+
+// Logout revokes the session of an access token or a refresh token
+func (svc *ServiceV2) Logout(tokenStr, refreshToken string) (err error) {
+	modelSvc := service.NewModelServiceV2[models.SessionV2]()
+	var s *models.SessionV2
+	if id, err := svc.GetTokenSessionId(tokenStr); err == nil {
+		s, _ = modelSvc.GetById(id)
+	}
+	if s == nil && refreshToken != "" {
+		s, _ = modelSvc.GetOne(bson.M{"refresh_token_hash": utils.EncryptSha256(refreshToken)}, nil)
+	}
+	if s == nil || s.Revoked {
+		return nil
+	}
+	return svc.RevokeSession(s.Id, s.UserId)
+}
+
+// GetTokenSessionId returns the session id of a valid access token
+func (svc *ServiceV2) GetTokenSessionId(tokenStr string) (id primitive.ObjectID, err error) {
+	token, err := jwt.Parse(tokenStr, svc.getSecretFunc())
+	if err != nil || !token.Valid {
+		return id, errors.ErrorUserInvalidToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return id, errors.ErrorUserInvalidToken
+	}
+	sid, _ := claims["sid"].(string)
+	return primitive.ObjectIDFromHex(sid)
+}
+
+// checkSession returns error if a session is revoked or expired, and
+// updates its last used time
+func (svc *ServiceV2) checkSession(id primitive.ObjectID, userId primitive.ObjectID) (err error) {
+	modelSvc := service.NewModelServiceV2[models.SessionV2]()
+	s, err := modelSvc.GetById(id)
+	if err != nil {
+		return errors.ErrorUserInvalidToken
+	}
+	if s.UserId != userId {
+		return errors.ErrorUserMismatch
+	}
+	if s.Revoked {
+		return errors.ErrorUserSessionRevoked
+	}
+	if time.Now().After(s.ExpiresAt) {
+		return errors.ErrorUserSessionExpired
+	}
+	if time.Since(s.LastUsedAt) > sessionLastUsedInterval {
+		if err := modelSvc.UpdateById(s.Id, bson.M{"$set": bson.M{"last_used_at": time.Now()}}); err != nil {
+			trace.PrintError(err)
+		}
+	}
+	return nil
+}
+
+func (svc *ServiceV2) getLoginResult(u *models.UserV2, sessionId primitive.ObjectID, refreshToken string) (res *entity.LoginResult, err error) {
+	expiresAt := time.Now().Add(getAccessTokenTtl())
+	token, err := svc.makeToken(u, sessionId, expiresAt)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return &entity.LoginResult{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+func generateRefreshToken() (token string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", trace.TraceError(err)
+	}
+	return hex.EncodeToString(b), nil
+}
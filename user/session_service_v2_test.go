@@ -0,0 +1,51 @@
+package user
+
+import (
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+func TestGetTokenSessionId(t *testing.T) {
+	svc := &ServiceV2{
+		jwtSecret:        "crawlab",
+		jwtSigningMethod: jwt.SigningMethodHS256,
+	}
+	u := &models.UserV2{Username: "alice"}
+	u.SetId(primitive.NewObjectID())
+	sessionId := primitive.NewObjectID()
+
+	token, err := svc.makeToken(u, sessionId, time.Now().Add(time.Minute))
+	require.Nil(t, err)
+	id, err := svc.GetTokenSessionId(token)
+	require.Nil(t, err)
+	require.Equal(t, sessionId, id)
+
+	// expired
+	token, err = svc.makeToken(u, sessionId, time.Now().Add(-time.Minute))
+	require.Nil(t, err)
+	_, err = svc.GetTokenSessionId(token)
+	require.NotNil(t, err)
+
+	// other secret
+	other := &ServiceV2{
+		jwtSecret:        "other",
+		jwtSigningMethod: jwt.SigningMethodHS256,
+	}
+	token, err = other.makeToken(u, sessionId, time.Now().Add(time.Minute))
+	require.Nil(t, err)
+	_, err = svc.GetTokenSessionId(token)
+	require.NotNil(t, err)
+}
+
+func TestGenerateRefreshToken(t *testing.T) {
+	a, err := generateRefreshToken()
+	require.Nil(t, err)
+	b, err := generateRefreshToken()
+	require.Nil(t, err)
+	require.Len(t, a, 64)
+	require.NotEqual(t, a, b)
+}
@@ -0,0 +1,185 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/crawlab-team/go-trace"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+// API tokens are random strings prefixed with constants.ApiTokenPrefix, of
+// which only the sha256 hash is stored. Each token has scopes in the format
+// of "<resource>:<read|write|run>", e.g. "tasks:run" or "results:read",
+// where either part can be "*".
+
+// tokenLastUsedInterval is the minimal interval to update last used time
+const tokenLastUsedInterval = time.Minute
+
+// IsApiToken returns true if tokenStr is an API token instead of a JWT
+func (svc *ServiceV2) IsApiToken(tokenStr string) bool {
+	return strings.HasPrefix(tokenStr, constants.ApiTokenPrefix)
+}
+
+// CreateToken creates an API token for a user. The plain token is only set
+// in the returned model and is not stored.
+func (svc *ServiceV2) CreateToken(u *models.UserV2, name string, scopes []string, expiresAt time.Time) (t *models.TokenV2, err error) {
+	if err := ValidateTokenScopes(scopes); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	tokenStr := constants.ApiTokenPrefix + hex.EncodeToString(b)
+
+	t = &models.TokenV2{
+		Name:      name,
+		TokenHash: utils.EncryptSha256(tokenStr),
+		Prefix:    tokenStr[:len(constants.ApiTokenPrefix)+6],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	t.SetCreated(u.Id)
+	t.SetUpdated(u.Id)
+	id, err := service.NewModelServiceV2[models.TokenV2]().InsertOne(*t)
+	if err != nil {
+		return nil, err
+	}
+	t.SetId(id)
+	t.Token = tokenStr
+
+	return t, nil
+}
+
+// CheckApiToken validates an API token and returns the token and its user
+func (svc *ServiceV2) CheckApiToken(tokenStr string) (u *models.UserV2, t *models.TokenV2, err error) {
+	modelSvc := service.NewModelServiceV2[models.TokenV2]()
+	t, err = modelSvc.GetOne(bson.M{"token_hash": utils.EncryptSha256(tokenStr)}, nil)
+	if err != nil {
+		return nil, nil, errors.ErrorUserInvalidToken
+	}
+	if t.Revoked {
+		return nil, nil, errors.ErrorUserTokenRevoked
+	}
+	if !t.ExpiresAt.IsZero() && time.Now().After(t.ExpiresAt) {
+		return nil, nil, errors.ErrorUserTokenExpired
+	}
+
+	u, err = svc.modelSvc.GetById(t.CreatedBy)
+	if err != nil {
+		return nil, nil, errors.ErrorUserNotExists
+	}
+
+	// last used
+	if time.Since(t.LastUsedAt) > tokenLastUsedInterval {
+		t.LastUsedAt = time.Now()
+		if err := modelSvc.UpdateById(t.Id, bson.M{"$set": bson.M{"last_used_at": t.LastUsedAt}}); err != nil {
+			trace.PrintError(err)
+		}
+	}
+
+	return u, t, nil
+}
+
+// RevokeToken revokes an API token so that it can no longer be used
+func (svc *ServiceV2) RevokeToken(id primitive.ObjectID, by primitive.ObjectID) (err error) {
+	return service.NewModelServiceV2[models.TokenV2]().UpdateById(id, bson.M{"$set": bson.M{
+		"revoked":    true,
+		"revoked_at": time.Now(),
+		"updated_by": by,
+		"updated_ts": time.Now(),
+	}})
+}
+
+// ValidateTokenScopes returns error if any of the scopes is invalid
+func ValidateTokenScopes(scopes []string) (err error) {
+	if len(scopes) == 0 {
+		return errors.ErrorUserTokenInvalidScope
+	}
+	for _, scope := range scopes {
+		if scope == constants.PermissionAll {
+			continue
+		}
+		parts := strings.Split(scope, ":")
+		if len(parts) != 2 || parts[0] == "" {
+			return errors.ErrorUserTokenInvalidScope
+		}
+		switch parts[1] {
+		case constants.TokenScopeRead, constants.TokenScopeWrite, constants.TokenScopeRun, constants.PermissionAll:
+		default:
+			return errors.ErrorUserTokenInvalidScope
+		}
+	}
+	return nil
+}
+
+// MatchTokenScopes returns true if any of the scopes grants action (one of
+// constants.PermissionAction*) on resource
+func MatchTokenScopes(scopes []string, resource, action string) bool {
+	scopeAction := constants.TokenScopeWrite
+	switch action {
+	case constants.PermissionActionView:
+		scopeAction = constants.TokenScopeRead
+	case constants.PermissionActionRun:
+		scopeAction = constants.TokenScopeRun
+	}
+	for _, scope := range scopes {
+		if scope == constants.PermissionAll {
+			return true
+		}
+		parts := strings.Split(scope, ":")
+		if len(parts) != 2 {
+			continue
+		}
+		if parts[0] != resource && parts[0] != constants.PermissionAll {
+			continue
+		}
+		if parts[1] == scopeAction || parts[1] == constants.PermissionAll {
+			return true
+		}
+	}
+	return false
+}
+
+// CoverTokenScopes returns true if every scope requested is covered by any
+// of the scopes, so that a token cannot create tokens with more access
+func CoverTokenScopes(scopes []string, requested []string) bool {
+	split := func(scope string) (resource, action string) {
+		if scope == constants.PermissionAll {
+			return constants.PermissionAll, constants.PermissionAll
+		}
+		parts := strings.SplitN(scope, ":", 2)
+		if len(parts) != 2 {
+			return "", ""
+		}
+		return parts[0], parts[1]
+	}
+	for _, r := range requested {
+		resource, action := split(r)
+		if resource == "" {
+			return false
+		}
+		covered := false
+		for _, scope := range scopes {
+			res, act := split(scope)
+			if (res == constants.PermissionAll || res == resource) &&
+				(act == constants.PermissionAll || act == action) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
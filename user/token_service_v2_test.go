@@ -0,0 +1,45 @@
+package user
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestValidateTokenScopes(t *testing.T) {
+	require.Nil(t, ValidateTokenScopes([]string{"tasks:run", "results:read"}))
+	require.Nil(t, ValidateTokenScopes([]string{"*"}))
+	require.Nil(t, ValidateTokenScopes([]string{"*:read", "spiders:*"}))
+	require.NotNil(t, ValidateTokenScopes(nil))
+	require.NotNil(t, ValidateTokenScopes([]string{"tasks"}))
+	require.NotNil(t, ValidateTokenScopes([]string{"tasks:execute"}))
+	require.NotNil(t, ValidateTokenScopes([]string{":read"}))
+}
+
+func TestMatchTokenScopes(t *testing.T) {
+	scopes := []string{"tasks:run", "results:read"}
+	require.True(t, MatchTokenScopes(scopes, "tasks", constants.PermissionActionRun))
+	require.False(t, MatchTokenScopes(scopes, "tasks", constants.PermissionActionView))
+	require.True(t, MatchTokenScopes(scopes, "results", constants.PermissionActionView))
+	require.False(t, MatchTokenScopes(scopes, "results", constants.PermissionActionDelete))
+	require.False(t, MatchTokenScopes(scopes, "spiders", constants.PermissionActionView))
+	require.False(t, MatchTokenScopes(scopes, "", ""))
+
+	require.True(t, MatchTokenScopes([]string{"*:read"}, "spiders", constants.PermissionActionView))
+	require.True(t, MatchTokenScopes([]string{"spiders:*"}, "spiders", constants.PermissionActionEdit))
+	require.True(t, MatchTokenScopes([]string{"spiders:write"}, "spiders", constants.PermissionActionCreate))
+	require.True(t, MatchTokenScopes([]string{"*"}, "", ""))
+}
+
+func TestCoverTokenScopes(t *testing.T) {
+	require.True(t, CoverTokenScopes([]string{"*"}, []string{"*"}))
+	require.True(t, CoverTokenScopes([]string{"tokens:write", "tasks:*"}, []string{"tasks:run", "tokens:write"}))
+	require.True(t, CoverTokenScopes([]string{"*:read"}, []string{"spiders:read", "*:read"}))
+
+	// narrow tokens cannot create tokens with more access
+	require.False(t, CoverTokenScopes([]string{"tokens:write"}, []string{"*"}))
+	require.False(t, CoverTokenScopes([]string{"*:write"}, []string{"*"}))
+	require.False(t, CoverTokenScopes([]string{"*:write"}, []string{"tasks:run"}))
+	require.False(t, CoverTokenScopes([]string{"tasks:*"}, []string{"*:run"}))
+	require.False(t, CoverTokenScopes([]string{"tokens:write"}, []string{"tokens:write", "spiders:read"}))
+}
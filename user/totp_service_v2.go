@@ -0,0 +1,433 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	errors2 "errors"
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/crawlab-core/models/models"
+	"github.com/crawlab-team/crawlab-core/models/service"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/crawlab-team/go-trace"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Two-factor authentication with TOTP (RFC 6238, SHA1, 6 digits, 30s). Once
+// enabled for a user, Login returns a short-lived challenge token instead of
+// a token, which is exchanged with LoginTotp for a token with a code from
+// the authenticator app or a recovery code. 2FA is mandatory for users of
+// roles (RoleV2) with require_totp, where a role with the key "admin" or
+// "normal" applies to all users of that builtin role.
+
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1
+	totpChallengeTtl  = 5 * time.Minute
+	totpSecretLength  = 20
+	totpRecoveryBytes = 5
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// SetupTotp generates a TOTP secret and recovery codes for a user, which
+// take effect once confirmed with EnableTotp
+func (svc *ServiceV2) SetupTotp(u *models.UserV2) (setup *entity.TotpSetup, err error) {
+	t, err := svc.getUserTotp(u.Id)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil && t.Enabled {
+		return nil, errors.ErrorUserTotpAlreadyEnabled
+	}
+
+	// secret
+	b := make([]byte, totpSecretLength)
+	if _, err := rand.Read(b); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	secret := totpEncoding.EncodeToString(b)
+	encryptedSecret, err := utils.EncryptAES(secret)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// recovery codes
+	recoveryCodes, recoveryCodeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	modelSvc := service.NewModelServiceV2[models.UserTotpV2]()
+	if t != nil {
+		if err := modelSvc.DeleteById(t.Id); err != nil {
+			return nil, trace.TraceError(err)
+		}
+	}
+	t = &models.UserTotpV2{
+		UserId:        u.Id,
+		Secret:        encryptedSecret,
+		RecoveryCodes: recoveryCodeHashes,
+	}
+	t.SetCreated(u.Id)
+	t.SetUpdated(u.Id)
+	if _, err := modelSvc.InsertOne(*t); err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	issuer := viper.GetString("totp.issuer")
+	if issuer == "" {
+		issuer = constants.TotpDefaultIssuer
+	}
+	return &entity.TotpSetup{
+		Secret:        secret,
+		Uri:           GetTotpUri(issuer, u.Username, secret),
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// EnableTotp enables 2FA of a user set up with SetupTotp, with a code from
+// the authenticator app
+func (svc *ServiceV2) EnableTotp(u *models.UserV2, code string) (err error) {
+	t, err := svc.getUserTotp(u.Id)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return errors.ErrorUserTotpNotEnabled
+	}
+	if t.Enabled {
+		return errors.ErrorUserTotpAlreadyEnabled
+	}
+	if err := svc.verifyTotp(t, code, false); err != nil {
+		return err
+	}
+	return service.NewModelServiceV2[models.UserTotpV2]().UpdateById(t.Id, bson.M{"$set": bson.M{
+		"enabled":    true,
+		"updated_by": u.Id,
+		"updated_ts": time.Now(),
+	}})
+}
+
+// DisableTotp disables 2FA of a user with a code, unless it is mandatory
+func (svc *ServiceV2) DisableTotp(u *models.UserV2, code string) (err error) {
+	t, err := svc.getEnabledUserTotp(u.Id)
+	if err != nil {
+		return err
+	}
+	required, err := svc.IsTotpRequired(u)
+	if err != nil {
+		return err
+	}
+	if required {
+		return errors.ErrorUserTotpMandatory
+	}
+	if err := svc.verifyTotp(t, code, true); err != nil {
+		return err
+	}
+	return service.NewModelServiceV2[models.UserTotpV2]().DeleteById(t.Id)
+}
+
+// ResetTotp removes 2FA of a user, e.g. when the device is lost, so that it
+// can be set up again
+func (svc *ServiceV2) ResetTotp(userId primitive.ObjectID) (err error) {
+	return service.NewModelServiceV2[models.UserTotpV2]().DeleteMany(bson.M{"user_id": userId})
+}
+
+// RegenerateTotpRecoveryCodes replaces recovery codes of a user with new
+// ones, with a code from the authenticator app
+func (svc *ServiceV2) RegenerateTotpRecoveryCodes(u *models.UserV2, code string) (recoveryCodes []string, err error) {
+	t, err := svc.getEnabledUserTotp(u.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.verifyTotp(t, code, false); err != nil {
+		return nil, err
+	}
+	recoveryCodes, recoveryCodeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := service.NewModelServiceV2[models.UserTotpV2]().UpdateById(t.Id, bson.M{"$set": bson.M{
+		"recovery_codes": recoveryCodeHashes,
+		"updated_by":     u.Id,
+		"updated_ts":     time.Now(),
+	}}); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return recoveryCodes, nil
+}
+
+// IsTotpEnabled returns true if 2FA of a user is enabled
+func (svc *ServiceV2) IsTotpEnabled(userId primitive.ObjectID) (ok bool, err error) {
+	t, err := svc.getUserTotp(userId)
+	if err != nil {
+		return false, err
+	}
+	return t != nil && t.Enabled, nil
+}
+
+// IsTotpRequired returns true if 2FA is mandatory for any role of a user
+func (svc *ServiceV2) IsTotpRequired(u *models.UserV2) (ok bool, err error) {
+	userRoles, err := service.NewModelServiceV2[models.UserRoleV2]().GetMany(bson.M{"user_id": u.Id}, nil)
+	if err != nil && !errors2.Is(err, mongo.ErrNoDocuments) {
+		return false, trace.TraceError(err)
+	}
+	roleIds := []primitive.ObjectID{}
+	for _, ur := range userRoles {
+		roleIds = append(roleIds, ur.RoleId)
+	}
+	count, err := service.NewModelServiceV2[models.RoleV2]().Count(bson.M{
+		"require_totp": true,
+		"$or": []bson.M{
+			{"key": u.Role},
+			{"_id": bson.M{"$in": roleIds}},
+		},
+	})
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	return count > 0, nil
+}
+
+// LoginTotpSetup sets up 2FA of a user of a challenge token during login,
+// if it is mandatory for the user but not set up yet
+func (svc *ServiceV2) LoginTotpSetup(challenge string) (setup *entity.TotpSetup, err error) {
+	u, err := svc.checkChallengeToken(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.checkTotp(u); !errors2.Is(err, errors.ErrorUserTotpSetupRequired) {
+		return nil, errors.ErrorUserInvalidToken
+	}
+	return svc.SetupTotp(u)
+}
+
+// LoginTotp completes login of a challenge token with a code from the
+// authenticator app or a recovery code. 2FA set up during login is enabled
+// once the code is verified. Invalid codes count as failed login attempts.
+func (svc *ServiceV2) LoginTotp(challenge, code string, client *entity.LoginClient) (res *entity.LoginResult, u *models.UserV2, err error) {
+	u, err = svc.checkChallengeToken(challenge)
+	if err != nil {
+		return nil, nil, err
+	}
+	username := u.Username
+	if err := svc.checkLoginLocked(username, client.Ip); err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if errors2.Is(err, errors.ErrorUserTotpInvalidCode) {
+			svc.recordLoginFailure(username, client.Ip)
+		}
+	}()
+	t, err := svc.getUserTotp(u.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t == nil {
+		return nil, nil, errors.ErrorUserTotpNotEnabled
+	}
+	if t.Enabled {
+		if err := svc.verifyTotp(t, code, true); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		if err := svc.EnableTotp(u, code); err != nil {
+			return nil, nil, err
+		}
+	}
+	res, err = svc.CreateSession(u, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, u, nil
+}
+
+// checkTotp returns errors.ErrorUserTotpRequired if 2FA of a user is
+// enabled, or errors.ErrorUserTotpSetupRequired if it is mandatory but not
+// enabled yet
+func (svc *ServiceV2) checkTotp(u *models.UserV2) (err error) {
+	enabled, err := svc.IsTotpEnabled(u.Id)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return errors.ErrorUserTotpRequired
+	}
+	required, err := svc.IsTotpRequired(u)
+	if err != nil {
+		return err
+	}
+	if required {
+		return errors.ErrorUserTotpSetupRequired
+	}
+	return nil
+}
+
+// verifyTotp verifies a code from the authenticator app, or a recovery
+// code if allowRecoveryCode, which can be used only once
+func (svc *ServiceV2) verifyTotp(t *models.UserTotpV2, code string, allowRecoveryCode bool) (err error) {
+	modelSvc := service.NewModelServiceV2[models.UserTotpV2]()
+
+	secret, err := utils.DecryptAES(t.Secret)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if step, ok := ValidateTotpCode(secret, code, time.Now(), t.LastStep); ok {
+		return modelSvc.UpdateById(t.Id, bson.M{"$set": bson.M{"last_step": step}})
+	}
+
+	if allowRecoveryCode {
+		hash := utils.EncryptSha256(normalizeRecoveryCode(code))
+		if utils.Contains(t.RecoveryCodes, hash) {
+			return modelSvc.UpdateById(t.Id, bson.M{"$pull": bson.M{"recovery_codes": hash}})
+		}
+	}
+
+	return errors.ErrorUserTotpInvalidCode
+}
+
+func (svc *ServiceV2) getUserTotp(userId primitive.ObjectID) (t *models.UserTotpV2, err error) {
+	t, err = service.NewModelServiceV2[models.UserTotpV2]().GetOne(bson.M{"user_id": userId}, nil)
+	if err != nil {
+		if errors2.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, trace.TraceError(err)
+	}
+	return t, nil
+}
+
+func (svc *ServiceV2) getEnabledUserTotp(userId primitive.ObjectID) (t *models.UserTotpV2, err error) {
+	t, err = svc.getUserTotp(userId)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || !t.Enabled {
+		return nil, errors.ErrorUserTotpNotEnabled
+	}
+	return t, nil
+}
+
+// makeChallengeToken returns a short-lived token of the second login step,
+// which cannot be used as a normal token
+func (svc *ServiceV2) makeChallengeToken(u *models.UserV2) (tokenStr string, err error) {
+	token := jwt.NewWithClaims(svc.jwtSigningMethod, jwt.MapClaims{
+		"id":       u.Id,
+		"username": u.Username,
+		"purpose":  constants.TotpChallengePurpose,
+		"exp":      time.Now().Add(totpChallengeTtl).Unix(),
+	})
+	return token.SignedString([]byte(svc.jwtSecret))
+}
+
+func (svc *ServiceV2) checkChallengeToken(tokenStr string) (u *models.UserV2, err error) {
+	token, err := jwt.Parse(tokenStr, svc.getSecretFunc(), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, errors.ErrorUserInvalidToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != constants.TotpChallengePurpose {
+		return nil, errors.ErrorUserInvalidToken
+	}
+	idStr, _ := claims["id"].(string)
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		return nil, errors.ErrorUserInvalidToken
+	}
+	u, err = svc.modelSvc.GetById(id)
+	if err != nil {
+		return nil, errors.ErrorUserNotExists
+	}
+	if claims["username"] != u.Username {
+		return nil, errors.ErrorUserMismatch
+	}
+	return u, nil
+}
+
+// GetTotpCode returns the TOTP code of a base32 secret at a time step
+func GetTotpCode(secret string, step int64) (code string, err error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	h := hmac.New(sha1.New, key)
+	h.Write(msg)
+	sum := h.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// ValidateTotpCode returns the time step of a code if it is valid at t
+// within the allowed skew, and later than lastStep so that a code cannot be
+// reused
+func ValidateTotpCode(secret, code string, t time.Time, lastStep int64) (step int64, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := t.Unix() / totpPeriod
+	for s := current - totpSkew; s <= current+totpSkew; s++ {
+		if s <= lastStep {
+			continue
+		}
+		expected, err := GetTotpCode(secret, s)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// GetTotpUri returns the provisioning uri of a secret for authenticator
+// apps, usually rendered as QR code
+func GetTotpUri(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", totpDigits))
+	params.Set("period", fmt.Sprintf("%d", totpPeriod))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// generateRecoveryCodes returns recovery codes in the format of
+// "xxxxx-xxxxx" and their sha256 hashes
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < constants.TotpRecoveryCodeCount; i++ {
+		b := make([]byte, totpRecoveryBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, trace.TraceError(err)
+		}
+		s := hex.EncodeToString(b)
+		code := s[:5] + "-" + s[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, utils.EncryptSha256(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,72 @@
+package user
+
+import (
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// secret "12345678901234567890" of RFC 6238 test vectors
+const testTotpSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGetTotpCode(t *testing.T) {
+	code, err := GetTotpCode(testTotpSecret, 59/totpPeriod)
+	require.Nil(t, err)
+	require.Equal(t, "287082", code)
+
+	code, err = GetTotpCode(testTotpSecret, 1111111109/totpPeriod)
+	require.Nil(t, err)
+	require.Equal(t, "081804", code)
+
+	_, err = GetTotpCode("not base32!", 1)
+	require.NotNil(t, err)
+}
+
+func TestValidateTotpCode(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	current := now.Unix() / totpPeriod
+	code, err := GetTotpCode(testTotpSecret, current)
+	require.Nil(t, err)
+
+	step, ok := ValidateTotpCode(testTotpSecret, code, now, 0)
+	require.True(t, ok)
+	require.Equal(t, current, step)
+
+	// previous step within skew
+	step, ok = ValidateTotpCode(testTotpSecret, code, now.Add(totpPeriod*time.Second), 0)
+	require.True(t, ok)
+	require.Equal(t, current, step)
+
+	// out of skew
+	_, ok = ValidateTotpCode(testTotpSecret, code, now.Add(3*totpPeriod*time.Second), 0)
+	require.False(t, ok)
+
+	// reused
+	_, ok = ValidateTotpCode(testTotpSecret, code, now, current)
+	require.False(t, ok)
+
+	// invalid
+	_, ok = ValidateTotpCode(testTotpSecret, "12345", now, 0)
+	require.False(t, ok)
+}
+
+func TestGetTotpUri(t *testing.T) {
+	u, err := url.Parse(GetTotpUri("Crawlab", "alice", testTotpSecret))
+	require.Nil(t, err)
+	require.Equal(t, "otpauth", u.Scheme)
+	require.Equal(t, "totp", u.Host)
+	require.Equal(t, "/Crawlab:alice", u.Path)
+	require.Equal(t, testTotpSecret, u.Query().Get("secret"))
+	require.Equal(t, "Crawlab", u.Query().Get("issuer"))
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	require.Nil(t, err)
+	require.Len(t, codes, 10)
+	require.Len(t, hashes, 10)
+	require.Len(t, codes[0], 11)
+	require.Equal(t, hashes[0], utils.EncryptSha256(normalizeRecoveryCode(" "+codes[0]+" ")))
+}
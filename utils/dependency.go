@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/go-trace"
+	"github.com/spf13/viper"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// dependencyManifestFiles are manifest files with their lock files (if any)
+// detected in spider workspace, ordered by language
+var dependencyManifestFiles = []struct {
+	lang      string
+	manifest  string
+	lockFiles []string
+}{
+	{constants.DependencyLangPython, constants.DependencyManifestPython, nil},
+	{constants.DependencyLangNode, constants.DependencyManifestNode, []string{"package-lock.json", "yarn.lock"}},
+	{constants.DependencyLangGo, constants.DependencyManifestGo, []string{"go.sum"}},
+}
+
+// GetDependencyManifests detects dependency manifests in the root of given
+// directory, and hashes each of them together with its lock files.
+func GetDependencyManifests(dir string) (manifests []entity.DependencyManifest, err error) {
+	for _, f := range dependencyManifestFiles {
+		manifestPath := filepath.Join(dir, f.manifest)
+		if !Exists(manifestPath) || IsDir(manifestPath) {
+			continue
+		}
+		filePaths := []string{manifestPath}
+		for _, lockFile := range f.lockFiles {
+			lockPath := filepath.Join(dir, lockFile)
+			if Exists(lockPath) && !IsDir(lockPath) {
+				filePaths = append(filePaths, lockPath)
+			}
+		}
+		hash, err := getDependencyManifestHash(filePaths)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, entity.DependencyManifest{
+			Lang:      f.lang,
+			FileName:  f.manifest,
+			FilePaths: filePaths,
+			Hash:      hash,
+		})
+	}
+	return manifests, nil
+}
+
+// GetDependencyEnvRootPath returns the directory where cached dependency
+// environments of all spiders are stored.
+func GetDependencyEnvRootPath() (path string) {
+	if path = viper.GetString("dependency.envPath"); path != "" {
+		return path
+	}
+	return filepath.Join(viper.GetString("workspace"), constants.DependencyEnvDirName)
+}
+
+// GetDependencyEnvPath returns the directory of the cached dependency
+// environment of a spider, which changes with the manifest hash.
+func GetDependencyEnvPath(spiderId string, m entity.DependencyManifest) (path string) {
+	return filepath.Join(GetDependencyEnvRootPath(), spiderId, m.Lang+"-"+m.Hash)
+}
+
+func getDependencyManifestHash(filePaths []string) (hash string, err error) {
+	h := sha256.New()
+	for _, filePath := range filePaths {
+		f, err := os.Open(filePath)
+		if err != nil {
+			return "", trace.TraceError(err)
+		}
+		_, _ = io.WriteString(h, filepath.Base(filePath))
+		if _, err := io.Copy(h, f); err != nil {
+			_ = f.Close()
+			return "", trace.TraceError(err)
+		}
+		_ = f.Close()
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
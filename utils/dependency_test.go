@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetDependencyManifests(t *testing.T) {
+	dir := t.TempDir()
+	manifests, err := GetDependencyManifests(dir)
+	require.Nil(t, err)
+	require.Len(t, manifests, 0)
+
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "requirements.txt"), []byte("requests\n"), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "package.json"), []byte("{}"), 0644))
+	manifests, err = GetDependencyManifests(dir)
+	require.Nil(t, err)
+	require.Len(t, manifests, 2)
+	require.Equal(t, constants.DependencyLangPython, manifests[0].Lang)
+	require.Equal(t, constants.DependencyLangNode, manifests[1].Lang)
+	hash := manifests[1].Hash
+
+	// lock file changes hash
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "package-lock.json"), []byte("{}"), 0644))
+	manifests, err = GetDependencyManifests(dir)
+	require.Nil(t, err)
+	require.Len(t, manifests[1].FilePaths, 2)
+	require.NotEqual(t, hash, manifests[1].Hash)
+}
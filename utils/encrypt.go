@@ -9,6 +9,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/crawlab-team/crawlab-core/constants"
 	"io"
@@ -37,6 +38,11 @@ func EncryptMd5(str string) string {
 	return md5str
 }
 
+func EncryptSha256(str string) string {
+	h := sha256.Sum256([]byte(str))
+	return hex.EncodeToString(h[:])
+}
+
 func padding(src []byte, blockSize int) []byte {
 	padNum := blockSize - len(src)%blockSize
 	pad := bytes.Repeat([]byte{byte(padNum)}, padNum)
@@ -50,31 +56,49 @@ func unPadding(src []byte) []byte {
 }
 
 func EncryptAES(src string) (res string, err error) {
+	return EncryptAESWithKey(src, GetSecretKey())
+}
+
+func DecryptAES(src string) (res string, err error) {
+	return DecryptAESWithKey(src, GetSecretKey())
+}
+
+// EncryptAESWithKey encrypts src with AES-CBC and a key of 16, 24 or 32
+// bytes, and returns hex-encoded cipher text
+func EncryptAESWithKey(src string, key string) (res string, err error) {
 	srcBytes := []byte(src)
-	key := GetSecretKeyBytes()
-	block, err := aes.NewCipher(key)
+	keyBytes := []byte(key)
+	block, err := aes.NewCipher(keyBytes)
 	if err != nil {
 		return res, err
 	}
 	srcBytes = padding(srcBytes, block.BlockSize())
-	blockMode := cipher.NewCBCEncrypter(block, key)
+	blockMode := cipher.NewCBCEncrypter(block, keyBytes[:block.BlockSize()])
 	blockMode.CryptBlocks(srcBytes, srcBytes)
 	res = hex.EncodeToString(srcBytes)
 	return res, nil
 }
 
-func DecryptAES(src string) (res string, err error) {
+// DecryptAESWithKey decrypts hex-encoded cipher text encrypted by
+// EncryptAESWithKey with the same key
+func DecryptAESWithKey(src string, key string) (res string, err error) {
 	srcBytes, err := hex.DecodeString(src)
 	if err != nil {
 		return res, err
 	}
-	key := GetSecretKeyBytes()
-	block, err := aes.NewCipher(key)
+	keyBytes := []byte(key)
+	block, err := aes.NewCipher(keyBytes)
 	if err != nil {
 		return res, err
 	}
-	blockMode := cipher.NewCBCDecrypter(block, key)
+	if len(srcBytes) == 0 || len(srcBytes)%block.BlockSize() != 0 {
+		return res, errors.New("invalid cipher text")
+	}
+	blockMode := cipher.NewCBCDecrypter(block, keyBytes[:block.BlockSize()])
 	blockMode.CryptBlocks(srcBytes, srcBytes)
+	if n := int(srcBytes[len(srcBytes)-1]); n == 0 || n > block.BlockSize() {
+		return res, errors.New("invalid padding")
+	}
 	res = string(unPadding(srcBytes))
 	return res, nil
 }
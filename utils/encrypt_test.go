@@ -18,3 +18,17 @@ func TestEncryptAesPassword(t *testing.T) {
 	require.Equal(t, decryptedText, plainText)
 	require.NotEqual(t, decryptedText, encryptedText)
 }
+
+func TestEncryptAESWithKey(t *testing.T) {
+	for _, key := range []string{"0123456789abcdef", "0123456789abcdef01234567", "0123456789abcdef0123456789abcdef"} {
+		encryptedText, err := EncryptAESWithKey("crawlab", key)
+		require.Nil(t, err)
+		decryptedText, err := DecryptAESWithKey(encryptedText, key)
+		require.Nil(t, err)
+		require.Equal(t, "crawlab", decryptedText)
+	}
+	_, err := EncryptAESWithKey("crawlab", "short")
+	require.NotNil(t, err)
+	_, err = DecryptAESWithKey("0102", "0123456789abcdef")
+	require.NotNil(t, err)
+}
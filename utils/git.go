@@ -2,9 +2,21 @@ package utils
 
 import (
 	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
 	"github.com/crawlab-team/crawlab-core/interfaces"
 	"github.com/crawlab-team/crawlab-core/models/models"
 	vcs "github.com/crawlab-team/crawlab-vcs"
+	"github.com/crawlab-team/go-trace"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	diff2 "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+	"sort"
+	"strings"
 )
 
 func InitGitClientAuth(g interfaces.Git, gitClient *vcs.GitClient) {
@@ -21,16 +33,318 @@ func InitGitClientAuth(g interfaces.Git, gitClient *vcs.GitClient) {
 	}
 }
 
-func InitGitClientAuthV2(g *models.GitV2, gitClient *vcs.GitClient) {
-	// set auth
-	switch g.AuthType {
+// GitClientV2 is a git client whose remote operations use the auth set by
+// InitGitClientAuthV2 in place of the one built by vcs, if any.
+type GitClientV2 struct {
+	*vcs.GitClient
+	auth transport.AuthMethod
+}
+
+func (c *GitClientV2) Pull(opts ...vcs.GitPullOption) (err error) {
+	if c.auth != nil {
+		opts = append(opts, vcs.WithAuthPull(c.auth))
+	}
+	return c.GitClient.Pull(opts...)
+}
+
+func (c *GitClientV2) Push(opts ...vcs.GitPushOption) (err error) {
+	if c.auth != nil {
+		opts = append(opts, vcs.WithAuthPush(c.auth))
+	}
+	return c.GitClient.Push(opts...)
+}
+
+func (c *GitClientV2) GetRemoteRefs(remoteName string) (gitRefs []vcs.GitRef, err error) {
+	if c.auth == nil {
+		return c.GitClient.GetRemoteRefs(remoteName)
+	}
+
+	// remote
+	r, err := c.GetRemote(remoteName)
+	if err != nil {
+		if err == git.ErrRemoteNotFound {
+			return nil, nil
+		}
+		return nil, trace.TraceError(err)
+	}
+
+	// refs
+	refs, err := r.List(&git.ListOptions{Auth: c.auth})
+	if err != nil {
+		if err != transport.ErrEmptyRemoteRepository {
+			return nil, trace.TraceError(err)
+		}
+		return nil, nil
+	}
+	for _, ref := range refs {
+		var refType string
+		if ref.Name().IsBranch() {
+			refType = vcs.GitRefTypeBranch
+		} else if ref.Name().IsTag() {
+			refType = vcs.GitRefTypeTag
+		} else {
+			continue
+		}
+		gitRefs = append(gitRefs, vcs.GitRef{
+			Type:     refType,
+			Name:     ref.Name().Short(),
+			FullName: ref.Name().String(),
+			Hash:     ref.Hash().String(),
+		})
+	}
+
+	// timestamps from logs
+	logs, err := c.GetLogs()
+	if err != nil {
+		return nil, err
+	}
+	logsMap := map[string]vcs.GitLog{}
+	for _, l := range logs {
+		logsMap[l.Hash] = l
+	}
+	for i, gitRef := range gitRefs {
+		if l, ok := logsMap[gitRef.Hash]; ok {
+			gitRefs[i].Timestamp = l.Timestamp
+		}
+	}
+	sort.Slice(gitRefs, func(i, j int) bool {
+		return gitRefs[i].Timestamp.Unix() > gitRefs[j].Timestamp.Unix()
+	})
+
+	return gitRefs, nil
+}
+
+func (c *GitClientV2) CheckoutBranch(branch string, opts ...vcs.GitCheckoutOption) (err error) {
+	if c.auth == nil {
+		return c.GitClient.CheckoutBranch(branch, opts...)
+	}
+
+	// new branches start from the remote ref, which vcs would look up
+	// without auth
+	var ref *plumbing.Reference
+	if _, err := c.GetRepository().Branch(branch); err == git.ErrBranchNotFound {
+		refs, err := c.GetRemoteRefs(vcs.GitRemoteNameOrigin)
+		if err != nil {
+			return err
+		}
+		for _, r := range refs {
+			if r.Type == vcs.GitRefTypeBranch && r.Name == branch {
+				ref = plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), plumbing.NewHash(r.Hash))
+				break
+			}
+		}
+		if ref == nil {
+			ref, err = c.GetRepository().Head()
+			if err != nil {
+				return trace.TraceError(err)
+			}
+		}
+	}
+	return c.CheckoutBranchWithRemote(branch, "", ref, opts...)
+}
+
+func (c *GitClientV2) IsRemoteChanged() (ok bool, err error) {
+	if c.auth == nil {
+		return c.GitClient.IsRemoteChanged()
+	}
+	b, err := c.GetCurrentBranchRef()
+	if err != nil {
+		return false, err
+	}
+	refs, err := c.GetRemoteRefs(vcs.GitRemoteNameOrigin)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range refs {
+		if r.Name == b.Name {
+			return r.Hash != b.Hash, nil
+		}
+	}
+	return false, nil
+}
+
+func NewGitClientV2(opts ...vcs.GitOption) (c *GitClientV2, err error) {
+	gitClient, err := vcs.NewGitClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GitClientV2{GitClient: gitClient}, nil
+}
+
+// InitGitClientAuthV2 sets auth of git client from the credential referenced
+// by git. Secrets of the credential are decrypted here, and pinned host keys
+// are verified in remote operations for ssh credentials. Git records
+// that have not been migrated to credentials fall back to legacy fields.
+func InitGitClientAuthV2(g *models.GitV2, cred *models.GitCredentialV2, gitClient *GitClientV2) (err error) {
+	// legacy
+	if cred == nil {
+		switch g.AuthType {
+		case constants.GitAuthTypeHttp:
+			gitClient.SetAuthType(vcs.GitAuthTypeHTTP)
+			gitClient.SetUsername(g.Username)
+			gitClient.SetPassword(g.Password)
+		case constants.GitAuthTypeSsh:
+			gitClient.SetAuthType(vcs.GitAuthTypeSSH)
+			gitClient.SetUsername(g.Username)
+			gitClient.SetPrivateKey(g.Password)
+		}
+		return nil
+	}
+
+	switch cred.Type {
 	case constants.GitAuthTypeHttp:
+		password, err := DecryptAES(cred.Password)
+		if err != nil {
+			return trace.TraceError(err)
+		}
 		gitClient.SetAuthType(vcs.GitAuthTypeHTTP)
-		gitClient.SetUsername(g.Username)
-		gitClient.SetPassword(g.Password)
+		gitClient.SetUsername(cred.Username)
+		gitClient.SetPassword(password)
 	case constants.GitAuthTypeSsh:
+		privateKey, err := DecryptAES(cred.PrivateKey)
+		if err != nil {
+			return trace.TraceError(err)
+		}
+		username := cred.Username
+		if username == "" {
+			username = "git"
+		}
+		if cred.KnownHosts != "" {
+			// vcs ignores host keys, so remote operations are authenticated
+			// by the wrapper with host keys pinned instead
+			signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+			if err != nil {
+				return trace.TraceError(err)
+			}
+			callback, err := GetSshHostKeyCallback(cred.KnownHosts)
+			if err != nil {
+				return err
+			}
+			gitClient.SetAuthType(vcs.GitAuthTypeNone)
+			gitClient.auth = &gitssh.PublicKeys{
+				User:   username,
+				Signer: signer,
+				HostKeyCallbackHelper: gitssh.HostKeyCallbackHelper{
+					HostKeyCallback: callback,
+				},
+			}
+			return nil
+		}
 		gitClient.SetAuthType(vcs.GitAuthTypeSSH)
-		gitClient.SetUsername(g.Username)
-		gitClient.SetPrivateKey(g.Password)
+		gitClient.SetUsername(username)
+		gitClient.SetPrivateKey(privateKey)
+	default:
+		return trace.TraceError(errors.ErrorGitInvalidAuthType)
+	}
+
+	return nil
+}
+
+// ResolveGitRevision resolves a branch, tag (lightweight or annotated),
+// short or full commit hash to a commit hash.
+func ResolveGitRevision(r *git.Repository, rev string) (hash string, err error) {
+	h, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	return h.String(), nil
+}
+
+// GetGitHeadCommit returns the commit hash of HEAD of the repository at
+// given path, or empty string if it is not a git repository.
+func GetGitHeadCommit(path string) (hash string) {
+	r, err := git.PlainOpen(path)
+	if err != nil {
+		return ""
 	}
+	ref, err := r.Head()
+	if err != nil {
+		return ""
+	}
+	return ref.Hash().String()
+}
+
+// GetGitDiff returns changes between two revisions. If to is empty, HEAD
+// is used; if from is empty, the first parent of to is used.
+func GetGitDiff(r *git.Repository, from, to string) (diff *entity.GitDiff, err error) {
+	if to == "" {
+		to = "HEAD"
+	}
+	toHash, err := ResolveGitRevision(r, to)
+	if err != nil {
+		return nil, err
+	}
+	toCommit, err := r.CommitObject(plumbing.NewHash(toHash))
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	toTree, err := toCommit.Tree()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// empty tree if to is the root commit
+	fromTree := &object.Tree{}
+	var fromHash string
+	if from != "" {
+		fromHash, err = ResolveGitRevision(r, from)
+		if err != nil {
+			return nil, err
+		}
+	} else if toCommit.NumParents() > 0 {
+		fromHash = toCommit.ParentHashes[0].String()
+	}
+	if fromHash != "" {
+		fromCommit, err := r.CommitObject(plumbing.NewHash(fromHash))
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		fromTree, err = fromCommit.Tree()
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+	}
+
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	patch, err := changes.Patch()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	diff = &entity.GitDiff{
+		From:  fromHash,
+		To:    toHash,
+		Files: []entity.GitDiffFile{},
+		Patch: patch.String(),
+	}
+	for _, fp := range patch.FilePatches() {
+		f := entity.GitDiffFile{
+			IsBinary: fp.IsBinary(),
+		}
+		fromFile, toFile := fp.Files()
+		if fromFile != nil {
+			f.From = fromFile.Path()
+		}
+		if toFile != nil {
+			f.To = toFile.Path()
+		}
+		for _, chunk := range fp.Chunks() {
+			n := strings.Count(chunk.Content(), "\n")
+			if !strings.HasSuffix(chunk.Content(), "\n") && chunk.Content() != "" {
+				n++
+			}
+			switch chunk.Type() {
+			case diff2.Add:
+				f.Additions += n
+			case diff2.Delete:
+				f.Deletions += n
+			}
+		}
+		diff.Files = append(diff.Files, f)
+	}
+
+	return diff, nil
 }
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	errors2 "errors"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/go-trace"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const gitSshDialTimeout = 10 * time.Second
+
+var errGitSshHostKeyScanned = errors2.New("host key scanned")
+
+// GenerateSshKeyPair generates a ssh key pair of given type, and returns
+// private key in OpenSSH PEM format and public key in authorized_keys format.
+func GenerateSshKeyPair(keyType, comment string) (privateKey, publicKey string, err error) {
+	var key any
+	switch keyType {
+	case constants.GitSshKeyTypeEd25519, "":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case constants.GitSshKeyTypeRsa:
+		key, err = rsa.GenerateKey(rand.Reader, 4096)
+	default:
+		return "", "", errors.ErrorGitInvalidSshKeyType
+	}
+	if err != nil {
+		return "", "", trace.TraceError(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, comment)
+	if err != nil {
+		return "", "", trace.TraceError(err)
+	}
+	privateKey = string(pem.EncodeToMemory(block))
+	publicKey, _, err = GetSshPublicKey(privateKey)
+	if err != nil {
+		return "", "", err
+	}
+	return privateKey, publicKey, nil
+}
+
+// GetSshPublicKey parses a private key and returns its public key in
+// authorized_keys format and SHA256 fingerprint.
+func GetSshPublicKey(privateKey string) (publicKey, fingerprint string, err error) {
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		return "", "", errors.ErrorGitInvalidPrivateKey
+	}
+	publicKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	fingerprint = ssh.FingerprintSHA256(signer.PublicKey())
+	return publicKey, fingerprint, nil
+}
+
+// GetSshAddressFromGitUrl returns "host:port" of a ssh git url, e.g.
+// "git@github.com:org/repo.git" -> "github.com:22". It returns empty
+// string if the url is not a ssh url.
+func GetSshAddressFromGitUrl(url string) (address string) {
+	var hostPort string
+	if strings.HasPrefix(url, "ssh://") {
+		hostPort = strings.TrimPrefix(url, "ssh://")
+		if i := strings.Index(hostPort, "/"); i >= 0 {
+			hostPort = hostPort[:i]
+		}
+		if i := strings.LastIndex(hostPort, "@"); i >= 0 {
+			hostPort = hostPort[i+1:]
+		}
+	} else if !strings.Contains(url, "://") && strings.Contains(url, ":") {
+		// scp-like syntax
+		hostPort = url[:strings.Index(url, ":")]
+		if i := strings.LastIndex(hostPort, "@"); i >= 0 {
+			hostPort = hostPort[i+1:]
+		}
+		return net.JoinHostPort(hostPort, "22")
+	} else {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		return net.JoinHostPort(hostPort, "22")
+	}
+	return hostPort
+}
+
+// ScanSshHostKey connects to a ssh server and returns its host key as a
+// known_hosts line, which can be pinned afterwards.
+func ScanSshHostKey(address string) (line string, err error) {
+	var hostKey ssh.PublicKey
+	cfg := &ssh.ClientConfig{
+		User: "git",
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return errGitSshHostKeyScanned
+		},
+		Timeout: gitSshDialTimeout,
+	}
+	_, err = ssh.Dial("tcp", address, cfg)
+	if hostKey == nil {
+		return "", trace.TraceError(err)
+	}
+	return knownhosts.Line([]string{knownhosts.Normalize(address)}, hostKey), nil
+}
+
+// GetSshHostKeyCallback returns a host key callback which accepts only the
+// host keys pinned in known_hosts lines.
+func GetSshHostKeyCallback(knownHosts string) (callback ssh.HostKeyCallback, err error) {
+	// known_hosts callback reads from files only
+	f, err := os.CreateTemp("", "known_hosts")
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(knownHosts); err != nil {
+		_ = f.Close()
+		return nil, trace.TraceError(err)
+	}
+	_ = f.Close()
+	cb, err := knownhosts.New(f.Name())
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := cb(hostname, remote, key); err != nil {
+			var keyErr *knownhosts.KeyError
+			if errors2.As(err, &keyErr) {
+				return errors.ErrorGitHostKeyMismatch
+			}
+			return err
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestGenerateSshKeyPair(t *testing.T) {
+	privateKey, publicKey, err := GenerateSshKeyPair(constants.GitSshKeyTypeEd25519, "test")
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(publicKey, "ssh-ed25519 "))
+
+	pub, fingerprint, err := GetSshPublicKey(privateKey)
+	require.Nil(t, err)
+	require.Equal(t, publicKey, pub)
+	require.True(t, strings.HasPrefix(fingerprint, "SHA256:"))
+
+	_, _, err = GenerateSshKeyPair("dsa", "test")
+	require.Equal(t, errors.ErrorGitInvalidSshKeyType, err)
+
+	_, _, err = GetSshPublicKey("invalid")
+	require.Equal(t, errors.ErrorGitInvalidPrivateKey, err)
+}
+
+func TestGetSshAddressFromGitUrl(t *testing.T) {
+	require.Equal(t, "github.com:22", GetSshAddressFromGitUrl("git@github.com:org/repo.git"))
+	require.Equal(t, "gitlab.example.com:2222", GetSshAddressFromGitUrl("ssh://git@gitlab.example.com:2222/org/repo.git"))
+	require.Equal(t, "gitlab.example.com:22", GetSshAddressFromGitUrl("ssh://gitlab.example.com/org/repo.git"))
+	require.Equal(t, "", GetSshAddressFromGitUrl("https://github.com/org/repo.git"))
+}
+
+func TestGetSshHostKeyCallback(t *testing.T) {
+	pinned, _, err := GenerateSshKeyPair(constants.GitSshKeyTypeEd25519, "")
+	require.Nil(t, err)
+	other, _, err := GenerateSshKeyPair(constants.GitSshKeyTypeEd25519, "")
+	require.Nil(t, err)
+	pinnedSigner, err := ssh.ParsePrivateKey([]byte(pinned))
+	require.Nil(t, err)
+	otherSigner, err := ssh.ParsePrivateKey([]byte(other))
+	require.Nil(t, err)
+
+	address := "github.com:22"
+	cb, err := GetSshHostKeyCallback(knownhosts.Line([]string{knownhosts.Normalize(address)}, pinnedSigner.PublicKey()))
+	require.Nil(t, err)
+
+	remote := &net.TCPAddr{IP: net.ParseIP("140.82.112.3"), Port: 22}
+	require.Nil(t, cb(address, remote, pinnedSigner.PublicKey()))
+	require.Equal(t, errors.ErrorGitHostKeyMismatch, cb(address, remote, otherSigner.PublicKey()))
+}
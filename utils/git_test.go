@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetGitDiff(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	require.Nil(t, err)
+	wt, err := r.Worktree()
+	require.Nil(t, err)
+
+	commit := func(content string) string {
+		require.Nil(t, os.WriteFile(filepath.Join(dir, "main.py"), []byte(content), 0644))
+		_, err := wt.Add("main.py")
+		require.Nil(t, err)
+		h, err := wt.Commit("update", &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		require.Nil(t, err)
+		return h.String()
+	}
+	first := commit("a\nb\n")
+	second := commit("a\nc\nd\n")
+
+	// default to HEAD and its parent
+	diff, err := GetGitDiff(r, "", "")
+	require.Nil(t, err)
+	require.Equal(t, first, diff.From)
+	require.Equal(t, second, diff.To)
+	require.Len(t, diff.Files, 1)
+	require.Equal(t, "main.py", diff.Files[0].To)
+	require.Equal(t, 2, diff.Files[0].Additions)
+	require.Equal(t, 1, diff.Files[0].Deletions)
+
+	// root commit
+	diff, err = GetGitDiff(r, "", first[:7])
+	require.Nil(t, err)
+	require.Equal(t, "", diff.From)
+	require.Equal(t, "", diff.Files[0].From)
+	require.Equal(t, 2, diff.Files[0].Additions)
+
+	require.Equal(t, second, GetGitHeadCommit(dir))
+	require.Equal(t, "", GetGitHeadCommit(t.TempDir()))
+}
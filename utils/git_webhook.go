@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/entity"
+	"github.com/crawlab-team/crawlab-core/errors"
+	"github.com/crawlab-team/go-trace"
+	"net/http"
+	"strings"
+)
+
+const (
+	gitRefPrefixBranch = "refs/heads/"
+)
+
+// ParseGitWebhookEvent detects the git provider from request headers and
+// extracts repository urls, ref and commit from the push payload.
+func ParseGitWebhookEvent(header http.Header, body []byte) (evt *entity.GitWebhookEvent, err error) {
+	evt = &entity.GitWebhookEvent{Body: body}
+
+	// provider (gitea also sends github headers, so it should be detected first)
+	switch {
+	case header.Get(constants.GitWebhookHeaderGiteaEvent) != "":
+		evt.Provider = constants.GitWebhookProviderGitea
+		evt.Event = header.Get(constants.GitWebhookHeaderGiteaEvent)
+		evt.DeliveryId = header.Get(constants.GitWebhookHeaderGiteaDelivery)
+		evt.Signature = header.Get(constants.GitWebhookHeaderGiteaSignature)
+	case header.Get(constants.GitWebhookHeaderGithubEvent) != "":
+		evt.Provider = constants.GitWebhookProviderGithub
+		evt.Event = header.Get(constants.GitWebhookHeaderGithubEvent)
+		evt.DeliveryId = header.Get(constants.GitWebhookHeaderGithubDelivery)
+		evt.Signature = header.Get(constants.GitWebhookHeaderGithubSignature)
+	case header.Get(constants.GitWebhookHeaderGitlabEvent) != "":
+		evt.Provider = constants.GitWebhookProviderGitlab
+		evt.Event = header.Get(constants.GitWebhookHeaderGitlabEvent)
+		evt.DeliveryId = header.Get(constants.GitWebhookHeaderGitlabDelivery)
+		evt.Signature = header.Get(constants.GitWebhookHeaderGitlabToken)
+	default:
+		evt.Provider = constants.GitWebhookProviderGeneric
+		evt.Event = "push"
+		evt.Signature = header.Get(constants.GitWebhookHeaderGenericSignature)
+	}
+
+	// payload
+	var payload struct {
+		// common
+		Ref         string `json:"ref"`
+		After       string `json:"after"`
+		CheckoutSha string `json:"checkout_sha"`
+
+		// github and gitea
+		Repository struct {
+			HtmlUrl  string `json:"html_url"`
+			CloneUrl string `json:"clone_url"`
+			SshUrl   string `json:"ssh_url"`
+
+			// gitlab
+			Url        string `json:"url"`
+			GitHttpUrl string `json:"git_http_url"`
+			GitSshUrl  string `json:"git_ssh_url"`
+			Homepage   string `json:"homepage"`
+		} `json:"repository"`
+
+		// gitlab
+		Project struct {
+			WebUrl     string `json:"web_url"`
+			GitHttpUrl string `json:"git_http_url"`
+			GitSshUrl  string `json:"git_ssh_url"`
+		} `json:"project"`
+
+		// generic
+		Url    string `json:"url"`
+		Branch string `json:"branch"`
+		Commit string `json:"commit"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, trace.TraceError(errors.ErrorGitWebhookInvalidPayload)
+	}
+
+	// urls
+	for _, u := range []string{
+		payload.Url,
+		payload.Repository.HtmlUrl,
+		payload.Repository.CloneUrl,
+		payload.Repository.SshUrl,
+		payload.Repository.Url,
+		payload.Repository.GitHttpUrl,
+		payload.Repository.GitSshUrl,
+		payload.Repository.Homepage,
+		payload.Project.WebUrl,
+		payload.Project.GitHttpUrl,
+		payload.Project.GitSshUrl,
+	} {
+		if u != "" && !StringArrayContains(evt.Urls, u) {
+			evt.Urls = append(evt.Urls, u)
+		}
+	}
+
+	// ref and branch
+	evt.Ref = payload.Ref
+	if payload.Branch != "" {
+		evt.Branch = payload.Branch
+		if evt.Ref == "" {
+			evt.Ref = gitRefPrefixBranch + payload.Branch
+		}
+	} else if strings.HasPrefix(payload.Ref, gitRefPrefixBranch) {
+		evt.Branch = strings.TrimPrefix(payload.Ref, gitRefPrefixBranch)
+	}
+
+	// commit
+	switch {
+	case payload.Commit != "":
+		evt.Commit = payload.Commit
+	case payload.CheckoutSha != "":
+		evt.Commit = payload.CheckoutSha
+	default:
+		evt.Commit = payload.After
+	}
+
+	return evt, nil
+}
+
+// VerifyGitWebhookSignature verifies the signature (or token for gitlab) of
+// a webhook event against the given secret. Empty secrets never verify.
+func VerifyGitWebhookSignature(evt *entity.GitWebhookEvent, secret string) (ok bool) {
+	if secret == "" || evt.Signature == "" {
+		return false
+	}
+
+	// gitlab sends the secret token as-is
+	if evt.Provider == constants.GitWebhookProviderGitlab {
+		return subtle.ConstantTimeCompare([]byte(evt.Signature), []byte(secret)) == 1
+	}
+
+	// others send hex-encoded hmac sha256 of body, optionally prefixed by "sha256="
+	sig, err := hex.DecodeString(strings.TrimPrefix(evt.Signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(evt.Body)
+	return hmac.Equal(sig, h.Sum(nil))
+}
+
+// IsGitWebhookPushEvent returns whether the event is a push to a branch
+func IsGitWebhookPushEvent(evt *entity.GitWebhookEvent) (ok bool) {
+	switch evt.Provider {
+	case constants.GitWebhookProviderGithub, constants.GitWebhookProviderGitea:
+		if evt.Event != "push" {
+			return false
+		}
+	case constants.GitWebhookProviderGitlab:
+		if evt.Event != "Push Hook" {
+			return false
+		}
+	}
+	return evt.Branch != ""
+}
+
+// NormalizeGitUrl normalizes http(s), ssh and scp-like git urls so that
+// different urls of the same repository can be compared,
+// e.g. "git@github.com:org/repo.git" -> "github.com/org/repo".
+func NormalizeGitUrl(url string) (res string) {
+	res = strings.ToLower(strings.TrimSpace(url))
+
+	// scheme
+	if i := strings.Index(res, "://"); i >= 0 {
+		res = res[i+3:]
+	}
+
+	// credentials
+	if i := strings.Index(res, "@"); i >= 0 && i < strings.Index(res+"/", "/") {
+		res = res[i+1:]
+	}
+
+	// port or scp-like path separator
+	if i := strings.Index(res, ":"); i >= 0 {
+		host, rest := res[:i], res[i+1:]
+		j := strings.Index(rest, "/")
+		if j > 0 && isDigits(rest[:j]) {
+			rest = rest[j+1:]
+		}
+		res = host + "/" + rest
+	}
+
+	// suffix
+	res = strings.TrimSuffix(res, "/")
+	res = strings.TrimSuffix(res, ".git")
+
+	return res
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -27,6 +27,10 @@ func HandleErrorUnauthorized(c *gin.Context, err error) {
 	HandleError(http.StatusUnauthorized, c, err)
 }
 
+func HandleErrorForbidden(c *gin.Context, err error) {
+	HandleError(http.StatusForbidden, c, err)
+}
+
 func HandleErrorInternalServerError(c *gin.Context, err error) {
 	HandleError(http.StatusInternalServerError, c, err)
 }